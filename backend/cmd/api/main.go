@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -25,6 +28,9 @@ import (
 
 const version = "1.0.0"
 
+// migrationTimeout bounds startup schema migrations (RUN_MIGRATIONS=true).
+const migrationTimeout = 2 * time.Minute
+
 func main() {
 	// ----------------------------------------------------------------
 	// 1. Load configuration
@@ -38,13 +44,31 @@ func main() {
 	// ----------------------------------------------------------------
 	// 2. Initialize structured logger
 	// ----------------------------------------------------------------
-	log, err := logger.New(cfg.LogFormat, cfg.LogLevel)
+	log, logLevel, err := logger.NewWithLevel(cfg.LogFormat, cfg.LogLevel, cfg.LogSampling, logger.File{
+		Path:       cfg.LogFile,
+		MaxSizeMB:  cfg.LogFileMaxSizeMB,
+		MaxAgeDays: cfg.LogFileMaxAgeDays,
+		MaxBackups: cfg.LogFileMaxBackups,
+	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "logger: %v\n", err)
 		os.Exit(1)
 	}
 	defer log.Sync()
 
+	// Lenient by default so a container without DATABASE_URL still serves
+	// /health; CONFIG_STRICT=true refuses to boot half-configured.
+	if err := cfg.Validate(); err != nil {
+		if cfg.Strict {
+			log.Fatal("invalid configuration", zap.Error(err))
+		}
+		log.Warn("invalid configuration — continuing (set CONFIG_STRICT=true to fail fast)", zap.Error(err))
+	}
+
+	// stopping is cancelled on SIGINT/SIGTERM; background loops exit on it.
+	stopping, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	log.Info("starting ApexRun API",
 		zap.String("version", version),
 		zap.String("port", cfg.Port),
@@ -59,10 +83,18 @@ func main() {
 		zap.Bool("db_url_empty", cfg.DatabaseURL == ""),
 	)
 	db := database.New(
+		stopping,
 		cfg.DatabaseURL,
 		cfg.DBMaxOpenConns,
 		cfg.DBMaxIdleConns,
 		cfg.DBConnMaxLifetime,
+		database.RetryPolicy{
+			Attempts:          cfg.DBConnectAttempts,
+			Backoff:           cfg.DBConnectBackoff,
+			MaxBackoff:        cfg.DBConnectMaxBackoff,
+			PingTimeout:       cfg.DBPingTimeout,
+			ReconnectInterval: cfg.DBReconnectInterval,
+		},
 		log,
 	)
 	defer db.Close()
@@ -92,16 +124,69 @@ func main() {
 		log.Error("database pool is nil — API endpoints requiring DB will return errors. " +
 			"Set a valid DATABASE_URL environment variable.")
 	}
-	activityRepo := activities.NewRepository(dbPool, log)
-	segmentRepo := segments.NewRepository(dbPool, log)
-	coachingRepo := coaching.NewRepository(dbPool, log)
+	if cfg.RunMigrations && dbPool != nil {
+		migrateCtx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+		err := database.Migrate(migrateCtx, dbPool, cfg.MigrationsDir)
+		cancel()
+		// Serving against a schema the code doesn't expect fails in
+		// confusing ways later, so a failed migration stops startup.
+		if err != nil {
+			log.Fatal("schema migrations failed", zap.Error(err))
+		}
+		log.Info("schema migrations up to date", zap.String("dir", cfg.MigrationsDir))
+	}
+	// Repositories retry reads that hit a dropped pooler connection.
+	var queries database.Querier = dbPool
+	if dbPool != nil {
+		queries = database.NewRetryQuerier(dbPool, log)
+	}
+	activityRepo := activities.NewRepository(queries, log)
+	segmentRepo := segments.NewRepository(queries, log)
+	coachingRepo := coaching.NewRepository(queries, log)
+	apiKeyRepo := auth.NewAPIKeyRepository(queries, log)
+	activityRepo.SetQueryTimeout(cfg.DBQueryTimeout)
+	segmentRepo.SetQueryTimeout(cfg.DBQueryTimeout)
+	coachingRepo.SetQueryTimeout(cfg.DBQueryTimeout)
+	apiKeyRepo.SetQueryTimeout(cfg.DBQueryTimeout)
 
 	// ----------------------------------------------------------------
 	// 6. Build handlers
 	// ----------------------------------------------------------------
-	activityHandler := activities.NewHandler(activityRepo, log)
+	var weatherProvider activities.WeatherProvider
+	if cfg.EnableWeatherEnrichment {
+		if cfg.WeatherProviderURL == "" {
+			log.Warn("ENABLE_WEATHER_ENRICHMENT is set but WEATHER_PROVIDER_URL is empty — weather enrichment disabled")
+		} else {
+			weatherProvider = activities.NewHTTPWeatherProvider(cfg.WeatherProviderURL, 5*time.Second)
+		}
+	}
+
+	var geocoder activities.Geocoder
+	if cfg.EnableReverseGeocoding {
+		if cfg.GeocoderURL == "" {
+			log.Warn("ENABLE_REVERSE_GEOCODING is set but GEOCODER_URL is empty — reverse geocoding disabled")
+		} else {
+			geocoder = activities.NewHTTPGeocoder(cfg.GeocoderURL, 5*time.Second)
+		}
+	}
+
+	segmentMatcher := segments.NewMatcher(segmentRepo, rds, cfg.SegmentMatchBufferMeters, log)
+	segmentMatcher.SetPostGISCheck(db.HasPostGIS)
+	activityHandler := activities.NewHandler(activityRepo, db, rds, weatherProvider, geocoder, segmentMatcher, log)
 	segmentHandler := segments.NewHandler(segmentRepo, rds, cfg.SegmentMatchBufferMeters, log)
-	coachingHandler := coaching.NewHandler(coachingRepo, log)
+	var coachAdvisor coaching.CoachAdvisor
+	if cfg.CoachAPIKey != "" {
+		coachAdvisor = coaching.NewGeminiAdvisor(cfg.CoachAPIURL, cfg.CoachAPIKey, cfg.CoachModel, cfg.RequestTimeout)
+		log.Info("server-side coaching enabled", zap.String("model", cfg.CoachModel))
+	}
+	coachingHandler := coaching.NewHandler(coachingRepo, db, coachAdvisor, log)
+
+	var tokenBlocklist auth.TokenBlocklist
+	if rds != nil {
+		tokenBlocklist = rds
+	}
+	authHandler := auth.NewHandler(tokenBlocklist, cfg.JWTClockSkew, log)
+	apiKeyHandler := auth.NewAPIKeyHandler(apiKeyRepo, log)
 
 	// ----------------------------------------------------------------
 	// 7. Setup Gin router
@@ -110,21 +195,72 @@ func main() {
 	router := gin.New()
 
 	// Global middleware
-	router.Use(gin.Recovery())
+	router.Use(logger.RequestIDMiddleware())
+	router.Use(recoveryMiddleware(log))
 	router.Use(requestLogger(log))
-	router.Use(corsMiddleware(cfg.AllowedOrigins))
-	router.Use(rateLimiter(cfg.RateLimitRPM))
+	router.Use(corsMiddleware(corsOptions{
+		Origins:     cfg.AllowedOrigins,
+		Methods:     cfg.AllowedMethods,
+		Headers:     cfg.AllowedHeaders,
+		Credentials: cfg.AllowCredentials,
+	}))
+	router.Use(securityHeaders(cfg.EnableHSTS))
+	router.Use(timeoutMiddleware(cfg.RequestTimeout))
+
+	// Unauthenticated routes are rate limited per IP; protected routes per
+	// user, so users behind a shared NAT don't exhaust each other's budget.
+	ipRateLimit := rateLimitMiddleware(newRateLimiter(rds, "ip", cfg.RateLimitRPM, log), clientIPKey)
+	userRateLimit := rateLimitMiddleware(newRateLimiter(rds, "user", cfg.UserRateLimitRPM, log), userIDKey)
+
+	// Structured JSON errors for unknown routes / methods
+	registerFallbackHandlers(router, ipRateLimit)
 
 	// Health check (no auth required)
-	router.GET("/health", healthHandler(db, rds))
+	router.GET("/health", ipRateLimit, healthHandler(db, rds))
+
+	// Liveness / readiness probes (not rate limited so probes never see 429)
+	router.GET("/livez", livezHandler())
+	router.GET("/readyz", readyzHandler(db, rds))
+
+	jwtConfig := auth.JWTConfig{
+		SupabaseURL: cfg.SupabaseURL,
+		Secret:      cfg.SupabaseJWTSecret,
+		Issuer:      cfg.JWTIssuer,
+		Audience:    cfg.JWTAudience,
+		ClockSkew:   cfg.JWTClockSkew,
+		Blocklist:   tokenBlocklist,
+	}
+	// One verifier backs both required and optional auth so they share a
+	// JWKS cache and refresh loop.
+	verifier := auth.NewVerifier(stopping, jwtConfig, log)
+
+	// Public routes (no auth required): share links, and segment views
+	// that recognise a signed-in caller when a valid token is sent.
+	public := router.Group("/api/v1/public")
+	public.Use(ipRateLimit)
+	activityHandler.RegisterPublicRoutes(public)
+	segmentHandler.RegisterPublicRoutes(public.Group("", auth.OptionalMiddleware(verifier)))
 
 	// Protected API routes
+	// The per-IP limit runs before authentication so 401 floods and
+	// token/key guessing are throttled too; the per-user limit needs the
+	// authenticated ID and runs after.
 	api := router.Group("/api/v1")
-	api.Use(auth.Middleware(cfg.SupabaseURL, cfg.SupabaseJWTSecret, log))
+	api.Use(ipRateLimit)
+	api.Use(auth.APIKeyMiddleware(apiKeyRepo, cfg.APIKeyRateLimitRPM, log))
+	api.Use(auth.Middleware(verifier))
+	api.Use(userRateLimit)
 	{
 		activityHandler.RegisterRoutes(api.Group("/activities"))
 		segmentHandler.RegisterRoutes(api.Group("/segments"))
 		coachingHandler.RegisterRoutes(api.Group("/coaching"))
+		authHandler.RegisterRoutes(api.Group("/auth"))
+
+		// Admin-only operational endpoints
+		admin := api.Group("/admin", auth.RequireRole("admin"))
+		logger.NewLevelHandler(logLevel, log).RegisterRoutes(admin)
+		segmentHandler.RegisterAdminRoutes(admin.Group("/segments"))
+		apiKeyHandler.RegisterAdminRoutes(admin.Group("/api-keys"))
 	}
 
 	// ----------------------------------------------------------------
@@ -138,8 +274,15 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	// Start rate limit janitor to prevent memory leak
-	go rateLimitJanitor()
+	// Permanently remove activities past their restore window
+	var background sync.WaitGroup
+	if dbPool != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			purgeDeletedActivities(stopping, activityRepo, log)
+		}()
+	}
 
 	// Start server in goroutine
 	go func() {
@@ -149,18 +292,27 @@ func main() {
 		}
 	}()
 
-	// Wait for interrupt signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	// Wait for interrupt signal; a second one kills the process.
+	<-stopping.Done()
+	stop()
 
 	log.Info("shutting down server...")
+	// One budget covers both draining requests and background matching, so
+	// shutdown finishes well inside a container's kill grace period.
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("server forced shutdown", zap.Error(err))
+		log.Error("server forced shutdown", zap.Error(err))
+	}
+
+	// Drain background work before the deferred db.Close. Matching still
+	// running at the deadline is cancelled; loops exit on stopping.
+	if err := activityHandler.Shutdown(ctx); err != nil {
+		log.Warn("segment matching cancelled at shutdown", zap.Error(err))
 	}
+	background.Wait()
+	<-db.ReconnectDone()
 	log.Info("server stopped")
 }
 
@@ -168,6 +320,37 @@ func main() {
 // Middleware
 // ================================================================
 
+// recoveryMiddleware turns a handler panic into a 500 JSON response and logs
+// the panic value and stack through zap, unlike gin.Recovery which writes to
+// gin's default writer.
+func recoveryMiddleware(log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			requestID := logger.RequestID(c)
+			log.Error("panic recovered",
+				zap.Any("panic", rec),
+				zap.String("stack", string(debug.Stack())),
+				zap.String("request_id", requestID),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+			)
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":      "internal error",
+				"request_id": requestID,
+			})
+		}()
+		c.Next()
+	}
+}
+
 // requestLogger logs each request with Zap.
 func requestLogger(log *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -182,27 +365,228 @@ func requestLogger(log *zap.Logger) gin.HandlerFunc {
 			zap.Int("status", c.Writer.Status()),
 			zap.Duration("latency", time.Since(start)),
 			zap.String("client_ip", c.ClientIP()),
+			zap.String("request_id", logger.RequestID(c)),
 		)
 	}
 }
 
-// corsMiddleware handles CORS headers.
-func corsMiddleware(allowedOrigins []string) gin.HandlerFunc {
+// timeoutMiddleware bounds each request with a deadline on its context so
+// QueryContext and other context-aware calls are cancelled, and answers 503
+// as soon as the deadline passes if the handler hasn't responded yet. The
+// handler still runs to completion; anything it writes afterwards is
+// discarded.
+func timeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		tw := &timeoutWriter{ResponseWriter: c.Writer, ctx: ctx, header: c.Writer.Header().Clone()}
+		stop := context.AfterFunc(ctx, func() {
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			if !tw.done {
+				tw.expiredLocked()
+			}
+		})
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = tw
+		c.Next()
+
+		stop()
+		tw.mu.Lock()
+		tw.done = true
+		tw.mu.Unlock()
+		c.Writer = tw.ResponseWriter
+	}
+}
+
+// timeoutResponse is the body sent when a request's deadline passes.
+var timeoutResponse = []byte(`{"error":"request timeout"}`)
+
+// timeoutWriter serializes the handler's writes with the deadline's 503.
+// Whichever runs first after the deadline — the context callback or the
+// handler reacting to cancellation — sends the 503. The handler's headers
+// are kept apart from the real ones until its first write (gin's
+// WriteHeader only records the status), so the two goroutines never share
+// a header map.
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	ctx          context.Context
+	mu           sync.Mutex
+	header       http.Header
+	headerCopied bool
+	timedOut     bool
+	done         bool
+}
+
+// expiredLocked reports whether the handler's output must be dropped,
+// sending the 503 first if the deadline has passed before the handler
+// started its response. mu must be held.
+func (w *timeoutWriter) expiredLocked() bool {
+	if w.timedOut {
+		return true
+	}
+	if w.ctx.Err() != context.DeadlineExceeded || w.ResponseWriter.Written() {
+		return false
+	}
+	w.timedOut = true
+	h := w.ResponseWriter.Header()
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	h.Set("Content-Length", strconv.Itoa(len(timeoutResponse)))
+	w.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	w.ResponseWriter.Write(timeoutResponse)
+	w.ResponseWriter.Flush()
+	return true
+}
+
+// copyHeaderLocked publishes the handler's headers before its first write.
+// mu must be held.
+func (w *timeoutWriter) copyHeaderLocked() {
+	if w.headerCopied {
+		return
+	}
+	dst := w.ResponseWriter.Header()
+	for k, v := range w.header {
+		dst[k] = v
+	}
+	w.headerCopied = true
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expiredLocked() {
+		return
+	}
+	w.copyHeaderLocked()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expiredLocked() {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.copyHeaderLocked()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Status()
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Size()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Written()
+}
+
+// corsOptions configures corsMiddleware.
+type corsOptions struct {
+	Origins     []string // patterns accepted by matchOrigin
+	Methods     []string
+	Headers     []string // request headers preflights may ask for
+	Credentials bool     // send Access-Control-Allow-Credentials
+}
+
+// corsMiddleware handles CORS headers. The matched request origin is always
+// echoed, never "*". Preflights get back the requested headers that are in
+// opts.Headers (case-insensitively); other requests see the whole allowlist.
+// Credentials are never paired with a bare "*" pattern: an origin admitted
+// only by "*" gets a CORS response without Access-Control-Allow-Credentials.
+func corsMiddleware(opts corsOptions) gin.HandlerFunc {
+	allowlist := make(map[string]string, len(opts.Headers))
+	var canonical []string
+	for _, h := range opts.Headers {
+		h = http.CanonicalHeaderKey(strings.TrimSpace(h))
+		if h == "" || allowlist[strings.ToLower(h)] != "" {
+			continue
+		}
+		allowlist[strings.ToLower(h)] = h
+		canonical = append(canonical, h)
+	}
+	allHeaders := strings.Join(canonical, ", ")
+
+	var methods []string
+	for _, m := range opts.Methods {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+			methods = append(methods, m)
+		}
+	}
+	allMethods := strings.Join(methods, ", ")
+
 	return func(c *gin.Context) {
 		origin := c.Request.Header.Get("Origin")
-		allowed := false
-		for _, pattern := range allowedOrigins {
-			if matchOrigin(origin, strings.TrimSpace(pattern)) {
+		allowed, credentials := false, false
+		for _, pattern := range opts.Origins {
+			pattern = strings.TrimSpace(pattern)
+			if matchOrigin(origin, pattern) {
 				allowed = true
-				break
+				if pattern != "*" {
+					credentials = opts.Credentials
+					break
+				}
 			}
 		}
 
 		if allowed {
 			c.Header("Access-Control-Allow-Origin", origin)
+			if credentials {
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
 		}
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept")
+		c.Writer.Header().Add("Vary", "Origin")
+		c.Header("Access-Control-Allow-Methods", allMethods)
+		if requested := c.Request.Header.Get("Access-Control-Request-Headers"); c.Request.Method == "OPTIONS" && requested != "" {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+			var granted []string
+			for _, h := range strings.Split(requested, ",") {
+				if name, ok := allowlist[strings.ToLower(strings.TrimSpace(h))]; ok {
+					granted = append(granted, name)
+				}
+			}
+			if len(granted) > 0 {
+				c.Header("Access-Control-Allow-Headers", strings.Join(granted, ", "))
+			}
+		} else {
+			c.Header("Access-Control-Allow-Headers", allHeaders)
+		}
+		c.Header("Access-Control-Expose-Headers", "X-Request-ID")
 		c.Header("Access-Control-Max-Age", "86400")
 
 		if c.Request.Method == "OPTIONS" {
@@ -213,11 +597,51 @@ func corsMiddleware(allowedOrigins []string) gin.HandlerFunc {
 	}
 }
 
-// matchOrigin checks if an origin matches a pattern (supports trailing wildcard *).
+// hstsValue is sent when HSTS is enabled: one year, including subdomains.
+const hstsValue = "max-age=31536000; includeSubDomains"
+
+// securityHeaders sets standard hardening headers. HSTS is opt-in because
+// it only makes sense when TLS is terminated in front of the API.
+func securityHeaders(enableHSTS bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("X-Frame-Options", "DENY")
+		c.Header("Referrer-Policy", "no-referrer")
+		if enableHSTS {
+			c.Header("Strict-Transport-Security", hstsValue)
+		}
+		c.Next()
+	}
+}
+
+// matchOrigin checks if an origin matches a pattern. Besides exact origins
+// it supports "*", a trailing wildcard ("http://localhost:*") and a
+// subdomain wildcard, with or without a scheme ("*.example.com",
+// "https://*.example.com"). The subdomain form never matches the bare
+// domain. Empty patterns match nothing.
 func matchOrigin(origin, pattern string) bool {
+	if pattern == "" {
+		return false
+	}
 	if pattern == "*" {
 		return true
 	}
+	if i := strings.Index(pattern, "*."); i >= 0 && (i == 0 || strings.HasSuffix(pattern[:i], "://")) {
+		scheme, domain := pattern[:i], pattern[i+1:] // domain keeps its leading "."
+		rest := origin
+		if scheme != "" {
+			if !strings.HasPrefix(origin, scheme) {
+				return false
+			}
+			rest = origin[len(scheme):]
+		} else if j := strings.Index(origin, "://"); j >= 0 {
+			rest = origin[j+len("://"):]
+		} else {
+			return false
+		}
+		sub := strings.TrimSuffix(rest, domain)
+		return len(sub) < len(rest) && sub != "" && !strings.ContainsAny(sub, "/:")
+	}
 	if strings.HasSuffix(pattern, "*") {
 		prefix := strings.TrimSuffix(pattern, "*")
 		return strings.HasPrefix(origin, prefix)
@@ -225,112 +649,305 @@ func matchOrigin(origin, pattern string) bool {
 	return origin == pattern
 }
 
-// rateLimiter is a simple per-IP token-bucket rate limiter.
-// For production, use a distributed limiter backed by Redis.
+// rateLimiter decides whether one more request from key fits in the
+// current one-minute window.
+type rateLimiter interface {
+	Allow(ctx context.Context, key string) bool
+}
+
+// newRateLimiter returns a Redis-backed limiter shared across instances, or
+// a process-local one when Redis isn't configured. scope namespaces the
+// Redis counters so limiters keyed on different things never collide.
+func newRateLimiter(rds *database.Redis, scope string, rpm int, log *zap.Logger) rateLimiter {
+	mem := newMemoryRateLimiter(rpm)
+	if rds == nil {
+		return mem
+	}
+	return &RedisRateLimiter{rds: rds, scope: scope, rpm: rpm, fallback: mem, now: time.Now, log: log}
+}
+
+// RedisRateLimiter is a fixed-window limiter counting each key's requests
+// per minute with INCR on a per-minute key. If Redis is unreachable it
+// falls back to the in-memory limiter rather than rejecting traffic.
+type RedisRateLimiter struct {
+	rds      *database.Redis
+	scope    string
+	rpm      int
+	fallback *memoryRateLimiter
+	now      func() time.Time
+	log      *zap.Logger
+}
+
+// Allow implements rateLimiter.
+func (l *RedisRateLimiter) Allow(ctx context.Context, key string) bool {
+	window := l.now().Truncate(time.Minute)
+	n, err := l.rds.IncrRateLimit(ctx, database.RateLimitKey(l.scope+":"+key, window), time.Minute)
+	if err != nil {
+		l.log.Debug("redis rate limit failed — using in-memory limiter", zap.Error(err))
+		return l.fallback.Allow(ctx, key)
+	}
+	return n <= int64(l.rpm)
+}
+
+// memoryRateLimiter is a process-local fixed-window limiter. Buckets idle
+// for more than staleBucketAge are swept at most once a minute so the map
+// doesn't grow with every IP ever seen.
+type memoryRateLimiter struct {
+	mu        sync.Mutex
+	rpm       int
+	buckets   map[string]*ipBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
 type ipBucket struct {
 	tokens    int
 	lastReset time.Time
 }
 
-var (
-	ipBuckets  = make(map[string]*ipBucket)
-	bucketsMu  sync.Mutex
-)
+const staleBucketAge = 10 * time.Minute
 
-func rateLimiter(rpm int) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		now := time.Now()
-
-		bucketsMu.Lock()
-		bucket, exists := ipBuckets[ip]
-		if !exists || now.Sub(bucket.lastReset) > time.Minute {
-			ipBuckets[ip] = &ipBucket{tokens: rpm, lastReset: now}
-			bucket = ipBuckets[ip]
+func newMemoryRateLimiter(rpm int) *memoryRateLimiter {
+	return &memoryRateLimiter{rpm: rpm, buckets: make(map[string]*ipBucket), lastSweep: time.Now(), now: time.Now}
+}
+
+// Allow implements rateLimiter.
+func (l *memoryRateLimiter) Allow(_ context.Context, key string) bool {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastReset) > staleBucketAge {
+				delete(l.buckets, k)
+			}
 		}
+		l.lastSweep = now
+	}
+
+	bucket, exists := l.buckets[key]
+	if !exists || now.Sub(bucket.lastReset) > time.Minute {
+		bucket = &ipBucket{tokens: l.rpm, lastReset: now}
+		l.buckets[key] = bucket
+	}
+	if bucket.tokens <= 0 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
 
-		if bucket.tokens <= 0 {
-			bucketsMu.Unlock()
+// rateLimitMiddleware rejects clients that exceed the limiter. keyFn picks
+// the bucket; requests it reports no key for are not limited here.
+func rateLimitMiddleware(limiter rateLimiter, keyFn func(*gin.Context) (string, bool)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := keyFn(c)
+		if !ok {
+			c.Next()
+			return
+		}
+		if !limiter.Allow(c.Request.Context(), key) {
 			c.Header("Retry-After", "60")
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
 				"error": "rate limit exceeded",
 			})
 			return
 		}
-
-		bucket.tokens--
-		bucketsMu.Unlock()
 		c.Next()
 	}
 }
 
+// clientIPKey buckets requests by client IP.
+func clientIPKey(c *gin.Context) (string, bool) {
+	return c.ClientIP(), true
+}
+
+// userIDKey buckets requests by authenticated user, so users sharing a NAT
+// don't share a budget. API key requests are limited per key instead.
+func userIDKey(c *gin.Context) (string, bool) {
+	return auth.GetUserID(c)
+}
+
 // ================================================================
-// Health check handler
+// Fallback handlers
 // ================================================================
 
-func healthHandler(db *database.DB, rds *database.Redis) gin.HandlerFunc {
+// registerFallbackHandlers installs JSON 404/405 handlers so unknown routes
+// return the same error envelope as the API. Global middleware (CORS) still
+// runs for these, since gin combines them with engine.Use; middleware adds
+// handlers that run only for them, such as per-IP rate limiting.
+func registerFallbackHandlers(router *gin.Engine, middleware ...gin.HandlerFunc) {
+	router.HandleMethodNotAllowed = true
+	with := func(h gin.HandlerFunc) []gin.HandlerFunc {
+		return append(append([]gin.HandlerFunc{}, middleware...), h)
+	}
+	router.NoRoute(with(notFoundHandler())...)
+	router.NoMethod(with(methodNotAllowedHandler())...)
+}
+
+// notFoundHandler responds to unregistered paths.
+func notFoundHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
-		defer cancel()
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "route not found",
+			"code":  "not_found",
+			"path":  c.Request.URL.Path,
+		})
+	}
+}
 
-		dbStatus := "not_configured"
-		dbConnType := "none"
-		dbLastError := ""
-		if db != nil {
-			dbConnType = db.ConnType()
-			if db.GetPool() != nil {
-				dbStatus = "connected"
-				if err := db.HealthCheck(ctx); err != nil {
-					dbStatus = "error"
-					dbLastError = err.Error()
-				}
-			} else {
-				dbStatus = "no_pool"
-				dbLastError = db.LastError()
+// methodNotAllowedHandler responds to registered paths hit with the wrong method.
+func methodNotAllowedHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{
+			"error":  "method not allowed",
+			"code":   "method_not_allowed",
+			"path":   c.Request.URL.Path,
+			"method": c.Request.Method,
+		})
+	}
+}
+
+// ================================================================
+// Health check handler
+// ================================================================
+
+// dependencyStatus is the state of the API's backing services.
+type dependencyStatus struct {
+	Database    string
+	DBConnType  string
+	DBPostGIS   bool
+	DBLastError string
+	Redis       string
+}
+
+// checkDependencies pings the database and Redis.
+func checkDependencies(ctx context.Context, db *database.DB, rds *database.Redis) dependencyStatus {
+	st := dependencyStatus{Database: "not_configured", DBConnType: "none", Redis: "disabled"}
+	if db != nil {
+		st.DBConnType = db.ConnType()
+		st.DBPostGIS = db.HasPostGIS()
+		if db.GetPool() != nil {
+			st.Database = "connected"
+			if err := db.HealthCheck(ctx); err != nil {
+				st.Database = "error"
+				st.DBLastError = err.Error()
 			}
+		} else {
+			st.Database = "no_pool"
+			st.DBLastError = db.LastError()
 		}
+	}
 
-		redisStatus := "disabled"
-		if rds != nil {
-			if err := rds.HealthCheck(ctx); err != nil {
-				redisStatus = "error"
-			} else {
-				redisStatus = "connected"
-			}
+	if rds != nil {
+		if err := rds.HealthCheck(ctx); err != nil {
+			st.Redis = "error"
+		} else {
+			st.Redis = "connected"
 		}
+	}
+	return st
+}
+
+func healthHandler(db *database.DB, rds *database.Redis) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		st := checkDependencies(ctx, db, rds)
 
 		// Always return 200 so the container stays alive.
 		// The "status" field indicates true health for monitoring.
 		overallStatus := "ok"
-		if dbStatus != "connected" {
+		if st.Database != "connected" {
 			overallStatus = "degraded"
 		}
 
 		response := gin.H{
 			"status":       overallStatus,
 			"version":      version,
-			"database":     dbStatus,
-			"db_conn_type": dbConnType,
-			"redis":        redisStatus,
+			"database":     st.Database,
+			"db_conn_type": st.DBConnType,
+			"db_postgis":   st.DBPostGIS,
+			"redis":        st.Redis,
+		}
+		if st.DBLastError != "" {
+			response["db_error"] = st.DBLastError
 		}
-		if dbLastError != "" {
-			response["db_error"] = dbLastError
+		if db != nil && db.GetPool() != nil {
+			response["db_pool"] = poolStats(db.Stats())
 		}
 
 		c.JSON(http.StatusOK, response)
 	}
 }
 
-// rateLimitJanitor periodically removes stale IP buckets to prevent memory leaks.
-func rateLimitJanitor() {
-	ticker := time.NewTicker(5 * time.Minute)
-	for range ticker.C {
-		bucketsMu.Lock()
-		for ip, bucket := range ipBuckets {
-			if time.Since(bucket.lastReset) > 10*time.Minute {
-				delete(ipBuckets, ip)
-			}
+// poolStats is the health output for connection pool usage.
+func poolStats(st sql.DBStats) gin.H {
+	return gin.H{
+		"max_open":         st.MaxOpenConnections,
+		"open_connections": st.OpenConnections,
+		"in_use":           st.InUse,
+		"idle":             st.Idle,
+		"wait_count":       st.WaitCount,
+		"wait_duration_ms": st.WaitDuration.Milliseconds(),
+	}
+}
+
+// livezHandler reports that the process is up; it checks nothing else.
+func livezHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+// readyzHandler returns 503 until the database answers, so traffic is only
+// routed to instances that can serve it. Redis is optional and only
+// reported.
+func readyzHandler(db *database.DB, rds *database.Redis) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		st := checkDependencies(ctx, db, rds)
+		if st.Database != "connected" {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status":   "not_ready",
+				"database": st.Database,
+				"redis":    st.Redis,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":   "ready",
+			"database": st.Database,
+			"redis":    st.Redis,
+		})
+	}
+}
+
+// purgeDeletedActivities hourly removes activities soft-deleted longer than
+// activities.RestoreWindow ago, until ctx is cancelled.
+func purgeDeletedActivities(ctx context.Context, repo *activities.Repository, log *zap.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		purgeCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		n, err := repo.PurgeDeleted(purgeCtx, activities.RestoreWindow)
+		cancel()
+		if err != nil {
+			log.Warn("purge deleted activities failed", zap.Error(err))
+			continue
+		}
+		if n > 0 {
+			log.Info("purged deleted activities", zap.Int64("count", n))
 		}
-		bucketsMu.Unlock()
 	}
 }
@@ -0,0 +1,597 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/apexrun/backend/internal/auth"
+	"github.com/apexrun/backend/internal/database"
+	"github.com/apexrun/backend/pkg/logger"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func newFallbackRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(corsMiddleware(corsOptions{Origins: []string{"http://localhost:*"}}))
+	registerFallbackHandlers(r)
+	r.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	return r
+}
+
+func TestNoRoute_StructuredJSON(t *testing.T) {
+	router := newFallbackRouter()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/does/not/exist", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+
+	var resp map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("expected JSON body, got %q: %v", w.Body.String(), err)
+	}
+	if resp["code"] != "not_found" {
+		t.Errorf("expected code 'not_found', got %q", resp["code"])
+	}
+	if resp["path"] != "/does/not/exist" {
+		t.Errorf("expected path '/does/not/exist', got %q", resp["path"])
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "http://localhost:3000" {
+		t.Errorf("expected CORS origin header on 404, got %q", got)
+	}
+}
+
+func TestNoMethod_StructuredJSON(t *testing.T) {
+	router := newFallbackRouter()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/health", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", w.Code)
+	}
+
+	var resp map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("expected JSON body, got %q: %v", w.Body.String(), err)
+	}
+	if resp["code"] != "method_not_allowed" {
+		t.Errorf("expected code 'method_not_allowed', got %q", resp["code"])
+	}
+	if resp["method"] != "POST" {
+		t.Errorf("expected method 'POST', got %q", resp["method"])
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "http://localhost:3000" {
+		t.Errorf("expected CORS origin header on 405, got %q", got)
+	}
+}
+
+func newTestRedisLimiter(t *testing.T, scope string, rpm int) (*RedisRateLimiter, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rds, err := database.NewRedis(mr.Addr(), "", 0, 5, zap.NewNop())
+	if err != nil {
+		t.Fatalf("redis: %v", err)
+	}
+	t.Cleanup(func() { rds.Close() })
+
+	l := newRateLimiter(rds, scope, rpm, zap.NewNop()).(*RedisRateLimiter)
+	fixed := time.Date(2024, 6, 1, 7, 0, 30, 0, time.UTC)
+	l.now = func() time.Time { return fixed }
+	return l, mr
+}
+
+func TestRateLimitMiddleware_CrossesThreshold(t *testing.T) {
+	redisLimiter, _ := newTestRedisLimiter(t, "ip", 3)
+	limiters := map[string]rateLimiter{
+		"redis":     redisLimiter,
+		"in-memory": newRateLimiter(nil, "ip", 3, zap.NewNop()),
+	}
+
+	for name, limiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(rateLimitMiddleware(limiter, clientIPKey))
+			r.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			for i := 1; i <= 4; i++ {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+				want := http.StatusOK
+				if i == 4 {
+					want = http.StatusTooManyRequests
+				}
+				if w.Code != want {
+					t.Fatalf("request %d: expected %d, got %d", i, want, w.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestRedisRateLimiter_ExpiryResetsCount(t *testing.T) {
+	ctx := context.Background()
+	l, mr := newTestRedisLimiter(t, "ip", 2)
+
+	l.Allow(ctx, "1.2.3.4")
+	l.Allow(ctx, "1.2.3.4")
+	if l.Allow(ctx, "1.2.3.4") {
+		t.Fatal("expected third request in the window to be limited")
+	}
+	if !l.Allow(ctx, "5.6.7.8") {
+		t.Fatal("a different key must have its own count")
+	}
+
+	// Same window key, but the counter has expired.
+	mr.FastForward(61 * time.Second)
+	if !l.Allow(ctx, "1.2.3.4") {
+		t.Fatal("expected count to reset once the key expired")
+	}
+}
+
+func TestMemoryRateLimiter_EvictsStaleBuckets(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC)
+	l := newMemoryRateLimiter(5)
+	l.now = func() time.Time { return now }
+	l.lastSweep = now
+
+	l.Allow(ctx, "1.2.3.4")
+	now = now.Add(staleBucketAge + time.Minute)
+	l.Allow(ctx, "5.6.7.8")
+
+	if _, ok := l.buckets["1.2.3.4"]; ok {
+		t.Error("expected idle bucket to be evicted")
+	}
+	if _, ok := l.buckets["5.6.7.8"]; !ok {
+		t.Error("expected active bucket to be kept")
+	}
+}
+
+func TestUserRateLimit_IndependentBucketsOnSharedIP(t *testing.T) {
+	redisLimiter, _ := newTestRedisLimiter(t, "user", 2)
+	limiters := map[string]rateLimiter{
+		"redis":     redisLimiter,
+		"in-memory": newRateLimiter(nil, "user", 2, zap.NewNop()),
+	}
+
+	for name, limiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			r := gin.New()
+			// Stand-in for auth.Middleware.
+			r.Use(func(c *gin.Context) {
+				if id := c.GetHeader("X-Test-User"); id != "" {
+					c.Set(auth.ContextKeyUserID, id)
+				}
+				c.Next()
+			})
+			r.Use(rateLimitMiddleware(limiter, userIDKey))
+			r.GET("/api/v1/activities", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			do := func(user string) int {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("GET", "/api/v1/activities", nil)
+				req.RemoteAddr = "203.0.113.7:4000" // same NAT address for everyone
+				req.Header.Set("X-Test-User", user)
+				r.ServeHTTP(w, req)
+				return w.Code
+			}
+
+			do("user-a")
+			do("user-a")
+			if code := do("user-a"); code != http.StatusTooManyRequests {
+				t.Fatalf("expected user-a to be limited, got %d", code)
+			}
+			if code := do("user-b"); code != http.StatusOK {
+				t.Fatalf("expected user-b to keep its own budget, got %d", code)
+			}
+		})
+	}
+}
+
+func TestRecoveryMiddleware_PanicReturnsJSON500(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	r := gin.New()
+	r.Use(logger.RequestIDMiddleware())
+	r.Use(recoveryMiddleware(zap.New(core)))
+	r.GET("/boom", func(c *gin.Context) { panic("boom") })
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/boom", nil)
+	req.Header.Set(logger.HeaderRequestID, "trace-42")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+	var resp map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("expected JSON body, got %q: %v", w.Body.String(), err)
+	}
+	if resp["error"] != "internal error" || resp["request_id"] != "trace-42" {
+		t.Errorf("unexpected body: %v", resp)
+	}
+
+	entries := logs.FilterMessage("panic recovered").All()
+	if len(entries) != 1 {
+		t.Fatalf("expected one panic log, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["request_id"] != "trace-42" || fields["path"] != "/boom" || fields["stack"] == "" {
+		t.Errorf("unexpected log fields: %v", fields)
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	newRouter := func(h gin.HandlerFunc) *gin.Engine {
+		r := gin.New()
+		r.Use(timeoutMiddleware(50 * time.Millisecond))
+		r.GET("/work", h)
+		return r
+	}
+
+	t.Run("slow handler gets 503 and a cancelled context", func(t *testing.T) {
+		ctxErr := make(chan error, 1)
+		r := newRouter(func(c *gin.Context) {
+			select {
+			case <-c.Request.Context().Done():
+				ctxErr <- c.Request.Context().Err()
+			case <-time.After(time.Second):
+				ctxErr <- nil
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "too late"})
+		})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/work", nil))
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("expected 503, got %d", w.Code)
+		}
+		if w.Body.String() != `{"error":"request timeout"}` {
+			t.Errorf("unexpected body %q", w.Body.String())
+		}
+		if err := <-ctxErr; err != context.DeadlineExceeded {
+			t.Errorf("expected handler context to hit its deadline, got %v", err)
+		}
+	})
+
+	t.Run("fast handler is untouched", func(t *testing.T) {
+		r := newRouter(func(c *gin.Context) {
+			c.Header("X-Custom", "yes")
+			c.JSON(http.StatusCreated, gin.H{"status": "ok"})
+		})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/work", nil))
+
+		if w.Code != http.StatusCreated || w.Body.String() != `{"status":"ok"}` {
+			t.Fatalf("expected 201 passthrough, got %d %q", w.Code, w.Body.String())
+		}
+		if w.Header().Get("X-Custom") != "yes" || w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+			t.Errorf("handler headers lost: %v", w.Header())
+		}
+	})
+}
+
+func TestCORSPreflight(t *testing.T) {
+	allowed := []string{"Authorization", "Content-Type", "X-Request-ID", "idempotency-key"}
+	tests := []struct {
+		name        string
+		origin      string
+		requested   string
+		credentials bool
+		wantHeaders string
+		wantCreds   string
+	}{
+		{
+			name:        "custom header is reflected",
+			origin:      "http://localhost:3000",
+			requested:   "content-type, Idempotency-Key",
+			wantHeaders: "Content-Type, Idempotency-Key",
+		},
+		{
+			name:        "headers outside the allowlist are dropped",
+			origin:      "http://localhost:3000",
+			requested:   "X-Request-ID, X-Evil",
+			wantHeaders: "X-Request-Id",
+		},
+		{
+			name:      "nothing allowed",
+			origin:    "http://localhost:3000",
+			requested: "X-Evil",
+		},
+		{
+			name:        "credentials for an allowed origin",
+			origin:      "http://localhost:3000",
+			requested:   "Authorization",
+			credentials: true,
+			wantHeaders: "Authorization",
+			wantCreds:   "true",
+		},
+		{
+			name:        "no credentials for a foreign origin",
+			origin:      "https://evil.example",
+			requested:   "Authorization",
+			credentials: true,
+			wantHeaders: "Authorization",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(corsMiddleware(corsOptions{Origins: []string{"http://localhost:*"}, Headers: allowed, Credentials: tt.credentials}))
+			r.POST("/api/v1/activities", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("OPTIONS", "/api/v1/activities", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			req.Header.Set("Access-Control-Request-Headers", tt.requested)
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("expected 204, got %d", w.Code)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Headers"); got != tt.wantHeaders {
+				t.Errorf("Access-Control-Allow-Headers = %q, want %q", got, tt.wantHeaders)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCreds {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.wantCreds)
+			}
+			if vary := w.Header().Values("Vary"); len(vary) != 2 || vary[1] != "Access-Control-Request-Headers" {
+				t.Errorf("Vary = %v, want Origin and Access-Control-Request-Headers", vary)
+			}
+		})
+	}
+
+	t.Run("simple request lists the allowlist", func(t *testing.T) {
+		r := gin.New()
+		r.Use(corsMiddleware(corsOptions{Origins: []string{"http://localhost:*"}, Headers: allowed}))
+		r.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set("Origin", "http://localhost:3000")
+		r.ServeHTTP(w, req)
+
+		want := "Authorization, Content-Type, X-Request-Id, Idempotency-Key"
+		if got := w.Header().Get("Access-Control-Allow-Headers"); got != want {
+			t.Errorf("Access-Control-Allow-Headers = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestCORSCredentials(t *testing.T) {
+	tests := []struct {
+		name       string
+		origins    []string
+		origin     string
+		wantOrigin string
+		wantCreds  string
+	}{
+		{"explicit origin", []string{"https://app.apexrun.app"}, "https://app.apexrun.app", "https://app.apexrun.app", "true"},
+		{"subdomain wildcard", []string{"https://*.apexrun.app"}, "https://app.apexrun.app", "https://app.apexrun.app", "true"},
+		{"bare wildcard echoes origin without credentials", []string{"*"}, "https://evil.example", "https://evil.example", ""},
+		{"explicit match wins over bare wildcard", []string{"*", "https://app.apexrun.app"}, "https://app.apexrun.app", "https://app.apexrun.app", "true"},
+		{"wildcard still withholds credentials from others", []string{"*", "https://app.apexrun.app"}, "https://evil.example", "https://evil.example", ""},
+		{"disallowed origin", []string{"https://app.apexrun.app"}, "https://evil.example", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(corsMiddleware(corsOptions{
+				Origins:     tt.origins,
+				Methods:     []string{"GET", "patch", "DELETE"},
+				Credentials: true,
+			}))
+			r.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("OPTIONS", "/health", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", "PATCH")
+			r.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCreds {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.wantCreds)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, PATCH, DELETE" {
+				t.Errorf("Access-Control-Allow-Methods = %q, want configured methods", got)
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	for _, hsts := range []bool{false, true} {
+		t.Run(fmt.Sprintf("hsts=%v", hsts), func(t *testing.T) {
+			r := gin.New()
+			r.Use(corsMiddleware(corsOptions{Origins: []string{"http://localhost:*"}}))
+			r.Use(securityHeaders(hsts))
+			r.GET("/health", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"status": "ok"}) })
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/health", nil)
+			req.Header.Set("Origin", "http://localhost:3000")
+			r.ServeHTTP(w, req)
+
+			want := map[string]string{
+				"X-Content-Type-Options":      "nosniff",
+				"X-Frame-Options":             "DENY",
+				"Referrer-Policy":             "no-referrer",
+				"Access-Control-Allow-Origin": "http://localhost:3000",
+			}
+			for k, v := range want {
+				if got := w.Header().Get(k); got != v {
+					t.Errorf("%s = %q, want %q", k, got, v)
+				}
+			}
+			got := w.Header().Get("Strict-Transport-Security")
+			if hsts && got != hstsValue {
+				t.Errorf("expected HSTS %q, got %q", hstsValue, got)
+			}
+			if !hsts && got != "" {
+				t.Errorf("expected no HSTS header, got %q", got)
+			}
+		})
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	connected := func(t *testing.T) *database.DB {
+		pool, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		t.Cleanup(func() { pool.Close() })
+		mock.ExpectPing()
+		return &database.DB{Pool: pool}
+	}
+	unreachable := func(t *testing.T) *database.DB {
+		pool, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		t.Cleanup(func() { pool.Close() })
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		return &database.DB{Pool: pool}
+	}
+	noPool := func(t *testing.T) *database.DB {
+		return database.New(context.Background(), "", 0, 0, 0, database.RetryPolicy{}, zap.NewNop())
+	}
+
+	tests := []struct {
+		name     string
+		db       func(t *testing.T) *database.DB
+		wantCode int
+	}{
+		{"connected", connected, http.StatusOK},
+		{"ping fails", unreachable, http.StatusServiceUnavailable},
+		{"no pool", noPool, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/readyz", readyzHandler(tt.db(t), nil))
+			r.GET("/livez", livezHandler())
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("readyz: expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/livez", nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("livez: expected 200 regardless of database, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestHealthPoolStats(t *testing.T) {
+	decode := func(t *testing.T, db *database.DB) map[string]interface{} {
+		t.Helper()
+		r := gin.New()
+		r.GET("/health", healthHandler(db, nil))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return body
+	}
+
+	t.Run("pool configured", func(t *testing.T) {
+		pool, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		defer pool.Close()
+		mock.ExpectPing()
+
+		stats, ok := decode(t, &database.DB{Pool: pool})["db_pool"].(map[string]interface{})
+		if !ok {
+			t.Fatal("expected db_pool object")
+		}
+		for _, key := range []string{"open_connections", "in_use", "idle", "wait_count", "wait_duration_ms"} {
+			if _, ok := stats[key]; !ok {
+				t.Errorf("db_pool missing %q: %v", key, stats)
+			}
+		}
+	})
+
+	t.Run("no pool", func(t *testing.T) {
+		db := database.New(context.Background(), "", 0, 0, 0, database.RetryPolicy{}, zap.NewNop())
+		if _, ok := decode(t, db)["db_pool"]; ok {
+			t.Error("expected no db_pool without a pool")
+		}
+		if st := db.Stats(); st != (sql.DBStats{}) {
+			t.Errorf("expected zero stats, got %+v", st)
+		}
+	})
+}
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		origin  string
+		pattern string
+		want    bool
+	}{
+		{"http://localhost:3000", "http://localhost:*", true},
+		{"https://apexrun.app", "https://apexrun.app", true},
+		{"https://evil.com", "https://apexrun.app", false},
+		{"https://anything.dev", "*", true},
+		{"https://app.example.com", "*.example.com", true},
+		{"http://a.b.example.com", "*.example.com", true},
+		{"https://evil.com", "*.example.com", false},
+		{"https://example.com", "*.example.com", false},
+		{"https://evilexample.com", "*.example.com", false},
+		{"https://app.example.com.evil.com", "*.example.com", false},
+		{"https://app.example.com:8443", "*.example.com", false},
+		{"https://app.example.com", "https://*.example.com", true},
+		{"http://app.example.com", "https://*.example.com", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := matchOrigin(tt.origin, tt.pattern); got != tt.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", tt.origin, tt.pattern, got, tt.want)
+		}
+	}
+}
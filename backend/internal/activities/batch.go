@@ -0,0 +1,119 @@
+package activities
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/auth"
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+// CreateBatch handles POST /api/v1/activities/batch
+// Semantics are partial: each item is validated (and, unless ?force=true,
+// checked for duplicates in the database and among earlier items in the
+// batch) on its own, and failures are reported per item.
+// The valid items are then inserted in one transaction, so a database error
+// creates none of them and responds 500. Weather enrichment is skipped for
+// batches.
+func (h *Handler) CreateBatch(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var batch BatchCreateRequest
+	if err := c.ShouldBindJSON(&batch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(batch.Activities) == 0 || len(batch.Activities) > MaxBatchActivities {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("activities must contain 1 to %d items", MaxBatchActivities),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	resp := BatchCreateResponse{Results: make([]BatchItemResult, len(batch.Activities))}
+	var candidates []*CreateActivityRequest
+	var candidateIdx []int
+	for i, raw := range batch.Activities {
+		res := &resp.Results[i]
+		res.Index, res.Status = i, BatchItemFailed
+
+		req := &CreateActivityRequest{}
+		if err := json.Unmarshal(raw, req); err != nil {
+			res.Error = err.Error()
+			continue
+		}
+		if err := binding.Validator.ValidateStruct(req); err != nil {
+			res.Error = err.Error()
+			continue
+		}
+		if err := utils.ValidateRoute(req.RawGPSPoints); err != nil {
+			res.Error = "invalid raw_gps_points: " + err.Error()
+			continue
+		}
+		candidates = append(candidates, req)
+		candidateIdx = append(candidateIdx, i)
+	}
+
+	valid, validIdx := candidates, candidateIdx
+	if c.Query("force") != "true" && len(candidates) > 0 {
+		dups, err := h.repo.FindDuplicates(ctx, userID, candidates)
+		if err != nil {
+			h.logger.Error("find duplicate activities", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create activities"})
+			return
+		}
+		valid, validIdx = nil, nil
+		for k, req := range candidates {
+			res := &resp.Results[candidateIdx[k]]
+			if dups[k] != nil {
+				res.Error, res.Code, res.ID = "duplicate activity", "duplicate_activity", dups[k].ID
+				continue
+			}
+			// The same activity twice in one batch is caught here, since
+			// neither copy is in the database yet.
+			if j := duplicateIn(valid, req); j >= 0 {
+				res.Error = fmt.Sprintf("duplicate of item %d in this batch", validIdx[j])
+				res.Code = "duplicate_activity"
+				continue
+			}
+			valid = append(valid, req)
+			validIdx = append(validIdx, candidateIdx[k])
+		}
+	}
+
+	if len(valid) > 0 {
+		created, err := h.repo.CreateMany(ctx, userID, valid)
+		if err != nil {
+			h.logger.Error("create activities", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create activities"})
+			return
+		}
+		for j, a := range created {
+			res := &resp.Results[validIdx[j]]
+			res.Status, res.ID = BatchItemCreated, a.ID
+			if h.segments != nil && valid[j].RouteWKT != "" {
+				h.matchSegments(a.ID)
+			}
+		}
+		h.invalidateLists(ctx, userID)
+	}
+
+	for _, res := range resp.Results {
+		if res.Status == BatchItemCreated {
+			resp.Created++
+		} else {
+			resp.Failed++
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,186 @@
+package activities_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/activities"
+)
+
+func batchItem(name, activityType, start string) string {
+	return fmt.Sprintf(`{"activity_name":%q,"activity_type":%q,"start_time":%q,"duration_seconds":1500,"distance_meters":5000}`,
+		name, activityType, start)
+}
+
+func postBatch(t *testing.T, router *gin.Engine, query string, items ...string) (*httptest.ResponseRecorder, activities.BatchCreateResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/activities/batch"+query,
+		strings.NewReader(`{"activities":[`+strings.Join(items, ",")+`]}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	var resp activities.BatchCreateResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+	}
+	return w, resp
+}
+
+func TestCreateBatchHandler(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	newRouter := func(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+		t.Helper()
+		repo, mock := newMockRepo(t)
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+		return router, mock
+	}
+	expectInsert := func(mock sqlmock.Sqlmock, id string) {
+		mock.ExpectQuery("INSERT INTO activities").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(id, start, start))
+	}
+
+	t.Run("mixed valid and invalid items", func(t *testing.T) {
+		router, mock := newRouter(t)
+		mock.ExpectBegin()
+		expectInsert(mock, "new-1")
+		expectInsert(mock, "new-2")
+		mock.ExpectCommit()
+
+		w, resp := postBatch(t, router, "?force=true",
+			batchItem("Morning Run", "run", "2024-03-15T06:30:00Z"),
+			batchItem("Swim", "swim", "2024-03-16T06:30:00Z"),
+			`{"activity_name":"Lost","activity_type":"run","start_time":"2024-03-17T06:30:00Z","duration_seconds":60,"distance_meters":100,"raw_gps_points":[{"lat":200,"lng":0}]}`,
+			`"not an object"`,
+			batchItem("Evening Run", "run", "2024-03-18T18:00:00Z"),
+		)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if resp.Created != 2 || resp.Failed != 3 || len(resp.Results) != 5 {
+			t.Fatalf("created=%d failed=%d results=%d, want 2/3/5", resp.Created, resp.Failed, len(resp.Results))
+		}
+		want := []struct {
+			status, id string
+		}{
+			{activities.BatchItemCreated, "new-1"},
+			{activities.BatchItemFailed, ""},
+			{activities.BatchItemFailed, ""},
+			{activities.BatchItemFailed, ""},
+			{activities.BatchItemCreated, "new-2"},
+		}
+		for i, res := range resp.Results {
+			if res.Index != i || res.Status != want[i].status || res.ID != want[i].id {
+				t.Errorf("result %d = %+v, want %s %q", i, res, want[i].status, want[i].id)
+			}
+			if res.Status == activities.BatchItemFailed && res.Error == "" {
+				t.Errorf("result %d: failed without an error", i)
+			}
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("duplicates fail per item", func(t *testing.T) {
+		router, mock := newRouter(t)
+		// One query checks every item; only the first has a match.
+		mock.ExpectQuery(regexp.QuoteMeta("unnest($2::timestamptz[], $3::float8[]) WITH ORDINALITY")).
+			WithArgs("test-user-id",
+				[]time.Time{start.Add(time.Minute), start.Add(3*24*time.Hour + 11*time.Hour + 30*time.Minute)},
+				[]float64{5000, 5000}, 120.0, 0.99, 1.01).
+			WillReturnRows(sqlmock.NewRows(append(append([]string{}, activityColumns...), "idx")).
+				AddRow(append(activityRow("existing-1", "test-user-id", start, 5000, 1500), 1)...))
+		mock.ExpectBegin()
+		expectInsert(mock, "new-1")
+		mock.ExpectCommit()
+
+		_, resp := postBatch(t, router, "",
+			batchItem("Morning Run", "run", "2024-03-15T06:31:00Z"),
+			batchItem("Evening Run", "run", "2024-03-18T18:00:00Z"),
+		)
+		if resp.Created != 1 || resp.Failed != 1 {
+			t.Fatalf("created=%d failed=%d, want 1/1", resp.Created, resp.Failed)
+		}
+		if dup := resp.Results[0]; dup.Code != "duplicate_activity" || dup.ID != "existing-1" {
+			t.Errorf("duplicate result = %+v", dup)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("duplicates within the batch fail", func(t *testing.T) {
+		router, mock := newRouter(t)
+		mock.ExpectQuery("WITH ORDINALITY").
+			WillReturnRows(sqlmock.NewRows(append(append([]string{}, activityColumns...), "idx")))
+		mock.ExpectBegin()
+		expectInsert(mock, "new-1")
+		expectInsert(mock, "new-2")
+		mock.ExpectCommit()
+
+		// Item 1 repeats item 0 from a second source, a minute later and
+		// 0.5% shorter; item 2 is a different activity.
+		_, resp := postBatch(t, router, "",
+			batchItem("Morning Run", "run", "2024-03-15T06:30:00Z"),
+			`{"activity_name":"Morning Run","activity_type":"run","start_time":"2024-03-15T06:31:00Z","duration_seconds":1500,"distance_meters":4975}`,
+			batchItem("Evening Run", "run", "2024-03-15T18:00:00Z"),
+		)
+		if resp.Created != 2 || resp.Failed != 1 {
+			t.Fatalf("created=%d failed=%d, want 2/1", resp.Created, resp.Failed)
+		}
+		if dup := resp.Results[1]; dup.Status != activities.BatchItemFailed || dup.Code != "duplicate_activity" || dup.ID != "" {
+			t.Errorf("in-batch duplicate result = %+v", dup)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("insert failure rolls back the batch", func(t *testing.T) {
+		router, mock := newRouter(t)
+		mock.ExpectBegin()
+		expectInsert(mock, "new-1")
+		mock.ExpectQuery("INSERT INTO activities").WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		w, _ := postBatch(t, router, "?force=true",
+			batchItem("Morning Run", "run", "2024-03-15T06:30:00Z"),
+			batchItem("Evening Run", "run", "2024-03-18T18:00:00Z"),
+		)
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("expected 500, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("size limits", func(t *testing.T) {
+		router, _ := newRouter(t)
+		if w, _ := postBatch(t, router, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("empty batch: expected 400, got %d", w.Code)
+		}
+		items := make([]string, activities.MaxBatchActivities+1)
+		for i := range items {
+			items[i] = batchItem("Run", "run", "2024-03-15T06:30:00Z")
+		}
+		if w, _ := postBatch(t, router, "?force=true", items...); w.Code != http.StatusBadRequest {
+			t.Errorf("oversized batch: expected 400, got %d", w.Code)
+		}
+	})
+}
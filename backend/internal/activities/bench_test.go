@@ -0,0 +1,64 @@
+package activities_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq" // baseline driver for the comparison
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/activities"
+	"github.com/apexrun/backend/internal/database"
+)
+
+// BenchmarkList compares List throughput on lib/pq and on the pgx pool that
+// database.New builds. It needs a real database with the schema applied:
+//
+//	BENCH_DATABASE_URL=postgres://... BENCH_USER_ID=<uuid> go test -run '^$' -bench BenchmarkList ./internal/activities
+func BenchmarkList(b *testing.B) {
+	dsn := os.Getenv("BENCH_DATABASE_URL")
+	userID := os.Getenv("BENCH_USER_ID")
+	if dsn == "" || userID == "" {
+		b.Skip("BENCH_DATABASE_URL and BENCH_USER_ID not set")
+	}
+
+	pq, err := sql.Open("postgres", dsn)
+	if err != nil {
+		b.Fatalf("open lib/pq: %v", err)
+	}
+	defer pq.Close()
+	pq.SetMaxOpenConns(25)
+
+	pgx := database.New(context.Background(), dsn, 25, 10, 30*time.Minute, database.RetryPolicy{Attempts: 1}, zap.NewNop())
+	defer pgx.Close()
+	if !pgx.IsConnected() {
+		b.Fatalf("pgx: %s", pgx.LastError())
+	}
+
+	drivers := []struct {
+		name string
+		db   *sql.DB
+	}{
+		{"lib/pq", pq},
+		{"pgx", pgx.GetPool()},
+	}
+	for _, d := range drivers {
+		b.Run(d.name, func(b *testing.B) {
+			repo := activities.NewRepository(d.db, zap.NewNop())
+			params := activities.ListActivitiesParams{Limit: 20}
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, _, err := repo.List(context.Background(), userID, params); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
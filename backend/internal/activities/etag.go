@@ -0,0 +1,29 @@
+package activities
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// activityETag identifies an activity's representation by id, updated_at
+// (bumped by a trigger on every write) and the requested units. It is weak
+// because computed fields such as calories can change with the profile.
+func activityETag(a *Activity, imperial bool) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%t", a.ID, a.UpdatedAt.UnixNano(), imperial)))
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag (or "*"),
+// using the weak comparison RFC 9110 prescribes for If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package activities
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Geocoder resolves a coordinate to a human-readable "City, Country" label.
+type Geocoder interface {
+	ReverseGeocode(ctx context.Context, lat, lng float64) (string, error)
+}
+
+// HTTPGeocoder queries a provider URL as GET {baseURL}?lat=..&lng=.. and
+// expects a JSON body {"city": "..", "country": ".."}.
+type HTTPGeocoder struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPGeocoder creates a geocoder with the given request timeout.
+func NewHTTPGeocoder(baseURL string, timeout time.Duration) *HTTPGeocoder {
+	return &HTTPGeocoder{
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// ReverseGeocode implements Geocoder. A place with only a country (e.g. at
+// sea or in a remote area) is labelled with the country alone.
+func (g *HTTPGeocoder) ReverseGeocode(ctx context.Context, lat, lng float64) (string, error) {
+	u, err := url.Parse(g.baseURL)
+	if err != nil {
+		return "", fmt.Errorf("geocoder url: %w", err)
+	}
+	q := u.Query()
+	q.Set("lat", strconv.FormatFloat(lat, 'f', 6, 64))
+	q.Set("lng", strconv.FormatFloat(lng, 'f', 6, 64))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("geocode request: %w", err)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("geocode request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("geocoder returned %d", resp.StatusCode)
+	}
+	var place struct {
+		City    string `json:"city"`
+		Country string `json:"country"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&place); err != nil {
+		return "", fmt.Errorf("decode geocode: %w", err)
+	}
+	switch {
+	case place.Country == "":
+		return "", fmt.Errorf("geocoder returned no country")
+	case place.City == "":
+		return place.Country, nil
+	default:
+		return place.City + ", " + place.Country, nil
+	}
+}
@@ -1,66 +1,372 @@
 package activities
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
 	"github.com/apexrun/backend/internal/auth"
+	"github.com/apexrun/backend/internal/database"
+	"github.com/apexrun/backend/pkg/utils"
 )
 
+// weatherLookupTimeout bounds how long Create waits on the weather provider.
+const weatherLookupTimeout = 3 * time.Second
+
+// geocodeTimeout bounds how long Create waits on the geocoder.
+const geocodeTimeout = 3 * time.Second
+
+// geocodeCacheTTL is how long a resolved place label is reused for nearby
+// starts; place names change rarely.
+const geocodeCacheTTL = 30 * 24 * time.Hour
+
+// segmentMatchTimeout bounds background segment matching after Create.
+const segmentMatchTimeout = 30 * time.Second
+
+// listCacheTTL bounds how stale a cached activity list can be; writes
+// through this handler also invalidate the user's lists.
+const listCacheTTL = 30 * time.Second
+
+// maxNearbyRadiusKm caps the search radius for Nearby.
+const maxNearbyRadiusKm = 50
+
+// SegmentMatcher records segment efforts for a newly created activity.
+// MatchActivityTx records them inside tx and returns a func to run after
+// commit (e.g. to update caches).
+type SegmentMatcher interface {
+	MatchActivity(ctx context.Context, activityID string) error
+	MatchActivityTx(ctx context.Context, tx *sql.Tx, activityID string) (func(context.Context), error)
+}
+
+// TxRunner runs fn in a database transaction; *database.DB implements it.
+type TxRunner interface {
+	WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error
+}
+
 // Handler serves activity HTTP endpoints.
 type Handler struct {
-	repo   *Repository
-	logger *zap.Logger
+	repo     *Repository
+	tx       TxRunner        // nil matches segments in the background instead
+	redis    *database.Redis // nil disables list caching
+	weather  WeatherProvider // nil disables weather enrichment
+	geocoder Geocoder        // nil disables start location labels
+	segments SegmentMatcher  // nil disables automatic segment matching
+	logger   *zap.Logger
+
+	// matchMu guards closing and matching.Add, so no run starts once
+	// Shutdown is waiting. Runs use matchCtx, which Shutdown cancels when
+	// its deadline passes.
+	matchMu     sync.Mutex
+	closing     bool
+	matching    sync.WaitGroup // background matchSegments runs
+	matchCtx    context.Context
+	cancelMatch context.CancelFunc
 }
 
-// NewHandler creates a new activities handler.
-func NewHandler(repo *Repository, logger *zap.Logger) *Handler {
-	return &Handler{repo: repo, logger: logger}
+// NewHandler creates a new activities handler. tx, redis, weather, geocoder
+// and segments may be nil.
+func NewHandler(repo *Repository, tx TxRunner, redis *database.Redis, weather WeatherProvider, geocoder Geocoder, segments SegmentMatcher, logger *zap.Logger) *Handler {
+	matchCtx, cancelMatch := context.WithCancel(context.Background())
+	return &Handler{
+		repo: repo, tx: tx, redis: redis, weather: weather, geocoder: geocoder, segments: segments, logger: logger,
+		matchCtx: matchCtx, cancelMatch: cancelMatch,
+	}
 }
 
 // RegisterRoutes mounts activity routes on the given RouterGroup.
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	rg.POST("", h.Create)
+	rg.POST("/batch", h.CreateBatch)
+	rg.POST("/bulk-delete", h.BulkDelete)
 	rg.GET("", h.List)
+	rg.GET("/stats", h.Stats)
+	rg.GET("/search", h.Search)
+	rg.GET("/nearby", h.Nearby)
+	rg.GET("/records", h.Records)
+	rg.GET("/compare", h.Compare)
 	rg.GET("/:id", h.GetByID)
+	rg.GET("/:id/best-efforts", h.BestEfforts)
+	rg.GET("/:id/export.gpx", h.ExportGPX)
+	rg.GET("/:id/hr-zones", h.HeartRateZones)
+	rg.GET("/:id/laps", h.Laps)
+	rg.GET("/:id/streams", h.Streams)
 	rg.PUT("/:id", h.Update)
+	rg.PATCH("/:id", h.Patch)
 	rg.DELETE("/:id", h.Delete)
+	rg.POST("/:id/restore", h.Restore)
+	rg.POST("/:id/share", h.Share)
+	rg.DELETE("/:id/share", h.Unshare)
+}
+
+// RegisterPublicRoutes mounts unauthenticated share-link routes. rg must be
+// outside the auth middleware.
+func (h *Handler) RegisterPublicRoutes(rg *gin.RouterGroup) {
+	rg.GET("/activities/:token", h.GetShared)
 }
 
 // Create handles POST /api/v1/activities
+// With an Idempotency-Key header, a repeat of a successful request replays
+// the original 201 response for 24h instead of inserting again; reusing the
+// key with a different body gets 422.
 func (h *Handler) Create(c *gin.Context) {
 	userID, ok := auth.GetUserID(c)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
+	imperial, ok := parseUnits(c)
+	if !ok {
+		return
+	}
 
 	var req CreateActivityRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := utils.ValidateRoute(req.RawGPSPoints); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid raw_gps_points: " + err.Error()})
+		return
+	}
 
-	activity, err := h.repo.Create(c.Request.Context(), userID, &req)
+	hash := requestHash(&req)
+	idemKey, done := h.beginIdempotent(c, userID, hash, imperial)
+	if done {
+		return
+	}
+	var created *Activity
+	defer func() { h.finishIdempotent(c.Request.Context(), idemKey, hash, created) }()
+
+	// Reject near-identical uploads (e.g. synced from two sources) unless forced.
+	if c.Query("force") != "true" {
+		dup, err := h.repo.FindDuplicate(c.Request.Context(), userID, req.StartTime, req.DistanceMeters)
+		if err != nil {
+			h.logger.Error("find duplicate activity", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create activity"})
+			return
+		}
+		if dup != nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":       "duplicate activity",
+				"code":        "duplicate_activity",
+				"activity_id": dup.ID,
+			})
+			return
+		}
+	}
+
+	h.enrichWeather(c.Request.Context(), &req)
+	h.enrichStartLocation(c.Request.Context(), &req)
+
+	activity, err := h.create(c.Request.Context(), userID, &req)
 	if err != nil {
 		h.logger.Error("create activity", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create activity"})
 		return
 	}
+	h.invalidateLists(c.Request.Context(), userID)
+	created = activity
 
-	c.JSON(http.StatusCreated, activity)
+	c.JSON(http.StatusCreated, activityView(activity, imperial))
 }
 
+// create inserts the activity and records its segment efforts. With a
+// TxRunner both happen in one transaction; matching runs under a savepoint,
+// so a failed match leaves no partial efforts and the activity is still
+// created, with matching retried in the background. Without one, matching
+// runs in the background after the insert.
+func (h *Handler) create(ctx context.Context, userID string, req *CreateActivityRequest) (*Activity, error) {
+	match := h.segments != nil && req.RouteWKT != ""
+	if !match || h.tx == nil {
+		activity, err := h.repo.Create(ctx, userID, req)
+		if err == nil && match {
+			h.matchSegments(activity.ID)
+		}
+		return activity, err
+	}
+
+	var activity *Activity
+	var afterCommit func(context.Context)
+	err := h.tx.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		if activity, err = h.repo.WithTx(tx).Create(ctx, userID, req); err != nil {
+			return err
+		}
+		err = database.WithSavepoint(ctx, tx, "segment_matching", func() error {
+			var err error
+			afterCommit, err = h.segments.MatchActivityTx(ctx, tx, activity.ID)
+			return err
+		})
+		if err != nil {
+			h.logger.Warn("segment matching failed, retrying after commit",
+				zap.String("activity_id", activity.ID), zap.Error(err))
+			afterCommit = nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if afterCommit == nil {
+		h.matchSegments(activity.ID)
+	} else {
+		afterCommit(ctx)
+	}
+	return activity, nil
+}
+
+// matchSegments runs segment matching for a new activity in the background.
+// It uses the handler's context since the request's is cancelled once the
+// response is written. After Shutdown it only logs the skipped activity.
+func (h *Handler) matchSegments(activityID string) {
+	h.matchMu.Lock()
+	defer h.matchMu.Unlock()
+	if h.closing {
+		h.logger.Warn("shutting down, skipping automatic segment matching",
+			zap.String("activity_id", activityID))
+		return
+	}
+	h.matching.Add(1)
+	go func() {
+		defer h.matching.Done()
+		ctx, cancel := context.WithTimeout(h.matchCtx, segmentMatchTimeout)
+		defer cancel()
+		if err := h.segments.MatchActivity(ctx, activityID); err != nil {
+			h.logger.Warn("automatic segment matching failed",
+				zap.String("activity_id", activityID), zap.Error(err))
+		}
+	}()
+}
+
+// Shutdown stops new background segment matching and waits for runs in
+// flight. If ctx ends first, the runs are cancelled and Shutdown returns
+// ctx's error once they have returned. Call it before closing the database;
+// handlers still running afterwards skip matching.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.matchMu.Lock()
+	h.closing = true
+	h.matchMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.matching.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		h.cancelMatch()
+		return nil
+	case <-ctx.Done():
+		h.cancelMatch()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// enrichWeather sets req.Weather from the provider for the start coordinate.
+// It is best-effort: any failure is logged and creation proceeds.
+func (h *Handler) enrichWeather(ctx context.Context, req *CreateActivityRequest) {
+	if h.weather == nil {
+		return
+	}
+	start, ok := startCoordinate(req)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, weatherLookupTimeout)
+	defer cancel()
+	w, err := h.weather.Lookup(ctx, start.Lat, start.Lng, req.StartTime)
+	if err != nil {
+		h.logger.Warn("weather enrichment failed", zap.Error(err))
+		return
+	}
+	req.Weather = w
+}
+
+// enrichStartLocation sets req.StartLocation from the geocoder for the start
+// coordinate, consulting the Redis cache first. Like enrichWeather it is
+// best-effort: any failure is logged and creation proceeds without a label.
+func (h *Handler) enrichStartLocation(ctx context.Context, req *CreateActivityRequest) {
+	if h.geocoder == nil {
+		return
+	}
+	start, ok := startCoordinate(req)
+	if !ok {
+		return
+	}
+	if h.redis != nil {
+		label, hit, err := h.redis.GetGeocode(ctx, start.Lat, start.Lng)
+		if err != nil {
+			h.logger.Warn("geocode cache read failed", zap.Error(err))
+		} else if hit {
+			req.StartLocation = &label
+			return
+		}
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, geocodeTimeout)
+	defer cancel()
+	label, err := h.geocoder.ReverseGeocode(lookupCtx, start.Lat, start.Lng)
+	if err != nil {
+		h.logger.Warn("reverse geocoding failed", zap.Error(err))
+		return
+	}
+	req.StartLocation = &label
+
+	if h.redis != nil {
+		if err := h.redis.SetGeocode(ctx, start.Lat, start.Lng, label, geocodeCacheTTL); err != nil {
+			h.logger.Warn("geocode cache write failed", zap.Error(err))
+		}
+	}
+}
+
+// startCoordinate returns the first point of the raw GPS points, falling
+// back to the route WKT, rounded to the ~1km cell the geocode cache is
+// keyed on. The exact start may be the athlete's home, so only the cell is
+// ever sent to the weather provider or geocoder.
+func startCoordinate(req *CreateActivityRequest) (utils.GPSPoint, bool) {
+	if len(req.RawGPSPoints) > 0 {
+		return roundCell(req.RawGPSPoints[0]), true
+	}
+	if req.RouteWKT != "" {
+		if route, err := utils.ParseWKTLineString(req.RouteWKT); err == nil && len(route) > 0 {
+			return roundCell(route[0]), true
+		}
+	}
+	return utils.GPSPoint{}, false
+}
+
+// roundCell rounds p to two decimal places, about 1km.
+func roundCell(p utils.GPSPoint) utils.GPSPoint {
+	return utils.GPSPoint{Lat: math.Round(p.Lat*100) / 100, Lng: math.Round(p.Lng*100) / 100}
+}
+
+// maxGPSGapSeconds is the longest pause between GPS samples GetByID accepts
+// before flagging a gap in data_quality.
+const maxGPSGapSeconds = 60
+
 // GetByID handles GET /api/v1/activities/:id
+// Responses carry an ETag; a matching If-None-Match gets 304 with no body.
 func (h *Handler) GetByID(c *gin.Context) {
 	userID, ok := auth.GetUserID(c)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
+	imperial, ok := parseUnits(c)
+	if !ok {
+		return
+	}
 
 	activityID := c.Param("id")
 	activity, err := h.repo.GetByID(c.Request.Context(), userID, activityID)
@@ -74,24 +380,385 @@ func (h *Handler) GetByID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, activity)
+	etag := activityETag(activity, imperial)
+	c.Header("ETag", etag)
+	if inm := c.GetHeader("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	// Calories are best-effort: a profile lookup failure shouldn't fail the read.
+	metrics, err := h.repo.GetUserMetrics(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Warn("get user metrics", zap.Error(err))
+	} else if metrics.WeightKg != nil {
+		kcal := utils.EstimateCalories(activity.ActivityType, activity.DistanceMeters,
+			float64(activity.DurationSeconds), *metrics.WeightKg)
+		if kcal > 0 {
+			kcal = math.Round(kcal)
+			activity.Calories = &kcal
+		}
+	}
+
+	// Likewise for data quality: only timestamped tracks can be checked.
+	points, err := h.repo.GetGPSPoints(c.Request.Context(), userID, activityID)
+	if err != nil {
+		h.logger.Warn("get gps points", zap.Error(err))
+	} else if len(points) > 1 && points[0].Timestamp != 0 {
+		gaps := utils.DetectGaps(points, maxGPSGapSeconds)
+		if gaps == nil {
+			gaps = []utils.Gap{}
+		}
+		activity.DataQuality = &DataQuality{GapCount: len(gaps), Gaps: gaps}
+	}
+
+	c.JSON(http.StatusOK, activityView(activity, imperial))
+}
+
+// BestEfforts handles GET /api/v1/activities/:id/best-efforts
+// Returns the fastest stretch within the activity for each standard distance.
+func (h *Handler) BestEfforts(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	activityID := c.Param("id")
+	points, err := h.repo.GetGPSPoints(c.Request.Context(), userID, activityID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("get gps points", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	efforts := utils.BestEfforts(points, utils.StandardDistances)
+	if efforts == nil {
+		efforts = []utils.BestEffort{}
+	}
+	c.JSON(http.StatusOK, gin.H{"activity_id": activityID, "best_efforts": efforts})
+}
+
+// defaultRestSpeedKmh separates work from rest laps (7:30 /km).
+const defaultRestSpeedKmh = 8.0
+
+// Laps handles GET /api/v1/activities/:id/laps
+// rest_speed_kmh overrides the work/rest speed threshold.
+func (h *Handler) Laps(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	threshold := defaultRestSpeedKmh
+	if v := c.Query("rest_speed_kmh"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rest_speed_kmh must be a positive number"})
+			return
+		}
+		threshold = f
+	}
+
+	activityID := c.Param("id")
+	points, err := h.repo.GetGPSPoints(c.Request.Context(), userID, activityID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("get gps points", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	laps := utils.DetectLaps(points, threshold)
+	if laps == nil {
+		laps = []utils.Lap{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"activity_id":    activityID,
+		"rest_speed_kmh": threshold,
+		"laps":           laps,
+	})
+}
+
+// Streams handles GET /api/v1/activities/:id/streams
+// keys selects a comma-separated subset of utils.StreamKeys (default all);
+// the time base is always included.
+func (h *Handler) Streams(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	keys := utils.StreamKeys
+	if v := c.Query("keys"); v != "" {
+		keys = nil
+		for _, k := range strings.Split(v, ",") {
+			k = strings.TrimSpace(k)
+			if !isStreamKey(k) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown stream key %q", k)})
+				return
+			}
+			keys = append(keys, k)
+		}
+	}
+
+	activityID := c.Param("id")
+	points, err := h.repo.GetGPSPoints(c.Request.Context(), userID, activityID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("get gps points", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	var stream []utils.HeartRateSample
+	for _, k := range keys {
+		if k != utils.StreamHeartRate {
+			continue
+		}
+		stream, err = h.repo.GetHeartRateStream(c.Request.Context(), userID, activityID)
+		if err != nil && err != sql.ErrNoRows {
+			h.logger.Error("get heart rate stream", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			return
+		}
+		break
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"activity_id": activityID,
+		"streams":     utils.ActivityStreams(points, stream, keys),
+	})
+}
+
+// isStreamKey reports whether k is one of utils.StreamKeys.
+func isStreamKey(k string) bool {
+	for _, key := range utils.StreamKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// HeartRateZones handles GET /api/v1/activities/:id/hr-zones
+// max_hr defaults to 220 - age from the user's profile.
+func (h *Handler) HeartRateZones(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	maxHR, source := 0, "query"
+	if v := c.Query("max_hr"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 100 || n > 250 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_hr must be an integer between 100 and 250"})
+			return
+		}
+		maxHR = n
+	} else {
+		metrics, err := h.repo.GetUserMetrics(c.Request.Context(), userID)
+		if err != nil {
+			h.logger.Error("get user metrics", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			return
+		}
+		age := metrics.Age
+		if age == nil || *age <= 0 || *age >= 120 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_hr is required when the profile has no age"})
+			return
+		}
+		maxHR, source = 220-*age, "age"
+	}
+
+	activityID := c.Param("id")
+	stream, err := h.repo.GetHeartRateStream(c.Request.Context(), userID, activityID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("get heart rate stream", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	seconds := utils.HeartRateZones(utils.ResampleHeartRate(stream), maxHR)
+	bounds := utils.HeartRateZoneBounds(maxHR)
+	zones := make([]gin.H, len(seconds))
+	for i := range seconds {
+		upper := maxHR
+		if i+1 < len(bounds) {
+			upper = bounds[i+1] - 1
+		}
+		zones[i] = gin.H{
+			"zone":    i + 1,
+			"min_bpm": bounds[i],
+			"max_bpm": upper,
+			"seconds": seconds[i],
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"activity_id":   activityID,
+		"max_hr":        maxHR,
+		"max_hr_source": source,
+		"zones":         zones,
+	})
+}
+
+// ExportGPX handles GET /api/v1/activities/:id/export.gpx
+func (h *Handler) ExportGPX(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	activityID := c.Param("id")
+	activity, err := h.repo.GetByID(c.Request.Context(), userID, activityID)
+	if err != nil {
+		h.logger.Error("get activity", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	if activity == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
+		return
+	}
+
+	route, err := h.repo.GetRoute(c.Request.Context(), userID, activityID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("get route", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	if len(route) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "activity has no stored route"})
+		return
+	}
+
+	doc, err := utils.EncodeGPX(activity.ActivityName, activity.ActivityType, activity.StartTime, route)
+	if err != nil {
+		h.logger.Error("encode gpx", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.gpx"`, gpxFilename(activity.ActivityName)))
+	c.Data(http.StatusOK, "application/gpx+xml", doc)
 }
 
 // List handles GET /api/v1/activities
+// Offset pages use the {"data", "pagination"} envelope unless
+// ?envelope=false; cursor pages keep {activities, count, next_cursor}.
 func (h *Handler) List(c *gin.Context) {
 	userID, ok := auth.GetUserID(c)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
+	imperial, ok := parseUnits(c)
+	if !ok {
+		return
+	}
+	envelope, ok := utils.ParseEnvelope(c)
+	if !ok {
+		return
+	}
 
 	var params ListActivitiesParams
 	if err := c.ShouldBindQuery(&params); err != nil {
-		params.Limit = 20
-		params.Offset = 0
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	activities, err := h.repo.List(c.Request.Context(), userID, params.Limit, params.Offset)
+	var err error
+	if params.From, err = parseTimeBound(c.Query("from"), false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'from': expected RFC3339 or YYYY-MM-DD"})
+		return
+	}
+	if params.To, err = parseTimeBound(c.Query("to"), true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'to': expected RFC3339 or YYYY-MM-DD"})
+		return
+	}
+	if params.From != nil && params.To != nil && params.From.After(*params.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'from' must not be after 'to'"})
+		return
+	}
+
+	// Presence of ?cursor (even empty, for the first page) selects keyset paging.
+	if raw, useCursor := c.GetQuery("cursor"); useCursor {
+		if !params.isDefaultSort() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor paging only supports the default sort (start_time desc)"})
+			return
+		}
+		if raw != "" {
+			if params.Cursor, err = DecodeActivityCursor(raw); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		activities, next, err := h.repo.ListByCursor(c.Request.Context(), userID, params)
+		if err != nil {
+			h.logger.Error("list activities by cursor", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			return
+		}
+		if activities == nil {
+			activities = []Activity{}
+		}
+		resp := gin.H{"activities": activityViews(activities, imperial), "count": len(activities)}
+		if next != nil {
+			resp["next_cursor"] = next.Encode()
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	respond := func(page activityPage) {
+		views := activityViews(page.Activities, imperial)
+		if !envelope {
+			c.JSON(http.StatusOK, gin.H{"activities": views, "count": len(page.Activities)})
+			return
+		}
+		limit, offset := params.page()
+		c.JSON(http.StatusOK, utils.NewListEnvelope(views, len(page.Activities), limit, offset, page.Total))
+	}
+
+	ctx := c.Request.Context()
+	cacheKey := h.listCacheKey(ctx, userID, params)
+	if cacheKey != "" {
+		var cached activityPage
+		hit, err := h.redis.GetJSON(ctx, cacheKey, &cached)
+		if err != nil {
+			h.logger.Debug("activity list cache read failed", zap.Error(err))
+		} else if hit {
+			respond(cached)
+			return
+		}
+	}
+
+	activities, total, err := h.repo.List(ctx, userID, params)
 	if err != nil {
 		h.logger.Error("list activities", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
@@ -101,7 +768,244 @@ func (h *Handler) List(c *gin.Context) {
 	if activities == nil {
 		activities = []Activity{}
 	}
-	c.JSON(http.StatusOK, gin.H{"activities": activities, "count": len(activities)})
+	page := activityPage{Activities: activities, Total: total}
+	if cacheKey != "" {
+		if err := h.redis.SetJSON(ctx, cacheKey, page, listCacheTTL); err != nil {
+			h.logger.Debug("activity list cache write failed", zap.Error(err))
+		}
+	}
+	respond(page)
+}
+
+// activityPage is a List page and its total, as cached.
+type activityPage struct {
+	Activities []Activity `json:"activities"`
+	Total      int        `json:"total"`
+}
+
+// listCacheKey returns the Redis key for an offset-paged list request, or ""
+// when caching is off or Redis is unreachable.
+func (h *Handler) listCacheKey(ctx context.Context, userID string, params ListActivitiesParams) string {
+	if h.redis == nil {
+		return ""
+	}
+	version, err := h.redis.ActivityListVersion(ctx, userID)
+	if err != nil {
+		h.logger.Debug("activity list cache version read failed", zap.Error(err))
+		return ""
+	}
+
+	activityType, from, to := "", "", ""
+	if params.ActivityType != nil {
+		activityType = *params.ActivityType
+	}
+	if params.From != nil {
+		from = params.From.UTC().Format(time.RFC3339)
+	}
+	if params.To != nil {
+		to = params.To.UTC().Format(time.RFC3339)
+	}
+	page := fmt.Sprintf("%d:%d:type=%s:from=%s:to=%s:sort=%s", params.Limit, params.Offset, activityType, from, to, params.orderBy())
+	return database.ActivityListKey(userID, version, page)
+}
+
+// invalidateLists drops the user's cached activity lists after a write.
+func (h *Handler) invalidateLists(ctx context.Context, userID string) {
+	if h.redis == nil {
+		return
+	}
+	if err := h.redis.InvalidateActivityLists(ctx, userID); err != nil {
+		h.logger.Warn("activity list cache invalidation failed",
+			zap.String("user_id", userID), zap.Error(err))
+	}
+}
+
+// Search handles GET /api/v1/activities/search?q=morning
+func (h *Handler) Search(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	imperial, ok := parseUnits(c)
+	if !ok {
+		return
+	}
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query parameter 'q' is required"})
+		return
+	}
+
+	var params ListActivitiesParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	activities, err := h.repo.Search(c.Request.Context(), userID, q, params.Limit, params.Offset)
+	if err != nil {
+		h.logger.Error("search activities", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	if activities == nil {
+		activities = []Activity{}
+	}
+	c.JSON(http.StatusOK, gin.H{"activities": activityViews(activities, imperial), "count": len(activities)})
+}
+
+// Nearby handles GET /api/v1/activities/nearby?lat=51.5&lng=-0.12&radius_km=2
+// Only the caller's own public activities are returned.
+func (h *Handler) Nearby(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	imperial, ok := parseUnits(c)
+	if !ok {
+		return
+	}
+
+	lat, latErr := strconv.ParseFloat(c.Query("lat"), 64)
+	lng, lngErr := strconv.ParseFloat(c.Query("lng"), 64)
+	if latErr != nil || lngErr != nil || math.IsNaN(lat) || math.IsNaN(lng) ||
+		lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lng must be valid coordinates"})
+		return
+	}
+	radiusKm, err := strconv.ParseFloat(c.Query("radius_km"), 64)
+	if err != nil || !(radiusKm > 0 && radiusKm <= maxNearbyRadiusKm) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("radius_km must be between 0 and %d", maxNearbyRadiusKm)})
+		return
+	}
+
+	var params ListActivitiesParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	activities, err := h.repo.Nearby(c.Request.Context(), userID, lat, lng, radiusKm, params.Limit)
+	if err != nil {
+		h.logger.Error("nearby activities", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	if activities == nil {
+		activities = []Activity{}
+	}
+	c.JSON(http.StatusOK, gin.H{"activities": activityViews(activities, imperial), "count": len(activities)})
+}
+
+// Stats handles GET /api/v1/activities/stats?period=week|month|year|all&by=type
+// Calendar periods are computed in UTC; the default is all time. An API key
+// reads another user's stats with ?user_id=.
+func (h *Handler) Stats(c *gin.Context) {
+	userID, ok := auth.SubjectUserID(c)
+	if !ok {
+		return
+	}
+
+	period := c.DefaultQuery("period", "all")
+	since, ok := utils.PeriodStart(period, time.Now().UTC())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be one of: week, month, year, all"})
+		return
+	}
+
+	resp := gin.H{"period": period}
+	if !since.IsZero() {
+		resp["since"] = since
+	}
+
+	switch c.Query("by") {
+	case "":
+		stats, err := h.repo.Stats(c.Request.Context(), userID, since)
+		if err != nil {
+			h.logger.Error("activity stats", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			return
+		}
+		resp["stats"] = stats
+	case "type":
+		stats, err := h.repo.StatsByType(c.Request.Context(), userID, since)
+		if err != nil {
+			h.logger.Error("activity stats by type", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			return
+		}
+		if stats == nil {
+			stats = []ActivityStats{}
+		}
+		resp["by_type"] = stats
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "by must be 'type' when set"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Compare handles GET /api/v1/activities/compare?a=<id>&b=<id>
+// Deltas are B relative to A.
+func (h *Handler) Compare(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	aID, bID := c.Query("a"), c.Query("b")
+	if aID == "" || bID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query parameters 'a' and 'b' are required"})
+		return
+	}
+
+	found, err := h.repo.GetManyByID(c.Request.Context(), userID, []string{aID, bID})
+	if err != nil {
+		h.logger.Error("get activities", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	var a, b *Activity
+	for i := range found {
+		if found[i].ID == aID {
+			a = &found[i]
+		}
+		if found[i].ID == bID {
+			b = &found[i]
+		}
+	}
+	if a == nil || b == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, CompareActivities(a, b))
+}
+
+// Records handles GET /api/v1/activities/records
+func (h *Handler) Records(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	records, err := h.repo.PersonalRecords(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Error("personal records", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"records": records})
 }
 
 // Update handles PUT /api/v1/activities/:id
@@ -111,15 +1015,22 @@ func (h *Handler) Update(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
+	imperial, ok := parseUnits(c)
+	if !ok {
+		return
+	}
 
-	activityID := c.Param("id")
 	var req UpdateActivityRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	h.update(c, userID, imperial, &req)
+}
 
-	activity, err := h.repo.Update(c.Request.Context(), userID, activityID, &req)
+// update applies req to the activity in the path and writes the response.
+func (h *Handler) update(c *gin.Context, userID string, imperial bool, req *UpdateActivityRequest) {
+	activity, err := h.repo.Update(c.Request.Context(), userID, c.Param("id"), req)
 	if err != nil {
 		h.logger.Error("update activity", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
@@ -129,8 +1040,9 @@ func (h *Handler) Update(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
 		return
 	}
+	h.invalidateLists(c.Request.Context(), userID)
 
-	c.JSON(http.StatusOK, activity)
+	c.JSON(http.StatusOK, activityView(activity, imperial))
 }
 
 // Delete handles DELETE /api/v1/activities/:id
@@ -152,6 +1064,203 @@ func (h *Handler) Delete(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
 		return
 	}
+	h.invalidateLists(c.Request.Context(), userID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "activity deleted"})
 }
+
+// BulkDelete handles POST /api/v1/activities/bulk-delete
+// The response's deleted count may be lower than the number of ids when some
+// don't match one of the caller's activities.
+func (h *Handler) BulkDelete(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req BulkDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ids must list 1 to %d activity ids: %v", MaxBulkDelete, err)})
+		return
+	}
+
+	deleted, err := h.repo.DeleteMany(c.Request.Context(), userID, req.IDs)
+	if err != nil {
+		h.logger.Error("bulk delete activities", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	if deleted > 0 {
+		h.invalidateLists(c.Request.Context(), userID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted, "requested": len(req.IDs)})
+}
+
+// shareBlurRadiusMeters hides where a shared route starts and ends.
+const shareBlurRadiusMeters = 200
+
+// Share handles POST /api/v1/activities/:id/share
+func (h *Handler) Share(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	token, err := h.repo.CreateShareToken(c.Request.Context(), userID, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("create share token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token": token,
+		"path":  "/api/v1/public/activities/" + token,
+	})
+}
+
+// Unshare handles DELETE /api/v1/activities/:id/share
+func (h *Handler) Unshare(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	err := h.repo.RevokeShareToken(c.Request.Context(), userID, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("revoke share token", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "share link revoked"})
+}
+
+// GetShared handles GET /api/v1/public/activities/:token (no auth).
+func (h *Handler) GetShared(c *gin.Context) {
+	activity, err := h.repo.GetByShareToken(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		h.logger.Error("get shared activity", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	if activity == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
+		return
+	}
+
+	route, err := h.repo.GetRoute(c.Request.Context(), activity.UserID, activity.ID)
+	if err != nil && err != sql.ErrNoRows {
+		h.logger.Error("get shared route", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, publicView(activity, route))
+}
+
+// publicView strips identifying fields and blurs the route near both ends.
+func publicView(a *Activity, route []utils.GPSPoint) PublicActivity {
+	if len(route) > 0 {
+		start, end := route[0], route[len(route)-1]
+		route = utils.BlurRoute(route, start, shareBlurRadiusMeters)
+		route = utils.BlurRoute(route, end, shareBlurRadiusMeters)
+	}
+	points := make([]PublicPoint, len(route))
+	for i, p := range route {
+		points[i] = PublicPoint{Lat: p.Lat, Lng: p.Lng}
+	}
+
+	return PublicActivity{
+		ActivityName:        a.ActivityName,
+		ActivityType:        a.ActivityType,
+		Description:         a.Description,
+		DistanceMeters:      a.DistanceMeters,
+		DurationSeconds:     a.DurationSeconds,
+		AvgPaceMinPerKm:     a.AvgPaceMinPerKm,
+		ElevationGainMeters: a.ElevationGainMeters,
+		StartTime:           a.StartTime,
+		Route:               points,
+	}
+}
+
+// Restore handles POST /api/v1/activities/:id/restore
+func (h *Handler) Restore(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	imperial, ok := parseUnits(c)
+	if !ok {
+		return
+	}
+
+	activity, err := h.repo.Restore(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		h.logger.Error("restore activity", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	if activity == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no deleted activity to restore"})
+		return
+	}
+	h.invalidateLists(c.Request.Context(), userID)
+
+	c.JSON(http.StatusOK, activityView(activity, imperial))
+}
+
+// --- helpers ---
+
+// gpxFilename turns an activity name into a safe download filename.
+func gpxFilename(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	out := strings.TrimSuffix(b.String(), "-")
+	if out == "" {
+		return "activity"
+	}
+	return out
+}
+
+// parseTimeBound parses an optional RFC3339 or YYYY-MM-DD query value.
+// A date-only upper bound is widened to the last instant of that day so the
+// whole day is included.
+func parseTimeBound(v string, endOfDay bool) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
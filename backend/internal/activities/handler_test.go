@@ -1,16 +1,30 @@
 package activities_test
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 
+	"github.com/apexrun/backend/internal/activities"
 	"github.com/apexrun/backend/internal/auth"
+	"github.com/apexrun/backend/internal/database"
+	"github.com/apexrun/backend/pkg/utils"
 )
 
 func init() {
@@ -329,3 +343,2029 @@ func TestGetUserID_Missing(t *testing.T) {
 		t.Error("expected GetUserID to return ok=false when no userID set")
 	}
 }
+
+func TestListHandler_DateRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		expectCode int
+		expectArgs []driver.Value
+	}{
+		{
+			name:       "date-only bounds are inclusive",
+			query:      "?from=2024-03-01&to=2024-03-31",
+			expectCode: http.StatusOK,
+			expectArgs: []driver.Value{
+				"test-user-id",
+				time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 3, 31, 23, 59, 59, 999999999, time.UTC),
+				20, 0,
+			},
+		},
+		{
+			name:       "from after to",
+			query:      "?from=2024-04-01&to=2024-03-01",
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "unparseable from",
+			query:      "?from=last-week",
+			expectCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			if tt.expectArgs != nil {
+				mock.ExpectQuery("FROM activities").
+					WithArgs(tt.expectArgs...).
+					WillReturnRows(sqlmock.NewRows(activityColumns))
+			}
+
+			router := setupTestRouter("test-user-id")
+			activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/activities"+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectCode {
+				t.Errorf("expected status %d, got %d. Body: %s", tt.expectCode, w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestListHandler_TypeFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		expectCode int
+		expectSQL  string
+		expectArgs []driver.Value
+	}{
+		{
+			name:       "valid filter",
+			query:      "?type=run",
+			expectCode: http.StatusOK,
+			expectSQL:  `WHERE user_id = \$1 AND deleted_at IS NULL AND activity_type = \$2`,
+			expectArgs: []driver.Value{"test-user-id", "run", 20, 0},
+		},
+		{
+			name:       "no filter",
+			query:      "",
+			expectCode: http.StatusOK,
+			expectSQL:  `WHERE user_id = \$1 AND deleted_at IS NULL\s+ORDER BY`,
+			expectArgs: []driver.Value{"test-user-id", 20, 0},
+		},
+		{
+			name:       "invalid filter",
+			query:      "?type=swim",
+			expectCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			if tt.expectSQL != "" {
+				mock.ExpectQuery(tt.expectSQL).
+					WithArgs(tt.expectArgs...).
+					WillReturnRows(sqlmock.NewRows(activityColumns))
+			}
+
+			router := setupTestRouter("test-user-id")
+			activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/activities"+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectCode {
+				t.Errorf("expected status %d, got %d. Body: %s", tt.expectCode, w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestListHandler_Sort(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		query      string
+		expectCode int
+		expectSQL  string
+	}{
+		{"default", "", http.StatusOK, `ORDER BY start_time DESC, id DESC\s+LIMIT`},
+		{"distance asc", "?sort=distance&order=asc", http.StatusOK, `ORDER BY distance_meters ASC, start_time DESC, id DESC\s+LIMIT`},
+		{"duration defaults to desc", "?sort=duration", http.StatusOK, `ORDER BY duration_seconds DESC, start_time DESC, id DESC\s+LIMIT`},
+		{"oldest first", "?order=asc", http.StatusOK, `ORDER BY start_time ASC, id ASC\s+LIMIT`},
+		{"unknown column", "?sort=activity_name", http.StatusBadRequest, ""},
+		{"injection attempt", "?sort=distance_meters%3BDROP%20TABLE%20activities", http.StatusBadRequest, ""},
+		{"unknown order", "?sort=distance&order=sideways", http.StatusBadRequest, ""},
+		{"custom sort with cursor", "?sort=distance&cursor=", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			if tt.expectSQL != "" {
+				// Rows come back in the database's order, shortest first here.
+				mock.ExpectQuery(tt.expectSQL).
+					WillReturnRows(sqlmock.NewRows(listColumns).
+						AddRow(listRow(2, activityRow("short", "test-user-id", start, 3000, 900))...).
+						AddRow(listRow(2, activityRow("long", "test-user-id", start.Add(-time.Hour), 10000, 3000))...))
+			}
+
+			router := setupTestRouter("test-user-id")
+			activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/activities"+tt.query, nil))
+			if w.Code != tt.expectCode {
+				t.Fatalf("expected status %d, got %d. Body: %s", tt.expectCode, w.Code, w.Body.String())
+			}
+			if tt.expectCode == http.StatusOK {
+				var resp struct {
+					Data []activities.Activity `json:"data"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("unmarshal: %v", err)
+				}
+				if len(resp.Data) != 2 || resp.Data[0].ID != "short" {
+					t.Errorf("activities out of query order: %+v", resp.Data)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestListHandler_Pagination(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	page := func(total int, ids ...string) *sqlmock.Rows {
+		rows := sqlmock.NewRows(listColumns)
+		for i, id := range ids {
+			rows.AddRow(listRow(total, activityRow(id, "test-user-id", start.Add(-time.Duration(i)*time.Hour), 5000, 1500))...)
+		}
+		return rows
+	}
+	type envelope struct {
+		Data       []activities.Activity `json:"data"`
+		Pagination utils.Pagination      `json:"pagination"`
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		args    []driver.Value
+		rows    *sqlmock.Rows
+		want    utils.Pagination
+		wantLen int
+	}{
+		{"first page", "?limit=2", []driver.Value{"test-user-id", 2, 0}, page(5, "a5", "a4"),
+			utils.Pagination{Limit: 2, Offset: 0, Total: 5, HasMore: true}, 2},
+		{"last full page", "?limit=2&offset=3", []driver.Value{"test-user-id", 2, 3}, page(5, "a2", "a1"),
+			utils.Pagination{Limit: 2, Offset: 3, Total: 5, HasMore: false}, 2},
+		{"short last page", "?limit=2&offset=4", []driver.Value{"test-user-id", 2, 4}, page(5, "a1"),
+			utils.Pagination{Limit: 2, Offset: 4, Total: 5, HasMore: false}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			mock.ExpectQuery(regexp.QuoteMeta("COUNT(*) OVER ()")).WithArgs(tt.args...).WillReturnRows(tt.rows)
+
+			router := setupTestRouter("test-user-id")
+			activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/activities"+tt.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var resp envelope
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if len(resp.Data) != tt.wantLen || resp.Pagination != tt.want {
+				t.Errorf("got %d items, %+v; want %d, %+v", len(resp.Data), resp.Pagination, tt.wantLen, tt.want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	t.Run("envelope=false keeps the original shape", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery(regexp.QuoteMeta("COUNT(*) OVER ()")).WillReturnRows(page(1, "a1"))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities?envelope=false", nil))
+
+		var resp map[string]json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if _, ok := resp["activities"]; !ok || string(resp["count"]) != "1" || resp["data"] != nil {
+			t.Errorf("expected {activities, count}, got %s", w.Body.String())
+		}
+	})
+
+	t.Run("invalid envelope", func(t *testing.T) {
+		repo, _ := newMockRepo(t)
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities?envelope=maybe", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestStatsHandler(t *testing.T) {
+	statsColumns := []string{"count", "distance", "duration", "elevation"}
+
+	t.Run("all time with no activities returns zeros", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery(`FROM activities\s+WHERE user_id = \$1 AND deleted_at IS NULL$`).
+			WithArgs("test-user-id").
+			WillReturnRows(sqlmock.NewRows(statsColumns).AddRow(0, 0.0, 0, 0.0))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/stats", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp struct {
+			Period string                    `json:"period"`
+			Stats  *activities.ActivityStats `json:"stats"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal failed: %v", err)
+		}
+		if resp.Period != "all" || resp.Stats == nil {
+			t.Fatalf("unexpected response: %s", w.Body.String())
+		}
+		if resp.Stats.ActivityCount != 0 || resp.Stats.AvgPaceMinPerKm != 0 {
+			t.Errorf("expected zero stats, got %+v", resp.Stats)
+		}
+	})
+
+	t.Run("week grouped by type", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery(`WHERE user_id = \$1 AND deleted_at IS NULL AND start_time >= \$2\s+GROUP BY activity_type`).
+			WithArgs("test-user-id", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(append([]string{"activity_type"}, statsColumns...)).
+				AddRow("bike", 1, 20000.0, 3600, 150.0).
+				AddRow("run", 2, 10000.0, 3000, 80.0))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/stats?period=week&by=type", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp struct {
+			ByType []activities.ActivityStats `json:"by_type"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal failed: %v", err)
+		}
+		if len(resp.ByType) != 2 {
+			t.Fatalf("expected 2 groups, got %d", len(resp.ByType))
+		}
+		run := resp.ByType[1]
+		if run.ActivityType == nil || *run.ActivityType != "run" {
+			t.Fatalf("expected run group, got %+v", run)
+		}
+		if run.AvgPaceMinPerKm != 5.0 {
+			t.Errorf("expected 5.0 min/km, got %f", run.AvgPaceMinPerKm)
+		}
+	})
+
+	t.Run("invalid period", func(t *testing.T) {
+		repo, _ := newMockRepo(t)
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/stats?period=decade", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestListHandler_CursorPagingStableAcrossInserts(t *testing.T) {
+	base := time.Date(2024, 3, 15, 6, 0, 0, 0, time.UTC)
+	a3 := activityRow("a3", "test-user-id", base.Add(3*time.Hour), 5000, 1500)
+	a2 := activityRow("a2", "test-user-id", base.Add(2*time.Hour), 5000, 1500)
+	a1 := activityRow("a1", "test-user-id", base.Add(1*time.Hour), 5000, 1500)
+
+	repo, mock := newMockRepo(t)
+	router := setupTestRouter("test-user-id")
+	activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+	type page struct {
+		Activities []activities.Activity `json:"activities"`
+		NextCursor string                `json:"next_cursor"`
+	}
+	fetch := func(query string) page {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var p page
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatalf("unmarshal failed: %v", err)
+		}
+		return p
+	}
+
+	// First page: limit 2 fetches 3 rows to detect another page.
+	mock.ExpectQuery(`ORDER BY start_time DESC, id DESC\s+LIMIT \$2`).
+		WithArgs("test-user-id", 3).
+		WillReturnRows(sqlmock.NewRows(activityColumns).AddRow(a3...).AddRow(a2...).AddRow(a1...))
+
+	first := fetch("?cursor=&limit=2")
+	if len(first.Activities) != 2 || first.Activities[1].ID != "a2" {
+		t.Fatalf("unexpected first page: %+v", first.Activities)
+	}
+	if first.NextCursor == "" {
+		t.Fatal("expected next_cursor on first page")
+	}
+
+	// A newer activity is inserted before the second page is requested. The
+	// keyset query still continues strictly after a2, so nothing is repeated.
+	mock.ExpectQuery(`\(start_time, id\) < \(\$2, \$3\)\s+ORDER BY start_time DESC, id DESC\s+LIMIT \$4`).
+		WithArgs("test-user-id", base.Add(2*time.Hour), "a2", 3).
+		WillReturnRows(sqlmock.NewRows(activityColumns).AddRow(a1...))
+
+	second := fetch("?limit=2&cursor=" + first.NextCursor)
+	if len(second.Activities) != 1 || second.Activities[0].ID != "a1" {
+		t.Fatalf("unexpected second page: %+v", second.Activities)
+	}
+	if second.NextCursor != "" {
+		t.Errorf("expected no next_cursor on last page, got %q", second.NextCursor)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListHandler_InvalidCursor(t *testing.T) {
+	repo, _ := newMockRepo(t)
+	router := setupTestRouter("test-user-id")
+	activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/activities?cursor=not-a-cursor!", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestSearchHandler(t *testing.T) {
+	t.Run("empty query", func(t *testing.T) {
+		repo, _ := newMockRepo(t)
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/search?q=%20", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("results are scoped to the caller", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+
+		// The caller's id is bound as $1 alongside the text query, so another
+		// user's "morning" run can never satisfy the WHERE clause.
+		mock.ExpectQuery(`WHERE user_id = \$1 AND deleted_at IS NULL\s+AND to_tsvector\(.+\) @@ plainto_tsquery\('english', \$2\)\s+ORDER BY ts_rank`).
+			WithArgs("test-user-id", "morning'; DROP TABLE activities;--", 20, 0).
+			WillReturnRows(sqlmock.NewRows(activityColumns).AddRow(activityRow("a1", "test-user-id", start, 5000, 1500)...))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/search?q=morning%27%3B%20DROP%20TABLE%20activities%3B--", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp struct {
+			Activities []activities.Activity `json:"activities"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal failed: %v", err)
+		}
+		for _, a := range resp.Activities {
+			if a.UserID != "test-user-id" {
+				t.Errorf("activity %s belongs to %s", a.ID, a.UserID)
+			}
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestNearbyHandler(t *testing.T) {
+	t.Run("invalid parameters", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			query string
+		}{
+			{"missing lat", "?lng=-0.12&radius_km=2"},
+			{"lat out of range", "?lat=91&lng=-0.12&radius_km=2"},
+			{"lng out of range", "?lat=51.5&lng=181&radius_km=2"},
+			{"not a number", "?lat=abc&lng=-0.12&radius_km=2"},
+			{"missing radius", "?lat=51.5&lng=-0.12"},
+			{"zero radius", "?lat=51.5&lng=-0.12&radius_km=0"},
+			{"radius too large", "?lat=51.5&lng=-0.12&radius_km=51"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				repo, _ := newMockRepo(t)
+				router := setupTestRouter("test-user-id")
+				activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/nearby"+tt.query, nil))
+				if w.Code != http.StatusBadRequest {
+					t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+				}
+			})
+		}
+	})
+
+	t.Run("radius filter", func(t *testing.T) {
+		// sqlmock can't evaluate ST_DWithin, so this checks what reaches it:
+		// radius_km=1.5 must be passed as $4 in meters.
+		lat, lng := 51.5, -0.12
+		repo, mock := newMockRepo(t)
+		start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+		mock.ExpectQuery(`WHERE user_id = \$1 AND deleted_at IS NULL AND is_private = FALSE\s+AND ST_DWithin\(\s+route_path::geography,\s+ST_SetSRID\(ST_MakePoint\(\$2, \$3\), 4326\)::geography,\s+\$4`).
+			WithArgs("test-user-id", lng, lat, 1500.0, 20).
+			WillReturnRows(sqlmock.NewRows(activityColumns).AddRow(activityRow("inside", "test-user-id", start, 5000, 1500)...))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/nearby?lat=51.5&lng=-0.12&radius_km=1.5", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestExportGPXHandler(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+
+	t.Run("round-trips stored points", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		raw := `[{"lat":37.7749,"lng":-122.4194,"elevation":12,"timestamp":1710484200000},
+			{"lat":37.7755,"lng":-122.4190,"elevation":14,"timestamp":1710484210000},
+			{"lat":37.7761,"lng":-122.4185,"timestamp":1710484220000}]`
+
+		mock.ExpectQuery("FROM activities").
+			WithArgs("a1", "test-user-id").
+			WillReturnRows(sqlmock.NewRows(activityColumns).AddRow(activityRow("a1", "test-user-id", start, 150, 20)...))
+		mock.ExpectQuery("SELECT raw_gps_points, ST_AsText\\(route_path\\)").
+			WithArgs("a1", "test-user-id").
+			WillReturnRows(sqlmock.NewRows([]string{"raw_gps_points", "st_astext"}).AddRow([]byte(raw), nil))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/a1/export.gpx", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/gpx+xml" {
+			t.Errorf("Content-Type: got %q", ct)
+		}
+		if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="run-a1.gpx"` {
+			t.Errorf("Content-Disposition: got %q", cd)
+		}
+
+		var doc utils.GPX
+		if err := xml.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+			t.Fatalf("re-import: %v", err)
+		}
+		if len(doc.Tracks) != 1 || len(doc.Tracks[0].Segments) != 1 {
+			t.Fatalf("unexpected structure: %+v", doc)
+		}
+		pts := doc.Tracks[0].Segments[0].Points
+		if len(pts) != 3 {
+			t.Fatalf("expected 3 points, got %d", len(pts))
+		}
+		if pts[0].Ele == nil || *pts[0].Ele != 12 || pts[0].Time != "2024-03-15T06:30:00Z" {
+			t.Errorf("first point lost elevation/time: %+v", pts[0])
+		}
+		if pts[2].Ele != nil {
+			t.Errorf("expected no elevation on last point, got %v", *pts[2].Ele)
+		}
+		if doc.Tracks[0].Type != "run" {
+			t.Errorf("track type: got %q", doc.Tracks[0].Type)
+		}
+	})
+
+	t.Run("no stored route", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("FROM activities").
+			WithArgs("a1", "test-user-id").
+			WillReturnRows(sqlmock.NewRows(activityColumns).AddRow(activityRow("a1", "test-user-id", start, 5000, 1500)...))
+		mock.ExpectQuery("SELECT raw_gps_points").
+			WithArgs("a1", "test-user-id").
+			WillReturnRows(sqlmock.NewRows([]string{"raw_gps_points", "st_astext"}).AddRow(nil, nil))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/a1/export.gpx", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestHeartRateZonesHandler(t *testing.T) {
+	t.Run("explicit max_hr", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("SELECT heart_rate_stream FROM activities").
+			WithArgs("a1", "test-user-id").
+			WillReturnRows(sqlmock.NewRows([]string{"heart_rate_stream"}).
+				AddRow([]byte(`[{"bpm":100},{"bpm":140},{"bpm":171},{"bpm":190}]`)))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/a1/hr-zones?max_hr=190", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var resp struct {
+			MaxHR int `json:"max_hr"`
+			Zones []struct {
+				Zone    int     `json:"zone"`
+				MinBPM  int     `json:"min_bpm"`
+				Seconds float64 `json:"seconds"`
+			} `json:"zones"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if resp.MaxHR != 190 || len(resp.Zones) != 5 {
+			t.Fatalf("unexpected response: %+v", resp)
+		}
+		want := []float64{1, 0, 1, 0, 2}
+		for i, z := range resp.Zones {
+			if z.Seconds != want[i] {
+				t.Errorf("zone %d: got %v seconds, want %v", z.Zone, z.Seconds, want[i])
+			}
+		}
+	})
+
+	t.Run("estimated from profile age", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("SELECT age, weight_kg FROM user_profiles").
+			WithArgs("test-user-id").
+			WillReturnRows(sqlmock.NewRows([]string{"age", "weight_kg"}).AddRow(40, nil))
+		mock.ExpectQuery("SELECT heart_rate_stream FROM activities").
+			WithArgs("a1", "test-user-id").
+			WillReturnRows(sqlmock.NewRows([]string{"heart_rate_stream"}).AddRow(nil))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/a1/hr-zones", nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"max_hr":180`) {
+			t.Errorf("expected 200 with max_hr 180, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("no age and no max_hr", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("SELECT age, weight_kg FROM user_profiles").
+			WithArgs("test-user-id").
+			WillReturnRows(sqlmock.NewRows([]string{"age", "weight_kg"}).AddRow(nil, 70.0))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/a1/hr-zones", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestStreamsHandler(t *testing.T) {
+	points := `[{"lat":51.500,"lng":-0.12,"elevation":10,"timestamp":1700000000000},
+		{"lat":51.501,"lng":-0.12,"elevation":12,"timestamp":1700000030000},
+		{"lat":51.502,"lng":-0.12,"elevation":11,"timestamp":1700000060000}]`
+	serve := func(h *activities.Handler, url string) *httptest.ResponseRecorder {
+		router := setupTestRouter("test-user-id")
+		h.RegisterRoutes(router.Group("/activities"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+	decode := func(t *testing.T, w *httptest.ResponseRecorder) map[string][]float64 {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Streams map[string][]float64 `json:"streams"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return resp.Streams
+	}
+
+	t.Run("all keys are equal length", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("SELECT raw_gps_points FROM activities").
+			WithArgs("a1", "test-user-id").
+			WillReturnRows(sqlmock.NewRows([]string{"raw_gps_points"}).AddRow([]byte(points)))
+		mock.ExpectQuery("SELECT heart_rate_stream FROM activities").
+			WithArgs("a1", "test-user-id").
+			WillReturnRows(sqlmock.NewRows([]string{"heart_rate_stream"}).
+				AddRow([]byte(`[{"timestamp":1700000000000,"bpm":120},{"timestamp":1700000040000,"bpm":150}]`)))
+
+		streams := decode(t, serve(activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()), "/activities/a1/streams"))
+		for _, key := range []string{"time", "distance", "altitude", "heartrate", "velocity"} {
+			if len(streams[key]) != 3 {
+				t.Errorf("%s: got %v, want 3 entries", key, streams[key])
+			}
+		}
+	})
+
+	t.Run("subset skips the heart rate query", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("SELECT raw_gps_points FROM activities").
+			WithArgs("a1", "test-user-id").
+			WillReturnRows(sqlmock.NewRows([]string{"raw_gps_points"}).AddRow([]byte(points)))
+
+		streams := decode(t, serve(activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()), "/activities/a1/streams?keys=altitude,velocity"))
+		if len(streams) != 3 || len(streams["altitude"]) != 3 || len(streams["velocity"]) != 3 {
+			t.Errorf("unexpected streams: %v", streams)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		repo, _ := newMockRepo(t)
+		w := serve(activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()), "/activities/a1/streams?keys=distance,power")
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "power") {
+			t.Errorf("expected 400 naming the key, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("missing activity", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("SELECT raw_gps_points FROM activities").
+			WithArgs("a1", "test-user-id").
+			WillReturnRows(sqlmock.NewRows([]string{"raw_gps_points"}))
+
+		w := serve(activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()), "/activities/a1/streams")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", w.Code)
+		}
+	})
+}
+
+func TestGetByIDHandler_Calories(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		weight       driver.Value
+		wantCalories *float64
+	}{
+		{"with weight", 70.0, func() *float64 { v := 725.0; return &v }()},
+		{"without weight", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			mock.ExpectQuery("FROM activities").
+				WithArgs("a1", "test-user-id").
+				WillReturnRows(sqlmock.NewRows(activityColumns).AddRow(activityRow("a1", "test-user-id", start, 10000, 3000)...))
+			mock.ExpectQuery("SELECT age, weight_kg FROM user_profiles").
+				WithArgs("test-user-id").
+				WillReturnRows(sqlmock.NewRows([]string{"age", "weight_kg"}).AddRow(nil, tt.weight))
+			mock.ExpectQuery("SELECT raw_gps_points FROM activities").
+				WillReturnRows(sqlmock.NewRows([]string{"raw_gps_points"}).AddRow(nil))
+
+			router := setupTestRouter("test-user-id")
+			activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/a1", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var got activities.Activity
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			switch {
+			case tt.wantCalories == nil && got.Calories != nil:
+				t.Errorf("expected no calories, got %v", *got.Calories)
+			case tt.wantCalories != nil && (got.Calories == nil || *got.Calories != *tt.wantCalories):
+				t.Errorf("expected %v calories, got %v", *tt.wantCalories, got.Calories)
+			}
+		})
+	}
+}
+
+func TestGetByIDHandler_DataQuality(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	ms := start.UnixMilli()
+	tests := []struct {
+		name     string
+		points   string
+		wantGaps int // -1: no data_quality
+	}{
+		{"clean route", fmt.Sprintf(`[{"lat":51.5,"lng":-0.12,"timestamp":%d},{"lat":51.501,"lng":-0.12,"timestamp":%d}]`, ms, ms+5000), 0},
+		{"five-minute gap", fmt.Sprintf(`[{"lat":51.5,"lng":-0.12,"timestamp":%d},{"lat":51.501,"lng":-0.12,"timestamp":%d},{"lat":51.502,"lng":-0.12,"timestamp":%d}]`, ms, ms+5000, ms+305000), 1},
+		{"untimed route", `[{"lat":51.5,"lng":-0.12},{"lat":51.501,"lng":-0.12}]`, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			mock.ExpectQuery("FROM activities").
+				WithArgs("a1", "test-user-id").
+				WillReturnRows(sqlmock.NewRows(activityColumns).AddRow(activityRow("a1", "test-user-id", start, 5000, 1500)...))
+			mock.ExpectQuery("SELECT age, weight_kg FROM user_profiles").
+				WillReturnRows(sqlmock.NewRows([]string{"age", "weight_kg"}).AddRow(nil, nil))
+			mock.ExpectQuery("SELECT raw_gps_points FROM activities").
+				WithArgs("a1", "test-user-id").
+				WillReturnRows(sqlmock.NewRows([]string{"raw_gps_points"}).AddRow([]byte(tt.points)))
+
+			router := setupTestRouter("test-user-id")
+			activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/a1", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var got activities.Activity
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if tt.wantGaps < 0 {
+				if got.DataQuality != nil {
+					t.Errorf("expected no data_quality, got %+v", got.DataQuality)
+				}
+				return
+			}
+			if got.DataQuality == nil || got.DataQuality.GapCount != tt.wantGaps || len(got.DataQuality.Gaps) != tt.wantGaps {
+				t.Fatalf("data_quality = %+v, want %d gaps", got.DataQuality, tt.wantGaps)
+			}
+			if tt.wantGaps == 1 && got.DataQuality.Gaps[0].DurationSeconds != 300 {
+				t.Errorf("gap = %+v, want 300s", got.DataQuality.Gaps[0])
+			}
+		})
+	}
+}
+
+func TestGetByIDHandler_ETag(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	repo, mock := newMockRepo(t)
+	router := setupTestRouter("test-user-id")
+	activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+	expectActivity := func(updatedAt time.Time) {
+		row := activityRow("a1", "test-user-id", start, 5000, 1500)
+		row[17] = updatedAt
+		mock.ExpectQuery("FROM activities").
+			WithArgs("a1", "test-user-id").
+			WillReturnRows(sqlmock.NewRows(activityColumns).AddRow(row...))
+	}
+	expectExtras := func() {
+		mock.ExpectQuery("SELECT age, weight_kg FROM user_profiles").
+			WillReturnRows(sqlmock.NewRows([]string{"age", "weight_kg"}).AddRow(nil, nil))
+		mock.ExpectQuery("SELECT raw_gps_points FROM activities").
+			WillReturnRows(sqlmock.NewRows([]string{"raw_gps_points"}).AddRow(nil))
+	}
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	expectActivity(start)
+	expectExtras()
+	first := get("/activities/a1", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first GET: code %d, ETag %q", first.Code, etag)
+	}
+
+	// A match skips the calorie and GPS lookups entirely.
+	expectActivity(start)
+	w := get("/activities/a1", etag)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("304 has a body: %s", w.Body.String())
+	}
+	if w.Header().Get("ETag") != etag {
+		t.Errorf("304 ETag = %q, want %q", w.Header().Get("ETag"), etag)
+	}
+
+	expectActivity(start)
+	if w := get("/activities/a1", `"other", `+etag); w.Code != http.StatusNotModified {
+		t.Errorf("etag in a list: expected 304, got %d", w.Code)
+	}
+
+	// An update bumps updated_at, so the old ETag no longer matches.
+	expectActivity(start.Add(time.Minute))
+	expectExtras()
+	w = get("/activities/a1", etag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("after update: expected 200, got %d", w.Code)
+	}
+	if w.Header().Get("ETag") == etag {
+		t.Error("ETag unchanged after update")
+	}
+
+	// Imperial is a different representation.
+	expectActivity(start)
+	expectExtras()
+	if w := get("/activities/a1?units=imperial", etag); w.Code != http.StatusOK {
+		t.Errorf("imperial with metric ETag: expected 200, got %d", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetByIDHandler_Units(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+
+	t.Run("imperial converts distance, pace, speed and elevation", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		row := activityRow("a1", "test-user-id", start, 1609.344, 600) // a 10:00 mile
+		row[9], row[10], row[11] = 10/1.609344, 9.656064, 30.48        // 10:00/mi, 6 mph, 100 ft
+		mock.ExpectQuery("FROM activities").
+			WithArgs("a1", "test-user-id").
+			WillReturnRows(sqlmock.NewRows(activityColumns).AddRow(row...))
+		mock.ExpectQuery("SELECT age, weight_kg FROM user_profiles").
+			WillReturnRows(sqlmock.NewRows([]string{"age", "weight_kg"}).AddRow(nil, nil))
+		mock.ExpectQuery("SELECT raw_gps_points FROM activities").
+			WillReturnRows(sqlmock.NewRows([]string{"raw_gps_points"}).AddRow(nil))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/a1?units=imperial", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var raw map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if _, ok := raw["distance_meters"]; ok {
+			t.Error("imperial response still has distance_meters")
+		}
+		var got activities.ImperialActivity
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if math.Abs(got.DistanceMiles-1) > 1e-9 {
+			t.Errorf("distance = %v mi, want 1", got.DistanceMiles)
+		}
+		if got.AvgPaceMinPerMile == nil || math.Abs(*got.AvgPaceMinPerMile-10) > 1e-9 {
+			t.Errorf("pace = %v min/mi, want 10", got.AvgPaceMinPerMile)
+		}
+		if got.MaxSpeedMph == nil || math.Abs(*got.MaxSpeedMph-6) > 1e-9 {
+			t.Errorf("max speed = %v mph, want 6", got.MaxSpeedMph)
+		}
+		if got.ElevationGainFeet == nil || math.Abs(*got.ElevationGainFeet-100) > 1e-9 {
+			t.Errorf("elevation gain = %v ft, want 100", got.ElevationGainFeet)
+		}
+	})
+
+	t.Run("unknown units", func(t *testing.T) {
+		repo, _ := newMockRepo(t)
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/a1?units=furlongs", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestCreateHandler_RejectsInvalidRoute(t *testing.T) {
+	body := func(points string) string {
+		return `{"activity_name":"Run","activity_type":"run","start_time":"2024-03-15T06:30:00Z",
+			"duration_seconds":1800,"distance_meters":5000,"raw_gps_points":` + points + `}`
+	}
+	tests := []struct {
+		name   string
+		points string
+	}{
+		{"latitude out of range", `[{"lat":200,"lng":0}]`},
+		{"longitude out of range", `[{"lat":0,"lng":181}]`},
+		{"timestamps go backwards", `[{"lat":0,"lng":0,"timestamp":2000},{"lat":0,"lng":0.001,"timestamp":1000}]`},
+		{"not a list of points", `"51.5,-0.12"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			router := setupTestRouter("test-user-id")
+			activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/activities", strings.NewReader(body(tt.points)))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCreateHandler_Duplicate(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	body := `{"activity_name":"Morning Run","activity_type":"run","start_time":"2024-03-15T06:31:00Z","duration_seconds":1500,"distance_meters":5000}`
+
+	t.Run("conflict returns existing id", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("AND start_time BETWEEN").
+			WillReturnRows(sqlmock.NewRows(activityColumns).AddRow(activityRow("existing-1", "test-user-id", start, 5020, 1500)...))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/activities", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d: %s", w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), `"activity_id":"existing-1"`) {
+			t.Errorf("expected existing activity id in body: %s", w.Body.String())
+		}
+	})
+
+	t.Run("force skips detection", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("INSERT INTO activities").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("new-1", start, start))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/activities?force=true", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+}
+
+func TestCreateHandler_IdempotencyKey(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	body := `{"activity_name":"Morning Run","activity_type":"run","start_time":"2024-03-15T06:31:00Z","duration_seconds":1500,"distance_meters":5000}`
+
+	newRouter := func(t *testing.T, withRedis bool) (*gin.Engine, sqlmock.Sqlmock) {
+		t.Helper()
+		repo, mock := newMockRepo(t)
+		var rds *database.Redis
+		if withRedis {
+			mr := miniredis.RunT(t)
+			var err error
+			if rds, err = database.NewRedis(mr.Addr(), "", 0, 5, zap.NewNop()); err != nil {
+				t.Fatalf("redis: %v", err)
+			}
+			t.Cleanup(func() { rds.Close() })
+		}
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, rds, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+		return router, mock
+	}
+	post := func(router *gin.Engine, key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/activities?force=true", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(activities.HeaderIdempotencyKey, key)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	expectInsert := func(mock sqlmock.Sqlmock, id string) {
+		mock.ExpectQuery("INSERT INTO activities").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(id, start, start))
+	}
+	createdID := func(t *testing.T, w *httptest.ResponseRecorder) string {
+		t.Helper()
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var a activities.Activity
+		if err := json.Unmarshal(w.Body.Bytes(), &a); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return a.ID
+	}
+
+	t.Run("replayed key returns the original response", func(t *testing.T) {
+		router, mock := newRouter(t, true)
+		expectInsert(mock, "new-1") // only one insert
+
+		first := post(router, "upload-123")
+		replay := post(router, "upload-123")
+		if got := createdID(t, replay); got != "new-1" {
+			t.Errorf("replayed id = %q, want new-1", got)
+		}
+		if first.Body.String() != replay.Body.String() {
+			t.Errorf("replay differs:\nfirst:  %s\nreplay: %s", first.Body.String(), replay.Body.String())
+		}
+		if replay.Header().Get("Idempotent-Replayed") != "true" {
+			t.Error("expected Idempotent-Replayed header on the replay")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("different key creates a new activity", func(t *testing.T) {
+		router, mock := newRouter(t, true)
+		expectInsert(mock, "new-1")
+		expectInsert(mock, "new-2")
+
+		if got := createdID(t, post(router, "upload-1")); got != "new-1" {
+			t.Errorf("first id = %q", got)
+		}
+		if got := createdID(t, post(router, "upload-2")); got != "new-2" {
+			t.Errorf("second id = %q, want new-2", got)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("failed request can be retried with its key", func(t *testing.T) {
+		router, mock := newRouter(t, true)
+		mock.ExpectQuery("INSERT INTO activities").WillReturnError(errors.New("connection reset"))
+		expectInsert(mock, "new-1")
+
+		if w := post(router, "upload-1"); w.Code != http.StatusInternalServerError {
+			t.Fatalf("expected 500, got %d", w.Code)
+		}
+		if got := createdID(t, post(router, "upload-1")); got != "new-1" {
+			t.Errorf("retried id = %q, want new-1", got)
+		}
+	})
+
+	t.Run("without redis every request inserts", func(t *testing.T) {
+		router, mock := newRouter(t, false)
+		expectInsert(mock, "new-1")
+		expectInsert(mock, "new-2")
+
+		createdID(t, post(router, "upload-1"))
+		if got := createdID(t, post(router, "upload-1")); got != "new-2" {
+			t.Errorf("second id = %q, want new-2", got)
+		}
+	})
+
+	t.Run("key too long", func(t *testing.T) {
+		router, _ := newRouter(t, true)
+		if w := post(router, strings.Repeat("k", 256)); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("reused key with a different body is rejected", func(t *testing.T) {
+		router, mock := newRouter(t, true)
+		expectInsert(mock, "new-1") // only one insert
+
+		createdID(t, post(router, "upload-1"))
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/activities?force=true",
+			strings.NewReader(strings.Replace(body, `"distance_meters":5000`, `"distance_meters":8000`, 1)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(activities.HeaderIdempotencyKey, "upload-1")
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("response is stored after the client disconnects", func(t *testing.T) {
+		router, mock := newRouter(t, true)
+		expectInsert(mock, "new-1") // only one insert
+
+		// The request context is cancelled as the response is written, as
+		// when the client drops before reading it.
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		w := &cancelOnWrite{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+		req := httptest.NewRequest("POST", "/activities?force=true", strings.NewReader(body)).WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(activities.HeaderIdempotencyKey, "upload-1")
+		router.ServeHTTP(w, req)
+		createdID(t, w.ResponseRecorder)
+
+		replay := post(router, "upload-1")
+		if got := createdID(t, replay); got != "new-1" {
+			t.Errorf("retried id = %q, want the replayed new-1", got)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// cancelOnWrite cancels the request context once the response status is
+// written.
+type cancelOnWrite struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (w *cancelOnWrite) WriteHeader(code int) {
+	w.cancel()
+	w.ResponseRecorder.WriteHeader(code)
+}
+
+func TestPatchHandler(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	where := "\n\t\tWHERE id = "
+
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		wantSet  string // exact SET list; empty expects no query
+		wantArgs []driver.Value
+		wantCode int
+	}{
+		{
+			name:     "absent fields are untouched",
+			method:   "PATCH",
+			body:     `{"activity_type":"walk"}`,
+			wantSet:  "SET activity_type = $1",
+			wantArgs: []driver.Value{"walk", "a1", "test-user-id"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "explicit null clears and values are applied",
+			method:   "PATCH",
+			body:     `{"description":null,"max_heart_rate":172}`,
+			wantSet:  "SET description = $1, max_heart_rate = $2",
+			wantArgs: []driver.Value{nil, 172, "a1", "test-user-id"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "start time shifts end time",
+			method:   "PATCH",
+			body:     `{"start_time":"2024-03-15T07:30:00Z"}`,
+			wantSet:  "SET start_time = $1, end_time = end_time + ($1::timestamptz - start_time)",
+			wantArgs: []driver.Value{start.Add(time.Hour), "a1", "test-user-id"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "PUT ignores null",
+			method:   "PUT",
+			body:     `{"activity_name":"Renamed","description":null}`,
+			wantSet:  "SET activity_name = $1",
+			wantArgs: []driver.Value{"Renamed", "a1", "test-user-id"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "activity type is re-validated",
+			method:   "PATCH",
+			body:     `{"activity_type":"swim"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "non-nullable field sent as null",
+			method:   "PATCH",
+			body:     `{"activity_name":null}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "malformed body",
+			method:   "PATCH",
+			body:     `{"activity_name":`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			if tt.wantSet != "" {
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE activities " + tt.wantSet + where)).
+					WithArgs(tt.wantArgs...).
+					WillReturnRows(sqlmock.NewRows(activityColumns).AddRow(activityRow("a1", "test-user-id", start, 5000, 1500)...))
+			}
+
+			router := setupTestRouter("test-user-id")
+			activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, "/activities/a1", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestBulkDeleteHandler(t *testing.T) {
+	own1 := "11111111-1111-1111-1111-111111111111"
+	own2 := "22222222-2222-2222-2222-222222222222"
+	other := "33333333-3333-3333-3333-333333333333" // another user's activity
+
+	t.Run("other users' ids are skipped", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		// The caller is bound as $2, so the row owned by someone else never
+		// matches and only the caller's two activities are affected.
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE activities SET deleted_at = NOW()\n\t\tWHERE id = ANY($1) AND user_id = $2 AND deleted_at IS NULL")).
+			WithArgs([]string{own1, other, own2}, "test-user-id").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"ids":[%q,%q,%q]}`, own1, other, own2)
+		req := httptest.NewRequest("POST", "/activities/bulk-delete", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Deleted   int `json:"deleted"`
+			Requested int `json:"requested"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal failed: %v", err)
+		}
+		if resp.Deleted != 2 || resp.Requested != 3 {
+			t.Errorf("expected 2 of 3 deleted, got %+v", resp)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	tooMany := make([]string, activities.MaxBulkDelete+1)
+	for i := range tooMany {
+		tooMany[i] = own1
+	}
+	tooManyBody, _ := json.Marshal(map[string][]string{"ids": tooMany})
+
+	for _, tt := range []struct {
+		name string
+		body string
+	}{
+		{"missing ids", `{}`},
+		{"empty list", `{"ids":[]}`},
+		{"not a uuid", `{"ids":["a1"]}`},
+		{"over the cap", string(tooManyBody)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			router := setupTestRouter("test-user-id")
+			activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/activities/bulk-delete", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCompareHandler(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+
+	t.Run("deltas relative to a", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		// Rows come back in arbitrary order; b first here.
+		mock.ExpectQuery(regexp.QuoteMeta("WHERE user_id = $1 AND id = ANY($2)")).
+			WithArgs("test-user-id", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(activityColumns).
+				AddRow(activityRow("b", "test-user-id", start, 5500, 1650)...).
+				AddRow(activityRow("a", "test-user-id", start, 5000, 1500)...))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/compare?a=a&b=b", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var got activities.ActivityComparison
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if got.A != "a" || got.B != "b" {
+			t.Errorf("ids: got a=%s b=%s", got.A, got.B)
+		}
+		d := got.DistanceMeters
+		if *d.A != 5000 || *d.Delta != 500 || *d.DeltaPct != 10 {
+			t.Errorf("distance delta: %+v", d)
+		}
+		if *got.DurationSeconds.DeltaPct != 10 {
+			t.Errorf("duration delta pct: got %v", *got.DurationSeconds.DeltaPct)
+		}
+		// Same pace (5:00/km) on both.
+		if p := got.AvgPaceMinPerKm; p.Delta == nil || *p.Delta != 0 {
+			t.Errorf("pace delta: %+v", p)
+		}
+		// Neither has HR stored.
+		if got.AvgHeartRate.Delta != nil {
+			t.Errorf("expected nil HR delta, got %v", *got.AvgHeartRate.Delta)
+		}
+	})
+
+	t.Run("other user's activity", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("id = ANY").
+			WillReturnRows(sqlmock.NewRows(activityColumns).
+				AddRow(activityRow("a", "test-user-id", start, 5000, 1500)...))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities/compare?a=a&b=someone-elses", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", w.Code)
+		}
+	})
+}
+
+func TestSharedActivity(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+
+	t.Run("public view is privacy safe", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		row := activityRow("a1", "owner-uuid", start, 2000, 600)
+		row[13] = 151 // avg_heart_rate
+		mock.ExpectQuery(regexp.QuoteMeta("WHERE share_token = $1 AND deleted_at IS NULL")).
+			WithArgs("tok123").
+			WillReturnRows(sqlmock.NewRows(activityColumns).AddRow(row...))
+
+		// 2.88 km due north, a point every 120 m.
+		var pts []string
+		for i := 0; i <= 24; i++ {
+			pts = append(pts, fmt.Sprintf(`{"lat":%f,"lng":0}`, float64(i)*120/111194.9))
+		}
+		mock.ExpectQuery("SELECT raw_gps_points").
+			WithArgs("a1", "owner-uuid").
+			WillReturnRows(sqlmock.NewRows([]string{"raw_gps_points", "st_astext"}).
+				AddRow([]byte("["+strings.Join(pts, ",")+"]"), nil))
+
+		// No auth middleware: the public route must work anonymously.
+		router := gin.New()
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterPublicRoutes(router.Group("/public"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/public/activities/tok123", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		for _, field := range []string{"user_id", `"id"`, "heart_rate", "is_private", "owner-uuid"} {
+			if strings.Contains(w.Body.String(), field) {
+				t.Errorf("public response leaks %s: %s", field, w.Body.String())
+			}
+		}
+
+		var got activities.PublicActivity
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		// Points within 200 m of either end (2 at each end) are removed.
+		if len(got.Route) != 21 {
+			t.Errorf("expected 21 blurred points, got %d", len(got.Route))
+		}
+	})
+
+	t.Run("revoked token 404s", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE activities SET share_token = NULL")).
+			WithArgs("a1", "test-user-id").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("WHERE share_token = \\$1").
+			WithArgs("tok123").
+			WillReturnRows(sqlmock.NewRows(activityColumns))
+
+		h := activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop())
+		router := setupTestRouter("test-user-id")
+		h.RegisterRoutes(router.Group("/activities"))
+		h.RegisterPublicRoutes(router.Group("/public"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("DELETE", "/activities/a1/share", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("revoke: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/public/activities/tok123", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected 404 after revoke, got %d", w.Code)
+		}
+	})
+
+	t.Run("share returns token", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery(regexp.QuoteMeta("SET share_token = COALESCE(share_token, $3)")).
+			WithArgs("a1", "test-user-id", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"share_token"}).AddRow("tok123"))
+
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, nil, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/activities/a1/share", nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"token":"tok123"`) {
+			t.Errorf("expected token, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+type fakeWeather struct {
+	weather        *activities.Weather
+	err            error
+	gotLat, gotLng float64
+}
+
+func (f *fakeWeather) Lookup(_ context.Context, lat, lng float64, _ time.Time) (*activities.Weather, error) {
+	f.gotLat, f.gotLng = lat, lng
+	return f.weather, f.err
+}
+
+// jsonArg matches a jsonb argument by substring (or SQL NULL when empty).
+type jsonArg string
+
+func (j jsonArg) Match(v driver.Value) bool {
+	if j == "" {
+		return v == nil
+	}
+	s, ok := v.(string)
+	return ok && strings.Contains(s, string(j))
+}
+
+func TestCreateHandler_WeatherEnrichment(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	body := `{"activity_name":"Morning Run","activity_type":"run","start_time":"2024-03-15T06:30:00Z",
+		"duration_seconds":1500,"distance_meters":5000,
+		"raw_gps_points":[{"lat":51.50412,"lng":-0.12345},{"lat":51.51,"lng":-0.12}]}`
+
+	tests := []struct {
+		name        string
+		provider    *fakeWeather
+		wantWeather jsonArg
+	}{
+		{
+			name:        "stored from provider",
+			provider:    &fakeWeather{weather: &activities.Weather{TemperatureC: 11.5, HumidityPct: 80, WindSpeedKmh: 14}},
+			wantWeather: `"temperature_c":11.5`,
+		},
+		{
+			name:     "provider failure does not fail create",
+			provider: &fakeWeather{err: errors.New("provider down")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			args := make([]driver.Value, 19)
+			for i := range args {
+				args[i] = sqlmock.AnyArg()
+			}
+			args[17] = tt.wantWeather
+			// No home zone, so the raw points are stored as sent.
+			mock.ExpectQuery("FROM user_profiles").
+				WillReturnRows(sqlmock.NewRows([]string{"home_location", "privacy_radius_meters"}))
+			mock.ExpectQuery("INSERT INTO activities").
+				WithArgs(args...).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("a1", start, start))
+
+			router := setupTestRouter("test-user-id")
+			activities.NewHandler(repo, nil, nil, tt.provider, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/activities?force=true", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusCreated {
+				t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+			}
+			// Only the ~1km cell leaves the server, never the exact start.
+			if tt.provider.gotLat != 51.5 || tt.provider.gotLng != -0.12 {
+				t.Errorf("weather lookup got %v,%v, want the rounded 51.5,-0.12", tt.provider.gotLat, tt.provider.gotLng)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+type fakeGeocoder struct {
+	label    string
+	err      error
+	calls    int
+	lat, lng float64 // last coordinate looked up
+}
+
+func (f *fakeGeocoder) ReverseGeocode(_ context.Context, lat, lng float64) (string, error) {
+	f.calls++
+	f.lat, f.lng = lat, lng
+	return f.label, f.err
+}
+
+// textArg matches a nullable text argument (SQL NULL when empty).
+type textArg string
+
+func (s textArg) Match(v driver.Value) bool {
+	if s == "" {
+		return v == nil
+	}
+	got, ok := v.(string)
+	return ok && got == string(s)
+}
+
+func TestCreateHandler_StartLocation(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	body := `{"activity_name":"Morning Run","activity_type":"run","start_time":"2024-03-15T06:30:00Z",
+		"duration_seconds":1500,"distance_meters":5000,
+		"raw_gps_points":[{"lat":51.50412,"lng":-0.12345},{"lat":51.51,"lng":-0.12}]}`
+
+	tests := []struct {
+		name      string
+		geocoder  *fakeGeocoder
+		cached    string // pre-seeded label for the rounded start point
+		wantLabel textArg
+		wantCalls int
+	}{
+		{
+			name:      "stored from geocoder",
+			geocoder:  &fakeGeocoder{label: "London, United Kingdom"},
+			wantLabel: "London, United Kingdom",
+			wantCalls: 1,
+		},
+		{
+			name:      "geocoder failure leaves label nil",
+			geocoder:  &fakeGeocoder{err: errors.New("geocoder down")},
+			wantCalls: 1,
+		},
+		{
+			name:      "cached label skips the geocoder",
+			geocoder:  &fakeGeocoder{label: "Elsewhere"},
+			cached:    "London, United Kingdom",
+			wantLabel: "London, United Kingdom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			mr := miniredis.RunT(t)
+			rds, err := database.NewRedis(mr.Addr(), "", 0, 5, zap.NewNop())
+			if err != nil {
+				t.Fatalf("redis: %v", err)
+			}
+			t.Cleanup(func() { rds.Close() })
+			if tt.cached != "" {
+				// 51.5041 rounds to the same key as the 51.50412 start point.
+				if err := rds.SetGeocode(context.Background(), 51.5041, -0.1201, tt.cached, time.Hour); err != nil {
+					t.Fatalf("seed cache: %v", err)
+				}
+			}
+
+			args := make([]driver.Value, 19)
+			for i := range args {
+				args[i] = sqlmock.AnyArg()
+			}
+			args[18] = tt.wantLabel
+			// No home zone, so the raw points are stored as sent.
+			mock.ExpectQuery("FROM user_profiles").
+				WillReturnRows(sqlmock.NewRows([]string{"home_location", "privacy_radius_meters"}))
+			mock.ExpectQuery("INSERT INTO activities").
+				WithArgs(args...).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("a1", start, start))
+
+			router := setupTestRouter("test-user-id")
+			activities.NewHandler(repo, nil, rds, nil, tt.geocoder, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/activities?force=true", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusCreated {
+				t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+			}
+			if tt.geocoder.calls != tt.wantCalls {
+				t.Errorf("expected %d geocoder calls, got %d", tt.wantCalls, tt.geocoder.calls)
+			}
+			// Only the ~1km cell leaves the server, never the exact start.
+			if tt.geocoder.calls > 0 && (tt.geocoder.lat != 51.5 || tt.geocoder.lng != -0.12) {
+				t.Errorf("geocoder got %v,%v, want the rounded 51.5,-0.12", tt.geocoder.lat, tt.geocoder.lng)
+			}
+			var got activities.Activity
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("unmarshal failed: %v", err)
+			}
+			if tt.wantLabel == "" {
+				if got.StartLocation != nil {
+					t.Errorf("expected no start_location, got %q", *got.StartLocation)
+				}
+			} else if got.StartLocation == nil || *got.StartLocation != string(tt.wantLabel) {
+				t.Errorf("expected start_location %q, got %v", tt.wantLabel, got.StartLocation)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+type fakeMatcher struct {
+	called chan string
+
+	// MatchActivityTx writes one effort row, then fails with txErr.
+	txErr     error
+	committed bool
+}
+
+func (f *fakeMatcher) MatchActivity(_ context.Context, activityID string) error {
+	f.called <- activityID
+	return nil
+}
+
+func (f *fakeMatcher) MatchActivityTx(ctx context.Context, tx *sql.Tx, activityID string) (func(context.Context), error) {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO segment_efforts (activity_id) VALUES ($1)`, activityID); err != nil {
+		return nil, err
+	}
+	if f.txErr != nil {
+		return nil, f.txErr
+	}
+	return func(context.Context) { f.committed = true }, nil
+}
+
+func TestCreateHandler_TriggersSegmentMatching(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	body := `{"activity_name":"Morning Run","activity_type":"run","start_time":"2024-03-15T06:30:00Z",
+		"duration_seconds":1500,"distance_meters":5000,
+		"route_wkt":"SRID=4326;LINESTRING(-0.12 51.5,-0.12 51.51)","is_private":true}`
+
+	repo, mock := newMockRepo(t)
+	mock.ExpectQuery("INSERT INTO activities").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("a1", start, start))
+
+	matcher := &fakeMatcher{called: make(chan string, 1)}
+	router := setupTestRouter("test-user-id")
+	h := activities.NewHandler(repo, nil, nil, nil, nil, matcher, zap.NewNop())
+	h.RegisterRoutes(router.Group("/activities"))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/activities?force=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := h.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	select {
+	case id := <-matcher.called:
+		if id != "a1" {
+			t.Errorf("expected matching for a1, got %s", id)
+		}
+	default:
+		t.Fatal("segment matching had not run when Shutdown returned")
+	}
+}
+
+// blockingMatcher holds each background run until its context ends.
+type blockingMatcher struct {
+	started chan struct{}
+	stopped chan error
+}
+
+func (b *blockingMatcher) MatchActivity(ctx context.Context, _ string) error {
+	b.started <- struct{}{}
+	<-ctx.Done()
+	b.stopped <- ctx.Err()
+	return ctx.Err()
+}
+
+func (b *blockingMatcher) MatchActivityTx(context.Context, *sql.Tx, string) (func(context.Context), error) {
+	return nil, errors.New("not used")
+}
+
+func TestHandler_ShutdownBoundsSegmentMatching(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	body := `{"activity_name":"Morning Run","activity_type":"run","start_time":"2024-03-15T06:30:00Z",
+		"duration_seconds":1500,"distance_meters":5000,
+		"route_wkt":"SRID=4326;LINESTRING(-0.12 51.5,-0.12 51.51)","is_private":true}`
+
+	repo, mock := newMockRepo(t)
+	for _, id := range []string{"a1", "a2"} {
+		mock.ExpectQuery("INSERT INTO activities").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(id, start, start))
+	}
+
+	matcher := &blockingMatcher{started: make(chan struct{}, 2), stopped: make(chan error, 2)}
+	router := setupTestRouter("test-user-id")
+	h := activities.NewHandler(repo, nil, nil, nil, nil, matcher, zap.NewNop())
+	h.RegisterRoutes(router.Group("/activities"))
+	create := func() {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/activities?force=true", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	create()
+	<-matcher.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := h.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if err := <-matcher.stopped; !errors.Is(err, context.Canceled) {
+		t.Errorf("in-flight run should be cancelled, got %v", err)
+	}
+
+	// Uploads that finish after Shutdown don't start new runs.
+	create()
+	if err := h.Shutdown(context.Background()); err != nil {
+		t.Fatalf("second shutdown: %v", err)
+	}
+	select {
+	case <-matcher.started:
+		t.Error("matching started after shutdown")
+	default:
+	}
+}
+
+func TestCreateHandler_ActivityAndEffortsInOneTransaction(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	body := `{"activity_name":"Morning Run","activity_type":"run","start_time":"2024-03-15T06:30:00Z",
+		"duration_seconds":1500,"distance_meters":5000,
+		"route_wkt":"SRID=4326;LINESTRING(-0.12 51.5,-0.12 51.51)","is_private":true}`
+
+	tests := []struct {
+		name       string
+		matchErr   error
+		wantStatus int
+	}{
+		{"commits both", nil, http.StatusCreated},
+		{"failed match keeps the activity but not its efforts", errors.New("effort insert failed"), http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery("INSERT INTO activities").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("a1", start, start))
+			mock.ExpectExec("SAVEPOINT segment_matching").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("INSERT INTO segment_efforts").
+				WithArgs("a1").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			if tt.matchErr != nil {
+				mock.ExpectExec("ROLLBACK TO SAVEPOINT segment_matching").WillReturnResult(sqlmock.NewResult(0, 0))
+			} else {
+				mock.ExpectExec("RELEASE SAVEPOINT segment_matching").WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			mock.ExpectCommit()
+
+			matcher := &fakeMatcher{called: make(chan string, 1), txErr: tt.matchErr}
+			router := setupTestRouter("test-user-id")
+			h := activities.NewHandler(activities.NewRepository(db, zap.NewNop()), &database.DB{Pool: db}, nil, nil, nil, matcher, zap.NewNop())
+			h.RegisterRoutes(router.Group("/activities"))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/activities?force=true", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			// Both inserts ran on the transaction; a failed match is rolled
+			// back to its savepoint, so only the activity commits.
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			if matcher.committed != (tt.matchErr == nil) {
+				t.Errorf("after-commit hook ran = %v", matcher.committed)
+			}
+			// A failed match is retried in the background once committed.
+			if err := h.Shutdown(context.Background()); err != nil {
+				t.Fatalf("shutdown: %v", err)
+			}
+			select {
+			case <-matcher.called:
+				if tt.matchErr == nil {
+					t.Error("background matching should not run when a transaction is available")
+				}
+			default:
+				if tt.matchErr != nil {
+					t.Error("expected the failed match to be retried in the background")
+				}
+			}
+		})
+	}
+}
+
+func TestListHandler_RedisCache(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	row := activityRow("a1", "test-user-id", start, 5000, 1500)
+
+	newCachedRouter := func(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+		t.Helper()
+		repo, mock := newMockRepo(t)
+		mr := miniredis.RunT(t)
+		rds, err := database.NewRedis(mr.Addr(), "", 0, 5, zap.NewNop())
+		if err != nil {
+			t.Fatalf("redis: %v", err)
+		}
+		t.Cleanup(func() { rds.Close() })
+		router := setupTestRouter("test-user-id")
+		activities.NewHandler(repo, nil, rds, nil, nil, nil, zap.NewNop()).RegisterRoutes(router.Group("/activities"))
+		return router, mock
+	}
+	list := func(t *testing.T, router *gin.Engine, query string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/activities"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("list: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	t.Run("second request is served from cache", func(t *testing.T) {
+		router, mock := newCachedRouter(t)
+		// Only one database query is expected.
+		mock.ExpectQuery("FROM activities").
+			WillReturnRows(sqlmock.NewRows(listColumns).AddRow(listRow(1, row)...))
+
+		miss := list(t, router, "?limit=10")
+		hit := list(t, router, "?limit=10")
+		if miss != hit {
+			t.Errorf("cached body differs:\nmiss: %s\nhit:  %s", miss, hit)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("filters get their own entry", func(t *testing.T) {
+		router, mock := newCachedRouter(t)
+		mock.ExpectQuery("FROM activities").
+			WillReturnRows(sqlmock.NewRows(listColumns).AddRow(listRow(1, row)...))
+		mock.ExpectQuery("FROM activities").
+			WillReturnRows(sqlmock.NewRows(activityColumns))
+
+		list(t, router, "")
+		if body := list(t, router, "?type=bike"); !strings.Contains(body, `"total":0`) {
+			t.Errorf("expected the filtered list from the database, got %s", body)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("delete invalidates", func(t *testing.T) {
+		router, mock := newCachedRouter(t)
+		mock.ExpectQuery("FROM activities").
+			WillReturnRows(sqlmock.NewRows(listColumns).AddRow(listRow(1, row)...))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE activities SET deleted_at = NOW()")).
+			WithArgs("a1", "test-user-id").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("FROM activities").
+			WillReturnRows(sqlmock.NewRows(activityColumns))
+
+		list(t, router, "")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("DELETE", "/activities/a1", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("delete: expected 200, got %d", w.Code)
+		}
+		if body := list(t, router, ""); !strings.Contains(body, `"total":0`) {
+			t.Errorf("expected a fresh list after delete, got %s", body)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
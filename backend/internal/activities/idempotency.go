@@ -0,0 +1,113 @@
+package activities
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/database"
+)
+
+// HeaderIdempotencyKey lets clients retry POST /activities safely.
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// maxIdempotencyKeyLen bounds the header so keys stay cheap to store.
+const maxIdempotencyKeyLen = 255
+
+// idempotencyTTL is how long a created activity is replayed for its key;
+// idempotencyPendingTTL bounds a reservation whose request never finished.
+const (
+	idempotencyTTL        = 24 * time.Hour
+	idempotencyPendingTTL = time.Minute
+)
+
+// requestHash fingerprints a create request so a reused Idempotency-Key can
+// be told apart from a genuine retry.
+func requestHash(req *CreateActivityRequest) string {
+	body, _ := json.Marshal(req)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// beginIdempotent reserves the request's Idempotency-Key for the payload
+// hash. It returns the Redis key to pass to finishIdempotent, or "" when the
+// header is absent or Redis is unavailable (the request then proceeds
+// normally). done is true when a response has already been written: a
+// replay of the original result, or an error for an invalid, in-flight or
+// reused key.
+func (h *Handler) beginIdempotent(c *gin.Context, userID, hash string, imperial bool) (key string, done bool) {
+	header := c.GetHeader(HeaderIdempotencyKey)
+	if header == "" || h.redis == nil {
+		return "", false
+	}
+	if len(header) > maxIdempotencyKeyLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+		return "", true
+	}
+
+	key = database.IdempotencyKey(userID, header)
+	rec, reserved, err := h.redis.ReserveIdempotencyKey(c.Request.Context(), key, hash, idempotencyPendingTTL)
+	if err != nil {
+		h.logger.Warn("idempotency key reservation failed", zap.Error(err))
+		return "", false
+	}
+	if reserved {
+		return key, false
+	}
+	// Records stored before payload hashing have no hash and still replay.
+	if rec.RequestHash != "" && rec.RequestHash != hash {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Idempotency-Key was already used with a different request body",
+			"code":  "idempotency_key_reused",
+		})
+		return "", true
+	}
+	if rec.Status == 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "a request with this Idempotency-Key is still in progress",
+			"code":  "idempotency_key_in_use",
+		})
+		return "", true
+	}
+
+	var activity Activity
+	if err := json.Unmarshal(rec.Body, &activity); err != nil {
+		h.logger.Warn("decode idempotent response", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return "", true
+	}
+	c.Header("Idempotent-Replayed", "true")
+	c.JSON(rec.Status, activityView(&activity, imperial))
+	return "", true
+}
+
+// finishIdempotent stores the created activity under key, or releases the
+// reservation when activity is nil so the client can retry. It runs even if
+// the client has gone away, since a dropped connection is exactly when the
+// client will retry, so ctx's cancellation is ignored.
+func (h *Handler) finishIdempotent(ctx context.Context, key, hash string, activity *Activity) {
+	if key == "" {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	if activity == nil {
+		if err := h.redis.ReleaseIdempotencyKey(ctx, key); err != nil {
+			h.logger.Warn("idempotency key release failed", zap.Error(err))
+		}
+		return
+	}
+	body, err := json.Marshal(activity)
+	if err == nil {
+		err = h.redis.StoreIdempotentResponse(ctx, key,
+			database.IdempotencyRecord{Status: http.StatusCreated, Body: body, RequestHash: hash}, idempotencyTTL)
+	}
+	if err != nil {
+		h.logger.Warn("idempotent response store failed", zap.Error(err))
+	}
+}
@@ -1,7 +1,13 @@
 package activities
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
 	"time"
+
+	"github.com/apexrun/backend/pkg/utils"
 )
 
 // Activity represents a recorded GPS activity (matches DB schema).
@@ -24,37 +30,312 @@ type Activity struct {
 	IsPrivate           bool       `json:"is_private"`
 	CreatedAt           time.Time  `json:"created_at"`
 	UpdatedAt           time.Time  `json:"updated_at"`
+	Weather             *Weather   `json:"weather,omitempty"`
+	StartLocation       *string    `json:"start_location,omitempty"`
+	// Computed fields (not in DB)
+	Calories    *float64     `json:"calories,omitempty"`
+	DataQuality *DataQuality `json:"data_quality,omitempty"`
+}
+
+// DataQuality flags recording problems in an activity's GPS track.
+type DataQuality struct {
+	GapCount int         `json:"gap_count"`
+	Gaps     []utils.Gap `json:"gaps"`
 }
 
 // CreateActivityRequest is the request body for creating a new activity.
 type CreateActivityRequest struct {
-	ActivityName        string      `json:"activity_name" binding:"required"`
-	ActivityType        string      `json:"activity_type" binding:"required,oneof=run walk bike hike"`
-	Description         *string     `json:"description"`
-	StartTime           time.Time   `json:"start_time" binding:"required"`
-	EndTime             *time.Time  `json:"end_time"`
-	DurationSeconds     int         `json:"duration_seconds" binding:"required,gt=0"`
-	DistanceMeters      float64     `json:"distance_meters" binding:"required,gte=0"`
-	AvgPaceMinPerKm     *float64    `json:"avg_pace_min_per_km"`
-	MaxSpeedKmh         *float64    `json:"max_speed_kmh"`
-	ElevationGainMeters *float64    `json:"elevation_gain_meters"`
-	ElevationLossMeters *float64    `json:"elevation_loss_meters"`
-	AvgHeartRate        *int        `json:"avg_heart_rate"`
-	MaxHeartRate        *int        `json:"max_heart_rate"`
-	RawGPSPoints        interface{} `json:"raw_gps_points"`
-	RouteWKT            string      `json:"route_wkt"`
-	IsPrivate           bool        `json:"is_private"`
-}
-
-// UpdateActivityRequest allows partial updates.
+	ActivityName        string                  `json:"activity_name" binding:"required"`
+	ActivityType        string                  `json:"activity_type" binding:"required,oneof=run walk bike hike"`
+	Description         *string                 `json:"description"`
+	StartTime           time.Time               `json:"start_time" binding:"required"`
+	EndTime             *time.Time              `json:"end_time"`
+	DurationSeconds     int                     `json:"duration_seconds" binding:"required,gt=0"`
+	DistanceMeters      float64                 `json:"distance_meters" binding:"required,gte=0"`
+	AvgPaceMinPerKm     *float64                `json:"avg_pace_min_per_km"`
+	MaxSpeedKmh         *float64                `json:"max_speed_kmh"`
+	ElevationGainMeters *float64                `json:"elevation_gain_meters"`
+	ElevationLossMeters *float64                `json:"elevation_loss_meters"`
+	AvgHeartRate        *int                    `json:"avg_heart_rate"`
+	MaxHeartRate        *int                    `json:"max_heart_rate"`
+	RawGPSPoints        []utils.GPSPoint        `json:"raw_gps_points"`
+	HeartRateStream     []utils.HeartRateSample `json:"heart_rate_stream"`
+	RouteWKT            string                  `json:"route_wkt"`
+	IsPrivate           bool                    `json:"is_private"`
+	// Weather is filled server-side by the WeatherProvider, never by clients.
+	Weather *Weather `json:"-"`
+	// StartLocation is filled server-side by the Geocoder, never by clients.
+	StartLocation *string `json:"-"`
+}
+
+// MaxBatchActivities caps how many activities one batch request may create.
+const MaxBatchActivities = 100
+
+// BatchCreateRequest is the request body for creating many activities. Items
+// are decoded and validated one by one so a bad item fails on its own.
+type BatchCreateRequest struct {
+	Activities []json.RawMessage `json:"activities"`
+}
+
+// Batch item statuses.
+const (
+	BatchItemCreated = "created"
+	BatchItemFailed  = "failed"
+)
+
+// BatchItemResult is the outcome for one item of a batch, by its index in
+// the request.
+type BatchItemResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Code   string `json:"code,omitempty"` // e.g. duplicate_activity
+}
+
+// BatchCreateResponse reports every item plus overall counts.
+type BatchCreateResponse struct {
+	Results []BatchItemResult `json:"results"`
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+}
+
+// MaxBulkDelete caps how many activities one bulk delete may name.
+const MaxBulkDelete = 100
+
+// BulkDeleteRequest is the request body for deleting many activities.
+type BulkDeleteRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1,max=100,dive,uuid"`
+}
+
+// UpdateActivityRequest allows partial updates. A nil field is left
+// untouched unless Present records it as sent, in which case the nullable
+// columns (description and heart rates) are cleared.
 type UpdateActivityRequest struct {
-	ActivityName *string `json:"activity_name"`
-	Description  *string `json:"description"`
-	IsPrivate    *bool   `json:"is_private"`
+	ActivityName *string    `json:"activity_name"`
+	ActivityType *string    `json:"activity_type" binding:"omitempty,oneof=run walk bike hike"`
+	Description  *string    `json:"description"`
+	StartTime    *time.Time `json:"start_time"`
+	AvgHeartRate *int       `json:"avg_heart_rate"`
+	MaxHeartRate *int       `json:"max_heart_rate"`
+	IsPrivate    *bool      `json:"is_private"`
+	// Present holds the JSON fields a PATCH body contained; nil for PUT,
+	// where null means "leave unchanged".
+	Present map[string]bool `json:"-"`
 }
 
 // ListActivitiesParams are query parameters for listing activities.
+// From/To are parsed by the handler (RFC3339 or YYYY-MM-DD) rather than by
+// form binding, so date-only bounds work and a date-only To is inclusive.
 type ListActivitiesParams struct {
-	Limit  int `form:"limit,default=20"`
-	Offset int `form:"offset,default=0"`
+	Limit        int        `form:"limit,default=20"`
+	Offset       int        `form:"offset,default=0"`
+	ActivityType *string    `form:"type" binding:"omitempty,oneof=run walk bike hike"`
+	From         *time.Time `form:"-"`
+	To           *time.Time `form:"-"`
+	// Sort and Order pick List's ordering (default start_time desc). Cursor
+	// paging only supports the default.
+	Sort  string `form:"sort" binding:"omitempty,oneof=start_time distance duration"`
+	Order string `form:"order" binding:"omitempty,oneof=asc desc"`
+	// Cursor switches to keyset pagination (see Repository.ListByCursor).
+	Cursor *ActivityCursor `form:"-"`
+}
+
+// sortColumns maps ?sort= values to columns; only these reach ORDER BY.
+var sortColumns = map[string]string{
+	"start_time": "start_time",
+	"distance":   "distance_meters",
+	"duration":   "duration_seconds",
+}
+
+// page returns List's effective limit (1-100, default 20) and offset.
+func (p ListActivitiesParams) page() (limit, offset int) {
+	limit, offset = p.Limit, p.Offset
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// isDefaultSort reports whether params ask for the default start_time desc.
+func (p ListActivitiesParams) isDefaultSort() bool {
+	return (p.Sort == "" || p.Sort == "start_time") && (p.Order == "" || p.Order == "desc")
+}
+
+// orderBy returns the ORDER BY clause for params. Unknown values fall back
+// to the default, so unvalidated input never reaches the SQL; ties on
+// distance or duration go to the most recent activity, and id breaks any
+// remaining tie so offset pages don't overlap.
+func (p ListActivitiesParams) orderBy() string {
+	column, ok := sortColumns[p.Sort]
+	if !ok {
+		column = "start_time"
+	}
+	dir := "DESC"
+	if p.Order == "asc" {
+		dir = "ASC"
+	}
+	if column == "start_time" {
+		return "start_time " + dir + ", id " + dir
+	}
+	return column + " " + dir + ", start_time DESC, id DESC"
+}
+
+// ActivityCursor marks a position in (start_time DESC, id DESC) order for
+// keyset pagination. Clients treat its encoded form as opaque.
+type ActivityCursor struct {
+	StartTime time.Time
+	ID        string
+}
+
+// Encode returns the opaque base64 form of the cursor.
+func (c ActivityCursor) Encode() string {
+	raw := c.StartTime.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeActivityCursor parses a cursor produced by ActivityCursor.Encode.
+func DecodeActivityCursor(s string) (*ActivityCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, errors.New("invalid cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &ActivityCursor{StartTime: t, ID: id}, nil
+}
+
+// ActivityStats aggregates a user's activities over a time window.
+// ActivityType is set only when stats are grouped by type.
+type ActivityStats struct {
+	ActivityType             *string `json:"activity_type,omitempty"`
+	ActivityCount            int     `json:"activity_count"`
+	TotalDistanceMeters      float64 `json:"total_distance_meters"`
+	TotalDurationSeconds     int     `json:"total_duration_seconds"`
+	TotalElevationGainMeters float64 `json:"total_elevation_gain_meters"`
+	AvgPaceMinPerKm          float64 `json:"avg_pace_min_per_km"`
+}
+
+// UserMetrics holds the profile fields used for derived activity metrics.
+type UserMetrics struct {
+	Age      *int
+	WeightKg *float64
+}
+
+// PersonalRecord is a user's best result for one record category.
+// Distance records rank runs of at least that distance by average pace;
+// EstimatedSeconds is that pace applied to the record distance.
+type PersonalRecord struct {
+	Record              string    `json:"record"`
+	ActivityID          string    `json:"activity_id"`
+	AchievedAt          time.Time `json:"achieved_at"`
+	DistanceMeters      float64   `json:"distance_meters"`
+	DurationSeconds     int       `json:"duration_seconds"`
+	PaceMinPerKm        *float64  `json:"pace_min_per_km,omitempty"`
+	EstimatedSeconds    *int      `json:"estimated_seconds,omitempty"`
+	ElevationGainMeters *float64  `json:"elevation_gain_meters,omitempty"`
+}
+
+// Record categories besides the standard distances.
+const (
+	RecordLongestRun    = "longest_run"
+	RecordMostElevation = "most_elevation"
+)
+
+// MetricDelta compares one metric between two activities. Delta is B - A and
+// DeltaPct is relative to A; either is nil when a side is missing (or A is 0
+// for DeltaPct).
+type MetricDelta struct {
+	A        *float64 `json:"a"`
+	B        *float64 `json:"b"`
+	Delta    *float64 `json:"delta"`
+	DeltaPct *float64 `json:"delta_pct"`
+}
+
+// ActivityComparison is a side-by-side diff of two activities, relative to A.
+type ActivityComparison struct {
+	A                   string      `json:"a"`
+	B                   string      `json:"b"`
+	DistanceMeters      MetricDelta `json:"distance_meters"`
+	DurationSeconds     MetricDelta `json:"duration_seconds"`
+	AvgPaceMinPerKm     MetricDelta `json:"avg_pace_min_per_km"`
+	ElevationGainMeters MetricDelta `json:"elevation_gain_meters"`
+	AvgHeartRate        MetricDelta `json:"avg_heart_rate"`
+}
+
+// CompareActivities diffs b against a. Pace falls back to distance/duration
+// when not stored.
+func CompareActivities(a, b *Activity) ActivityComparison {
+	pace := func(x *Activity) *float64 {
+		if x.AvgPaceMinPerKm != nil {
+			return x.AvgPaceMinPerKm
+		}
+		if x.DistanceMeters <= 0 {
+			return nil
+		}
+		v := avgPaceMinPerKm(x.DistanceMeters, x.DurationSeconds)
+		return &v
+	}
+	hr := func(x *Activity) *float64 {
+		if x.AvgHeartRate == nil {
+			return nil
+		}
+		v := float64(*x.AvgHeartRate)
+		return &v
+	}
+	f := func(v float64) *float64 { return &v }
+
+	return ActivityComparison{
+		A:                   a.ID,
+		B:                   b.ID,
+		DistanceMeters:      newMetricDelta(f(a.DistanceMeters), f(b.DistanceMeters)),
+		DurationSeconds:     newMetricDelta(f(float64(a.DurationSeconds)), f(float64(b.DurationSeconds))),
+		AvgPaceMinPerKm:     newMetricDelta(pace(a), pace(b)),
+		ElevationGainMeters: newMetricDelta(a.ElevationGainMeters, b.ElevationGainMeters),
+		AvgHeartRate:        newMetricDelta(hr(a), hr(b)),
+	}
+}
+
+func newMetricDelta(a, b *float64) MetricDelta {
+	d := MetricDelta{A: a, B: b}
+	if a == nil || b == nil {
+		return d
+	}
+	delta := *b - *a
+	d.Delta = &delta
+	if *a != 0 {
+		pct := delta / *a * 100
+		d.DeltaPct = &pct
+	}
+	return d
+}
+
+// PublicActivity is the privacy-safe view served for share links. It omits
+// IDs, owner, heart rate and privacy flags; the route is blurred near its
+// start and end.
+type PublicActivity struct {
+	ActivityName        string        `json:"activity_name"`
+	ActivityType        string        `json:"activity_type"`
+	Description         *string       `json:"description,omitempty"`
+	DistanceMeters      float64       `json:"distance_meters"`
+	DurationSeconds     int           `json:"duration_seconds"`
+	AvgPaceMinPerKm     *float64      `json:"avg_pace_min_per_km,omitempty"`
+	ElevationGainMeters *float64      `json:"elevation_gain_meters,omitempty"`
+	StartTime           time.Time     `json:"start_time"`
+	Route               []PublicPoint `json:"route"`
+}
+
+// PublicPoint is a route coordinate without elevation or timestamp.
+type PublicPoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
 }
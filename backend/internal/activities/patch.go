@@ -0,0 +1,66 @@
+package activities
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/apexrun/backend/internal/auth"
+)
+
+// patchNonNullable are the PATCH fields backed by NOT NULL columns, so an
+// explicit null is rejected rather than silently ignored.
+var patchNonNullable = map[string]bool{
+	"activity_name": true,
+	"activity_type": true,
+	"start_time":    true,
+	"is_private":    true,
+}
+
+// Patch handles PATCH /api/v1/activities/:id
+// Unlike PUT, an explicit null clears description and the heart-rate
+// fields; absent fields are left untouched.
+func (h *Handler) Patch(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	imperial, ok := parseUnits(c)
+	if !ok {
+		return
+	}
+
+	req, err := parsePatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.update(c, userID, imperial, req)
+}
+
+// parsePatch decodes a PATCH body, recording which fields it contained.
+func parsePatch(c *gin.Context) (*UpdateActivityRequest, error) {
+	var fields map[string]json.RawMessage
+	if err := c.ShouldBindBodyWith(&fields, binding.JSON); err != nil {
+		return nil, err
+	}
+
+	var req UpdateActivityRequest
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		return nil, err
+	}
+
+	req.Present = make(map[string]bool, len(fields))
+	for name, raw := range fields {
+		if patchNonNullable[name] && bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			return nil, fmt.Errorf("%s cannot be null", name)
+		}
+		req.Present[name] = true
+	}
+	return &req, nil
+}
@@ -2,35 +2,102 @@ package activities
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math"
+	"time"
 
 	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/database"
+	"github.com/apexrun/backend/pkg/utils"
 )
 
 // Repository provides data access for activities.
 type Repository struct {
-	db     *sql.DB
-	logger *zap.Logger
+	db      database.Querier
+	logger  *zap.Logger
+	timeout time.Duration // per-call query timeout; 0 disables
 }
 
 // NewRepository creates a new activities repository.
-func NewRepository(db *sql.DB, logger *zap.Logger) *Repository {
+func NewRepository(db database.Querier, logger *zap.Logger) *Repository {
 	return &Repository{db: db, logger: logger}
 }
 
+// SetQueryTimeout bounds each repository call; 0 (the default) leaves calls
+// bounded only by the caller's context.
+func (r *Repository) SetQueryTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+func (r *Repository) queryCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	return database.WithQueryTimeout(ctx, r.timeout)
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *Repository) WithTx(tx *sql.Tx) *Repository {
+	return &Repository{db: tx, logger: r.logger, timeout: r.timeout}
+}
+
 // Create inserts a new activity and returns it with populated ID and timestamps.
 func (r *Repository) Create(ctx context.Context, userID string, req *CreateActivityRequest) (*Activity, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	// Privacy shroud: trim public routes and their raw points around the
+	// user's home zone.
+	routeWKT, gpsPoints := req.RouteWKT, req.RawGPSPoints
+	if !req.IsPrivate && (routeWKT != "" || len(gpsPoints) > 0) {
+		var err error
+		if routeWKT, gpsPoints, err = r.shroud(ctx, userID, routeWKT, gpsPoints); err != nil {
+			return nil, err
+		}
+	}
+
 	var gpsJSON interface{} // nil interface{} will be SQL NULL
-	if req.RawGPSPoints != nil {
-		data, err := json.Marshal(req.RawGPSPoints)
+	if len(gpsPoints) > 0 {
+		data, err := json.Marshal(gpsPoints)
 		if err != nil {
 			return nil, fmt.Errorf("marshal gps data: %w", err)
 		}
 		gpsJSON = string(data) // pass as string for jsonb column
 	}
 
+	var hrJSON interface{}
+	if len(req.HeartRateStream) > 0 {
+		data, err := json.Marshal(req.HeartRateStream)
+		if err != nil {
+			return nil, fmt.Errorf("marshal heart rate stream: %w", err)
+		}
+		hrJSON = string(data)
+	}
+
+	var weatherJSON interface{}
+	if req.Weather != nil {
+		data, err := json.Marshal(req.Weather)
+		if err != nil {
+			return nil, fmt.Errorf("marshal weather: %w", err)
+		}
+		weatherJSON = string(data)
+	}
+
+	// Derive pace/max speed server-side when the client omits them.
+	avgPace := req.AvgPaceMinPerKm
+	if avgPace == nil && req.DistanceMeters > 0 && req.DurationSeconds > 0 {
+		v := utils.PaceMinPerKmFloat(req.DistanceMeters, float64(req.DurationSeconds))
+		avgPace = &v
+	}
+	maxSpeed := req.MaxSpeedKmh
+	if maxSpeed == nil {
+		if v := utils.MaxSpeedKmh(req.RawGPSPoints); v > 0 {
+			maxSpeed = &v
+		}
+	}
+
 	query := `
 		INSERT INTO activities (
 			user_id, activity_name, activity_type, description,
@@ -38,16 +105,18 @@ func (r *Repository) Create(ctx context.Context, userID string, req *CreateActiv
 			avg_pace_min_per_km, max_speed_kmh,
 			elevation_gain_meters, elevation_loss_meters,
 			avg_heart_rate, max_heart_rate,
-			raw_gps_points, is_private
-		` + routeInsertColumn(req.RouteWKT) + `
+			raw_gps_points, is_private, heart_rate_stream,
+			weather, start_location
+		` + routeInsertColumn(routeWKT) + `
 		) VALUES (
 			$1, $2, $3, $4,
 			$5, $6, $7, $8,
 			$9, $10,
 			$11, $12,
 			$13, $14,
-			$15, $16
-		` + routeInsertValue(req.RouteWKT) + `
+			$15, $16, $17,
+			$18, $19
+		` + routeInsertValue(routeWKT) + `
 		)
 		RETURNING id, created_at, updated_at`
 
@@ -60,25 +129,28 @@ func (r *Repository) Create(ctx context.Context, userID string, req *CreateActiv
 		EndTime:             req.EndTime,
 		DurationSeconds:     req.DurationSeconds,
 		DistanceMeters:      req.DistanceMeters,
-		AvgPaceMinPerKm:     req.AvgPaceMinPerKm,
-		MaxSpeedKmh:         req.MaxSpeedKmh,
+		AvgPaceMinPerKm:     avgPace,
+		MaxSpeedKmh:         maxSpeed,
 		ElevationGainMeters: req.ElevationGainMeters,
 		ElevationLossMeters: req.ElevationLossMeters,
 		AvgHeartRate:        req.AvgHeartRate,
 		MaxHeartRate:        req.MaxHeartRate,
 		IsPrivate:           req.IsPrivate,
+		Weather:             req.Weather,
+		StartLocation:       req.StartLocation,
 	}
 
 	args := []interface{}{
 		userID, req.ActivityName, req.ActivityType, req.Description,
 		req.StartTime, req.EndTime, req.DurationSeconds, req.DistanceMeters,
-		req.AvgPaceMinPerKm, req.MaxSpeedKmh,
+		avgPace, maxSpeed,
 		req.ElevationGainMeters, req.ElevationLossMeters,
 		req.AvgHeartRate, req.MaxHeartRate,
-		gpsJSON, req.IsPrivate,
+		gpsJSON, req.IsPrivate, hrJSON,
+		weatherJSON, req.StartLocation,
 	}
-	if req.RouteWKT != "" {
-		args = append(args, req.RouteWKT)
+	if routeWKT != "" {
+		args = append(args, routeWKT)
 	}
 
 	err := r.db.QueryRowContext(ctx, query, args...).Scan(&a.ID, &a.CreatedAt, &a.UpdatedAt)
@@ -89,31 +161,221 @@ func (r *Repository) Create(ctx context.Context, userID string, req *CreateActiv
 	return a, nil
 }
 
+// CreateMany inserts reqs in one transaction and returns the activities in
+// order. Any insert failure rolls back the whole batch.
+func (r *Repository) CreateMany(ctx context.Context, userID string, reqs []*CreateActivityRequest) ([]*Activity, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	insert := func(repo *Repository) ([]*Activity, error) {
+		created := make([]*Activity, 0, len(reqs))
+		for i, req := range reqs {
+			a, err := repo.Create(ctx, userID, req)
+			if err != nil {
+				return nil, fmt.Errorf("activity %d: %w", i, err)
+			}
+			created = append(created, a)
+		}
+		return created, nil
+	}
+
+	pool, ok := r.db.(database.TxBeginner)
+	if !ok {
+		// Already bound to the caller's transaction.
+		return insert(r)
+	}
+	var created []*Activity
+	err := database.RunInTx(ctx, pool, func(tx *sql.Tx) error {
+		var err error
+		created, err = insert(r.WithTx(tx))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create activities: %w", err)
+	}
+	return created, nil
+}
+
 // activitySelectColumns is the standard column list for activity queries.
 const activitySelectColumns = `id, user_id, activity_name, activity_type, description,
 	start_time, end_time, duration_seconds, distance_meters,
 	avg_pace_min_per_km, max_speed_kmh,
 	elevation_gain_meters, elevation_loss_meters,
 	avg_heart_rate, max_heart_rate,
-	is_private, created_at, updated_at`
+	is_private, created_at, updated_at,
+	weather, start_location`
 
 // scanActivity scans a row into an Activity struct.
 func scanActivity(scanner interface{ Scan(...interface{}) error }, a *Activity) error {
-	return scanner.Scan(
+	var weather []byte
+	if err := scanner.Scan(
 		&a.ID, &a.UserID, &a.ActivityName, &a.ActivityType, &a.Description,
 		&a.StartTime, &a.EndTime, &a.DurationSeconds, &a.DistanceMeters,
 		&a.AvgPaceMinPerKm, &a.MaxSpeedKmh,
 		&a.ElevationGainMeters, &a.ElevationLossMeters,
 		&a.AvgHeartRate, &a.MaxHeartRate,
 		&a.IsPrivate, &a.CreatedAt, &a.UpdatedAt,
-	)
+		&weather, &a.StartLocation,
+	); err != nil {
+		return err
+	}
+	if len(weather) > 0 {
+		a.Weather = &Weather{}
+		if err := json.Unmarshal(weather, a.Weather); err != nil {
+			return fmt.Errorf("decode weather: %w", err)
+		}
+	}
+	return nil
+}
+
+// Duplicate detection window: uploads of the same activity from two sources
+// start within a couple of minutes and agree on distance to about 1%.
+const (
+	duplicateStartWindow    = 2 * time.Minute
+	duplicateDistanceTolPct = 0.01
+)
+
+// FindDuplicate returns the user's existing activity that starts within
+// ±2 minutes of startTime and is within ±1% of distanceMeters (both bounds
+// inclusive), preferring the closest start. Returns nil if none matches.
+func (r *Repository) FindDuplicate(ctx context.Context, userID string, startTime time.Time, distanceMeters float64) (*Activity, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	query := `SELECT ` + activitySelectColumns + `
+		FROM activities
+		WHERE user_id = $1 AND deleted_at IS NULL
+		  AND start_time BETWEEN $2 AND $3
+		  AND distance_meters BETWEEN $4 AND $5
+		ORDER BY ABS(EXTRACT(EPOCH FROM (start_time - $6::timestamptz))) ASC
+		LIMIT 1`
+
+	a := &Activity{}
+	err := scanActivity(r.db.QueryRowContext(ctx, query,
+		userID,
+		startTime.Add(-duplicateStartWindow), startTime.Add(duplicateStartWindow),
+		distanceMeters*(1-duplicateDistanceTolPct), distanceMeters*(1+duplicateDistanceTolPct),
+		startTime,
+	), a)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find duplicate activity: %w", err)
+	}
+	return a, nil
+}
+
+// FindDuplicates is FindDuplicate for many uploads in one query. The result
+// is parallel to reqs, with nil where an upload has no duplicate.
+func (r *Repository) FindDuplicates(ctx context.Context, userID string, reqs []*CreateActivityRequest) ([]*Activity, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	starts := make([]time.Time, len(reqs))
+	distances := make([]float64, len(reqs))
+	for i, req := range reqs {
+		starts[i], distances[i] = req.StartTime, req.DistanceMeters
+	}
+
+	query := `SELECT ` + activitySelectColumns + `, c.idx
+		FROM unnest($2::timestamptz[], $3::float8[]) WITH ORDINALITY AS c(want_start, want_distance, idx)
+		CROSS JOIN LATERAL (
+			SELECT ` + activitySelectColumns + `
+			FROM activities
+			WHERE user_id = $1 AND deleted_at IS NULL
+			  AND start_time BETWEEN c.want_start - $4 * INTERVAL '1 second'
+			                     AND c.want_start + $4 * INTERVAL '1 second'
+			  AND distance_meters BETWEEN c.want_distance * $5 AND c.want_distance * $6
+			ORDER BY ABS(EXTRACT(EPOCH FROM (start_time - c.want_start))) ASC
+			LIMIT 1
+		) a`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, starts, distances,
+		duplicateStartWindow.Seconds(), 1-duplicateDistanceTolPct, 1+duplicateDistanceTolPct)
+	if err != nil {
+		return nil, fmt.Errorf("find duplicate activities: %w", err)
+	}
+	defer rows.Close()
+
+	dups := make([]*Activity, len(reqs))
+	for rows.Next() {
+		a := &Activity{}
+		var idx int
+		if err := scanActivity(database.WithTrailing(rows, &idx), a); err != nil {
+			return nil, fmt.Errorf("scan activity: %w", err)
+		}
+		if idx >= 1 && idx <= len(dups) {
+			dups[idx-1] = a
+		}
+	}
+	return dups, rows.Err()
+}
+
+// duplicateIn applies FindDuplicate's rule to req against uploads accepted
+// earlier in the same batch, returning the index of the first match or -1.
+func duplicateIn(accepted []*CreateActivityRequest, req *CreateActivityRequest) int {
+	for i, prev := range accepted {
+		gap := req.StartTime.Sub(prev.StartTime)
+		if gap < -duplicateStartWindow || gap > duplicateStartWindow {
+			continue
+		}
+		if prev.DistanceMeters >= req.DistanceMeters*(1-duplicateDistanceTolPct) &&
+			prev.DistanceMeters <= req.DistanceMeters*(1+duplicateDistanceTolPct) {
+			return i
+		}
+	}
+	return -1
+}
+
+// shroud removes the route and raw GPS points inside the user's home zone
+// (user_profiles.home_location / privacy_radius_meters) via utils.BlurRoute.
+// Both are returned unchanged when no home zone is set. A route with fewer
+// than two points left comes back as "", so the activity is stored without
+// one rather than with an empty geometry.
+func (r *Repository) shroud(ctx context.Context, userID, routeWKT string, points []utils.GPSPoint) (string, []utils.GPSPoint, error) {
+	// home_location is read as hex EWKB so uploads need no PostGIS functions.
+	var location sql.NullString
+	var radius sql.NullInt64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT home_location::text, privacy_radius_meters
+		FROM user_profiles WHERE id = $1`, userID,
+	).Scan(&location, &radius)
+	if err == sql.ErrNoRows {
+		return routeWKT, points, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("get home zone: %w", err)
+	}
+	if !location.Valid || !radius.Valid || radius.Int64 <= 0 {
+		return routeWKT, points, nil
+	}
+	home, err := utils.ParseHexEWKBPoint(location.String)
+	if err != nil {
+		return "", nil, fmt.Errorf("decode home location: %w", err)
+	}
+
+	if len(points) > 0 {
+		points = utils.BlurRoute(points, home, float64(radius.Int64))
+	}
+	if routeWKT != "" {
+		route, err := utils.ParseWKTLineString(routeWKT)
+		if err != nil {
+			return "", nil, fmt.Errorf("parse route: %w", err)
+		}
+		routeWKT = utils.RouteToWKTLineString(utils.BlurRoute(route, home, float64(radius.Int64)))
+	}
+	return routeWKT, points, nil
 }
 
 // GetByID retrieves a single activity by its ID, scoped to the user.
 func (r *Repository) GetByID(ctx context.Context, userID, activityID string) (*Activity, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
 	query := `SELECT ` + activitySelectColumns + `
 		FROM activities
-		WHERE id = $1 AND user_id = $2`
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
 
 	a := &Activity{}
 	err := scanActivity(r.db.QueryRowContext(ctx, query, activityID, userID), a)
@@ -126,19 +388,383 @@ func (r *Repository) GetByID(ctx context.Context, userID, activityID string) (*A
 	return a, nil
 }
 
-// List returns paginated activities for a user, newest first.
-func (r *Repository) List(ctx context.Context, userID string, limit, offset int) ([]Activity, error) {
+// CreateShareToken returns the activity's share token, generating one if it
+// has none. Returns sql.ErrNoRows if the activity does not exist.
+func (r *Repository) CreateShareToken(ctx context.Context, userID, activityID string) (string, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate share token: %w", err)
+	}
+
+	var token string
+	err := r.db.QueryRowContext(ctx,
+		`UPDATE activities SET share_token = COALESCE(share_token, $3)
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		RETURNING share_token`,
+		activityID, userID, base64.RawURLEncoding.EncodeToString(buf),
+	).Scan(&token)
+	if err == sql.ErrNoRows {
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("create share token: %w", err)
+	}
+	return token, nil
+}
+
+// RevokeShareToken clears the activity's share token so existing links 404.
+// Returns sql.ErrNoRows if the activity does not exist.
+func (r *Repository) RevokeShareToken(ctx context.Context, userID, activityID string) error {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE activities SET share_token = NULL
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`,
+		activityID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("revoke share token: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetByShareToken returns the activity a share token points to, or nil if the
+// token is unknown or revoked. Callers must not expose the result directly.
+func (r *Repository) GetByShareToken(ctx context.Context, token string) (*Activity, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	query := `SELECT ` + activitySelectColumns + `
+		FROM activities
+		WHERE share_token = $1 AND deleted_at IS NULL`
+
+	a := &Activity{}
+	err := scanActivity(r.db.QueryRowContext(ctx, query, token), a)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get shared activity: %w", err)
+	}
+	return a, nil
+}
+
+// GetManyByID fetches the user's activities with the given IDs in one query.
+// IDs that don't exist or belong to another user are silently absent.
+func (r *Repository) GetManyByID(ctx context.Context, userID string, ids []string) ([]Activity, error) {
+	query := `SELECT ` + activitySelectColumns + `
+		FROM activities
+		WHERE user_id = $1 AND id = ANY($2) AND deleted_at IS NULL`
+	return r.queryActivities(ctx, query, userID, ids)
+}
+
+// GetGPSPoints returns the stored raw GPS points for an activity, scoped to the user.
+// Returns sql.ErrNoRows if the activity does not exist, and an empty slice if
+// it has no stored points.
+func (r *Repository) GetGPSPoints(ctx context.Context, userID, activityID string) ([]utils.GPSPoint, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	var raw []byte
+	err := r.db.QueryRowContext(ctx,
+		`SELECT raw_gps_points FROM activities WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`,
+		activityID, userID,
+	).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get gps points: %w", err)
+	}
+	if len(raw) == 0 {
+		return []utils.GPSPoint{}, nil
+	}
+
+	var points []utils.GPSPoint
+	if err := json.Unmarshal(raw, &points); err != nil {
+		return nil, fmt.Errorf("decode gps points: %w", err)
+	}
+	return points, nil
+}
+
+// GetHeartRateStream returns the stored heart-rate samples for an activity.
+// Returns sql.ErrNoRows if the activity does not exist, and an empty slice if
+// it has no stored stream.
+func (r *Repository) GetHeartRateStream(ctx context.Context, userID, activityID string) ([]utils.HeartRateSample, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	var raw []byte
+	err := r.db.QueryRowContext(ctx,
+		`SELECT heart_rate_stream FROM activities WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`,
+		activityID, userID,
+	).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get heart rate stream: %w", err)
+	}
+	if len(raw) == 0 {
+		return []utils.HeartRateSample{}, nil
+	}
+
+	var stream []utils.HeartRateSample
+	if err := json.Unmarshal(raw, &stream); err != nil {
+		return nil, fmt.Errorf("decode heart rate stream: %w", err)
+	}
+	return stream, nil
+}
+
+// GetUserMetrics returns the profile fields used for derived metrics.
+// A missing profile yields an empty UserMetrics.
+func (r *Repository) GetUserMetrics(ctx context.Context, userID string) (*UserMetrics, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	var age sql.NullInt64
+	var weight sql.NullFloat64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT age, weight_kg FROM user_profiles WHERE id = $1`, userID,
+	).Scan(&age, &weight)
+	if err == sql.ErrNoRows {
+		return &UserMetrics{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get user metrics: %w", err)
+	}
+
+	m := &UserMetrics{}
+	if age.Valid {
+		v := int(age.Int64)
+		m.Age = &v
+	}
+	if weight.Valid {
+		m.WeightKg = &weight.Float64
+	}
+	return m, nil
+}
+
+// GetRoute returns the best available route for an activity: the raw GPS
+// points when stored (they carry elevation and timestamps), otherwise the
+// route_path geometry. Returns sql.ErrNoRows if the activity does not exist,
+// and an empty slice if it has no stored route.
+func (r *Repository) GetRoute(ctx context.Context, userID, activityID string) ([]utils.GPSPoint, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	var raw []byte
+	var wkt sql.NullString
+	err := r.db.QueryRowContext(ctx,
+		`SELECT raw_gps_points, ST_AsText(route_path) FROM activities WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`,
+		activityID, userID,
+	).Scan(&raw, &wkt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get route: %w", err)
+	}
+
+	if len(raw) > 0 {
+		var points []utils.GPSPoint
+		if err := json.Unmarshal(raw, &points); err != nil {
+			return nil, fmt.Errorf("decode gps points: %w", err)
+		}
+		if len(points) > 0 {
+			return points, nil
+		}
+	}
+	if wkt.Valid && wkt.String != "" {
+		points, err := utils.ParseWKTLineString(wkt.String)
+		if err != nil {
+			return nil, fmt.Errorf("decode route path: %w", err)
+		}
+		return points, nil
+	}
+	return []utils.GPSPoint{}, nil
+}
+
+// List returns a page of a user's activities, newest first unless
+// params.Sort/Order say otherwise, and how many activities match in all.
+// Optional From/To bounds restrict the start_time window and ActivityType
+// restricts to a single type.
+func (r *Repository) List(ctx context.Context, userID string, params ListActivitiesParams) ([]Activity, int, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	limit, offset := params.page()
+	where, args := listFilters(userID, params)
+	argIdx := len(args) + 1
+
+	query := fmt.Sprintf(`SELECT `+activitySelectColumns+`, COUNT(*) OVER ()
+		FROM activities
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`,
+		joinStrings(where, " AND "), params.orderBy(), argIdx, argIdx+1)
+
+	rows, err := r.db.QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list activities: %w", err)
+	}
+	defer rows.Close()
+
+	var activities []Activity
+	total := 0
+	for rows.Next() {
+		var a Activity
+		if err := scanActivity(database.WithTotal(rows, &total), &a); err != nil {
+			return nil, 0, fmt.Errorf("scan activity: %w", err)
+		}
+		activities = append(activities, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// A page past the end carries no window count; count separately.
+	if len(activities) == 0 && offset > 0 {
+		err := r.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM activities WHERE `+joinStrings(where, " AND "), args...,
+		).Scan(&total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("count activities: %w", err)
+		}
+	}
+	return activities, total, nil
+}
+
+// ListByCursor returns the page of activities after params.Cursor (or the
+// first page when nil) in (start_time DESC, id DESC) order, applying the same
+// filters as List. Unlike offsets, the keyset stays stable when newer
+// activities are inserted mid-scroll. next is nil on the last page.
+func (r *Repository) ListByCursor(ctx context.Context, userID string, params ListActivitiesParams) ([]Activity, *ActivityCursor, error) {
+	limit := params.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	where, args := listFilters(userID, params)
+	argIdx := len(args) + 1
+	if params.Cursor != nil {
+		where = append(where, fmt.Sprintf("(start_time, id) < ($%d, $%d)", argIdx, argIdx+1))
+		args = append(args, params.Cursor.StartTime, params.Cursor.ID)
+		argIdx += 2
+	}
+
+	// Fetch one extra row to learn whether another page exists.
+	query := fmt.Sprintf(`SELECT `+activitySelectColumns+`
+		FROM activities
+		WHERE %s
+		ORDER BY start_time DESC, id DESC
+		LIMIT $%d`,
+		joinStrings(where, " AND "), argIdx)
+	args = append(args, limit+1)
+
+	activities, err := r.queryActivities(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *ActivityCursor
+	if len(activities) > limit {
+		activities = activities[:limit]
+		last := activities[limit-1]
+		next = &ActivityCursor{StartTime: last.StartTime, ID: last.ID}
+	}
+	return activities, next, nil
+}
+
+// searchVector is the indexed tsvector expression (see migrations/011_activity_search.sql).
+const searchVector = `to_tsvector('english', activity_name || ' ' || COALESCE(description, ''))`
+
+// Search returns the user's activities whose name or description match a
+// free-text query, best match first. The query is passed as a parameter to
+// plainto_tsquery, so user input never reaches the SQL text.
+func (r *Repository) Search(ctx context.Context, userID, query string, limit, offset int) ([]Activity, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	sqlQuery := `SELECT ` + activitySelectColumns + `
+		FROM activities
+		WHERE user_id = $1 AND deleted_at IS NULL
+		  AND ` + searchVector + ` @@ plainto_tsquery('english', $2)
+		ORDER BY ts_rank(` + searchVector + `, plainto_tsquery('english', $2)) DESC, start_time DESC
+		LIMIT $3 OFFSET $4`
+
+	activities, err := r.queryActivities(ctx, sqlQuery, userID, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("search activities: %w", err)
+	}
+	return activities, nil
+}
+
+// Nearby returns the user's public activities whose route passes within
+// radiusKm of (lat, lng), closest first. Private activities are excluded
+// even though they belong to the caller, matching what a shared map would
+// show; public routes are already shrouded by privacy zones at create time.
+func (r *Repository) Nearby(ctx context.Context, userID string, lat, lng, radiusKm float64, limit int) ([]Activity, error) {
 	if limit <= 0 || limit > 100 {
 		limit = 20
 	}
 
 	query := `SELECT ` + activitySelectColumns + `
 		FROM activities
-		WHERE user_id = $1
-		ORDER BY start_time DESC
-		LIMIT $2 OFFSET $3`
+		WHERE user_id = $1 AND deleted_at IS NULL AND is_private = FALSE
+		  AND ST_DWithin(
+			route_path::geography,
+			ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography,
+			$4
+		)
+		ORDER BY ST_Distance(route_path::geography, ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography) ASC, start_time DESC
+		LIMIT $5`
+
+	activities, err := r.queryActivities(ctx, query, userID, lng, lat, radiusKm*1000, limit)
+	if err != nil {
+		return nil, fmt.Errorf("nearby activities: %w", err)
+	}
+	return activities, nil
+}
+
+// listFilters builds the WHERE clauses shared by List and ListByCursor.
+func listFilters(userID string, params ListActivitiesParams) ([]string, []interface{}) {
+	where := []string{"user_id = $1", "deleted_at IS NULL"}
+	args := []interface{}{userID}
+	argIdx := 2
+
+	if params.ActivityType != nil {
+		where = append(where, fmt.Sprintf("activity_type = $%d", argIdx))
+		args = append(args, *params.ActivityType)
+		argIdx++
+	}
+	if params.From != nil {
+		where = append(where, fmt.Sprintf("start_time >= $%d", argIdx))
+		args = append(args, *params.From)
+		argIdx++
+	}
+	if params.To != nil {
+		where = append(where, fmt.Sprintf("start_time <= $%d", argIdx))
+		args = append(args, *params.To)
+	}
+	return where, args
+}
+
+// queryActivities runs a query selecting activitySelectColumns.
+func (r *Repository) queryActivities(ctx context.Context, query string, args ...interface{}) ([]Activity, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
 
-	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("list activities: %w", err)
 	}
@@ -155,26 +781,214 @@ func (r *Repository) List(ctx context.Context, userID string, limit, offset int)
 	return activities, rows.Err()
 }
 
-// Update applies partial updates to an activity.
+// statsAggregateColumns is the aggregation shared by Stats and StatsByType.
+// COALESCE keeps users with no activities at zero rather than NULL.
+const statsAggregateColumns = `COUNT(*),
+	COALESCE(SUM(distance_meters), 0),
+	COALESCE(SUM(duration_seconds), 0),
+	COALESCE(SUM(elevation_gain_meters), 0)`
+
+// statsWhere returns the WHERE clause and args for a stats query.
+// A zero since means all time.
+func statsWhere(userID string, since time.Time) (string, []interface{}) {
+	if since.IsZero() {
+		return "WHERE user_id = $1 AND deleted_at IS NULL", []interface{}{userID}
+	}
+	return "WHERE user_id = $1 AND deleted_at IS NULL AND start_time >= $2", []interface{}{userID, since}
+}
+
+// Stats returns totals for a user's activities starting at or after since.
+func (r *Repository) Stats(ctx context.Context, userID string, since time.Time) (*ActivityStats, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	where, args := statsWhere(userID, since)
+	query := `SELECT ` + statsAggregateColumns + `
+		FROM activities
+		` + where
+
+	st := &ActivityStats{}
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
+		&st.ActivityCount, &st.TotalDistanceMeters,
+		&st.TotalDurationSeconds, &st.TotalElevationGainMeters,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("activity stats: %w", err)
+	}
+	st.AvgPaceMinPerKm = avgPaceMinPerKm(st.TotalDistanceMeters, st.TotalDurationSeconds)
+	return st, nil
+}
+
+// StatsByType returns the same totals as Stats, grouped by activity_type.
+func (r *Repository) StatsByType(ctx context.Context, userID string, since time.Time) ([]ActivityStats, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	where, args := statsWhere(userID, since)
+	query := `SELECT activity_type, ` + statsAggregateColumns + `
+		FROM activities
+		` + where + `
+		GROUP BY activity_type
+		ORDER BY activity_type`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("activity stats by type: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []ActivityStats
+	for rows.Next() {
+		var st ActivityStats
+		if err := rows.Scan(
+			&st.ActivityType, &st.ActivityCount, &st.TotalDistanceMeters,
+			&st.TotalDurationSeconds, &st.TotalElevationGainMeters,
+		); err != nil {
+			return nil, fmt.Errorf("scan activity stats: %w", err)
+		}
+		st.AvgPaceMinPerKm = avgPaceMinPerKm(st.TotalDistanceMeters, st.TotalDurationSeconds)
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
+
+// PersonalRecords returns the user's records across all runs: best average
+// pace per standard distance (among runs at least that long), the longest run
+// and the run with the most elevation gain. Categories with no qualifying run
+// are omitted.
+func (r *Repository) PersonalRecords(ctx context.Context, userID string) ([]PersonalRecord, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	query := `SELECT id, start_time, distance_meters, duration_seconds, elevation_gain_meters
+		FROM activities
+		WHERE user_id = $1 AND activity_type = 'run' AND deleted_at IS NULL
+		ORDER BY start_time ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("personal records: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []Activity
+	for rows.Next() {
+		var a Activity
+		if err := rows.Scan(&a.ID, &a.StartTime, &a.DistanceMeters, &a.DurationSeconds, &a.ElevationGainMeters); err != nil {
+			return nil, fmt.Errorf("scan personal record candidate: %w", err)
+		}
+		runs = append(runs, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("personal records: %w", err)
+	}
+	return selectPersonalRecords(runs), nil
+}
+
+// selectPersonalRecords picks records from runs ordered oldest first, so ties
+// go to the run that set the mark first.
+func selectPersonalRecords(runs []Activity) []PersonalRecord {
+	records := []PersonalRecord{}
+
+	for _, d := range utils.StandardDistances {
+		var best *Activity
+		var bestPace float64
+		for i := range runs {
+			a := &runs[i]
+			if a.DistanceMeters < d.Meters || a.DurationSeconds <= 0 {
+				continue
+			}
+			pace := avgPaceMinPerKm(a.DistanceMeters, a.DurationSeconds)
+			if best == nil || pace < bestPace {
+				best, bestPace = a, pace
+			}
+		}
+		if best == nil {
+			continue
+		}
+		estimated := int(math.Round(bestPace * 60 * d.Meters / 1000))
+		records = append(records, PersonalRecord{
+			Record:           d.Name,
+			ActivityID:       best.ID,
+			AchievedAt:       best.StartTime,
+			DistanceMeters:   best.DistanceMeters,
+			DurationSeconds:  best.DurationSeconds,
+			PaceMinPerKm:     &bestPace,
+			EstimatedSeconds: &estimated,
+		})
+	}
+
+	var longest, highest *Activity
+	for i := range runs {
+		a := &runs[i]
+		if a.DistanceMeters > 0 && (longest == nil || a.DistanceMeters > longest.DistanceMeters) {
+			longest = a
+		}
+		if a.ElevationGainMeters != nil && *a.ElevationGainMeters > 0 &&
+			(highest == nil || *a.ElevationGainMeters > *highest.ElevationGainMeters) {
+			highest = a
+		}
+	}
+	if longest != nil {
+		records = append(records, PersonalRecord{
+			Record:          RecordLongestRun,
+			ActivityID:      longest.ID,
+			AchievedAt:      longest.StartTime,
+			DistanceMeters:  longest.DistanceMeters,
+			DurationSeconds: longest.DurationSeconds,
+		})
+	}
+	if highest != nil {
+		records = append(records, PersonalRecord{
+			Record:              RecordMostElevation,
+			ActivityID:          highest.ID,
+			AchievedAt:          highest.StartTime,
+			DistanceMeters:      highest.DistanceMeters,
+			DurationSeconds:     highest.DurationSeconds,
+			ElevationGainMeters: highest.ElevationGainMeters,
+		})
+	}
+	return records
+}
+
+// Update applies partial updates to an activity (see UpdateActivityRequest
+// for how nil fields are treated).
 func (r *Repository) Update(ctx context.Context, userID, activityID string, req *UpdateActivityRequest) (*Activity, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
 	setClauses := []string{}
 	args := []interface{}{}
 	argIdx := 1
+	set := func(clause string, value interface{}) {
+		setClauses = append(setClauses, fmt.Sprintf(clause, argIdx))
+		args = append(args, value)
+		argIdx++
+	}
+	// setNullable also clears the column when its field was sent as null;
+	// the JSON field names match the columns.
+	setNullable := func(column string, value interface{}, isNil bool) {
+		if !isNil || req.Present[column] {
+			set(column+" = $%d", value)
+		}
+	}
 
 	if req.ActivityName != nil {
-		setClauses = append(setClauses, fmt.Sprintf("activity_name = $%d", argIdx))
-		args = append(args, *req.ActivityName)
-		argIdx++
+		set("activity_name = $%d", *req.ActivityName)
 	}
-	if req.Description != nil {
-		setClauses = append(setClauses, fmt.Sprintf("description = $%d", argIdx))
-		args = append(args, *req.Description)
-		argIdx++
+	if req.ActivityType != nil {
+		set("activity_type = $%d", *req.ActivityType)
+	}
+	setNullable("description", req.Description, req.Description == nil)
+	if req.StartTime != nil {
+		// Shift end_time with start_time so the recorded duration still holds;
+		// the right-hand start_time is the row's old value.
+		set("start_time = $%[1]d, end_time = end_time + ($%[1]d::timestamptz - start_time)", *req.StartTime)
 	}
+	setNullable("avg_heart_rate", req.AvgHeartRate, req.AvgHeartRate == nil)
+	setNullable("max_heart_rate", req.MaxHeartRate, req.MaxHeartRate == nil)
 	if req.IsPrivate != nil {
-		setClauses = append(setClauses, fmt.Sprintf("is_private = $%d", argIdx))
-		args = append(args, *req.IsPrivate)
-		argIdx++
+		set("is_private = $%d", *req.IsPrivate)
 	}
 
 	if len(setClauses) == 0 {
@@ -183,7 +997,7 @@ func (r *Repository) Update(ctx context.Context, userID, activityID string, req
 
 	query := fmt.Sprintf(`
 		UPDATE activities SET %s
-		WHERE id = $%d AND user_id = $%d
+		WHERE id = $%d AND user_id = $%d AND deleted_at IS NULL
 		RETURNING `+activitySelectColumns,
 		joinStrings(setClauses, ", "), argIdx, argIdx+1)
 
@@ -200,10 +1014,14 @@ func (r *Repository) Update(ctx context.Context, userID, activityID string, req
 	return a, nil
 }
 
-// Delete removes an activity.
+// Delete soft-deletes an activity; see Restore and PurgeDeleted.
 func (r *Repository) Delete(ctx context.Context, userID, activityID string) error {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
 	result, err := r.db.ExecContext(ctx,
-		`DELETE FROM activities WHERE id = $1 AND user_id = $2`,
+		`UPDATE activities SET deleted_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`,
 		activityID, userID,
 	)
 	if err != nil {
@@ -216,6 +1034,70 @@ func (r *Repository) Delete(ctx context.Context, userID, activityID string) erro
 	return nil
 }
 
+// DeleteMany soft-deletes the user's activities among ids in one statement
+// and returns how many were deleted. Ids that don't exist, are already
+// deleted or belong to another user are skipped.
+func (r *Repository) DeleteMany(ctx context.Context, userID string, ids []string) (int64, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE activities SET deleted_at = NOW()
+		WHERE id = ANY($1) AND user_id = $2 AND deleted_at IS NULL`,
+		ids, userID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("delete activities: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// RestoreWindow is how long a soft-deleted activity can be restored before
+// PurgeDeleted removes it permanently.
+const RestoreWindow = 30 * 24 * time.Hour
+
+// Restore undoes a soft delete within RestoreWindow. Returns nil if the
+// activity doesn't exist, isn't deleted, or is past the window.
+func (r *Repository) Restore(ctx context.Context, userID, activityID string) (*Activity, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	query := `UPDATE activities SET deleted_at = NULL
+		WHERE id = $1 AND user_id = $2
+		  AND deleted_at IS NOT NULL AND deleted_at >= $3
+		RETURNING ` + activitySelectColumns
+
+	a := &Activity{}
+	err := scanActivity(r.db.QueryRowContext(ctx, query,
+		activityID, userID, time.Now().Add(-RestoreWindow),
+	), a)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("restore activity: %w", err)
+	}
+	return a, nil
+}
+
+// PurgeDeleted permanently removes activities soft-deleted more than
+// olderThan ago and returns how many were removed. It is a single statement,
+// so it is safe to run from a background goroutine alongside requests.
+func (r *Repository) PurgeDeleted(ctx context.Context, olderThan time.Duration) (int64, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM activities WHERE deleted_at IS NOT NULL AND deleted_at < $1`,
+		time.Now().Add(-olderThan),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("purge deleted activities: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n, nil
+}
+
 // --- helpers ---
 
 func routeInsertColumn(wkt string) string {
@@ -225,13 +1107,19 @@ func routeInsertColumn(wkt string) string {
 	return ""
 }
 
+// routeInsertValue passes the EWKT straight to route_path, whose type input
+// parses it, so inserts don't depend on PostGIS functions being resolvable.
 func routeInsertValue(wkt string) string {
 	if wkt != "" {
-		return ", ST_GeomFromEWKT($17)"
+		return ", $20"
 	}
 	return ""
 }
 
+func avgPaceMinPerKm(distanceMeters float64, durationSeconds int) float64 {
+	return utils.PaceMinPerKmFloat(distanceMeters, float64(durationSeconds))
+}
+
 func joinStrings(s []string, sep string) string {
 	result := ""
 	for i, v := range s {
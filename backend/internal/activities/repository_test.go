@@ -0,0 +1,493 @@
+package activities_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/activities"
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+// activityColumns mirrors the repository's activitySelectColumns order.
+var activityColumns = []string{
+	"id", "user_id", "activity_name", "activity_type", "description",
+	"start_time", "end_time", "duration_seconds", "distance_meters",
+	"avg_pace_min_per_km", "max_speed_kmh",
+	"elevation_gain_meters", "elevation_loss_meters",
+	"avg_heart_rate", "max_heart_rate",
+	"is_private", "created_at", "updated_at",
+	"weather", "start_location",
+}
+
+// activityRow returns row values for a minimal activity.
+func activityRow(id, userID string, start time.Time, distance float64, duration int) []driver.Value {
+	return []driver.Value{
+		id, userID, "Run " + id, "run", nil,
+		start, nil, duration, distance,
+		nil, nil,
+		nil, nil,
+		nil, nil,
+		false, start, start,
+		nil, nil,
+	}
+}
+
+// listColumns is activityColumns plus List's window total.
+var listColumns = append(append([]string{}, activityColumns...), "total")
+
+// listRow is an activityRow for List, carrying the window total.
+func listRow(total int, row []driver.Value) []driver.Value {
+	return append(row, total)
+}
+
+// pgxArgs lets sqlmock accept the slice arguments pgx encodes natively
+// (e.g. []string for ANY($2)), which database/sql's default converter rejects.
+type pgxArgs struct{}
+
+func (pgxArgs) ConvertValue(v interface{}) (driver.Value, error) {
+	switch v.(type) {
+	case []string, []time.Time, []float64:
+		return v, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+func newMockRepo(t *testing.T) (*activities.Repository, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(pgxArgs{}))
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return activities.NewRepository(db, zap.NewNop()), mock
+}
+
+func TestRepositoryList_NoDateFilter(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE user_id = $1 AND deleted_at IS NULL\n\t\tORDER BY start_time DESC, id DESC\n\t\tLIMIT $2 OFFSET $3")).
+		WithArgs("user-1", 20, 0).
+		WillReturnRows(sqlmock.NewRows(listColumns).AddRow(listRow(1, activityRow("a1", "user-1", start, 5000, 1500))...))
+
+	got, total, err := repo.List(context.Background(), "user-1", activities.ListActivitiesParams{Limit: 20})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != "a1" || total != 1 {
+		t.Errorf("expected activity a1 of 1, got %+v of %d", got, total)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRepositoryList_DateRange(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 31, 23, 59, 59, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE user_id = $1 AND deleted_at IS NULL AND start_time >= $2 AND start_time <= $3\n\t\tORDER BY start_time DESC, id DESC\n\t\tLIMIT $4 OFFSET $5")).
+		WithArgs("user-1", from, to, 10, 5).
+		WillReturnRows(sqlmock.NewRows(listColumns))
+	// The empty page past the end still reports how many match.
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM activities WHERE user_id = $1 AND deleted_at IS NULL AND start_time >= $2 AND start_time <= $3")).
+		WithArgs("user-1", from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	_, total, err := repo.List(context.Background(), "user-1", activities.ListActivitiesParams{
+		Limit: 10, Offset: 5, From: &from, To: &to,
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 3 {
+		t.Errorf("expected total 3, got %d", total)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRepositoryList_OnlyUpperBound(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	to := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE user_id = $1 AND deleted_at IS NULL AND start_time <= $2\n\t\tORDER BY start_time DESC, id DESC\n\t\tLIMIT $3 OFFSET $4")).
+		WithArgs("user-1", to, 20, 0).
+		WillReturnRows(sqlmock.NewRows(activityColumns))
+
+	if _, _, err := repo.List(context.Background(), "user-1", activities.ListActivitiesParams{To: &to}); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRepositoryPersonalRecords(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 7, 0, 0, 0, time.UTC) }
+	elev := func(v float64) *float64 { return &v }
+
+	rows := sqlmock.NewRows([]string{"id", "start_time", "distance_meters", "duration_seconds", "elevation_gain_meters"}).
+		AddRow("fast-1k", day(1), 1200.0, 300, nil).          // 4:10/km, too short for 5k
+		AddRow("steady-5k", day(2), 5000.0, 1500, elev(40)).  // 5:00/km
+		AddRow("quick-6k", day(3), 6000.0, 1680, elev(120)).  // 4:40/km, best 5k
+		AddRow("long-slow", day(4), 21097.5, 7595, elev(80)). // 6:00/km, longest
+		AddRow("hilly-10k", day(5), 10000.0, 3300, elev(350)) // 5:30/km, best 10k, most elevation
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE user_id = $1 AND activity_type = 'run'")).
+		WithArgs("user-1").
+		WillReturnRows(rows)
+
+	got, err := repo.PersonalRecords(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("PersonalRecords: %v", err)
+	}
+
+	byRecord := map[string]activities.PersonalRecord{}
+	for _, r := range got {
+		byRecord[r.Record] = r
+	}
+
+	want := map[string]string{
+		"1k":                           "fast-1k",
+		"1mi":                          "quick-6k",
+		"5k":                           "quick-6k",
+		"10k":                          "hilly-10k",
+		activities.RecordLongestRun:    "long-slow",
+		activities.RecordMostElevation: "hilly-10k",
+	}
+	for record, id := range want {
+		r, ok := byRecord[record]
+		if !ok {
+			t.Errorf("missing %s record", record)
+			continue
+		}
+		if r.ActivityID != id {
+			t.Errorf("%s: got activity %s, want %s", record, r.ActivityID, id)
+		}
+	}
+
+	fiveK := byRecord["5k"]
+	if fiveK.EstimatedSeconds == nil || *fiveK.EstimatedSeconds != 1400 {
+		t.Errorf("5k estimate: got %v, want 1400", fiveK.EstimatedSeconds)
+	}
+	if !fiveK.AchievedAt.Equal(day(3)) {
+		t.Errorf("5k achieved_at: got %v, want %v", fiveK.AchievedAt, day(3))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestRepositoryPersonalRecords_NoRuns(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	mock.ExpectQuery("FROM activities").
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "start_time", "distance_meters", "duration_seconds", "elevation_gain_meters"}))
+
+	got, err := repo.PersonalRecords(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("PersonalRecords: %v", err)
+	}
+	if got == nil || len(got) != 0 {
+		t.Errorf("expected empty non-nil slice, got %#v", got)
+	}
+}
+
+func TestRepositoryCreate_DerivesPace(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+
+	mock.ExpectQuery("INSERT INTO activities").
+		WithArgs(
+			"user-1", "Morning Run", "run", nil,
+			start, nil, 1500, 5000.0,
+			5.0, nil,
+			nil, nil,
+			nil, nil,
+			nil, false, nil,
+			nil, nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("a1", start, start))
+
+	got, err := repo.Create(context.Background(), "user-1", &activities.CreateActivityRequest{
+		ActivityName:    "Morning Run",
+		ActivityType:    "run",
+		StartTime:       start,
+		DurationSeconds: 1500,
+		DistanceMeters:  5000,
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if got.AvgPaceMinPerKm == nil || *got.AvgPaceMinPerKm != 5.0 {
+		t.Errorf("expected derived pace 5.0, got %v", got.AvgPaceMinPerKm)
+	}
+	if got.MaxSpeedKmh != nil {
+		t.Errorf("expected nil max speed without GPS, got %v", *got.MaxSpeedKmh)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestRepositoryCreate_KeepsClientPace(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	pace := 4.8
+
+	mock.ExpectQuery("INSERT INTO activities").
+		WithArgs(
+			"user-1", "Morning Run", "run", nil,
+			start, nil, 1500, 5000.0,
+			4.8, nil,
+			nil, nil,
+			nil, nil,
+			nil, false, nil,
+			nil, nil,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("a1", start, start))
+
+	if _, err := repo.Create(context.Background(), "user-1", &activities.CreateActivityRequest{
+		ActivityName:    "Morning Run",
+		ActivityType:    "run",
+		StartTime:       start,
+		DurationSeconds: 1500,
+		DistanceMeters:  5000,
+		AvgPaceMinPerKm: &pace,
+	}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestRepositoryFindDuplicate_Window(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	repo, mock := newMockRepo(t)
+
+	// Inclusive edges: exactly ±2 minutes and ±1% of 10 km.
+	mock.ExpectQuery(regexp.QuoteMeta("AND start_time BETWEEN $2 AND $3\n\t\t  AND distance_meters BETWEEN $4 AND $5")).
+		WithArgs("user-1",
+			start.Add(-2*time.Minute), start.Add(2*time.Minute),
+			9900.0, 10100.0,
+			start,
+		).
+		WillReturnRows(sqlmock.NewRows(activityColumns).
+			AddRow(activityRow("a1", "user-1", start.Add(2*time.Minute), 10100, 3000)...))
+
+	got, err := repo.FindDuplicate(context.Background(), "user-1", start, 10000)
+	if err != nil {
+		t.Fatalf("FindDuplicate: %v", err)
+	}
+	if got == nil || got.ID != "a1" {
+		t.Errorf("expected duplicate a1, got %+v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestRepositoryFindDuplicate_NoMatch(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	mock.ExpectQuery("FROM activities").
+		WillReturnRows(sqlmock.NewRows(activityColumns))
+
+	got, err := repo.FindDuplicate(context.Background(), "user-1", time.Now(), 5000)
+	if err != nil {
+		t.Fatalf("FindDuplicate: %v", err)
+	}
+	if got != nil {
+		t.Errorf("expected nil, got %+v", got)
+	}
+}
+
+func TestRepositorySoftDelete_ListThenRestore(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	listSQL := regexp.QuoteMeta("WHERE user_id = $1 AND deleted_at IS NULL\n\t\tORDER BY start_time DESC, id DESC")
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE activities SET deleted_at = NOW()")).
+		WithArgs("a1", "user-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(listSQL).
+		WithArgs("user-1", 20, 0).
+		WillReturnRows(sqlmock.NewRows(activityColumns))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE activities SET deleted_at = NULL")).
+		WithArgs("a1", "user-1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(activityColumns).AddRow(activityRow("a1", "user-1", start, 5000, 1500)...))
+	mock.ExpectQuery(listSQL).
+		WithArgs("user-1", 20, 0).
+		WillReturnRows(sqlmock.NewRows(listColumns).AddRow(listRow(1, activityRow("a1", "user-1", start, 5000, 1500))...))
+
+	ctx := context.Background()
+	params := activities.ListActivitiesParams{Limit: 20}
+
+	if err := repo.Delete(ctx, "user-1", "a1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	got, _, err := repo.List(ctx, "user-1", params)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("expected deleted activity hidden, got %d", len(got))
+	}
+
+	restored, err := repo.Restore(ctx, "user-1", "a1")
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored == nil || restored.ID != "a1" {
+		t.Fatalf("expected restored a1, got %+v", restored)
+	}
+	got, _, err = repo.List(ctx, "user-1", params)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != "a1" {
+		t.Errorf("expected restored activity listed, got %+v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestRepositoryRestore_OutsideWindow(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	mock.ExpectQuery("deleted_at >= \\$3").
+		WithArgs("a1", "user-1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(activityColumns))
+
+	got, err := repo.Restore(context.Background(), "user-1", "a1")
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if got != nil {
+		t.Errorf("expected nil, got %+v", got)
+	}
+}
+
+func TestRepositoryPurgeDeleted(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM activities WHERE deleted_at IS NOT NULL AND deleted_at < $1")).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	n, err := repo.PurgeDeleted(context.Background(), activities.RestoreWindow)
+	if err != nil {
+		t.Fatalf("PurgeDeleted: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 purged, got %d", n)
+	}
+}
+
+func TestRepositoryCreate_PrivacyShroud(t *testing.T) {
+	start := time.Date(2024, 3, 15, 6, 30, 0, 0, time.UTC)
+	// Home at the origin; the route leaves home heading north ~111 m per 0.001°.
+	route := []utils.GPSPoint{
+		{Lat: 0.000, Lng: 0}, // at home
+		{Lat: 0.001, Lng: 0}, // ~111 m, inside 200 m
+		{Lat: 0.002, Lng: 0}, // ~222 m, kept
+		{Lat: 0.003, Lng: 0},
+		{Lat: 0.004, Lng: 0},
+	}
+	wkt := utils.RouteToWKTLineString(route)
+	homeCols := []string{"home_location", "privacy_radius_meters"}
+	// SRID=4326;POINT(0 0) as home_location::text prints it.
+	home := "0101000020E610000000000000000000000000000000000000"
+
+	rawJSON := func(points []utils.GPSPoint) driver.Value {
+		data, _ := json.Marshal(points)
+		return string(data)
+	}
+
+	tests := []struct {
+		name      string
+		homeRow   []driver.Value
+		isPrivate bool
+		wantWKT   string // "" expects no route_path column
+		wantRaw   driver.Value
+	}{
+		{
+			name:    "points inside the home zone are stripped",
+			homeRow: []driver.Value{home, 200},
+			wantWKT: utils.RouteToWKTLineString(route[2:]),
+			wantRaw: rawJSON(route[2:]),
+		},
+		{
+			name:    "route entirely inside the zone is stored without one",
+			homeRow: []driver.Value{home, 1000},
+			wantRaw: nil,
+		},
+		{
+			name:    "no home zone set",
+			homeRow: []driver.Value{nil, 200},
+			wantWKT: wkt,
+			wantRaw: rawJSON(route),
+		},
+		{
+			name:      "private activities are not shrouded",
+			isPrivate: true,
+			wantWKT:   wkt,
+			wantRaw:   rawJSON(route),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			if tt.homeRow != nil {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT home_location::text, privacy_radius_meters\n\t\tFROM user_profiles WHERE id = $1")).
+					WithArgs("user-1").
+					WillReturnRows(sqlmock.NewRows(homeCols).AddRow(tt.homeRow...))
+			}
+			args := []driver.Value{
+				"user-1", "Run", "run", nil,
+				start, nil, 1500, 5000.0,
+				5.0, nil,
+				nil, nil,
+				nil, nil,
+				tt.wantRaw, tt.isPrivate, nil,
+				nil, nil,
+			}
+			columns := "weather, start_location\n\t\t\n\t\t) VALUES"
+			if tt.wantWKT != "" {
+				args = append(args, tt.wantWKT)
+				columns = "weather, start_location\n\t\t, route_path"
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(columns)).
+				WithArgs(args...).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("a1", start, start))
+
+			_, err := repo.Create(context.Background(), "user-1", &activities.CreateActivityRequest{
+				ActivityName:    "Run",
+				ActivityType:    "run",
+				StartTime:       start,
+				DurationSeconds: 1500,
+				DistanceMeters:  5000,
+				RouteWKT:        wkt,
+				RawGPSPoints:    route,
+				IsPrivate:       tt.isPrivate,
+			})
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
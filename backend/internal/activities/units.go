@@ -0,0 +1,113 @@
+package activities
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+// Unit systems accepted by ?units=. Storage is always metric; imperial is
+// converted at the response boundary.
+const (
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
+)
+
+// ImperialActivity is Activity with distance, pace, speed and elevation in
+// miles and feet, served for ?units=imperial.
+type ImperialActivity struct {
+	ID                string       `json:"id"`
+	UserID            string       `json:"user_id"`
+	ActivityName      string       `json:"activity_name"`
+	ActivityType      string       `json:"activity_type"`
+	Description       *string      `json:"description,omitempty"`
+	DistanceMiles     float64      `json:"distance_miles"`
+	DurationSeconds   int          `json:"duration_seconds"`
+	AvgPaceMinPerMile *float64     `json:"avg_pace_min_per_mile,omitempty"`
+	MaxSpeedMph       *float64     `json:"max_speed_mph,omitempty"`
+	ElevationGainFeet *float64     `json:"elevation_gain_feet,omitempty"`
+	ElevationLossFeet *float64     `json:"elevation_loss_feet,omitempty"`
+	AvgHeartRate      *int         `json:"avg_heart_rate,omitempty"`
+	MaxHeartRate      *int         `json:"max_heart_rate,omitempty"`
+	StartTime         time.Time    `json:"start_time"`
+	EndTime           *time.Time   `json:"end_time,omitempty"`
+	IsPrivate         bool         `json:"is_private"`
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+	Weather           *Weather     `json:"weather,omitempty"`
+	StartLocation     *string      `json:"start_location,omitempty"`
+	Calories          *float64     `json:"calories,omitempty"`
+	DataQuality       *DataQuality `json:"data_quality,omitempty"`
+}
+
+// ToImperial converts an activity's metric fields to miles and feet.
+func ToImperial(a *Activity) ImperialActivity {
+	scale := func(v *float64, factor float64) *float64 {
+		if v == nil {
+			return nil
+		}
+		out := *v * factor
+		return &out
+	}
+	return ImperialActivity{
+		ID:                a.ID,
+		UserID:            a.UserID,
+		ActivityName:      a.ActivityName,
+		ActivityType:      a.ActivityType,
+		Description:       a.Description,
+		DistanceMiles:     a.DistanceMeters / utils.MetersPerMile,
+		DurationSeconds:   a.DurationSeconds,
+		AvgPaceMinPerMile: scale(a.AvgPaceMinPerKm, utils.MetersPerMile/1000),
+		MaxSpeedMph:       scale(a.MaxSpeedKmh, 1000/utils.MetersPerMile),
+		ElevationGainFeet: scale(a.ElevationGainMeters, 1/utils.MetersPerFoot),
+		ElevationLossFeet: scale(a.ElevationLossMeters, 1/utils.MetersPerFoot),
+		AvgHeartRate:      a.AvgHeartRate,
+		MaxHeartRate:      a.MaxHeartRate,
+		StartTime:         a.StartTime,
+		EndTime:           a.EndTime,
+		IsPrivate:         a.IsPrivate,
+		CreatedAt:         a.CreatedAt,
+		UpdatedAt:         a.UpdatedAt,
+		Weather:           a.Weather,
+		StartLocation:     a.StartLocation,
+		Calories:          a.Calories,
+		DataQuality:       a.DataQuality,
+	}
+}
+
+// parseUnits reads ?units=metric|imperial (default metric), responding 400
+// and returning false for anything else.
+func parseUnits(c *gin.Context) (imperial bool, ok bool) {
+	switch c.Query("units") {
+	case "", UnitsMetric:
+		return false, true
+	case UnitsImperial:
+		return true, true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "units must be metric or imperial"})
+		return false, false
+	}
+}
+
+// activityView returns a in the requested units.
+func activityView(a *Activity, imperial bool) interface{} {
+	if imperial {
+		return ToImperial(a)
+	}
+	return a
+}
+
+// activityViews returns list in the requested units.
+func activityViews(list []Activity, imperial bool) interface{} {
+	if !imperial {
+		return list
+	}
+	out := make([]ImperialActivity, len(list))
+	for i := range list {
+		out[i] = ToImperial(&list[i])
+	}
+	return out
+}
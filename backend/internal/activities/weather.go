@@ -0,0 +1,71 @@
+package activities
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Weather is the conditions at an activity's start, stored as jsonb.
+type Weather struct {
+	TemperatureC float64 `json:"temperature_c"`
+	HumidityPct  float64 `json:"humidity_pct"`
+	WindSpeedKmh float64 `json:"wind_speed_kmh"`
+}
+
+// WeatherProvider looks up historical weather at a coordinate and time.
+type WeatherProvider interface {
+	Lookup(ctx context.Context, lat, lng float64, t time.Time) (*Weather, error)
+}
+
+// HTTPWeatherProvider queries a provider URL as
+// GET {baseURL}?lat=..&lng=..&time=<RFC3339> and expects a JSON body shaped
+// like Weather.
+type HTTPWeatherProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPWeatherProvider creates a provider with the given request timeout.
+func NewHTTPWeatherProvider(baseURL string, timeout time.Duration) *HTTPWeatherProvider {
+	return &HTTPWeatherProvider{
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Lookup implements WeatherProvider.
+func (p *HTTPWeatherProvider) Lookup(ctx context.Context, lat, lng float64, t time.Time) (*Weather, error) {
+	u, err := url.Parse(p.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("weather provider url: %w", err)
+	}
+	q := u.Query()
+	q.Set("lat", strconv.FormatFloat(lat, 'f', 6, 64))
+	q.Set("lng", strconv.FormatFloat(lng, 'f', 6, 64))
+	q.Set("time", t.UTC().Format(time.RFC3339))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("weather request: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("weather request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("weather provider returned %d", resp.StatusCode)
+	}
+	var w Weather
+	if err := json.NewDecoder(resp.Body).Decode(&w); err != nil {
+		return nil, fmt.Errorf("decode weather: %w", err)
+	}
+	return &w, nil
+}
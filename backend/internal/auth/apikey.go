@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/database"
+)
+
+// HeaderAPIKey is the request header carrying a server-to-server API key.
+const HeaderAPIKey = "X-API-Key"
+
+// ContextKeyServicePrincipal is the gin context key for an authenticated API key.
+const ContextKeyServicePrincipal = "servicePrincipal"
+
+// APIKey is a long-lived service credential (matches DB schema, minus the hash).
+// Scopes are route prefixes the key may read, e.g. "/api/v1/segments".
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  *string    `json:"created_by,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Allows reports whether the key may perform a request. Keys are read-only
+// and limited to their scoped route prefixes.
+func (k *APIKey) Allows(method, path string) bool {
+	if method != http.MethodGet && method != http.MethodHead {
+		return false
+	}
+	for _, scope := range k.Scopes {
+		scope = strings.TrimSuffix(scope, "/")
+		if scope != "" && (path == scope || strings.HasPrefix(path, scope+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// HashAPIKey returns the hex-encoded SHA-256 digest stored for a plaintext key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyRepository provides data access for API keys.
+type APIKeyRepository struct {
+	db      database.Querier
+	logger  *zap.Logger
+	timeout time.Duration // per-call query timeout; 0 disables
+}
+
+// NewAPIKeyRepository creates a new API key repository.
+func NewAPIKeyRepository(db database.Querier, logger *zap.Logger) *APIKeyRepository {
+	// A nil *sql.DB (no DATABASE_URL) must stay a nil Querier so the
+	// "database not configured" checks below still fire.
+	if pool, ok := db.(*sql.DB); ok && pool == nil {
+		db = nil
+	}
+	return &APIKeyRepository{db: db, logger: logger}
+}
+
+// SetQueryTimeout bounds each repository call; 0 (the default) leaves calls
+// bounded only by the caller's context.
+func (r *APIKeyRepository) SetQueryTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+func (r *APIKeyRepository) queryCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	return database.WithQueryTimeout(ctx, r.timeout)
+}
+
+// Create issues a new key for an admin and returns the plaintext once.
+// Only the hash is persisted.
+func (r *APIKeyRepository) Create(ctx context.Context, name string, scopes []string, createdBy string) (string, *APIKey, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	if r.db == nil {
+		return "", nil, errors.New("database not configured")
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("generate api key: %w", err)
+	}
+	plaintext := "apx_" + hex.EncodeToString(buf)
+
+	k := &APIKey{Name: name, Scopes: scopes, CreatedBy: &createdBy}
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (name, key_hash, scopes, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		name, HashAPIKey(plaintext), scopes, createdBy,
+	).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		return "", nil, fmt.Errorf("create api key: %w", err)
+	}
+	return plaintext, k, nil
+}
+
+// Lookup returns the active (non-revoked) key matching a plaintext key, or nil.
+func (r *APIKeyRepository) Lookup(ctx context.Context, plaintext string) (*APIKey, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	if r.db == nil {
+		return nil, errors.New("database not configured")
+	}
+
+	k := &APIKey{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, name, scopes, created_by, last_used_at, created_at
+		FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL`,
+		HashAPIKey(plaintext),
+	).Scan(&k.ID, &k.Name, pgtype.NewMap().SQLScanner(&k.Scopes), &k.CreatedBy, &k.LastUsedAt, &k.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup api key: %w", err)
+	}
+	return k, nil
+}
+
+// TouchLastUsed records that a key was just used.
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, keyID string) error {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	if r.db == nil {
+		return errors.New("database not configured")
+	}
+	_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`, keyID)
+	if err != nil {
+		return fmt.Errorf("touch api key: %w", err)
+	}
+	return nil
+}
+
+// Revoke marks a key revoked so Lookup no longer returns it. It returns
+// sql.ErrNoRows when no active key has the id.
+func (r *APIKeyRepository) Revoke(ctx context.Context, keyID string) error {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	if r.db == nil {
+		return errors.New("database not configured")
+	}
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, keyID)
+	if err != nil {
+		return fmt.Errorf("revoke api key: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// keyLimiter is a fixed-window per-key request limiter, kept separate from
+// the per-IP limiter so service traffic is budgeted on its own.
+type keyLimiter struct {
+	mu      sync.Mutex
+	rpm     int
+	buckets map[string]*keyBucket
+}
+
+type keyBucket struct {
+	tokens    int
+	lastReset time.Time
+}
+
+func (l *keyLimiter) allow(keyID string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[keyID]
+	if !ok || now.Sub(b.lastReset) > time.Minute {
+		b = &keyBucket{tokens: l.rpm, lastReset: now}
+		l.buckets[keyID] = b
+	}
+	if b.tokens <= 0 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// APIKeyMiddleware authenticates requests carrying an X-API-Key header as a
+// service principal, bypassing the Supabase JWT flow. Requests without the
+// header pass through untouched so Middleware can handle them. Keys are
+// read-only, restricted to their scopes, rate limited per key at rpm, and
+// every use is audit-logged.
+func APIKeyMiddleware(repo *APIKeyRepository, rpm int, logger *zap.Logger) gin.HandlerFunc {
+	limiter := &keyLimiter{rpm: rpm, buckets: make(map[string]*keyBucket)}
+
+	return func(c *gin.Context) {
+		plaintext := c.GetHeader(HeaderAPIKey)
+		if plaintext == "" {
+			c.Next()
+			return
+		}
+
+		key, err := repo.Lookup(c.Request.Context(), plaintext)
+		if err != nil {
+			logger.Error("api key lookup failed", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "unable to verify api key",
+			})
+			return
+		}
+		if key == nil {
+			logger.Warn("api key rejected",
+				zap.String("path", c.Request.URL.Path),
+				zap.String("client_ip", c.ClientIP()),
+			)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "invalid api key",
+			})
+			return
+		}
+
+		auditFields := []zap.Field{
+			zap.String("api_key_id", key.ID),
+			zap.String("api_key_name", key.Name),
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.String("client_ip", c.ClientIP()),
+		}
+
+		if !key.Allows(c.Request.Method, c.Request.URL.Path) {
+			logger.Warn("api key audit: out of scope", auditFields...)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "api key not permitted for this endpoint",
+			})
+			return
+		}
+
+		if !limiter.allow(key.ID, time.Now()) {
+			logger.Warn("api key audit: rate limited", auditFields...)
+			c.Header("Retry-After", "60")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": "api key rate limit exceeded",
+			})
+			return
+		}
+
+		logger.Info("api key audit: access", auditFields...)
+		if err := repo.TouchLastUsed(c.Request.Context(), key.ID); err != nil {
+			logger.Warn("api key last_used update failed", zap.Error(err))
+		}
+
+		c.Set(ContextKeyServicePrincipal, key)
+		c.Next()
+	}
+}
+
+// GetServicePrincipal returns the API key authenticating the request, if any.
+func GetServicePrincipal(c *gin.Context) (*APIKey, bool) {
+	v, exists := c.Get(ContextKeyServicePrincipal)
+	if !exists {
+		return nil, false
+	}
+	key, ok := v.(*APIKey)
+	return key, ok
+}
+
+// SubjectUserID returns the user an aggregate read is about, writing the
+// error response and returning false when there is none. A signed-in user
+// reads their own data; a service principal names the user with
+// ?user_id=, since keys act for no user of their own.
+func SubjectUserID(c *gin.Context) (string, bool) {
+	if _, ok := GetServicePrincipal(c); ok {
+		userID := c.Query("user_id")
+		if userID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required with an api key"})
+			return "", false
+		}
+		return userID, true
+	}
+	userID, ok := GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return "", false
+	}
+	return userID, true
+}
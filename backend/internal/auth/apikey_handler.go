@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// CreateAPIKeyRequest is the body for issuing a service API key. Scopes are
+// route prefixes under /api/v1/.
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,startswith=/api/v1/"`
+}
+
+// CreateAPIKeyResponse carries the plaintext key, which is never shown again.
+type CreateAPIKeyResponse struct {
+	Key    string  `json:"key"`
+	APIKey *APIKey `json:"api_key"`
+}
+
+// APIKeyHandler serves the admin endpoints that manage service API keys.
+type APIKeyHandler struct {
+	repo   *APIKeyRepository
+	logger *zap.Logger
+}
+
+// NewAPIKeyHandler creates a new API key handler.
+func NewAPIKeyHandler(repo *APIKeyRepository, logger *zap.Logger) *APIKeyHandler {
+	return &APIKeyHandler{repo: repo, logger: logger}
+}
+
+// RegisterAdminRoutes mounts key management routes on the given
+// RouterGroup, which the caller must already restrict to admins.
+func (h *APIKeyHandler) RegisterAdminRoutes(rg *gin.RouterGroup) {
+	rg.POST("", h.Create)
+	rg.DELETE("/:id", h.Revoke)
+}
+
+// Create handles POST /api/v1/admin/api-keys
+// Issues a key for the calling admin and returns its plaintext once.
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	adminID, ok := GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plaintext, key, err := h.repo.Create(c.Request.Context(), req.Name, req.Scopes, adminID)
+	if err != nil {
+		h.logger.Error("create api key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	h.logger.Info("api key audit: created",
+		zap.String("api_key_id", key.ID),
+		zap.String("api_key_name", key.Name),
+		zap.Strings("scopes", key.Scopes),
+		zap.String("admin_id", adminID),
+	)
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{Key: plaintext, APIKey: key})
+}
+
+// Revoke handles DELETE /api/v1/admin/api-keys/:id
+// Takes effect on the key's next request.
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	adminID, ok := GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	keyID := c.Param("id")
+	if err := h.repo.Revoke(c.Request.Context(), keyID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+			return
+		}
+		h.logger.Error("revoke api key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	h.logger.Info("api key audit: revoked",
+		zap.String("api_key_id", keyID),
+		zap.String("admin_id", adminID),
+	)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,160 @@
+package auth_test
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/auth"
+)
+
+// pgxArgs lets sqlmock accept the []string scopes pgx encodes as text[],
+// which database/sql's default converter rejects.
+type pgxArgs struct{}
+
+func (pgxArgs) ConvertValue(v interface{}) (driver.Value, error) {
+	if _, ok := v.([]string); ok {
+		return v, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+// captureArg matches any argument and records it.
+type captureArg struct{ v driver.Value }
+
+func (a *captureArg) Match(v driver.Value) bool {
+	a.v = v
+	return true
+}
+
+// newAPIKeyAdminRouter mounts the admin key routes behind RequireRole for
+// a caller with the given role.
+func newAPIKeyAdminRouter(t *testing.T, role string) (*gin.Engine, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(pgxArgs{}))
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(auth.ContextKeyUserID, "admin-1")
+		c.Set(auth.ContextKeyRole, role)
+		c.Next()
+	})
+	admin := r.Group("/api/v1/admin", auth.RequireRole("admin"))
+	repo := auth.NewAPIKeyRepository(db, zap.NewNop())
+	auth.NewAPIKeyHandler(repo, zap.NewNop()).RegisterAdminRoutes(admin.Group("/api-keys"))
+	return r, mock
+}
+
+func TestAPIKeyHandler_Create(t *testing.T) {
+	router, mock := newAPIKeyAdminRouter(t, "admin")
+	stored := &captureArg{}
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO api_keys")).
+		WithArgs("analytics", stored, []string{"/api/v1/coaching"}, "admin-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("key-1", time.Now()))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/admin/api-keys",
+		strings.NewReader(`{"name":"analytics","scopes":["/api/v1/coaching"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp auth.CreateAPIKeyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !strings.HasPrefix(resp.Key, "apx_") || resp.APIKey == nil || resp.APIKey.ID != "key-1" {
+		t.Errorf("unexpected response: %s", w.Body.String())
+	}
+	// Only the hash of the returned plaintext is persisted.
+	if stored.v != auth.HashAPIKey(resp.Key) {
+		t.Errorf("stored %v, want the hash of the returned key", stored.v)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAPIKeyHandler_CreateValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"missing name", `{"scopes":["/api/v1/coaching"]}`},
+		{"no scopes", `{"name":"analytics","scopes":[]}`},
+		{"scope outside the api", `{"name":"analytics","scopes":["/admin"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := newAPIKeyAdminRouter(t, "admin")
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/api/v1/admin/api-keys", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAPIKeyHandler_Revoke(t *testing.T) {
+	tests := []struct {
+		name     string
+		affected int64
+		wantCode int
+	}{
+		{"active key", 1, http.StatusNoContent},
+		{"unknown or already revoked", 0, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := newAPIKeyAdminRouter(t, "admin")
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE api_keys SET revoked_at = NOW()")).
+				WithArgs("key-1").
+				WillReturnResult(sqlmock.NewResult(0, tt.affected))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/v1/admin/api-keys/key-1", nil))
+			if w.Code != tt.wantCode {
+				t.Errorf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAPIKeyHandler_RequiresAdmin(t *testing.T) {
+	router, mock := newAPIKeyAdminRouter(t, "authenticated")
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/admin/api-keys",
+		strings.NewReader(`{"name":"analytics","scopes":["/api/v1/coaching"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,156 @@
+package auth_test
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/auth"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+var apiKeyColumns = []string{"id", "name", "scopes", "created_by", "last_used_at", "created_at"}
+
+// newAPIKeyRouter mounts the API key middleware in front of a stub handler
+// that reports whether a service principal was set.
+func newAPIKeyRouter(t *testing.T, rpm int) (*gin.Engine, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	repo := auth.NewAPIKeyRepository(db, zap.NewNop())
+	r := gin.New()
+	r.Use(auth.APIKeyMiddleware(repo, rpm, zap.NewNop()))
+	handler := func(c *gin.Context) {
+		key, ok := auth.GetServicePrincipal(c)
+		if !ok {
+			c.JSON(http.StatusOK, gin.H{"principal": ""})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"principal": key.Name})
+	}
+	r.GET("/api/v1/segments/:id/leaderboard", handler)
+	r.POST("/api/v1/segments", handler)
+	r.GET("/api/v1/activities", handler)
+	return r, mock
+}
+
+func expectKeyLookup(mock sqlmock.Sqlmock, plaintext string) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM api_keys")).
+		WithArgs(auth.HashAPIKey(plaintext)).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow("key-1", "analytics", "{/api/v1/segments}", nil, nil, time.Now()))
+}
+
+func serve(r *gin.Engine, method, path, apiKey string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	if apiKey != "" {
+		req.Header.Set(auth.HeaderAPIKey, apiKey)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKeyMiddleware_ValidKeyScopedAccess(t *testing.T) {
+	router, mock := newAPIKeyRouter(t, 10)
+	expectKeyLookup(mock, "apx_valid")
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE api_keys SET last_used_at")).
+		WithArgs("key-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := serve(router, "GET", "/api/v1/segments/seg-1/leaderboard", "apx_valid")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if want := `{"principal":"analytics"}`; w.Body.String() != want {
+		t.Errorf("expected body %s, got %s", want, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAPIKeyMiddleware_InvalidKeyRejected(t *testing.T) {
+	router, mock := newAPIKeyRouter(t, 10)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM api_keys")).
+		WithArgs(auth.HashAPIKey("apx_bogus")).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns))
+
+	w := serve(router, "GET", "/api/v1/segments/seg-1/leaderboard", "apx_bogus")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
+
+func TestAPIKeyMiddleware_OutOfScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{"write method", "POST", "/api/v1/segments"},
+		{"unscoped path", "GET", "/api/v1/activities"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := newAPIKeyRouter(t, 10)
+			expectKeyLookup(mock, "apx_valid")
+
+			w := serve(router, tt.method, tt.path, "apx_valid")
+			if w.Code != http.StatusForbidden {
+				t.Errorf("expected 403, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestAPIKeyMiddleware_RateLimitedPerKey(t *testing.T) {
+	router, mock := newAPIKeyRouter(t, 1)
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < 2; i++ {
+		expectKeyLookup(mock, "apx_valid")
+	}
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE api_keys")).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if w := serve(router, "GET", "/api/v1/segments/seg-1/leaderboard", "apx_valid"); w.Code != http.StatusOK {
+		t.Fatalf("first request: expected 200, got %d", w.Code)
+	}
+	if w := serve(router, "GET", "/api/v1/segments/seg-1/leaderboard", "apx_valid"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second request: expected 429, got %d", w.Code)
+	}
+}
+
+func TestAPIKeyMiddleware_NoHeaderPassesThrough(t *testing.T) {
+	router, _ := newAPIKeyRouter(t, 10)
+
+	w := serve(router, "GET", "/api/v1/activities", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if want := `{"principal":""}`; w.Body.String() != want {
+		t.Errorf("expected no principal, got %s", w.Body.String())
+	}
+}
+
+func TestAPIKeyRepository_NilPool(t *testing.T) {
+	var pool *sql.DB
+	repo := auth.NewAPIKeyRepository(pool, zap.NewNop())
+	if _, err := repo.Lookup(context.Background(), "apx_anything"); err == nil {
+		t.Fatal("expected an error without a database")
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// defaultRevocationTTL is how long a token without an exp claim stays
+// revoked.
+const defaultRevocationTTL = 24 * time.Hour
+
+// Handler serves auth HTTP endpoints.
+type Handler struct {
+	blocklist TokenBlocklist
+	clockSkew time.Duration
+	logger    *zap.Logger
+}
+
+// NewHandler creates a new auth handler. blocklist may be nil, in which
+// case revocation reports 503. clockSkew must match the verifier's
+// JWTConfig.ClockSkew, since tokens are accepted that long past exp.
+func NewHandler(blocklist TokenBlocklist, clockSkew time.Duration, logger *zap.Logger) *Handler {
+	return &Handler{blocklist: blocklist, clockSkew: clockSkew, logger: logger}
+}
+
+// RegisterRoutes mounts auth routes on the given RouterGroup.
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.POST("/revoke", h.Revoke)
+}
+
+// Revoke handles POST /api/v1/auth/revoke
+// Blocklists the bearer token used for this request until it expires.
+func (h *Handler) Revoke(c *gin.Context) {
+	v, _ := c.Get(contextKeyToken)
+	ref, ok := v.(*tokenRef)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if h.blocklist == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "token revocation unavailable"})
+		return
+	}
+
+	ttl := defaultRevocationTTL
+	if !ref.ExpiresAt.IsZero() {
+		ttl = time.Until(ref.ExpiresAt) + h.clockSkew
+	}
+	if ttl > 0 {
+		if err := h.blocklist.BlockToken(c.Request.Context(), ref.ID, ttl); err != nil {
+			h.logger.Error("revoke token", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token"})
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,112 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/auth"
+)
+
+// memoryBlocklist is an in-process auth.TokenBlocklist.
+type memoryBlocklist struct {
+	mu      sync.Mutex
+	blocked map[string]time.Duration
+	err     error
+}
+
+func (b *memoryBlocklist) BlockToken(_ context.Context, id string, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.blocked[id] = ttl
+	return nil
+}
+
+func (b *memoryBlocklist) IsTokenBlocked(_ context.Context, id string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return false, b.err
+	}
+	_, ok := b.blocked[id]
+	return ok, nil
+}
+
+func newRevokeRouter(t *testing.T, blocklist *memoryBlocklist) (*gin.Engine, string) {
+	t.Helper()
+	supabase := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(supabase.Close)
+
+	cfg := testJWTConfig(supabase.URL)
+	cfg.Blocklist = blocklist
+	r := gin.New()
+	api := r.Group("/api/v1")
+	api.Use(auth.Middleware(auth.NewVerifier(stopOnCleanup(t), cfg, zap.NewNop())))
+	auth.NewHandler(blocklist, 0, zap.NewNop()).RegisterRoutes(api.Group("/auth"))
+	api.GET("/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	token := signHS256(t, auth.Claims{RegisteredClaims: jwt.RegisteredClaims{
+		ID:        "token-1",
+		Subject:   "user-1",
+		Issuer:    cfg.Issuer,
+		Audience:  jwt.ClaimStrings{"authenticated"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}})
+	return r, token
+}
+
+func doWithToken(r *gin.Engine, method, path, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRevoke_RejectsRevokedToken(t *testing.T) {
+	blocklist := &memoryBlocklist{blocked: map[string]time.Duration{}}
+	r, token := newRevokeRouter(t, blocklist)
+
+	if w := doWithToken(r, "GET", "/api/v1/me", token); w.Code != http.StatusOK {
+		t.Fatalf("before revoke: expected 200, got %d", w.Code)
+	}
+	if w := doWithToken(r, "POST", "/api/v1/auth/revoke", token); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	ttl, ok := blocklist.blocked["jti:token-1"]
+	if !ok {
+		t.Fatalf("expected token blocklisted by jti, got %v", blocklist.blocked)
+	}
+	if ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("expected ttl of the remaining lifetime (~1h), got %v", ttl)
+	}
+
+	w := doWithToken(r, "GET", "/api/v1/me", token)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("after revoke: expected 401, got %d", w.Code)
+	}
+	if body := w.Body.String(); body != `{"error":"token has been revoked"}` {
+		t.Errorf("unexpected body %s", body)
+	}
+}
+
+func TestRevoke_BlocklistUnavailableAllowsTokens(t *testing.T) {
+	blocklist := &memoryBlocklist{
+		blocked: map[string]time.Duration{"jti:token-1": time.Hour},
+		err:     errors.New("redis: connection refused"),
+	}
+	r, token := newRevokeRouter(t, blocklist)
+
+	if w := doWithToken(r, "GET", "/api/v1/me", token); w.Code != http.StatusOK {
+		t.Errorf("expected fail-open 200 when the blocklist errors, got %d", w.Code)
+	}
+}
@@ -1,9 +1,12 @@
 package auth
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,11 +19,23 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
+// jwksTTL is how long fetched signing keys are trusted before the
+// background refresh replaces them.
+const jwksTTL = 5 * time.Minute
+
 // ContextKeyUserID is the gin context key for the authenticated user's UUID.
 const ContextKeyUserID = "userID"
 
+// ContextKeyEmail and ContextKeyRole hold the token's email and role claims
+// when present.
+const (
+	ContextKeyEmail = "userEmail"
+	ContextKeyRole  = "userRole"
+)
+
 // Claims represents the JWT claims from a Supabase token.
 type Claims struct {
 	jwt.RegisteredClaims
@@ -31,86 +46,80 @@ type Claims struct {
 }
 
 // jwksCache stores cached JWKS keys to avoid hitting the endpoint per request.
+// A background goroutine re-fetches every ttl/2; a kid that misses the cache
+// triggers an immediate refresh, shared by all concurrent misses.
 type jwksCache struct {
-	mu          sync.RWMutex
-	keys        map[string]*ecdsa.PublicKey
-	fetchedAt   time.Time
+	supabaseURL string
 	ttl         time.Duration
-	refreshing  bool
-	refreshCond *sync.Cond
-}
+	logger      *zap.Logger
 
-func newJWKSCache(ttl time.Duration) *jwksCache {
-	c := &jwksCache{
-		keys: make(map[string]*ecdsa.PublicKey),
-		ttl:  ttl,
-	}
-	c.refreshCond = sync.NewCond(&c.mu)
-	return c
-}
-
-func (c *jwksCache) get(kid string, supabaseURL string, logger *zap.Logger) (*ecdsa.PublicKey, error) {
-	c.mu.RLock()
-	key, ok := c.keys[kid]
-	fresh := time.Since(c.fetchedAt) < c.ttl
-	c.mu.RUnlock()
+	mu        sync.RWMutex
+	keys      map[string]*ecdsa.PublicKey
+	fetchedAt time.Time
 
-	if ok && fresh {
-		return key, nil
-	}
+	refreshes singleflight.Group
+}
 
-	// Lock for refresh logic
-	c.mu.Lock()
-	// Check again in case someone else refreshed while we were waiting for lock
-	if key, ok := c.keys[kid]; ok && time.Since(c.fetchedAt) < c.ttl {
-		c.mu.Unlock()
-		return key, nil
+func newJWKSCache(supabaseURL string, ttl time.Duration, logger *zap.Logger) *jwksCache {
+	return &jwksCache{
+		supabaseURL: supabaseURL,
+		ttl:         ttl,
+		logger:      logger,
+		keys:        make(map[string]*ecdsa.PublicKey),
 	}
+}
 
-	// If already refreshing, wait
-	if c.refreshing {
-		for c.refreshing {
-			c.refreshCond.Wait()
+// refresh fetches the JWKS, coalescing concurrent callers into one request.
+// On failure the previously cached keys are kept.
+func (c *jwksCache) refresh() error {
+	_, err, _ := c.refreshes.Do("jwks", func() (interface{}, error) {
+		keys, err := fetchJWKS(c.supabaseURL)
+		if err != nil {
+			return nil, err
 		}
-		// Try again after waiting
-		key, ok := c.keys[kid]
+		c.mu.Lock()
+		c.keys = keys
+		c.fetchedAt = time.Now()
 		c.mu.Unlock()
-		if !ok {
-			return nil, errors.New("unknown signing key after refresh")
+		return nil, nil
+	})
+	return err
+}
+
+// refreshLoop keeps the keys fresh so requests rarely wait on a fetch. It
+// returns when ctx is done.
+func (c *jwksCache) refreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(c.ttl / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.refresh(); err != nil {
+				c.logger.Warn("background JWKS refresh failed", zap.Error(err))
+			}
 		}
-		return key, nil
 	}
+}
 
-	// We are the lucky one to refresh
-	c.refreshing = true
-	c.mu.Unlock()
-
-	defer func() {
-		c.mu.Lock()
-		c.refreshing = false
-		c.refreshCond.Broadcast()
-		c.mu.Unlock()
-	}()
+func (c *jwksCache) get(kid string) (*ecdsa.PublicKey, error) {
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	c.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
 
-	keys, err := fetchJWKS(supabaseURL)
-	if err != nil {
-		logger.Error("JWKS refresh failed", zap.Error(err))
-		// Return existing key even if stale if it matches the kid
-		c.mu.RLock()
-		key, ok := c.keys[kid]
-		c.mu.RUnlock()
-		if ok {
-			return key, nil
-		}
+	// Unknown kid: the keys may have rotated since the last fetch.
+	if err := c.refresh(); err != nil {
+		c.logger.Error("JWKS refresh failed", zap.Error(err))
 		return nil, fmt.Errorf("unable to verify token (JWKS unavailable): %w", err)
 	}
 
-	c.mu.Lock()
-	c.keys = keys
-	c.fetchedAt = time.Now()
+	c.mu.RLock()
 	key, ok = c.keys[kid]
-	c.mu.Unlock()
-
+	c.mu.RUnlock()
 	if !ok {
 		return nil, errors.New("unknown signing key after refresh")
 	}
@@ -175,111 +184,248 @@ func fetchJWKS(supabaseURL string) (map[string]*ecdsa.PublicKey, error) {
 	return keys, nil
 }
 
-// Middleware returns a Gin middleware that validates Supabase JWT tokens.
-// It supports both ES256 (via JWKS) and HS256 (via JWT secret) verification.
-// It injects the user ID into the gin context under ContextKeyUserID.
-func Middleware(supabaseURL, jwtSecret string, logger *zap.Logger) gin.HandlerFunc {
-	hmacSecret := []byte(jwtSecret)
-	cache := newJWKSCache(5 * time.Minute)
+// JWTConfig configures Supabase token verification.
+type JWTConfig struct {
+	SupabaseURL string
+	Secret      string         // HS256 signing secret
+	Issuer      string         // required iss; empty skips the check
+	Audience    []string       // accepted aud values; empty skips the check
+	ClockSkew   time.Duration  // leeway applied to exp, nbf and iat
+	Blocklist   TokenBlocklist // revoked tokens; nil disables revocation
+}
+
+// TokenBlocklist records revoked tokens by id until they would expire.
+// *database.Redis implements it.
+type TokenBlocklist interface {
+	BlockToken(ctx context.Context, tokenID string, ttl time.Duration) error
+	IsTokenBlocked(ctx context.Context, tokenID string) (bool, error)
+}
+
+// tokenRef identifies the request's token for revocation.
+type tokenRef struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// contextKeyToken holds the request's tokenRef.
+const contextKeyToken = "authToken"
+
+// tokenID is the token's jti, or a SHA-256 of the token when it has none.
+func tokenID(tokenString string, claims *Claims) string {
+	if claims.ID != "" {
+		return "jti:" + claims.ID
+	}
+	sum := sha256.Sum256([]byte(tokenString))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// parserOptions returns the jwt validation options for cfg.
+func (cfg JWTConfig) parserOptions() []jwt.ParserOption {
+	opts := []jwt.ParserOption{jwt.WithIssuedAt(), jwt.WithLeeway(cfg.ClockSkew)}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	return opts
+}
+
+// Verifier validates Supabase bearer tokens for Middleware and
+// OptionalMiddleware. It supports both ES256 (via JWKS) and HS256 (via JWT
+// secret) verification. Build one per process and share it so every route
+// uses the same JWKS cache.
+type Verifier struct {
+	cfg        JWTConfig
+	hmacSecret []byte
+	parseOpts  []jwt.ParserOption
+	cache      *jwksCache
+	logger     *zap.Logger
+}
+
+// NewVerifier builds a Verifier for cfg. Tokens must be issued by
+// cfg.Issuer and carry at least one of cfg.Audience in aud; time claims are
+// checked with cfg.ClockSkew leeway. Cancelling ctx stops the background
+// JWKS refresh; keys are then only re-fetched when a token names an
+// unknown kid.
+func NewVerifier(ctx context.Context, cfg JWTConfig, logger *zap.Logger) *Verifier {
+	v := &Verifier{
+		cfg:        cfg,
+		hmacSecret: []byte(cfg.Secret),
+		parseOpts:  cfg.parserOptions(),
+		cache:      newJWKSCache(cfg.SupabaseURL, jwksTTL, logger),
+		logger:     logger,
+	}
 
-	// Pre-fetch JWKS at startup
-	if keys, err := fetchJWKS(supabaseURL); err != nil {
+	// Pre-fetch JWKS at startup, then keep it fresh in the background
+	if err := v.cache.refresh(); err != nil {
 		logger.Warn("initial JWKS fetch failed — will retry on first request", zap.Error(err))
 	} else {
-		cache.mu.Lock()
-		cache.keys = keys
-		cache.fetchedAt = time.Now()
-		cache.mu.Unlock()
-		logger.Info("JWKS loaded", zap.Int("keys", len(keys)))
+		v.cache.mu.RLock()
+		logger.Info("JWKS loaded", zap.Int("keys", len(v.cache.keys)))
+		v.cache.mu.RUnlock()
 	}
+	go v.cache.refreshLoop(ctx)
+	return v
+}
 
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "missing authorization header",
-			})
-			return
-		}
+// verify validates an Authorization header value. The returned error's
+// message is the reason reported to the client.
+func (v *Verifier) verify(ctx context.Context, authHeader string) (*Claims, *tokenRef, error) {
+	if authHeader == "" {
+		return nil, nil, errors.New("missing authorization header")
+	}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "invalid authorization format, expected 'Bearer <token>'",
-			})
-			return
-		}
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return nil, nil, errors.New("invalid authorization format, expected 'Bearer <token>'")
+	}
+
+	// Parse without verification first to inspect header
+	parser := jwt.NewParser()
+	unverified, _, err := parser.ParseUnverified(tokenString, &Claims{})
+	if err != nil {
+		v.logger.Debug("jwt parse failed", zap.Error(err))
+		return nil, nil, errors.New("malformed token")
+	}
+
+	claims := &Claims{}
+	var token *jwt.Token
 
-		// Parse without verification first to inspect header
-		parser := jwt.NewParser()
-		unverified, _, err := parser.ParseUnverified(tokenString, &Claims{})
+	switch unverified.Method.Alg() {
+	case "ES256":
+		kid, _ := unverified.Header["kid"].(string)
+		pubKey, err := v.cache.get(kid)
 		if err != nil {
-			logger.Debug("jwt parse failed", zap.Error(err))
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "malformed token",
-			})
-			return
+			return nil, nil, err
 		}
 
-		var claims *Claims
-		var token *jwt.Token
-
-		switch unverified.Method.Alg() {
-		case "ES256":
-			kid, _ := unverified.Header["kid"].(string)
-			pubKey, err := cache.get(kid, supabaseURL, logger)
-			if err != nil {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-					"error": err.Error(),
-				})
-				return
+		token, err = jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+			if _, ok := t.Method.(*jwt.SigningMethodECDSA); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 			}
+			return pubKey, nil
+		}, v.parseOpts...)
 
-			claims = &Claims{}
-			token, err = jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-				if _, ok := t.Method.(*jwt.SigningMethodECDSA); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-				}
-				return pubKey, nil
-			})
+	case "HS256":
+		token, err = jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+			}
+			return v.hmacSecret, nil
+		}, v.parseOpts...)
 
-		case "HS256":
-			claims = &Claims{}
-			token, err = jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-				if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-				}
-				return hmacSecret, nil
-			})
+	default:
+		return nil, nil, fmt.Errorf("unsupported signing algorithm: %s", unverified.Method.Alg())
+	}
 
-		default:
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": fmt.Sprintf("unsupported signing algorithm: %s", unverified.Method.Alg()),
-			})
+	// A missing iss surfaces as a missing required claim.
+	if errors.Is(err, jwt.ErrTokenInvalidIssuer) ||
+		(v.cfg.Issuer != "" && claims.Issuer == "" && errors.Is(err, jwt.ErrTokenRequiredClaimMissing)) {
+		v.logger.Debug("jwt issuer rejected", zap.Error(err))
+		return nil, nil, errors.New("invalid token issuer")
+	}
+	if err != nil || !token.Valid {
+		v.logger.Debug("jwt validation failed", zap.Error(err))
+		return nil, nil, errors.New("invalid or expired token")
+	}
+	if !audienceAllowed(claims.Audience, v.cfg.Audience) {
+		v.logger.Debug("jwt audience rejected", zap.Strings("aud", claims.Audience))
+		return nil, nil, errors.New("invalid token audience")
+	}
+	if claims.Subject == "" {
+		return nil, nil, errors.New("token missing subject (user id)")
+	}
+
+	ref := &tokenRef{ID: tokenID(tokenString, claims)}
+	if claims.ExpiresAt != nil {
+		ref.ExpiresAt = claims.ExpiresAt.Time
+	}
+	if v.cfg.Blocklist != nil {
+		blocked, err := v.cfg.Blocklist.IsTokenBlocked(ctx, ref.ID)
+		if err != nil {
+			// Blocklist unavailable: fail open rather than locking everyone out.
+			v.logger.Debug("token blocklist check failed", zap.Error(err))
+		} else if blocked {
+			return nil, nil, errors.New("token has been revoked")
+		}
+	}
+	return claims, ref, nil
+}
+
+// setClaims stores the caller's identity in the gin context.
+func setClaims(c *gin.Context, claims *Claims, ref *tokenRef) {
+	c.Set(ContextKeyUserID, claims.Subject)
+	c.Set(contextKeyToken, ref)
+	if claims.Email != "" {
+		c.Set(ContextKeyEmail, claims.Email)
+	}
+	if claims.Role != "" {
+		c.Set(ContextKeyRole, claims.Role)
+	}
+}
+
+// Middleware returns a Gin middleware that validates Supabase JWT tokens
+// with v. It injects the user ID into the gin context under
+// ContextKeyUserID.
+func Middleware(v *Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Already authenticated as a service by APIKeyMiddleware
+		if _, ok := GetServicePrincipal(c); ok {
+			c.Next()
 			return
 		}
 
-		if err != nil || !token.Valid {
-			logger.Debug("jwt validation failed", zap.Error(err))
+		claims, ref, err := v.verify(c.Request.Context(), c.GetHeader("Authorization"))
+		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "invalid or expired token",
+				"error": err.Error(),
 			})
 			return
 		}
 
-		userID := claims.Subject
-		if userID == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "token missing subject (user id)",
-			})
+		setClaims(c, claims, ref)
+		c.Next()
+	}
+}
+
+// OptionalMiddleware is Middleware for routes that also serve anonymous
+// callers: a valid token sets the user ID as usual, while a missing or
+// invalid one leaves the request anonymous instead of returning 401.
+// Handlers branch on GetUserID.
+func OptionalMiddleware(v *Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Next()
+			return
+		}
+
+		claims, ref, err := v.verify(c.Request.Context(), header)
+		if err != nil {
+			v.logger.Debug("optional auth: ignoring invalid token", zap.Error(err))
+			c.Next()
 			return
 		}
 
-		c.Set(ContextKeyUserID, userID)
+		setClaims(c, claims, ref)
 		c.Next()
 	}
 }
 
+// audienceAllowed reports whether aud contains one of allowed. jwt/v5's
+// WithAudience only accepts a single value, so the set is checked here.
+func audienceAllowed(aud jwt.ClaimStrings, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range aud {
+		for _, want := range allowed {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // GetUserID extracts the authenticated user ID from the gin context.
 func GetUserID(c *gin.Context) (string, bool) {
 	id, exists := c.Get(ContextKeyUserID)
@@ -288,3 +434,23 @@ func GetUserID(c *gin.Context) (string, bool) {
 	}
 	return id.(string), true
 }
+
+// GetEmail returns the authenticated user's email, if the token carried one.
+func GetEmail(c *gin.Context) (string, bool) {
+	return getString(c, ContextKeyEmail)
+}
+
+// GetRole returns the authenticated user's role claim (e.g. "authenticated"),
+// if the token carried one.
+func GetRole(c *gin.Context) (string, bool) {
+	return getString(c, ContextKeyRole)
+}
+
+func getString(c *gin.Context, key string) (string, bool) {
+	v, exists := c.Get(key)
+	if !exists {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok && s != ""
+}
@@ -0,0 +1,408 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/auth"
+)
+
+const testJWTSecret = "test-secret"
+
+// stopOnCleanup returns a context cancelled when t finishes, so each test's
+// JWKS refresh goroutine exits with it.
+func stopOnCleanup(t *testing.T) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// testJWTConfig accepts HS256 tokens issued by a stub Supabase at url.
+func testJWTConfig(url string) auth.JWTConfig {
+	return auth.JWTConfig{
+		SupabaseURL: url,
+		Secret:      testJWTSecret,
+		Issuer:      url + "/auth/v1",
+		Audience:    []string{"authenticated"},
+	}
+}
+
+// newJWTRouter mounts auth.Middleware against a stub Supabase that serves no
+// JWKS, so only HS256 tokens verify.
+func newJWTRouter(t *testing.T) (*gin.Engine, string) {
+	t.Helper()
+	supabase := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(supabase.Close)
+	issuer := supabase.URL + "/auth/v1"
+
+	r := gin.New()
+	r.Use(auth.Middleware(auth.NewVerifier(stopOnCleanup(t), testJWTConfig(supabase.URL), zap.NewNop())))
+	r.GET("/me", func(c *gin.Context) {
+		id, _ := auth.GetUserID(c)
+		c.JSON(http.StatusOK, gin.H{"user_id": id})
+	})
+	return r, issuer
+}
+
+func signHS256(t *testing.T, claims auth.Claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return token
+}
+
+func TestMiddleware_IssuerAndAudience(t *testing.T) {
+	r, issuer := newJWTRouter(t)
+	claims := func(iss string, aud ...string) auth.Claims {
+		return auth.Claims{RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			Issuer:    iss,
+			Audience:  aud,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}}
+	}
+
+	tests := []struct {
+		name      string
+		claims    auth.Claims
+		wantCode  int
+		wantError string
+	}{
+		{"valid token", claims(issuer, "authenticated"), http.StatusOK, ""},
+		{"wrong issuer", claims("https://evil.example.com/auth/v1", "authenticated"), http.StatusUnauthorized, "invalid token issuer"},
+		{"missing issuer", claims("", "authenticated"), http.StatusUnauthorized, "invalid token issuer"},
+		{"wrong audience", claims(issuer, "anon"), http.StatusUnauthorized, "invalid token audience"},
+		{"one allowed audience among several", claims(issuer, "other", "authenticated"), http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+signHS256(t, tt.claims))
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantError == "" {
+				return
+			}
+			var resp map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp["error"] != tt.wantError {
+				t.Errorf("expected error %q, got %q", tt.wantError, resp["error"])
+			}
+		})
+	}
+}
+
+func TestMiddleware_EmailAndRole(t *testing.T) {
+	supabase := httptest.NewServer(http.NotFoundHandler())
+	defer supabase.Close()
+	issuer := supabase.URL + "/auth/v1"
+
+	r := gin.New()
+	r.Use(auth.Middleware(auth.NewVerifier(stopOnCleanup(t), testJWTConfig(supabase.URL), zap.NewNop())))
+	r.GET("/me", func(c *gin.Context) {
+		email, hasEmail := auth.GetEmail(c)
+		role, hasRole := auth.GetRole(c)
+		c.JSON(http.StatusOK, gin.H{"email": email, "has_email": hasEmail, "role": role, "has_role": hasRole})
+	})
+
+	tests := []struct {
+		name         string
+		email, role  string
+		wantHasEmail bool
+		wantHasRole  bool
+	}{
+		{"both claims", "runner@example.com", "authenticated", true, true},
+		{"no email", "", "service_role", false, true},
+		{"neither", "", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := signHS256(t, auth.Claims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Subject:   "user-1",
+					Issuer:    issuer,
+					Audience:  jwt.ClaimStrings{"authenticated"},
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+				},
+				Email: tt.email,
+				Role:  tt.role,
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var resp struct {
+				Email    string `json:"email"`
+				HasEmail bool   `json:"has_email"`
+				Role     string `json:"role"`
+				HasRole  bool   `json:"has_role"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.HasEmail != tt.wantHasEmail || resp.Email != tt.email {
+				t.Errorf("GetEmail = %q, %v; want %q, %v", resp.Email, resp.HasEmail, tt.email, tt.wantHasEmail)
+			}
+			if resp.HasRole != tt.wantHasRole || resp.Role != tt.role {
+				t.Errorf("GetRole = %q, %v; want %q, %v", resp.Role, resp.HasRole, tt.role, tt.wantHasRole)
+			}
+		})
+	}
+}
+
+func TestMiddleware_ClockSkewLeeway(t *testing.T) {
+	supabase := httptest.NewServer(http.NotFoundHandler())
+	defer supabase.Close()
+
+	// Expired 10s ago, as seen by a client whose clock runs fast.
+	token := signHS256(t, auth.Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "user-1",
+		Issuer:    supabase.URL + "/auth/v1",
+		Audience:  jwt.ClaimStrings{"authenticated"},
+		IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-10 * time.Second)),
+	}})
+
+	tests := []struct {
+		name     string
+		leeway   time.Duration
+		wantCode int
+	}{
+		{"accepted within 30s leeway", 30 * time.Second, http.StatusOK},
+		{"rejected with no leeway", 0, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testJWTConfig(supabase.URL)
+			cfg.ClockSkew = tt.leeway
+			r := gin.New()
+			r.Use(auth.Middleware(auth.NewVerifier(stopOnCleanup(t), cfg, zap.NewNop())))
+			r.GET("/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// fakeJWKS serves one P-256 key as kid "key-1" and counts fetches. Each
+// fetch takes delay, so concurrent misses overlap a single in-flight fetch.
+type fakeJWKS struct {
+	key     *ecdsa.PrivateKey
+	delay   time.Duration
+	fetches atomic.Int32
+}
+
+func (f *fakeJWKS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.fetches.Add(1)
+	time.Sleep(f.delay)
+	pub := f.key.PublicKey
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "EC", "crv": "P-256", "kid": "key-1", "alg": "ES256",
+			"x": base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+			"y": base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+		}},
+	})
+}
+
+func TestMiddleware_JWKSMissesShareOneFetch(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	jwks := &fakeJWKS{key: key, delay: 100 * time.Millisecond}
+	supabase := httptest.NewServer(jwks)
+	defer supabase.Close()
+
+	r := gin.New()
+	r.Use(auth.Middleware(auth.NewVerifier(stopOnCleanup(t), testJWTConfig(supabase.URL), zap.NewNop())))
+	r.GET("/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	sign := func(kid string) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodES256, auth.Claims{RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			Issuer:    supabase.URL + "/auth/v1",
+			Audience:  jwt.ClaimStrings{"authenticated"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}})
+		tok.Header["kid"] = kid
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+	do := func(token string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if got := jwks.fetches.Load(); got != 1 {
+		t.Fatalf("expected one startup fetch, got %d", got)
+	}
+	if code := do(sign("key-1")); code != http.StatusOK {
+		t.Fatalf("known kid: expected 200, got %d", code)
+	}
+
+	const n = 20
+	unknown := sign("rotated-key")
+	codes := make(chan int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- do(unknown)
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		if code != http.StatusUnauthorized {
+			t.Errorf("unknown kid: expected 401 after refresh, got %d", code)
+		}
+	}
+	if got := jwks.fetches.Load(); got != 2 {
+		t.Errorf("expected %d concurrent misses to share one fetch (2 total), got %d", n, got)
+	}
+}
+
+func TestVerifier_SharedByBothMiddlewares(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	jwks := &fakeJWKS{key: key}
+	supabase := httptest.NewServer(jwks)
+	defer supabase.Close()
+
+	v := auth.NewVerifier(stopOnCleanup(t), testJWTConfig(supabase.URL), zap.NewNop())
+	r := gin.New()
+	r.GET("/me", auth.Middleware(v), func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/public", auth.OptionalMiddleware(v), func(c *gin.Context) {
+		if _, ok := auth.GetUserID(c); !ok {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodES256, auth.Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "user-1",
+		Issuer:    supabase.URL + "/auth/v1",
+		Audience:  jwt.ClaimStrings{"authenticated"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}})
+	tok.Header["kid"] = "key-1"
+	signed, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	for _, path := range []string{"/me", "/public"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+signed)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", path, w.Code)
+		}
+	}
+	if got := jwks.fetches.Load(); got != 1 {
+		t.Errorf("expected one JWKS fetch for both middlewares, got %d", got)
+	}
+}
+
+func TestOptionalMiddleware(t *testing.T) {
+	supabase := httptest.NewServer(http.NotFoundHandler())
+	defer supabase.Close()
+
+	r := gin.New()
+	r.Use(auth.OptionalMiddleware(auth.NewVerifier(stopOnCleanup(t), testJWTConfig(supabase.URL), zap.NewNop())))
+	r.GET("/segments/:id", func(c *gin.Context) {
+		id, ok := auth.GetUserID(c)
+		c.JSON(http.StatusOK, gin.H{"user_id": id, "authenticated": ok})
+	})
+
+	valid := signHS256(t, auth.Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "user-1",
+		Issuer:    supabase.URL + "/auth/v1",
+		Audience:  jwt.ClaimStrings{"authenticated"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}})
+
+	tests := []struct {
+		name       string
+		header     string
+		wantUserID string
+	}{
+		{"no header proceeds anonymously", "", ""},
+		{"valid token proceeds with user id", "Bearer " + valid, "user-1"},
+		{"invalid token proceeds anonymously", "Bearer not-a-jwt", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/segments/seg-1", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+			var resp struct {
+				UserID        string `json:"user_id"`
+				Authenticated bool   `json:"authenticated"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.UserID != tt.wantUserID || resp.Authenticated != (tt.wantUserID != "") {
+				t.Errorf("got user %q (authenticated=%v), want %q", resp.UserID, resp.Authenticated, tt.wantUserID)
+			}
+		})
+	}
+}
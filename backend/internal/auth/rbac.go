@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole allows only callers whose role claim is one of roles. It must
+// run after Middleware, which stores the role; requests without a user are
+// rejected with 401 and those with any other (or no) role with 403.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(roles))
+	for _, r := range roles {
+		allowed[r] = true
+	}
+
+	return func(c *gin.Context) {
+		if _, ok := GetUserID(c); !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		role, _ := GetRole(c)
+		if !allowed[role] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient role"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,50 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/apexrun/backend/internal/auth"
+)
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   string
+		role     string
+		wantCode int
+	}{
+		{"admin passes", "user-1", "admin", http.StatusOK},
+		{"authenticated user forbidden", "user-2", "authenticated", http.StatusForbidden},
+		{"no role forbidden", "user-3", "", http.StatusForbidden},
+		{"no user unauthorized", "", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			// Stand-in for auth.Middleware.
+			r.Use(func(c *gin.Context) {
+				if tt.userID != "" {
+					c.Set(auth.ContextKeyUserID, tt.userID)
+				}
+				if tt.role != "" {
+					c.Set(auth.ContextKeyRole, tt.role)
+				}
+				c.Next()
+			})
+			r.POST("/segments/:id/verify", auth.RequireRole("admin"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("POST", "/segments/seg-1/verify", nil))
+			if w.Code != tt.wantCode {
+				t.Errorf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package coaching
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CoachAdvisor answers a training question given the athlete's week.
+type CoachAdvisor interface {
+	Advise(ctx context.Context, question string, summary *WeekSummary) (string, error)
+}
+
+// GeminiAdvisor calls Gemini's generateContent endpoint as
+// POST {baseURL}/v1beta/models/{model}:generateContent.
+type GeminiAdvisor struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+// NewGeminiAdvisor creates an advisor with the given request timeout.
+func NewGeminiAdvisor(baseURL, apiKey, model string, timeout time.Duration) *GeminiAdvisor {
+	return &GeminiAdvisor{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent  `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent `json:"contents"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content geminiContent `json:"content"`
+	} `json:"candidates"`
+}
+
+// coachInstruction frames every question for the model.
+const coachInstruction = "You are a running coach. Answer the athlete's question in a few short " +
+	"paragraphs, grounded in their training this week. Do not give medical advice."
+
+// Advise implements CoachAdvisor.
+func (a *GeminiAdvisor) Advise(ctx context.Context, question string, summary *WeekSummary) (string, error) {
+	body, err := json.Marshal(geminiRequest{
+		SystemInstruction: &geminiContent{Parts: []geminiPart{{Text: coachInstruction}}},
+		Contents: []geminiContent{{
+			Role:  "user",
+			Parts: []geminiPart{{Text: CoachPrompt(question, summary)}},
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("encode coach request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v1beta/models/%s:generateContent", a.baseURL, a.model)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("coach request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", a.apiKey)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("coach request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("coach model returned %d", resp.StatusCode)
+	}
+	var out geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("decode coach response: %w", err)
+	}
+
+	var text strings.Builder
+	if len(out.Candidates) > 0 {
+		for _, p := range out.Candidates[0].Content.Parts {
+			text.WriteString(p.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("coach model returned no text")
+	}
+	return strings.TrimSpace(text.String()), nil
+}
+
+// CoachPrompt renders the athlete's question with this week's training as
+// context.
+func CoachPrompt(question string, summary *WeekSummary) string {
+	var b strings.Builder
+	b.WriteString("Training this week:\n")
+	if summary == nil {
+		b.WriteString("- no data\n")
+	} else {
+		fmt.Fprintf(&b, "- runs: %d\n", summary.RunCount)
+		fmt.Fprintf(&b, "- distance: %.1f km\n", summary.TotalDistanceM/1000)
+		fmt.Fprintf(&b, "- duration: %.0f min\n", summary.TotalDurationS/60)
+		if summary.AvgPaceSecKm > 0 {
+			pace := int(summary.AvgPaceSecKm + 0.5)
+			fmt.Fprintf(&b, "- average pace: %d:%02d /km\n", pace/60, pace%60)
+		}
+		if z := summary.PaceZones; z != nil {
+			fmt.Fprintf(&b, "- time by pace zone: easy %.0f min, moderate %.0f min, hard %.0f min\n",
+				z.Easy/60, z.Moderate/60, z.Hard/60)
+		}
+	}
+	b.WriteString("\nQuestion: ")
+	b.WriteString(question)
+	return b.String()
+}
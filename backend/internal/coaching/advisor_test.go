@@ -0,0 +1,93 @@
+package coaching_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apexrun/backend/internal/coaching"
+)
+
+func TestCoachPrompt_IncludesWeekSummary(t *testing.T) {
+	summary := &coaching.WeekSummary{
+		RunCount:       3,
+		TotalDistanceM: 21500,
+		TotalDurationS: 6450,
+		AvgPaceSecKm:   300,
+		PaceZones:      &coaching.PaceZoneSeconds{Easy: 3600, Moderate: 1800, Hard: 1050},
+	}
+	prompt := coaching.CoachPrompt("Should I race on Sunday?", summary)
+
+	for _, want := range []string{"runs: 3", "distance: 21.5 km", "duration: 108 min", "average pace: 5:00 /km", "easy 60 min", "Question: Should I race on Sunday?"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt missing %q:\n%s", want, prompt)
+		}
+	}
+}
+
+func TestGeminiAdvisor(t *testing.T) {
+	var gotPath, gotKey, gotPrompt string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotKey = r.URL.Path, r.Header.Get("x-goog-api-key")
+		var body struct {
+			Contents []struct {
+				Parts []struct {
+					Text string `json:"text"`
+				} `json:"parts"`
+			} `json:"contents"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err == nil && len(body.Contents) > 0 && len(body.Contents[0].Parts) > 0 {
+			gotPrompt = body.Contents[0].Parts[0].Text
+		}
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"Keep Saturday easy, "},{"text":"then race.\n"}]}}]}`))
+	}))
+	defer srv.Close()
+
+	a := coaching.NewGeminiAdvisor(srv.URL+"/", "test-key", "gemini-test", time.Second)
+	got, err := a.Advise(context.Background(), "Should I race on Sunday?", &coaching.WeekSummary{RunCount: 2})
+	if err != nil {
+		t.Fatalf("Advise: %v", err)
+	}
+	if got != "Keep Saturday easy, then race." {
+		t.Errorf("got %q", got)
+	}
+	if gotPath != "/v1beta/models/gemini-test:generateContent" {
+		t.Errorf("path = %q", gotPath)
+	}
+	if gotKey != "test-key" {
+		t.Errorf("api key header = %q", gotKey)
+	}
+	if !strings.Contains(gotPrompt, "runs: 2") || !strings.Contains(gotPrompt, "Should I race on Sunday?") {
+		t.Errorf("prompt lacks summary or question:\n%s", gotPrompt)
+	}
+}
+
+func TestGeminiAdvisor_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"upstream error", http.StatusTooManyRequests, `{"error":{"message":"quota"}}`},
+		{"no candidates", http.StatusOK, `{"candidates":[]}`},
+		{"malformed", http.StatusOK, `not json`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			a := coaching.NewGeminiAdvisor(srv.URL, "k", "m", time.Second)
+			if _, err := a.Advise(context.Background(), "How was my week?", nil); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package coaching
+
+// Sexes AgeGrade has factors for; profiles store them as gender.
+const (
+	SexMale   = "male"
+	SexFemale = "female"
+)
+
+// AgeGrade accepts athletes between these ages.
+const (
+	minAgeGradeAge = 10
+	maxAgeGradeAge = 100
+)
+
+// ageFactorPoint is a road age factor at one age; factors between points
+// are interpolated linearly.
+type ageFactorPoint struct {
+	age    int
+	factor float64
+}
+
+// ageFactors approximate the WMA road-running age factors (open class,
+// ages 20-30, is 1.0), which vary little with distance from 5k to the
+// marathon, so one curve per sex serves every segment length.
+var ageFactors = map[string][]ageFactorPoint{
+	SexMale: {
+		{10, 0.80}, {12, 0.86}, {14, 0.91}, {16, 0.95}, {18, 0.98},
+		{20, 1.0}, {30, 1.0}, {35, 0.985}, {40, 0.955}, {45, 0.92},
+		{50, 0.885}, {55, 0.85}, {60, 0.815}, {65, 0.78}, {70, 0.745},
+		{75, 0.705}, {80, 0.66}, {85, 0.605}, {90, 0.535}, {95, 0.45},
+		{100, 0.35},
+	},
+	SexFemale: {
+		{10, 0.80}, {12, 0.855}, {14, 0.90}, {16, 0.94}, {18, 0.975},
+		{20, 1.0}, {30, 1.0}, {35, 0.985}, {40, 0.955}, {45, 0.92},
+		{50, 0.88}, {55, 0.84}, {60, 0.80}, {65, 0.76}, {70, 0.715},
+		{75, 0.67}, {80, 0.62}, {85, 0.56}, {90, 0.49}, {95, 0.41},
+		{100, 0.32},
+	},
+}
+
+// openStandard5kSeconds is the open-class 5k road standard (100%) per sex;
+// other distances are scaled from it with Riegel's formula.
+var openStandard5kSeconds = map[string]float64{
+	SexMale:   757,
+	SexFemale: 845,
+}
+
+// AgeGradeResult is an effort normalized to open-class age.
+type AgeGradeResult struct {
+	// GradedSeconds is the time an open-class athlete would need for an
+	// equivalent performance.
+	GradedSeconds float64 `json:"age_graded_seconds"`
+	// Percent is the performance level against the open standard for the
+	// distance (100 is world-standard).
+	Percent float64 `json:"age_grade_pct"`
+}
+
+// AgeGrade grades an effort of elapsedSeconds over distanceMeters by an
+// athlete of the given age and sex. It reports false when the effort cannot
+// be graded: non-positive inputs, an age outside 10-100, or a sex other
+// than SexMale or SexFemale.
+func AgeGrade(elapsedSeconds, distanceMeters float64, age int, sex string) (AgeGradeResult, bool) {
+	points, ok := ageFactors[sex]
+	if !ok || elapsedSeconds <= 0 || distanceMeters <= 0 || age < minAgeGradeAge || age > maxAgeGradeAge {
+		return AgeGradeResult{}, false
+	}
+
+	graded := elapsedSeconds * ageFactor(points, age)
+	standard := PredictRaceTime(openStandard5kSeconds[sex], 5000, distanceMeters)
+	return AgeGradeResult{
+		GradedSeconds: graded,
+		Percent:       standard / graded * 100,
+	}, true
+}
+
+// ageFactor interpolates the factor for age, which must lie within points.
+func ageFactor(points []ageFactorPoint, age int) float64 {
+	for i := 1; i < len(points); i++ {
+		lo, hi := points[i-1], points[i]
+		if age <= hi.age {
+			frac := float64(age-lo.age) / float64(hi.age-lo.age)
+			return lo.factor + (hi.factor-lo.factor)*frac
+		}
+	}
+	return points[len(points)-1].factor
+}
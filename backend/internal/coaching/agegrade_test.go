@@ -0,0 +1,63 @@
+package coaching_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/apexrun/backend/internal/coaching"
+)
+
+func TestAgeGrade(t *testing.T) {
+	tests := []struct {
+		name            string
+		seconds, meters float64
+		age             int
+		sex             string
+		wantSeconds     float64
+		wantPct         float64
+	}{
+		{"open class is ungraded", 1200, 5000, 25, coaching.SexMale, 1200, 63.08},
+		{"male 50 5k", 1200, 5000, 50, coaching.SexMale, 1062, 71.28},
+		{"interpolated between anchors", 1200, 5000, 42, coaching.SexMale, 1129.2, 67.04},
+		{"female 60 5k", 1500, 5000, 60, coaching.SexFemale, 1200, 70.42},
+		{"standard scales with distance", 2500, 10000, 50, coaching.SexMale, 2212.5, 71.34},
+		{"youngest graded age", 1200, 5000, 10, coaching.SexFemale, 960, 88.02},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := coaching.AgeGrade(tt.seconds, tt.meters, tt.age, tt.sex)
+			if !ok {
+				t.Fatal("expected effort to be graded")
+			}
+			if math.Abs(got.GradedSeconds-tt.wantSeconds) > 0.05 {
+				t.Errorf("GradedSeconds = %.2f, want %.1f", got.GradedSeconds, tt.wantSeconds)
+			}
+			if math.Abs(got.Percent-tt.wantPct) > 0.01 {
+				t.Errorf("Percent = %.3f, want %.2f", got.Percent, tt.wantPct)
+			}
+		})
+	}
+}
+
+func TestAgeGrade_Ungradable(t *testing.T) {
+	tests := []struct {
+		name            string
+		seconds, meters float64
+		age             int
+		sex             string
+	}{
+		{"sex without factors", 1200, 5000, 40, "other"},
+		{"no sex", 1200, 5000, 40, ""},
+		{"too young", 1200, 5000, 9, coaching.SexMale},
+		{"too old", 1200, 5000, 101, coaching.SexFemale},
+		{"no time", 0, 5000, 40, coaching.SexMale},
+		{"no distance", 1200, 0, 40, coaching.SexMale},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, ok := coaching.AgeGrade(tt.seconds, tt.meters, tt.age, tt.sex); ok {
+				t.Errorf("expected no grade, got %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package coaching
+
+// Exponentially weighted time constants, in days, of the fitness-fatigue
+// model.
+const (
+	ctlDays = 42 // chronic training load ("fitness")
+	atlDays = 7  // acute training load ("fatigue")
+)
+
+// fitnessWarmupDays of load before the requested window seed CTL, which
+// otherwise starts from zero and takes weeks to become meaningful.
+const fitnessWarmupDays = ctlDays
+
+// ComputeFitnessFatigue returns the CTL, ATL and TSB series for daily
+// training stress (one entry per consecutive day, zero for rest days, oldest
+// first). Both loads start at 0 and each day moves toward that day's stress
+// by 1/N of the difference:
+//
+//	CTL[i] = CTL[i-1] + (daily[i] - CTL[i-1]) / 42
+//	ATL[i] = ATL[i-1] + (daily[i] - ATL[i-1]) / 7
+//	TSB[i] = CTL[i] - ATL[i]
+//
+// so a rest day decays both loads rather than being skipped.
+func ComputeFitnessFatigue(daily []float64) (ctl, atl, tsb []float64) {
+	ctl = make([]float64, len(daily))
+	atl = make([]float64, len(daily))
+	tsb = make([]float64, len(daily))
+	var c, a float64
+	for i, load := range daily {
+		c += (load - c) / ctlDays
+		a += (load - a) / atlDays
+		ctl[i], atl[i], tsb[i] = c, a, c-a
+	}
+	return ctl, atl, tsb
+}
+
+// FitnessDay is one day of the fitness-fatigue model.
+type FitnessDay struct {
+	Date   string  `json:"date"` // YYYY-MM-DD
+	Stress float64 `json:"stress"`
+	CTL    float64 `json:"ctl"`
+	ATL    float64 `json:"atl"`
+	TSB    float64 `json:"tsb"`
+}
+
+// Fitness is the fitness (CTL), fatigue (ATL) and form (TSB) series for a
+// window, oldest day first.
+type Fitness struct {
+	Days  int          `json:"days"`
+	Daily []FitnessDay `json:"daily"`
+	Hint  string       `json:"hint,omitempty"`
+}
+
+// buildFitness runs the model over load and keeps the last days days.
+func buildFitness(load *TrainingLoad, days int) *Fitness {
+	stress := make([]float64, len(load.Daily))
+	for i, d := range load.Daily {
+		stress[i] = d.Stress
+	}
+	ctl, atl, tsb := ComputeFitnessFatigue(stress)
+
+	f := &Fitness{Days: days, Daily: make([]FitnessDay, 0, days), Hint: load.Hint}
+	for i := max(0, len(stress)-days); i < len(stress); i++ {
+		f.Daily = append(f.Daily, FitnessDay{
+			Date:   load.Daily[i].Date,
+			Stress: stress[i],
+			CTL:    round1(ctl[i]),
+			ATL:    round1(atl[i]),
+			TSB:    round1(tsb[i]),
+		})
+	}
+	return f
+}
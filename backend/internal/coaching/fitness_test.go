@@ -0,0 +1,99 @@
+package coaching_test
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+
+	"github.com/apexrun/backend/internal/coaching"
+)
+
+func TestComputeFitnessFatigue(t *testing.T) {
+	// Hand-computed: each day moves CTL by 1/42 and ATL by 1/7 of the gap to
+	// that day's load.
+	//   day 1 (70): CTL = 70/42         = 1.666667  ATL = 70/7    = 10
+	//   day 2 (0):  CTL = 1.666667*41/42 = 1.626984  ATL = 10*6/7  = 8.571429
+	//   day 3 (0):  CTL = 1.626984*41/42 = 1.588246  ATL = 8.571429*6/7 = 7.346939
+	//   day 4 (70): CTL = 1.588246 + (70-1.588246)/42 = 3.217098
+	//               ATL = 7.346939 + (70-7.346939)/7  = 16.297376
+	daily := []float64{70, 0, 0, 70}
+	wantCTL := []float64{1.666667, 1.626984, 1.588246, 3.217098}
+	wantATL := []float64{10, 8.571429, 7.346939, 16.297376}
+
+	ctl, atl, tsb := coaching.ComputeFitnessFatigue(daily)
+	if len(ctl) != 4 || len(atl) != 4 || len(tsb) != 4 {
+		t.Fatalf("expected 4 values per series, got %d/%d/%d", len(ctl), len(atl), len(tsb))
+	}
+	for i := range daily {
+		if math.Abs(ctl[i]-wantCTL[i]) > 1e-6 {
+			t.Errorf("CTL[%d] = %.6f, want %.6f", i, ctl[i], wantCTL[i])
+		}
+		if math.Abs(atl[i]-wantATL[i]) > 1e-6 {
+			t.Errorf("ATL[%d] = %.6f, want %.6f", i, atl[i], wantATL[i])
+		}
+		if want := wantCTL[i] - wantATL[i]; math.Abs(tsb[i]-want) > 1e-6 {
+			t.Errorf("TSB[%d] = %.6f, want %.6f", i, tsb[i], want)
+		}
+	}
+}
+
+func TestComputeFitnessFatigue_RestDaysDecay(t *testing.T) {
+	// Two weeks off after one session: both loads must fall by
+	// (1-1/N) per day, not hold their last value.
+	const rest = 14
+	daily := make([]float64, 1+rest)
+	daily[0] = 100
+
+	ctl, atl, tsb := coaching.ComputeFitnessFatigue(daily)
+	wantCTL := 100.0 / 42 * math.Pow(41.0/42, rest)
+	wantATL := 100.0 / 7 * math.Pow(6.0/7, rest)
+	if math.Abs(ctl[rest]-wantCTL) > 1e-9 || math.Abs(atl[rest]-wantATL) > 1e-9 {
+		t.Errorf("after %d rest days got CTL %.6f ATL %.6f, want %.6f %.6f", rest, ctl[rest], atl[rest], wantCTL, wantATL)
+	}
+	// Fatigue clears faster than fitness, so form turns positive.
+	if tsb[0] >= 0 || tsb[rest] <= 0 {
+		t.Errorf("expected TSB negative after the session and positive after rest, got %.3f then %.3f", tsb[0], tsb[rest])
+	}
+}
+
+func TestComputeFitnessFatigue_SteadyLoadConverges(t *testing.T) {
+	daily := make([]float64, 42)
+	for i := range daily {
+		daily[i] = 100
+	}
+	ctl, atl, _ := coaching.ComputeFitnessFatigue(daily)
+	// 100 * (1 - (41/42)^42) and 100 * (1 - (6/7)^42)
+	if math.Abs(ctl[41]-63.654405) > 1e-6 {
+		t.Errorf("CTL after 42 days = %.6f, want 63.654405", ctl[41])
+	}
+	if math.Abs(atl[41]-99.845747) > 1e-6 {
+		t.Errorf("ATL after 42 days = %.6f, want 99.845747", atl[41])
+	}
+}
+
+func TestComputeFitnessFatigue_Empty(t *testing.T) {
+	ctl, atl, tsb := coaching.ComputeFitnessFatigue(nil)
+	if len(ctl) != 0 || len(atl) != 0 || len(tsb) != 0 {
+		t.Errorf("expected empty series, got %v %v %v", ctl, atl, tsb)
+	}
+}
+
+func TestFitness_WindowAfterWarmup(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	mock.ExpectQuery("FROM user_profiles").WithArgs("user-1").WillReturnError(sql.ErrNoRows)
+
+	f, err := repo.Fitness(context.Background(), "user-1", 30)
+	if err != nil {
+		t.Fatalf("Fitness: %v", err)
+	}
+	if f.Days != 30 || len(f.Daily) != 30 {
+		t.Errorf("expected 30 days, got %d (%d entries)", f.Days, len(f.Daily))
+	}
+	if f.Hint == "" {
+		t.Error("expected the threshold pace hint")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
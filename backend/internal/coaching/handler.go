@@ -1,28 +1,64 @@
 package coaching
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
 	"github.com/apexrun/backend/internal/auth"
+	"github.com/apexrun/backend/internal/database"
 )
 
+// Listing defaults to the next four weeks and is capped at a year.
+const (
+	defaultWorkoutRangeDays = 28
+	maxWorkoutRangeDays     = 366
+)
+
+// Training load windows default to four weeks (the usual chronic window),
+// fitness windows to about three months.
+const (
+	defaultLoadDays    = 28
+	defaultFitnessDays = 90
+	maxLoadDays        = 365
+)
+
+// maxTargetMeters caps custom prediction targets (well past a 100-miler).
+const maxTargetMeters = 200000
+
 // Handler serves AI coaching HTTP endpoints.
 type Handler struct {
-	repo   *Repository
-	logger *zap.Logger
+	repo    *Repository
+	db      *database.DB
+	advisor CoachAdvisor
+	logger  *zap.Logger
 }
 
-// NewHandler creates a new coaching handler.
-func NewHandler(repo *Repository, logger *zap.Logger) *Handler {
-	return &Handler{repo: repo, logger: logger}
+// NewHandler creates a new coaching handler. db is used only for its
+// connection state so requests can fail fast while the database is down.
+// advisor may be nil, in which case Analyze leaves the LLM call to the client.
+func NewHandler(repo *Repository, db *database.DB, advisor CoachAdvisor, logger *zap.Logger) *Handler {
+	return &Handler{repo: repo, db: db, advisor: advisor, logger: logger}
 }
 
 // RegisterRoutes mounts coaching routes on the given RouterGroup.
 func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	rg.GET("/daily", h.DailyWorkout)
+	rg.GET("/summary", h.WeekSummary)
+	rg.GET("/summary/monthly", h.MonthlySummary)
+	rg.GET("/summary/yearly", h.YearlySummary)
+	rg.GET("/load", h.TrainingLoad)
+	rg.GET("/fitness", h.Fitness)
+	rg.GET("/streak", h.Streak)
+	rg.GET("/predict", h.PredictRaceTimes)
+	rg.POST("/workouts", h.CreateWorkout)
+	rg.GET("/workouts", h.ListWorkouts)
+	rg.POST("/workouts/:id/complete", h.CompleteWorkout)
 	rg.POST("/analyze", h.Analyze)
 }
 
@@ -35,6 +71,10 @@ func (h *Handler) DailyWorkout(c *gin.Context) {
 		return
 	}
 
+	if !h.requireDB(c) {
+		return
+	}
+
 	ctx := c.Request.Context()
 
 	workout, err := h.repo.GetTodaysWorkout(ctx, userID)
@@ -58,10 +98,367 @@ func (h *Handler) DailyWorkout(c *gin.Context) {
 	})
 }
 
+// WeekSummary handles GET /api/v1/coaching/summary?week=2024-03-11
+// Returns the training summary for the Monday-Sunday week containing the
+// given date, bounded by local midnight in the user's timezone (default:
+// the current local week).
+func (h *Handler) WeekSummary(c *gin.Context) {
+	userID, ok := auth.SubjectUserID(c)
+	if !ok {
+		return
+	}
+
+	var day time.Time
+	if v := c.Query("week"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "week must be a date (YYYY-MM-DD)"})
+			return
+		}
+		day = parsed
+	}
+
+	if !h.requireDB(c) {
+		return
+	}
+
+	var summary *WeekSummary
+	var err error
+	if day.IsZero() {
+		summary, err = h.repo.GetWeekSummary(c.Request.Context(), userID)
+	} else {
+		summary, err = h.repo.GetWeekSummaryFor(c.Request.Context(), userID, day)
+	}
+	if err != nil {
+		h.logger.Error("get week summary", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, WeekSummaryResponse{
+		WeekStart:   summary.WeekStart.Format("2006-01-02"),
+		WeekSummary: summary,
+	})
+}
+
+// MonthlySummary handles GET /api/v1/coaching/summary/monthly?month=2024-03
+// Returns the training summary for a calendar month (default: this month)
+// compared to the month before.
+func (h *Handler) MonthlySummary(c *gin.Context) {
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if v := c.Query("month"); v != "" {
+		parsed, err := time.Parse("2006-01", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "month must be YYYY-MM"})
+			return
+		}
+		start = parsed
+	}
+	h.periodSummary(c, start, start.AddDate(0, 1, 0))
+}
+
+// YearlySummary handles GET /api/v1/coaching/summary/yearly?year=2024
+// Returns the training summary for a calendar year (default: this year)
+// compared to the year before.
+func (h *Handler) YearlySummary(c *gin.Context) {
+	start := time.Date(time.Now().UTC().Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	if v := c.Query("year"); v != "" {
+		parsed, err := time.Parse("2006", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "year must be YYYY"})
+			return
+		}
+		start = parsed
+	}
+	h.periodSummary(c, start, start.AddDate(1, 0, 0))
+}
+
+// periodSummary responds with the subject's summary for [start, end).
+func (h *Handler) periodSummary(c *gin.Context, start, end time.Time) {
+	userID, ok := auth.SubjectUserID(c)
+	if !ok {
+		return
+	}
+	if !h.requireDB(c) {
+		return
+	}
+
+	summary, err := h.repo.GetPeriodSummary(c.Request.Context(), userID, start, end)
+	if err != nil {
+		h.logger.Error("get period summary", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// TrainingLoad handles GET /api/v1/coaching/load?days=28
+// Returns daily TSS-style stress for the last days days plus acute and
+// chronic load.
+func (h *Handler) TrainingLoad(c *gin.Context) {
+	userID, ok := auth.SubjectUserID(c)
+	if !ok {
+		return
+	}
+
+	days, ok := parseDays(c, defaultLoadDays)
+	if !ok {
+		return
+	}
+
+	if !h.requireDB(c) {
+		return
+	}
+
+	load, err := h.repo.TrainingLoad(c.Request.Context(), userID, days)
+	if err != nil {
+		h.logger.Error("training load", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, load)
+}
+
+// Fitness handles GET /api/v1/coaching/fitness?days=90
+// Returns daily fitness (CTL), fatigue (ATL) and form (TSB).
+func (h *Handler) Fitness(c *gin.Context) {
+	userID, ok := auth.SubjectUserID(c)
+	if !ok {
+		return
+	}
+
+	days, ok := parseDays(c, defaultFitnessDays)
+	if !ok {
+		return
+	}
+
+	if !h.requireDB(c) {
+		return
+	}
+
+	fitness, err := h.repo.Fitness(c.Request.Context(), userID, days)
+	if err != nil {
+		h.logger.Error("fitness", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, fitness)
+}
+
+// Streak handles GET /api/v1/coaching/streak
+// Returns the current and longest run of consecutive active days.
+func (h *Handler) Streak(c *gin.Context) {
+	userID, ok := auth.SubjectUserID(c)
+	if !ok {
+		return
+	}
+
+	if !h.requireDB(c) {
+		return
+	}
+
+	streaks, err := h.repo.Streaks(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Error("streaks", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, streaks)
+}
+
+// PredictRaceTimes handles GET /api/v1/coaching/predict?target=21097
+// Predicts 5k/10k/half/marathon times (and ?target meters) with Riegel's
+// formula from the user's best recent standard-distance run.
+func (h *Handler) PredictRaceTimes(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var target float64
+	if v := c.Query("target"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t <= 0 || t > maxTargetMeters {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "target must be a distance in meters between 0 and 200000"})
+			return
+		}
+		target = t
+	}
+
+	if !h.requireDB(c) {
+		return
+	}
+
+	resp, err := h.repo.PredictRaceTimes(c.Request.Context(), userID, target)
+	if err != nil {
+		h.logger.Error("predict race times", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// parseDays reads ?days (1-365, default def). Returns false if it responded
+// with 400.
+func parseDays(c *gin.Context, def int) (int, bool) {
+	v := c.Query("days")
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > maxLoadDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+		return 0, false
+	}
+	return n, true
+}
+
+// CreateWorkout handles POST /api/v1/coaching/workouts
+// Past planned dates are rejected unless ?backfill=true.
+func (h *Handler) CreateWorkout(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req CreateWorkoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	planned, err := time.Parse("2006-01-02", req.PlannedDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "planned_date must be a date (YYYY-MM-DD)"})
+		return
+	}
+	if planned.Before(today()) && c.Query("backfill") != "true" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "planned_date is in the past; pass ?backfill=true to record it"})
+		return
+	}
+
+	if !h.requireDB(c) {
+		return
+	}
+
+	workout, err := h.repo.CreateWorkout(c.Request.Context(), userID, &req)
+	if err != nil {
+		h.logger.Error("create workout", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, workout)
+}
+
+// ListWorkouts handles GET /api/v1/coaching/workouts?from=&to=
+// Dates are YYYY-MM-DD and inclusive; from defaults to today and to to four
+// weeks after from.
+func (h *Handler) ListWorkouts(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	from := today()
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'from': expected YYYY-MM-DD"})
+			return
+		}
+		from = t
+	}
+	to := from.AddDate(0, 0, defaultWorkoutRangeDays-1)
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid 'to': expected YYYY-MM-DD"})
+			return
+		}
+		to = t
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'from' must not be after 'to'"})
+		return
+	}
+	if to.Sub(from) >= maxWorkoutRangeDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date range must not exceed 366 days"})
+		return
+	}
+
+	if !h.requireDB(c) {
+		return
+	}
+
+	workouts, err := h.repo.ListWorkouts(c.Request.Context(), userID, from, to)
+	if err != nil {
+		h.logger.Error("list workouts", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workouts": workouts,
+		"count":    len(workouts),
+		"from":     from.Format("2006-01-02"),
+		"to":       to.Format("2006-01-02"),
+	})
+}
+
+// today returns midnight UTC of the current date.
+func today() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// CompleteWorkout handles POST /api/v1/coaching/workouts/:id/complete
+// Marks a planned workout done, optionally linking {"activity_id": "..."}.
+func (h *Handler) CompleteWorkout(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// The body is optional.
+	var req CompleteWorkoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.requireDB(c) {
+		return
+	}
+
+	workout, err := h.repo.CompleteWorkout(c.Request.Context(), userID, c.Param("id"), req.ActivityID)
+	if err != nil {
+		h.logger.Error("complete workout", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	if workout == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "workout not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, workout)
+}
+
 // Analyze handles POST /api/v1/coaching/analyze
-// Returns the user's weekly training summary for client-side AI analysis.
-// Note: Actual Gemini LLM calls happen on the Flutter client (CoachingDataSource).
-// This endpoint provides the structured data the AI model needs.
+// With an advisor configured, answers the question server-side using the
+// user's weekly training summary as context. Otherwise it echoes the
+// question and returns the summary so the Flutter client
+// (CoachingDataSource) can call Gemini itself.
 func (h *Handler) Analyze(c *gin.Context) {
 	userID, ok := auth.GetUserID(c)
 	if !ok {
@@ -75,6 +472,10 @@ func (h *Handler) Analyze(c *gin.Context) {
 		return
 	}
 
+	if !h.requireDB(c) {
+		return
+	}
+
 	weekSummary, err := h.repo.GetWeekSummary(c.Request.Context(), userID)
 	if err != nil {
 		h.logger.Error("get week summary for analysis", zap.Error(err))
@@ -82,8 +483,37 @@ func (h *Handler) Analyze(c *gin.Context) {
 		return
 	}
 
+	analysis := req.Question // echo back; the client runs the LLM
+	if h.advisor != nil {
+		analysis, err = h.advisor.Advise(c.Request.Context(), req.Question, weekSummary)
+		if err != nil {
+			h.logger.Error("coach advisor", zap.Error(err))
+			c.JSON(http.StatusBadGateway, gin.H{"error": "coaching model unavailable"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, AnalyzeResponse{
-		Analysis:    req.Question, // Echo back; actual LLM processing is client-side
+		Analysis:    analysis,
 		WeekSummary: weekSummary,
 	})
 }
+
+// requireDB responds 503 with a database_unavailable code when the pool is
+// missing or the last health state is disconnected, so clients get a clear
+// retry signal instead of a generic 500. Returns false if it responded.
+func (h *Handler) requireDB(c *gin.Context) bool {
+	if h.db != nil && h.db.GetPool() != nil && h.db.IsConnected() {
+		return true
+	}
+
+	h.logger.Warn("coaching request degraded: database unavailable",
+		zap.String("path", c.FullPath()),
+	)
+	c.Header("Retry-After", "30")
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error": "database unavailable",
+		"code":  "database_unavailable",
+	})
+	return false
+}
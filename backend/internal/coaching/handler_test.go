@@ -0,0 +1,327 @@
+package coaching_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/auth"
+	"github.com/apexrun/backend/internal/coaching"
+	"github.com/apexrun/backend/internal/database"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// setupTestRouter creates a gin router with a fake authenticated user.
+func setupTestRouter(userID string) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(auth.ContextKeyUserID, userID)
+		c.Next()
+	})
+	return r
+}
+
+func TestCoaching_NilPoolReturns503(t *testing.T) {
+	log := zap.NewNop()
+	// An empty DSN yields a stub DB with a nil pool.
+	db := database.New(context.Background(), "", 1, 1, 0, database.DefaultRetryPolicy(), log)
+	h := coaching.NewHandler(coaching.NewRepository(db.GetPool(), log), db, nil, log)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"daily workout", "GET", "/coaching/daily", ""},
+		{"analyze", "POST", "/coaching/analyze", `{"question":"How was my week?"}`},
+		{"week summary", "GET", "/coaching/summary?week=2024-03-11", ""},
+		{"complete workout", "POST", "/coaching/workouts/w1/complete", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupTestRouter("user-1")
+			h.RegisterRoutes(router.Group("/coaching"))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusServiceUnavailable {
+				t.Fatalf("expected 503, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var resp map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unmarshal failed: %v", err)
+			}
+			if resp["code"] != "database_unavailable" {
+				t.Errorf("expected code 'database_unavailable', got %v", resp["code"])
+			}
+			if _, ok := resp["week_summary"]; ok {
+				t.Error("expected week_summary to be omitted")
+			}
+		})
+	}
+}
+
+func TestWeekSummary_InvalidDate(t *testing.T) {
+	log := zap.NewNop()
+	db := database.New(context.Background(), "", 1, 1, 0, database.DefaultRetryPolicy(), log)
+	h := coaching.NewHandler(coaching.NewRepository(db.GetPool(), log), db, nil, log)
+
+	for _, week := range []string{"last-week", "2024-13-01", "11/03/2024"} {
+		t.Run(week, func(t *testing.T) {
+			router := setupTestRouter("user-1")
+			h.RegisterRoutes(router.Group("/coaching"))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/coaching/summary?week="+week, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCompleteWorkout_InvalidActivityID(t *testing.T) {
+	log := zap.NewNop()
+	db := database.New(context.Background(), "", 1, 1, 0, database.DefaultRetryPolicy(), log)
+	h := coaching.NewHandler(coaching.NewRepository(db.GetPool(), log), db, nil, log)
+
+	router := setupTestRouter("user-1")
+	h.RegisterRoutes(router.Group("/coaching"))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/coaching/workouts/w1/complete", strings.NewReader(`{"activity_id":"not-a-uuid"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCoaching_RequestValidation(t *testing.T) {
+	log := zap.NewNop()
+	db := database.New(context.Background(), "", 1, 1, 0, database.DefaultRetryPolicy(), log)
+	h := coaching.NewHandler(coaching.NewRepository(db.GetPool(), log), db, nil, log)
+
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02")
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	workout := func(workoutType, date string) string {
+		return fmt.Sprintf(`{"workout_type":%q,"planned_date":%q,"description":"easy 8k"}`, workoutType, date)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+	}{
+		{"unknown workout type", "POST", "/coaching/workouts", workout("fartlek", tomorrow), http.StatusBadRequest},
+		{"unparseable date", "POST", "/coaching/workouts", workout("easy", "next tuesday"), http.StatusBadRequest},
+		{"past date", "POST", "/coaching/workouts", workout("easy", yesterday), http.StatusBadRequest},
+		// Valid requests reach the database check.
+		{"past date with backfill", "POST", "/coaching/workouts?backfill=true", workout("easy", yesterday), http.StatusServiceUnavailable},
+		{"future date", "POST", "/coaching/workouts", workout("long_run", tomorrow), http.StatusServiceUnavailable},
+		{"bad from", "GET", "/coaching/workouts?from=2024-3-1", "", http.StatusBadRequest},
+		{"to before from", "GET", "/coaching/workouts?from=2024-03-11&to=2024-03-10", "", http.StatusBadRequest},
+		{"range too long", "GET", "/coaching/workouts?from=2024-01-01&to=2025-01-01", "", http.StatusBadRequest},
+		{"valid range", "GET", "/coaching/workouts?from=2024-03-11&to=2024-03-24", "", http.StatusServiceUnavailable},
+		{"load days not a number", "GET", "/coaching/load?days=month", "", http.StatusBadRequest},
+		{"load days too large", "GET", "/coaching/load?days=400", "", http.StatusBadRequest},
+		{"load days valid", "GET", "/coaching/load?days=42", "", http.StatusServiceUnavailable},
+		{"fitness days invalid", "GET", "/coaching/fitness?days=0", "", http.StatusBadRequest},
+		{"fitness default window", "GET", "/coaching/fitness", "", http.StatusServiceUnavailable},
+		{"streak", "GET", "/coaching/streak", "", http.StatusServiceUnavailable},
+		{"month not YYYY-MM", "GET", "/coaching/summary/monthly?month=2024-3", "", http.StatusBadRequest},
+		{"month out of range", "GET", "/coaching/summary/monthly?month=2024-13", "", http.StatusBadRequest},
+		{"valid month", "GET", "/coaching/summary/monthly?month=2024-02", "", http.StatusServiceUnavailable},
+		{"year not YYYY", "GET", "/coaching/summary/yearly?year=24", "", http.StatusBadRequest},
+		{"valid year", "GET", "/coaching/summary/yearly?year=2024", "", http.StatusServiceUnavailable},
+		{"predict target not a number", "GET", "/coaching/predict?target=half", "", http.StatusBadRequest},
+		{"predict target negative", "GET", "/coaching/predict?target=-5000", "", http.StatusBadRequest},
+		{"predict target", "GET", "/coaching/predict?target=21097", "", http.StatusServiceUnavailable},
+		{"predict standard distances only", "GET", "/coaching/predict", "", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupTestRouter("user-1")
+			h.RegisterRoutes(router.Group("/coaching"))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// fakeAdvisor records what Analyze passed it.
+type fakeAdvisor struct {
+	answer   string
+	err      error
+	question string
+	summary  *coaching.WeekSummary
+}
+
+func (f *fakeAdvisor) Advise(_ context.Context, question string, summary *coaching.WeekSummary) (string, error) {
+	f.question, f.summary = question, summary
+	return f.answer, f.err
+}
+
+func TestAnalyze_Advisor(t *testing.T) {
+	tests := []struct {
+		name         string
+		advisor      *fakeAdvisor
+		wantCode     int
+		wantAnalysis string
+	}{
+		{"no advisor echoes the question", nil, http.StatusOK, "How was my week?"},
+		{"advisor answers", &fakeAdvisor{answer: "Solid week; rest tomorrow."}, http.StatusOK, "Solid week; rest tomorrow."},
+		{"advisor failure", &fakeAdvisor{err: errors.New("model down")}, http.StatusBadGateway, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock: %v", err)
+			}
+			defer sqlDB.Close()
+			db := &database.DB{Pool: sqlDB}
+			if err := db.HealthCheck(context.Background()); err != nil {
+				t.Fatalf("health check: %v", err)
+			}
+			mock.ExpectQuery("SELECT timezone FROM user_profiles").WillReturnError(sql.ErrNoRows)
+			mock.ExpectQuery("FROM activities").
+				WillReturnRows(sqlmock.NewRows([]string{"count", "dist", "dur"}).AddRow(4, 32000.0, 9600.0))
+			mock.ExpectQuery("FROM user_profiles").WillReturnError(sql.ErrNoRows)
+
+			var advisor coaching.CoachAdvisor
+			if tt.advisor != nil {
+				advisor = tt.advisor
+			}
+			log := zap.NewNop()
+			h := coaching.NewHandler(coaching.NewRepository(sqlDB, log), db, advisor, log)
+			router := setupTestRouter("user-1")
+			h.RegisterRoutes(router.Group("/coaching"))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/coaching/analyze", strings.NewReader(`{"question":"How was my week?"}`))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.advisor != nil {
+				if tt.advisor.question != "How was my week?" {
+					t.Errorf("advisor got question %q", tt.advisor.question)
+				}
+				if tt.advisor.summary == nil || tt.advisor.summary.RunCount != 4 {
+					t.Errorf("advisor got summary %+v, want the week's 4 runs", tt.advisor.summary)
+				}
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var resp coaching.AnalyzeResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if resp.Analysis != tt.wantAnalysis {
+				t.Errorf("analysis = %q, want %q", resp.Analysis, tt.wantAnalysis)
+			}
+			if resp.WeekSummary == nil || resp.WeekSummary.RunCount != 4 {
+				t.Errorf("week_summary = %+v", resp.WeekSummary)
+			}
+		})
+	}
+}
+
+func TestStreak_ServicePrincipal(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+	}{
+		{"scoped key reads a named user", "/api/v1/coaching/streak?user_id=user-1", http.StatusOK},
+		{"scoped key must name a user", "/api/v1/coaching/streak", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock: %v", err)
+			}
+			defer sqlDB.Close()
+			db := &database.DB{Pool: sqlDB}
+			if err := db.HealthCheck(context.Background()); err != nil {
+				t.Fatalf("health check: %v", err)
+			}
+			mock.ExpectQuery("FROM api_keys").
+				WithArgs(auth.HashAPIKey("apx_analytics")).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "scopes", "created_by", "last_used_at", "created_at"}).
+					AddRow("key-1", "analytics", "{/api/v1/coaching}", nil, nil, time.Now()))
+			mock.ExpectExec("UPDATE api_keys SET last_used_at").
+				WithArgs("key-1").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			if tt.wantCode == http.StatusOK {
+				expectActiveDays(mock, nil, 0, 1)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			log := zap.NewNop()
+			router := gin.New()
+			api := router.Group("/api/v1")
+			api.Use(auth.APIKeyMiddleware(auth.NewAPIKeyRepository(sqlDB, log), 10, log))
+			api.Use(auth.Middleware(auth.NewVerifier(ctx, auth.JWTConfig{}, log)))
+			coaching.NewHandler(coaching.NewRepository(sqlDB, log), db, nil, log).RegisterRoutes(api.Group("/coaching"))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set(auth.HeaderAPIKey, "apx_analytics")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantCode == http.StatusOK {
+				var got coaching.StreakResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+					t.Fatalf("unmarshal: %v", err)
+				}
+				if got.Current != 2 {
+					t.Errorf("current = %d, want 2", got.Current)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package coaching
+
+import (
+	"math"
+	"time"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+// Acute load averages the most recent week; chronic load the whole window.
+const acuteLoadDays = 7
+
+// StressScore is a running TSS-style training stress score:
+// hours * IF^2 * 100, where the intensity factor IF is threshold pace over
+// the activity's average pace (both sec/km, so faster than threshold is
+// above 1). An hour at threshold pace scores 100. Activities without
+// distance or duration score 0.
+func StressScore(durationSeconds, distanceMeters, thresholdSecPerKm float64) float64 {
+	if durationSeconds <= 0 || distanceMeters <= 0 || thresholdSecPerKm <= 0 {
+		return 0
+	}
+	pace := utils.PaceSecPerKm(distanceMeters, durationSeconds)
+	intensity := thresholdSecPerKm / pace
+	return durationSeconds / 3600 * intensity * intensity * 100
+}
+
+// DailyLoad is the summed stress of one UTC day's activities.
+type DailyLoad struct {
+	Date   string  `json:"date"` // YYYY-MM-DD
+	Stress float64 `json:"stress"`
+}
+
+// TrainingLoad is per-day stress over a window, oldest day first, plus the
+// acute (last 7 days) and chronic (whole window) average daily load.
+type TrainingLoad struct {
+	Days        int         `json:"days"`
+	TotalStress float64     `json:"total_stress"`
+	AcuteLoad   float64     `json:"acute_load"`
+	ChronicLoad float64     `json:"chronic_load"`
+	Daily       []DailyLoad `json:"daily"`
+	Hint        string      `json:"hint,omitempty"`
+}
+
+// trainingLoadHint is returned when stress can't be scored.
+const trainingLoadHint = "set a threshold pace on your profile to see training load"
+
+// timedEffort is an effort with its start time, for day bucketing.
+type timedEffort struct {
+	ActivityEffort
+	StartTime time.Time
+}
+
+// buildTrainingLoad scores efforts into days consecutive UTC day buckets
+// ending on the day of end. A nil threshold leaves every day at 0.
+func buildTrainingLoad(efforts []timedEffort, threshold *float64, end time.Time, days int) *TrainingLoad {
+	first := dayStart(end).AddDate(0, 0, -(days - 1))
+	load := &TrainingLoad{Days: days, Daily: make([]DailyLoad, days)}
+	for i := range load.Daily {
+		load.Daily[i].Date = first.AddDate(0, 0, i).Format("2006-01-02")
+	}
+	if threshold == nil {
+		load.Hint = trainingLoadHint
+		return load
+	}
+
+	for _, e := range efforts {
+		i := int(dayStart(e.StartTime).Sub(first).Hours() / 24)
+		if i < 0 || i >= days {
+			continue
+		}
+		load.Daily[i].Stress += StressScore(e.DurationSeconds, e.DistanceMeters, *threshold)
+	}
+
+	var acute float64
+	for i := range load.Daily {
+		load.Daily[i].Stress = round1(load.Daily[i].Stress)
+		load.TotalStress += load.Daily[i].Stress
+		if i >= days-acuteLoadDays {
+			acute += load.Daily[i].Stress
+		}
+	}
+	load.TotalStress = round1(load.TotalStress)
+	load.AcuteLoad = round1(acute / float64(min(days, acuteLoadDays)))
+	load.ChronicLoad = round1(load.TotalStress / float64(days))
+	return load
+}
+
+// dayStart returns midnight UTC of t's UTC date.
+func dayStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
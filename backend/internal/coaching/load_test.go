@@ -0,0 +1,98 @@
+package coaching_test
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/apexrun/backend/internal/coaching"
+)
+
+func TestStressScore(t *testing.T) {
+	const threshold = 300.0 // 5:00/km
+
+	tests := []struct {
+		name     string
+		duration float64
+		distance float64
+		want     float64
+	}{
+		{"hour at threshold", 3600, 12000, 100},
+		{"hour at 6:15/km (IF 0.8)", 3600, 9600, 64},
+		{"30 min at 4:32.7/km (IF 1.1)", 1800, 1800 / (threshold / 1.1) * 1000, 60.5},
+		{"two easy hours at 7:30/km (IF 2/3)", 7200, 16000, 88.9},
+		{"no distance", 1800, 0, 0},
+		{"no duration", 0, 5000, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := coaching.StressScore(tt.duration, tt.distance, threshold)
+			if math.Abs(got-tt.want) > 0.05 {
+				t.Errorf("StressScore(%v s, %v m) = %.2f, want %.1f", tt.duration, tt.distance, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrainingLoad_DailyBuckets(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("FROM user_profiles").
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"threshold"}).AddRow(300.0))
+	mock.ExpectQuery("SELECT start_time, distance_meters, duration_seconds").
+		WithArgs("user-1", today.AddDate(0, 0, -13)).
+		WillReturnRows(sqlmock.NewRows([]string{"start_time", "distance_meters", "duration_seconds"}).
+			AddRow(today.AddDate(0, 0, -13).Add(7*time.Hour), 12000.0, 3600.0). // 100, first day
+			AddRow(today.AddDate(0, 0, -2).Add(6*time.Hour), 9600.0, 3600.0).   // 64
+			AddRow(today.AddDate(0, 0, -2).Add(18*time.Hour), 12000.0, 3600.0). // +100 same day
+			AddRow(today.Add(time.Minute), 0.0, 1200.0))                        // no distance scores 0
+
+	load, err := repo.TrainingLoad(context.Background(), "user-1", 14)
+	if err != nil {
+		t.Fatalf("TrainingLoad: %v", err)
+	}
+	if len(load.Daily) != 14 {
+		t.Fatalf("expected 14 daily buckets, got %d", len(load.Daily))
+	}
+	if first, last := load.Daily[0].Date, load.Daily[13].Date; first != today.AddDate(0, 0, -13).Format("2006-01-02") || last != today.Format("2006-01-02") {
+		t.Errorf("buckets span %s..%s, want the last 14 days ending today", first, last)
+	}
+	if load.Daily[0].Stress != 100 || load.Daily[11].Stress != 164 || load.Daily[13].Stress != 0 {
+		t.Errorf("unexpected buckets: %+v", load.Daily)
+	}
+	if load.TotalStress != 264 {
+		t.Errorf("total = %v, want 264", load.TotalStress)
+	}
+	if load.AcuteLoad != 23.4 { // 164 / 7
+		t.Errorf("acute = %v, want 23.4", load.AcuteLoad)
+	}
+	if load.ChronicLoad != 18.9 { // 264 / 14
+		t.Errorf("chronic = %v, want 18.9", load.ChronicLoad)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTrainingLoad_NoThreshold(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	mock.ExpectQuery("FROM user_profiles").WithArgs("user-1").WillReturnError(sql.ErrNoRows)
+
+	load, err := repo.TrainingLoad(context.Background(), "user-1", 7)
+	if err != nil {
+		t.Fatalf("TrainingLoad: %v", err)
+	}
+	if load.Hint == "" || len(load.Daily) != 7 || load.TotalStress != 0 {
+		t.Errorf("expected 7 empty buckets with a hint, got %+v", load)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
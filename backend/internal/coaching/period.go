@@ -0,0 +1,99 @@
+package coaching
+
+import "time"
+
+// PeriodTotals aggregates the activities in a period.
+type PeriodTotals struct {
+	Count          int     `json:"count"`
+	TotalDistanceM float64 `json:"total_distance_meters"`
+	TotalDurationS float64 `json:"total_duration_seconds"`
+	ElevationGainM float64 `json:"elevation_gain_meters"`
+}
+
+func (t *PeriodTotals) add(o PeriodTotals) {
+	t.Count += o.Count
+	t.TotalDistanceM += o.TotalDistanceM
+	t.TotalDurationS += o.TotalDurationS
+	t.ElevationGainM += o.ElevationGainM
+}
+
+// ActivityTypeTotals are the totals for one activity type.
+type ActivityTypeTotals struct {
+	ActivityType string `json:"activity_type"`
+	PeriodTotals
+}
+
+// PeriodChange is the percentage change of each total against the prior
+// period. A field is nil when the prior period's total was 0.
+type PeriodChange struct {
+	Count          *float64 `json:"count"`
+	TotalDistanceM *float64 `json:"total_distance_meters"`
+	TotalDurationS *float64 `json:"total_duration_seconds"`
+	ElevationGainM *float64 `json:"elevation_gain_meters"`
+}
+
+// PeriodSummary is the training summary for [Start, End), broken down by
+// activity type and compared to the prior period of the same length.
+type PeriodSummary struct {
+	Start  string               `json:"start"` // YYYY-MM-DD
+	End    string               `json:"end"`   // YYYY-MM-DD, last day included
+	ByType []ActivityTypeTotals `json:"by_type"`
+	PeriodTotals
+	Previous  PeriodTotals `json:"previous"`
+	ChangePct PeriodChange `json:"change_pct"`
+}
+
+// PreviousPeriod returns the period of the same length ending at start.
+// Whole-month spans step back by calendar months, so March's prior period
+// is all of February (28 or 29 days) and a year's is the previous year.
+func PreviousPeriod(start, end time.Time) (time.Time, time.Time) {
+	if months, ok := wholeMonths(start, end); ok {
+		return start.AddDate(0, -months, 0), start
+	}
+	return start.Add(-end.Sub(start)), start
+}
+
+// wholeMonths reports how many calendar months [start, end) spans when both
+// bounds fall at midnight on the first of a month.
+func wholeMonths(start, end time.Time) (int, bool) {
+	isMonthStart := func(t time.Time) bool {
+		return t.Day() == 1 && t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0
+	}
+	if !isMonthStart(start) || !isMonthStart(end) || start.Location() != end.Location() {
+		return 0, false
+	}
+	months := (end.Year()-start.Year())*12 + int(end.Month()-start.Month())
+	return months, months > 0
+}
+
+// buildPeriodSummary totals the per-type rows of both periods.
+func buildPeriodSummary(start, end time.Time, byType []ActivityTypeTotals, previous []ActivityTypeTotals) *PeriodSummary {
+	s := &PeriodSummary{
+		Start:  start.Format("2006-01-02"),
+		End:    end.AddDate(0, 0, -1).Format("2006-01-02"),
+		ByType: byType,
+	}
+	for _, t := range byType {
+		s.PeriodTotals.add(t.PeriodTotals)
+	}
+	for _, t := range previous {
+		s.Previous.add(t.PeriodTotals)
+	}
+	s.ChangePct = PeriodChange{
+		Count:          changePct(float64(s.Count), float64(s.Previous.Count)),
+		TotalDistanceM: changePct(s.TotalDistanceM, s.Previous.TotalDistanceM),
+		TotalDurationS: changePct(s.TotalDurationS, s.Previous.TotalDurationS),
+		ElevationGainM: changePct(s.ElevationGainM, s.Previous.ElevationGainM),
+	}
+	return s
+}
+
+// changePct returns the percentage change from prev to cur, rounded to one
+// decimal, or nil when prev is 0.
+func changePct(cur, prev float64) *float64 {
+	if prev == 0 {
+		return nil
+	}
+	pct := round1((cur - prev) / prev * 100)
+	return &pct
+}
@@ -0,0 +1,112 @@
+package coaching_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/apexrun/backend/internal/coaching"
+)
+
+func utcDate(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestPreviousPeriod(t *testing.T) {
+	tests := []struct {
+		name               string
+		start, end         time.Time
+		wantStart, wantEnd time.Time
+	}{
+		{"march in a leap year", utcDate(2024, 3, 1), utcDate(2024, 4, 1), utcDate(2024, 2, 1), utcDate(2024, 3, 1)},
+		{"march in a common year", utcDate(2023, 3, 1), utcDate(2023, 4, 1), utcDate(2023, 2, 1), utcDate(2023, 3, 1)},
+		{"leap february", utcDate(2024, 2, 1), utcDate(2024, 3, 1), utcDate(2024, 1, 1), utcDate(2024, 2, 1)},
+		{"january crosses the year", utcDate(2024, 1, 1), utcDate(2024, 2, 1), utcDate(2023, 12, 1), utcDate(2024, 1, 1)},
+		{"leap year", utcDate(2024, 1, 1), utcDate(2025, 1, 1), utcDate(2023, 1, 1), utcDate(2024, 1, 1)},
+		{"year after a leap year", utcDate(2025, 1, 1), utcDate(2026, 1, 1), utcDate(2024, 1, 1), utcDate(2025, 1, 1)},
+		{"arbitrary span", utcDate(2024, 3, 10), utcDate(2024, 3, 20), utcDate(2024, 2, 29), utcDate(2024, 3, 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStart, gotEnd := coaching.PreviousPeriod(tt.start, tt.end)
+			if !gotStart.Equal(tt.wantStart) || !gotEnd.Equal(tt.wantEnd) {
+				t.Errorf("PreviousPeriod = [%s, %s), want [%s, %s)",
+					gotStart.Format(time.DateOnly), gotEnd.Format(time.DateOnly),
+					tt.wantStart.Format(time.DateOnly), tt.wantEnd.Format(time.DateOnly))
+			}
+		})
+	}
+}
+
+var periodColumns = []string{"type", "count", "distance", "duration", "elevation"}
+
+func TestGetPeriodSummary(t *testing.T) {
+	tests := []struct {
+		name               string
+		start, end         time.Time
+		prevStart          time.Time
+		wantStart, wantEnd string
+	}{
+		{"leap february", utcDate(2024, 2, 1), utcDate(2024, 3, 1), utcDate(2024, 1, 1), "2024-02-01", "2024-02-29"},
+		{"common february", utcDate(2023, 2, 1), utcDate(2023, 3, 1), utcDate(2023, 1, 1), "2023-02-01", "2023-02-28"},
+		{"leap year", utcDate(2024, 1, 1), utcDate(2025, 1, 1), utcDate(2023, 1, 1), "2024-01-01", "2024-12-31"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+
+			mock.ExpectQuery("GROUP BY type").
+				WithArgs("user-1", tt.start, tt.end).
+				WillReturnRows(sqlmock.NewRows(periodColumns).
+					AddRow("bike", 1, 40000.0, 5400.0, 300.0).
+					AddRow("run", 3, 30000.0, 9000.0, 150.0))
+			mock.ExpectQuery("GROUP BY type").
+				WithArgs("user-1", tt.prevStart, tt.start).
+				WillReturnRows(sqlmock.NewRows(periodColumns).
+					AddRow("run", 2, 20000.0, 6000.0, 0.0))
+
+			s, err := repo.GetPeriodSummary(context.Background(), "user-1", tt.start, tt.end)
+			if err != nil {
+				t.Fatalf("GetPeriodSummary: %v", err)
+			}
+			if s.Start != tt.wantStart || s.End != tt.wantEnd {
+				t.Errorf("period = %s..%s, want %s..%s", s.Start, s.End, tt.wantStart, tt.wantEnd)
+			}
+			if len(s.ByType) != 2 || s.ByType[1].ActivityType != "run" || s.ByType[1].Count != 3 {
+				t.Errorf("by_type = %+v", s.ByType)
+			}
+			if s.Count != 4 || s.TotalDistanceM != 70000 || s.TotalDurationS != 14400 || s.ElevationGainM != 450 {
+				t.Errorf("totals = %+v", s.PeriodTotals)
+			}
+			if s.Previous.Count != 2 || s.Previous.TotalDistanceM != 20000 {
+				t.Errorf("previous = %+v", s.Previous)
+			}
+			if c := s.ChangePct; c.Count == nil || *c.Count != 100 || c.TotalDistanceM == nil || *c.TotalDistanceM != 250 ||
+				c.TotalDurationS == nil || *c.TotalDurationS != 140 {
+				t.Errorf("change_pct = %+v", c)
+			}
+			if s.ChangePct.ElevationGainM != nil {
+				t.Errorf("elevation change = %v, want nil with no prior elevation", *s.ChangePct.ElevationGainM)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestGetPeriodSummary_Empty(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	mock.ExpectQuery("GROUP BY type").WillReturnRows(sqlmock.NewRows(periodColumns))
+	mock.ExpectQuery("GROUP BY type").WillReturnRows(sqlmock.NewRows(periodColumns))
+
+	s, err := repo.GetPeriodSummary(context.Background(), "user-1", utcDate(2024, 3, 1), utcDate(2024, 4, 1))
+	if err != nil {
+		t.Fatalf("GetPeriodSummary: %v", err)
+	}
+	if s.ByType == nil || len(s.ByType) != 0 || s.Count != 0 || s.ChangePct.Count != nil {
+		t.Errorf("summary = %+v, want empty by_type and no change", s)
+	}
+}
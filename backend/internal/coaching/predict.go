@@ -0,0 +1,114 @@
+package coaching
+
+import (
+	"math"
+	"time"
+)
+
+// riegelExponent is the fatigue factor in Riegel's T2 = T1 * (D2/D1)^1.06.
+const riegelExponent = 1.06
+
+// predictionWindow is how far back an effort may be to serve as the basis.
+const predictionWindow = 90 * 24 * time.Hour
+
+// An activity counts as an effort at a standard distance when it is between
+// 98% and 105% of it; its time is scaled to the exact distance by pace.
+const (
+	standardDistanceMin = 0.98
+	standardDistanceMax = 1.05
+)
+
+// RaceDistance is a named race distance.
+type RaceDistance struct {
+	Name   string  `json:"name"`
+	Meters float64 `json:"distance_meters"`
+}
+
+// StandardRaceDistances are predicted in every response, shortest first.
+var StandardRaceDistances = []RaceDistance{
+	{"5k", 5000},
+	{"10k", 10000},
+	{"half_marathon", 21097.5},
+	{"marathon", 42195},
+}
+
+// PredictRaceTime applies Riegel's formula to estimate the time (seconds)
+// for targetMeters from a performance of recentBestSeconds over
+// recentBestMeters. Returns 0 for non-positive inputs.
+func PredictRaceTime(recentBestSeconds, recentBestMeters, targetMeters float64) float64 {
+	if recentBestSeconds <= 0 || recentBestMeters <= 0 || targetMeters <= 0 {
+		return 0
+	}
+	return recentBestSeconds * math.Pow(targetMeters/recentBestMeters, riegelExponent)
+}
+
+// RaceEffort is a recent run used as the basis for predictions, normalized
+// to a standard distance.
+type RaceEffort struct {
+	ActivityID  string    `json:"activity_id"`
+	Distance    string    `json:"distance"` // standard distance name
+	Meters      float64   `json:"distance_meters"`
+	TimeSeconds float64   `json:"time_seconds"`
+	StartTime   time.Time `json:"start_time"`
+}
+
+// RacePrediction is the predicted time for one distance.
+type RacePrediction struct {
+	RaceDistance
+	TimeSeconds float64 `json:"time_seconds"`
+}
+
+// PredictionResponse is the response for race-time predictions. Target is
+// set when a custom target distance was requested.
+type PredictionResponse struct {
+	Basis       *RaceEffort      `json:"basis"`
+	Predictions []RacePrediction `json:"predictions"`
+	Target      *RacePrediction  `json:"target,omitempty"`
+	Hint        string           `json:"hint,omitempty"`
+}
+
+// predictionHint is returned when no effort qualifies as a basis.
+const predictionHint = "run a 5k, 10k, half marathon or marathon to get race-time predictions"
+
+// asStandardEffort normalizes a run to the standard distance it covers, if
+// any. ok is false when the run isn't close to one.
+func asStandardEffort(distanceMeters, durationSeconds float64) (d RaceDistance, seconds float64, ok bool) {
+	if durationSeconds <= 0 {
+		return RaceDistance{}, 0, false
+	}
+	for _, std := range StandardRaceDistances {
+		if distanceMeters >= std.Meters*standardDistanceMin && distanceMeters <= std.Meters*standardDistanceMax {
+			return std, durationSeconds * std.Meters / distanceMeters, true
+		}
+	}
+	return RaceDistance{}, 0, false
+}
+
+// riegelScore ranks efforts: lower predicts faster at every distance, since
+// Riegel scales all efforts by the same (D2)^1.06 factor.
+func riegelScore(e *RaceEffort) float64 {
+	return e.TimeSeconds / math.Pow(e.Meters, riegelExponent)
+}
+
+// buildPredictions predicts every standard distance, plus targetMeters when
+// it is positive, from basis.
+func buildPredictions(basis *RaceEffort, targetMeters float64) *PredictionResponse {
+	resp := &PredictionResponse{Basis: basis, Predictions: []RacePrediction{}}
+	if basis == nil {
+		resp.Hint = predictionHint
+		return resp
+	}
+	for _, d := range StandardRaceDistances {
+		resp.Predictions = append(resp.Predictions, RacePrediction{
+			RaceDistance: d,
+			TimeSeconds:  math.Round(PredictRaceTime(basis.TimeSeconds, basis.Meters, d.Meters)),
+		})
+	}
+	if targetMeters > 0 {
+		resp.Target = &RacePrediction{
+			RaceDistance: RaceDistance{Name: "target", Meters: targetMeters},
+			TimeSeconds:  math.Round(PredictRaceTime(basis.TimeSeconds, basis.Meters, targetMeters)),
+		}
+	}
+	return resp
+}
@@ -0,0 +1,98 @@
+package coaching_test
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/apexrun/backend/internal/coaching"
+)
+
+func TestPredictRaceTime(t *testing.T) {
+	tests := []struct {
+		name                    string
+		seconds, meters, target float64
+		want                    float64
+	}{
+		{"20:00 5k to 10k", 1200, 5000, 10000, 2501.9},      // 41:42
+		{"40:00 10k to half", 2400, 10000, 21097.5, 5295.4}, // 1:28:15
+		{"1:30:00 half to marathon", 5400, 21097.5, 42195, 11258.6},
+		{"20:00 5k to marathon", 1200, 5000, 42195, 11509.3}, // 3:11:49
+		{"50:00 10k down to 5k", 3000, 10000, 5000, 1438.9},
+		{"same distance", 1500, 5000, 5000, 1500},
+		{"no basis time", 0, 5000, 10000, 0},
+		{"no basis distance", 1200, 0, 10000, 0},
+		{"no target", 1200, 5000, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := coaching.PredictRaceTime(tt.seconds, tt.meters, tt.target)
+			if math.Abs(got-tt.want) > 0.05 {
+				t.Errorf("PredictRaceTime(%v, %v, %v) = %.2f, want %.1f", tt.seconds, tt.meters, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPredictRaceTimes_BestEffortBasis(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	day := time.Now().UTC().AddDate(0, 0, -10)
+
+	mock.ExpectQuery("SELECT id, start_time, distance_meters, duration_seconds").
+		WithArgs("user-1", sqlmock.AnyArg(), 4900.0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "start_time", "distance_meters", "duration_seconds"}).
+			AddRow("a-10k", day, 10000.0, 2700.0).                 // 45:00 10k
+			AddRow("a-5k", day.Add(24*time.Hour), 5100.0, 1280.0). // 5.1 km, scales to 1255s
+			AddRow("a-7k", day.Add(48*time.Hour), 7000.0, 1500.0)) // not a standard distance
+
+	resp, err := repo.PredictRaceTimes(context.Background(), "user-1", 15000)
+	if err != nil {
+		t.Fatalf("PredictRaceTimes: %v", err)
+	}
+	if resp.Basis == nil || resp.Basis.ActivityID != "a-5k" {
+		t.Fatalf("basis = %+v, want a-5k", resp.Basis)
+	}
+	if resp.Basis.Meters != 5000 || resp.Basis.TimeSeconds != 1255 {
+		t.Errorf("basis = %v m in %v s, want 5000 m in 1255 s", resp.Basis.Meters, resp.Basis.TimeSeconds)
+	}
+
+	want := map[string]float64{
+		"5k":            1255,
+		"10k":           math.Round(coaching.PredictRaceTime(1255, 5000, 10000)),
+		"half_marathon": math.Round(coaching.PredictRaceTime(1255, 5000, 21097.5)),
+		"marathon":      math.Round(coaching.PredictRaceTime(1255, 5000, 42195)),
+	}
+	if len(resp.Predictions) != len(want) {
+		t.Fatalf("got %d predictions, want %d", len(resp.Predictions), len(want))
+	}
+	for _, p := range resp.Predictions {
+		if p.TimeSeconds != want[p.Name] {
+			t.Errorf("%s = %v s, want %v", p.Name, p.TimeSeconds, want[p.Name])
+		}
+	}
+	if resp.Target == nil || resp.Target.TimeSeconds != math.Round(coaching.PredictRaceTime(1255, 5000, 15000)) {
+		t.Errorf("target = %+v", resp.Target)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPredictRaceTimes_NoEffort(t *testing.T) {
+	repo, mock := newMockRepo(t)
+
+	mock.ExpectQuery("SELECT id, start_time, distance_meters, duration_seconds").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "start_time", "distance_meters", "duration_seconds"}).
+			AddRow("a-7k", time.Now(), 7000.0, 2100.0))
+
+	resp, err := repo.PredictRaceTimes(context.Background(), "user-1", 0)
+	if err != nil {
+		t.Fatalf("PredictRaceTimes: %v", err)
+	}
+	if resp.Basis != nil || len(resp.Predictions) != 0 || resp.Target != nil || resp.Hint == "" {
+		t.Errorf("resp = %+v, want no basis, no predictions and a hint", resp)
+	}
+}
@@ -4,16 +4,20 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"math"
 	"time"
 
 	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/database"
+	"github.com/apexrun/backend/pkg/utils"
 )
 
 // DailyWorkoutResponse contains the daily workout recommendation data.
 type DailyWorkoutResponse struct {
-	HasWorkout  bool             `json:"has_workout"`
-	Workout     *PlannedWorkout  `json:"workout,omitempty"`
-	WeekSummary *WeekSummary     `json:"week_summary"`
+	HasWorkout  bool            `json:"has_workout"`
+	Workout     *PlannedWorkout `json:"workout,omitempty"`
+	WeekSummary *WeekSummary    `json:"week_summary"`
 }
 
 // PlannedWorkout mirrors the database table for API responses.
@@ -26,16 +30,47 @@ type PlannedWorkout struct {
 	TargetDistanceMeters  *float64  `json:"target_distance_meters,omitempty"`
 	TargetDurationMinutes *int      `json:"target_duration_minutes,omitempty"`
 	IsCompleted           bool      `json:"is_completed"`
+	CompletedActivityID   *string   `json:"completed_activity_id,omitempty"`
 	CoachingRationale     *string   `json:"coaching_rationale,omitempty"`
 	CreatedAt             time.Time `json:"created_at"`
 }
 
 // WeekSummary provides training context for the AI coach.
+// PaceZones is null (with a hint) until the user sets a threshold pace.
 type WeekSummary struct {
-	RunCount       int     `json:"run_count"`
-	TotalDistanceM float64 `json:"total_distance_meters"`
-	TotalDurationS float64 `json:"total_duration_seconds"`
-	AvgPaceSecKm   float64 `json:"avg_pace_sec_per_km"`
+	RunCount       int              `json:"run_count"`
+	TotalDistanceM float64          `json:"total_distance_meters"`
+	TotalDurationS float64          `json:"total_duration_seconds"`
+	AvgPaceSecKm   float64          `json:"avg_pace_sec_per_km"`
+	PaceZones      *PaceZoneSeconds `json:"pace_zones"`
+	PaceZonesHint  string           `json:"pace_zones_hint,omitempty"`
+	// WeekStart is local midnight on the summarized week's Monday.
+	WeekStart time.Time `json:"-"`
+}
+
+// paceZonesHint is returned when pace zones can't be computed.
+const paceZonesHint = "set a threshold pace on your profile to see pace-zone distribution"
+
+// WeekSummaryResponse is the response for a specific week's summary.
+type WeekSummaryResponse struct {
+	WeekStart   string       `json:"week_start"` // Monday, YYYY-MM-DD
+	WeekSummary *WeekSummary `json:"week_summary"`
+}
+
+// CreateWorkoutRequest is the request body for scheduling a workout.
+// Workout types match the planned_workouts CHECK constraint.
+type CreateWorkoutRequest struct {
+	WorkoutType           string   `json:"workout_type" binding:"required,oneof=easy tempo intervals long_run recovery race"`
+	PlannedDate           string   `json:"planned_date" binding:"required"` // YYYY-MM-DD
+	Description           string   `json:"description" binding:"required,max=1000"`
+	TargetDistanceMeters  *float64 `json:"target_distance_meters" binding:"omitempty,gt=0"`
+	TargetDurationMinutes *int     `json:"target_duration_minutes" binding:"omitempty,gt=0"`
+	CoachingRationale     *string  `json:"coaching_rationale"`
+}
+
+// CompleteWorkoutRequest is the optional body for marking a workout done.
+type CompleteWorkoutRequest struct {
+	ActivityID *string `json:"activity_id" binding:"omitempty,uuid"`
 }
 
 // AnalyzeRequest is the request body for the training analysis endpoint.
@@ -51,33 +86,55 @@ type AnalyzeResponse struct {
 
 // Repository provides data access for coaching features.
 type Repository struct {
-	db     *sql.DB
-	logger *zap.Logger
+	db      database.Querier
+	logger  *zap.Logger
+	timeout time.Duration // per-call query timeout; 0 disables
 }
 
 // NewRepository creates a new coaching repository.
-func NewRepository(db *sql.DB, logger *zap.Logger) *Repository {
+func NewRepository(db database.Querier, logger *zap.Logger) *Repository {
 	return &Repository{db: db, logger: logger}
 }
 
+// SetQueryTimeout bounds each repository call; 0 (the default) leaves calls
+// bounded only by the caller's context.
+func (r *Repository) SetQueryTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+func (r *Repository) queryCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	return database.WithQueryTimeout(ctx, r.timeout)
+}
+
+// workoutColumns is the planned_workouts column list read by scanWorkout.
+const workoutColumns = `id, user_id, workout_type, planned_date, description,
+		       target_distance_meters, target_duration_minutes,
+		       is_completed, completed_activity_id, coaching_rationale, created_at`
+
+func scanWorkout(row interface{ Scan(...interface{}) error }) (*PlannedWorkout, error) {
+	w := &PlannedWorkout{}
+	err := row.Scan(
+		&w.ID, &w.UserID, &w.WorkoutType, &w.PlannedDate, &w.Description,
+		&w.TargetDistanceMeters, &w.TargetDurationMinutes,
+		&w.IsCompleted, &w.CompletedActivityID, &w.CoachingRationale, &w.CreatedAt,
+	)
+	return w, err
+}
+
 // GetTodaysWorkout returns the user's planned workout for today (if any).
 func (r *Repository) GetTodaysWorkout(ctx context.Context, userID string) (*PlannedWorkout, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
 	today := time.Now().Format("2006-01-02")
 	query := `
-		SELECT id, user_id, workout_type, planned_date, description,
-		       target_distance_meters, target_duration_minutes,
-		       is_completed, coaching_rationale, created_at
+		SELECT ` + workoutColumns + `
 		FROM planned_workouts
 		WHERE user_id = $1 AND planned_date = $2
 		ORDER BY created_at DESC
 		LIMIT 1`
 
-	w := &PlannedWorkout{}
-	err := r.db.QueryRowContext(ctx, query, userID, today).Scan(
-		&w.ID, &w.UserID, &w.WorkoutType, &w.PlannedDate, &w.Description,
-		&w.TargetDistanceMeters, &w.TargetDurationMinutes,
-		&w.IsCompleted, &w.CoachingRationale, &w.CreatedAt,
-	)
+	w, err := scanWorkout(r.db.QueryRowContext(ctx, query, userID, today))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -87,25 +144,146 @@ func (r *Repository) GetTodaysWorkout(ctx context.Context, userID string) (*Plan
 	return w, nil
 }
 
-// GetWeekSummary returns aggregated training stats for the current week.
+// CreateWorkout schedules a workout for the user. req.PlannedDate must
+// already be validated as YYYY-MM-DD.
+func (r *Repository) CreateWorkout(ctx context.Context, userID string, req *CreateWorkoutRequest) (*PlannedWorkout, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO planned_workouts (
+			user_id, workout_type, planned_date, description,
+			target_distance_meters, target_duration_minutes, coaching_rationale
+		) VALUES ($1, $2, $3::date, $4, $5, $6, $7)
+		RETURNING ` + workoutColumns
+
+	w, err := scanWorkout(r.db.QueryRowContext(ctx, query,
+		userID, req.WorkoutType, req.PlannedDate, req.Description,
+		req.TargetDistanceMeters, req.TargetDurationMinutes, req.CoachingRationale,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create workout: %w", err)
+	}
+	return w, nil
+}
+
+// ListWorkouts returns the user's planned workouts dated from..to
+// (inclusive calendar dates), earliest first.
+func (r *Repository) ListWorkouts(ctx context.Context, userID string, from, to time.Time) ([]PlannedWorkout, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	query := `
+		SELECT ` + workoutColumns + `
+		FROM planned_workouts
+		WHERE user_id = $1 AND planned_date BETWEEN $2::date AND $3::date
+		ORDER BY planned_date, created_at`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("list workouts: %w", err)
+	}
+	defer rows.Close()
+
+	workouts := []PlannedWorkout{}
+	for rows.Next() {
+		w, err := scanWorkout(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan workout: %w", err)
+		}
+		workouts = append(workouts, *w)
+	}
+	return workouts, rows.Err()
+}
+
+// CompleteWorkout marks one of the user's planned workouts as done,
+// optionally linking the activity that fulfilled it. Completing again is
+// harmless; a nil activityID keeps any existing link. Returns nil if the
+// workout isn't the user's, or activityID isn't one of their activities.
+func (r *Repository) CompleteWorkout(ctx context.Context, userID, workoutID string, activityID *string) (*PlannedWorkout, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE planned_workouts
+		SET is_completed = TRUE,
+		    completed_activity_id = COALESCE($3, completed_activity_id),
+		    updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		  AND ($3::uuid IS NULL OR EXISTS (
+		      SELECT 1 FROM activities
+		      WHERE id = $3 AND user_id = $2 AND deleted_at IS NULL))
+		RETURNING ` + workoutColumns
+
+	w, err := scanWorkout(r.db.QueryRowContext(ctx, query, workoutID, userID, activityID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("complete workout: %w", err)
+	}
+	return w, nil
+}
+
+// GetWeekSummary returns aggregated training stats for the current week in
+// the user's timezone.
 func (r *Repository) GetWeekSummary(ctx context.Context, userID string) (*WeekSummary, error) {
-	now := time.Now()
-	weekday := int(now.Weekday())
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	loc, err := r.getLocation(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return r.weekSummary(ctx, userID, WeekStartIn(time.Now().In(loc), loc))
+}
+
+// WeekStart returns midnight UTC on the Monday of the week containing t's
+// calendar date.
+func WeekStart(t time.Time) time.Time {
+	return WeekStartIn(t, time.UTC)
+}
+
+// WeekStartIn returns midnight in loc on the Monday of the week containing
+// t's calendar date (as written in t's own location). Convert an instant
+// with t.In(loc) first to find its local week.
+func WeekStartIn(t time.Time, loc *time.Location) time.Time {
+	weekday := int(t.Weekday())
 	if weekday == 0 {
 		weekday = 7
 	}
-	weekStart := now.AddDate(0, 0, -(weekday - 1))
-	weekStartDate := time.Date(weekStart.Year(), weekStart.Month(), weekStart.Day(), 0, 0, 0, 0, time.UTC)
+	monday := t.AddDate(0, 0, -(weekday - 1))
+	return time.Date(monday.Year(), monday.Month(), monday.Day(), 0, 0, 0, 0, loc)
+}
+
+// GetWeekSummaryFor returns aggregated training stats for the Monday-Sunday
+// week containing day's calendar date (any day of the week may be passed),
+// with the week bounded by local midnight in the user's timezone.
+func (r *Repository) GetWeekSummaryFor(ctx context.Context, userID string, day time.Time) (*WeekSummary, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	loc, err := r.getLocation(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return r.weekSummary(ctx, userID, WeekStartIn(day, loc))
+}
+
+// weekSummary aggregates the week starting at weekStartDate.
+func (r *Repository) weekSummary(ctx context.Context, userID string, weekStartDate time.Time) (*WeekSummary, error) {
+	weekEndDate := weekStartDate.AddDate(0, 0, 7)
 
 	query := `
 		SELECT COUNT(*), COALESCE(SUM(distance_meters), 0),
 		       COALESCE(SUM(duration_seconds), 0)
 		FROM activities
-		WHERE user_id = $1 AND start_time >= $2`
+		WHERE user_id = $1 AND deleted_at IS NULL
+		  AND start_time >= $2 AND start_time < $3`
 
-	ws := &WeekSummary{}
+	ws := &WeekSummary{WeekStart: weekStartDate}
 	var totalDist, totalDur float64
-	err := r.db.QueryRowContext(ctx, query, userID, weekStartDate).Scan(
+	err := r.db.QueryRowContext(ctx, query, userID, weekStartDate, weekEndDate).Scan(
 		&ws.RunCount, &totalDist, &totalDur,
 	)
 	if err != nil {
@@ -114,9 +292,292 @@ func (r *Repository) GetWeekSummary(ctx context.Context, userID string) (*WeekSu
 
 	ws.TotalDistanceM = totalDist
 	ws.TotalDurationS = totalDur
-	if totalDist > 0 {
-		ws.AvgPaceSecKm = totalDur / (totalDist / 1000.0)
+	ws.AvgPaceSecKm = utils.PaceSecPerKm(totalDist, totalDur)
+
+	threshold, err := r.getThresholdPace(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if threshold == nil {
+		ws.PaceZonesHint = paceZonesHint
+		return ws, nil
 	}
 
+	efforts, err := r.listEffortsBetween(ctx, userID, weekStartDate, weekEndDate)
+	if err != nil {
+		return nil, err
+	}
+	zones := PaceZoneDistribution(efforts, *threshold)
+	ws.PaceZones = &zones
+
 	return ws, nil
 }
+
+// GetPeriodSummary returns the user's totals for [start, end), by activity
+// type, compared to the prior period (see PreviousPeriod).
+func (r *Repository) GetPeriodSummary(ctx context.Context, userID string, start, end time.Time) (*PeriodSummary, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	byType, err := r.periodTotals(ctx, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	prevStart, prevEnd := PreviousPeriod(start, end)
+	previous, err := r.periodTotals(ctx, userID, prevStart, prevEnd)
+	if err != nil {
+		return nil, err
+	}
+	return buildPeriodSummary(start, end, byType, previous), nil
+}
+
+// periodTotals aggregates the user's activities in [from, to) by type.
+func (r *Repository) periodTotals(ctx context.Context, userID string, from, to time.Time) ([]ActivityTypeTotals, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT COALESCE(activity_type, 'run') AS type, COUNT(*),
+		       COALESCE(SUM(distance_meters), 0), COALESCE(SUM(duration_seconds), 0),
+		       COALESCE(SUM(elevation_gain_meters), 0)
+		FROM activities
+		WHERE user_id = $1 AND deleted_at IS NULL
+		  AND start_time >= $2 AND start_time < $3
+		GROUP BY type
+		ORDER BY type`,
+		userID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("get period totals: %w", err)
+	}
+	defer rows.Close()
+
+	totals := []ActivityTypeTotals{}
+	for rows.Next() {
+		var t ActivityTypeTotals
+		if err := rows.Scan(&t.ActivityType, &t.Count, &t.TotalDistanceM, &t.TotalDurationS, &t.ElevationGainM); err != nil {
+			return nil, fmt.Errorf("scan period totals: %w", err)
+		}
+		totals = append(totals, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("get period totals: %w", err)
+	}
+	return totals, nil
+}
+
+// TrainingLoad returns the user's daily training stress over the last days
+// days (today included), scored against their threshold pace.
+func (r *Repository) TrainingLoad(ctx context.Context, userID string, days int) (*TrainingLoad, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	now := time.Now()
+	since := dayStart(now).AddDate(0, 0, -(days - 1))
+
+	threshold, err := r.getThresholdPace(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if threshold == nil {
+		return buildTrainingLoad(nil, nil, now, days), nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT start_time, distance_meters, duration_seconds
+		FROM activities
+		WHERE user_id = $1 AND deleted_at IS NULL AND start_time >= $2
+		ORDER BY start_time`, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("list training load efforts: %w", err)
+	}
+	defer rows.Close()
+
+	var efforts []timedEffort
+	for rows.Next() {
+		var e timedEffort
+		if err := rows.Scan(&e.StartTime, &e.DistanceMeters, &e.DurationSeconds); err != nil {
+			return nil, fmt.Errorf("scan training load effort: %w", err)
+		}
+		efforts = append(efforts, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list training load efforts: %w", err)
+	}
+	return buildTrainingLoad(efforts, threshold, now, days), nil
+}
+
+// Fitness returns the user's fitness-fatigue series for the last days days.
+// Load from the preceding fitnessWarmupDays seeds the model.
+func (r *Repository) Fitness(ctx context.Context, userID string, days int) (*Fitness, error) {
+	load, err := r.TrainingLoad(ctx, userID, days+fitnessWarmupDays)
+	if err != nil {
+		return nil, err
+	}
+	return buildFitness(load, days), nil
+}
+
+// Streaks returns the user's current and longest runs of consecutive
+// active days, in their timezone. The current streak counts back from
+// today; one that ran through yesterday is still current until today ends.
+func (r *Repository) Streaks(ctx context.Context, userID string) (*StreakResponse, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	days, today, err := r.activeDays(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &StreakResponse{Current: currentStreak(days, today), Longest: longestStreak(days)}, nil
+}
+
+// CurrentStreak returns how many consecutive days, in the user's timezone,
+// have at least one activity, counting back from today. Callers that also
+// need the longest streak should use Streaks to scan only once.
+func (r *Repository) CurrentStreak(ctx context.Context, userID string) (int, error) {
+	s, err := r.Streaks(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return s.Current, nil
+}
+
+// LongestStreak returns the user's longest run of consecutive active days,
+// in their timezone.
+func (r *Repository) LongestStreak(ctx context.Context, userID string) (int, error) {
+	s, err := r.Streaks(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return s.Longest, nil
+}
+
+// activeDays returns the distinct local dates with an activity, newest
+// first, and today's local date.
+func (r *Repository) activeDays(ctx context.Context, userID string) ([]time.Time, time.Time, error) {
+	loc, err := r.getLocation(ctx, userID)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT DISTINCT (start_time AT TIME ZONE $2)::date AS day
+		FROM activities
+		WHERE user_id = $1 AND deleted_at IS NULL
+		ORDER BY day DESC`, userID, loc.String())
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("list active days: %w", err)
+	}
+	defer rows.Close()
+
+	var days []time.Time
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			return nil, time.Time{}, fmt.Errorf("scan active day: %w", err)
+		}
+		days = append(days, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("list active days: %w", err)
+	}
+	return days, localDate(time.Now(), loc), nil
+}
+
+// getLocation returns the user's profile timezone, or UTC if unset or not
+// a known IANA zone.
+func (r *Repository) getLocation(ctx context.Context, userID string) (*time.Location, error) {
+	var tz *string
+	err := r.db.QueryRowContext(ctx,
+		`SELECT timezone FROM user_profiles WHERE id = $1`, userID,
+	).Scan(&tz)
+	if err == sql.ErrNoRows || (err == nil && (tz == nil || *tz == "")) {
+		return time.UTC, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get timezone: %w", err)
+	}
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		r.logger.Warn("unknown profile timezone, using UTC", zap.String("timezone", *tz))
+		return time.UTC, nil
+	}
+	return loc, nil
+}
+
+// PredictRaceTimes predicts the user's standard race times (and
+// targetMeters, if positive) from their best run at a standard distance in
+// the last predictionWindow.
+func (r *Repository) PredictRaceTimes(ctx context.Context, userID string, targetMeters float64) (*PredictionResponse, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, start_time, distance_meters, duration_seconds
+		FROM activities
+		WHERE user_id = $1 AND deleted_at IS NULL AND activity_type = 'run'
+		  AND start_time >= $2 AND distance_meters >= $3`,
+		userID, time.Now().Add(-predictionWindow), StandardRaceDistances[0].Meters*standardDistanceMin)
+	if err != nil {
+		return nil, fmt.Errorf("list race efforts: %w", err)
+	}
+	defer rows.Close()
+
+	var best *RaceEffort
+	for rows.Next() {
+		var (
+			e                  RaceEffort
+			distance, duration float64
+		)
+		if err := rows.Scan(&e.ActivityID, &e.StartTime, &distance, &duration); err != nil {
+			return nil, fmt.Errorf("scan race effort: %w", err)
+		}
+		std, seconds, ok := asStandardEffort(distance, duration)
+		if !ok {
+			continue
+		}
+		e.Distance, e.Meters, e.TimeSeconds = std.Name, std.Meters, math.Round(seconds)
+		if best == nil || riegelScore(&e) < riegelScore(best) {
+			best = &e
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list race efforts: %w", err)
+	}
+	return buildPredictions(best, targetMeters), nil
+}
+
+// getThresholdPace returns the user's threshold pace (sec/km), or nil if unset.
+func (r *Repository) getThresholdPace(ctx context.Context, userID string) (*float64, error) {
+	var threshold *float64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT threshold_pace_sec_per_km FROM user_profiles WHERE id = $1`, userID,
+	).Scan(&threshold)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get threshold pace: %w", err)
+	}
+	return threshold, nil
+}
+
+// listEffortsBetween returns distance/duration for each activity started in
+// [from, to).
+func (r *Repository) listEffortsBetween(ctx context.Context, userID string, from, to time.Time) ([]ActivityEffort, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT distance_meters, duration_seconds
+		FROM activities
+		WHERE user_id = $1 AND deleted_at IS NULL
+		  AND start_time >= $2 AND start_time < $3`, userID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("list efforts: %w", err)
+	}
+	defer rows.Close()
+
+	var efforts []ActivityEffort
+	for rows.Next() {
+		var e ActivityEffort
+		if err := rows.Scan(&e.DistanceMeters, &e.DurationSeconds); err != nil {
+			return nil, fmt.Errorf("scan effort: %w", err)
+		}
+		efforts = append(efforts, e)
+	}
+	return efforts, rows.Err()
+}
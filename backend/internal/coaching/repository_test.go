@@ -0,0 +1,319 @@
+package coaching_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/coaching"
+)
+
+func newMockRepo(t *testing.T) (*coaching.Repository, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return coaching.NewRepository(db, zap.NewNop()), mock
+}
+
+func TestGetWeekSummary_PaceZones(t *testing.T) {
+	t.Run("no threshold returns null bands with hint", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("SELECT timezone FROM user_profiles").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery("FROM activities").
+			WillReturnRows(sqlmock.NewRows([]string{"count", "dist", "dur"}).AddRow(1, 5000.0, 1500.0))
+		mock.ExpectQuery("FROM user_profiles").
+			WithArgs("user-1").
+			WillReturnError(sql.ErrNoRows)
+
+		ws, err := repo.GetWeekSummary(context.Background(), "user-1")
+		if err != nil {
+			t.Fatalf("GetWeekSummary: %v", err)
+		}
+		if ws.PaceZones != nil {
+			t.Errorf("expected nil pace zones, got %+v", ws.PaceZones)
+		}
+		if ws.PaceZonesHint == "" {
+			t.Error("expected a hint when threshold pace is unset")
+		}
+	})
+
+	t.Run("threshold set buckets activities", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("SELECT timezone FROM user_profiles").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery("COUNT\\(\\*\\)").
+			WillReturnRows(sqlmock.NewRows([]string{"count", "dist", "dur"}).AddRow(2, 15000.0, 5050.0))
+		mock.ExpectQuery("FROM user_profiles").
+			WithArgs("user-1").
+			WillReturnRows(sqlmock.NewRows([]string{"threshold"}).AddRow(300.0))
+		mock.ExpectQuery("SELECT distance_meters, duration_seconds").
+			WillReturnRows(sqlmock.NewRows([]string{"distance_meters", "duration_seconds"}).
+				AddRow(10000.0, 3600.0).
+				AddRow(5000.0, 1450.0))
+
+		ws, err := repo.GetWeekSummary(context.Background(), "user-1")
+		if err != nil {
+			t.Fatalf("GetWeekSummary: %v", err)
+		}
+		want := coaching.PaceZoneSeconds{Easy: 3600, Hard: 1450}
+		if ws.PaceZones == nil || *ws.PaceZones != want {
+			t.Errorf("got %+v, want %+v", ws.PaceZones, want)
+		}
+		if ws.PaceZonesHint != "" {
+			t.Errorf("expected no hint, got %q", ws.PaceZonesHint)
+		}
+	})
+}
+
+func TestWeekStart(t *testing.T) {
+	monday := time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		in   time.Time
+		want time.Time
+	}{
+		{"monday maps to itself", time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), monday},
+		{"mid-week", time.Date(2024, 3, 13, 18, 45, 0, 0, time.UTC), monday},
+		{"sunday maps to the prior monday", time.Date(2024, 3, 17, 23, 59, 0, 0, time.UTC), monday},
+		{"next monday starts a new week", time.Date(2024, 3, 18, 0, 0, 0, 0, time.UTC), monday.AddDate(0, 0, 7)},
+		{"across a month boundary", time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC), time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coaching.WeekStart(tt.in); !got.Equal(tt.want) {
+				t.Errorf("WeekStart(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetWeekSummaryFor_BoundsQueryToWeek(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	monday := time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)
+	nextMonday := monday.AddDate(0, 0, 7)
+
+	mock.ExpectQuery("SELECT timezone FROM user_profiles").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(regexp.QuoteMeta("start_time >= $2 AND start_time < $3")).
+		WithArgs("user-1", monday, nextMonday).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "dist", "dur"}).AddRow(3, 20000.0, 6000.0))
+	mock.ExpectQuery("FROM user_profiles").
+		WithArgs("user-1").
+		WillReturnError(sql.ErrNoRows)
+
+	// A Sunday selects the week that started the previous Monday.
+	ws, err := repo.GetWeekSummaryFor(context.Background(), "user-1", time.Date(2024, 3, 17, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("GetWeekSummaryFor: %v", err)
+	}
+	if ws.RunCount != 3 || ws.AvgPaceSecKm != 300 {
+		t.Errorf("got %+v, want 3 runs at 300 s/km", ws)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWeekStartIn_SundayNight(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	// 20:00 UTC on Sunday the 17th is 01:30 on Monday the 18th in IST.
+	sundayNight := time.Date(2024, 3, 17, 20, 0, 0, 0, time.UTC)
+
+	utcWeek := coaching.WeekStartIn(sundayNight.In(time.UTC), time.UTC)
+	if want := time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC); !utcWeek.Equal(want) {
+		t.Errorf("UTC week start = %v, want %v", utcWeek, want)
+	}
+	istWeek := coaching.WeekStartIn(sundayNight.In(kolkata), kolkata)
+	if want := time.Date(2024, 3, 18, 0, 0, 0, 0, kolkata); !istWeek.Equal(want) {
+		t.Errorf("Asia/Kolkata week start = %v, want %v", istWeek, want)
+	}
+	if want := time.Date(2024, 3, 17, 18, 30, 0, 0, time.UTC); !istWeek.Equal(want) {
+		t.Errorf("Asia/Kolkata week starts at %v UTC, want %v", istWeek.UTC(), want)
+	}
+}
+
+func TestGetWeekSummaryFor_ProfileTimezone(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	repo, mock := newMockRepo(t)
+	monday := time.Date(2024, 3, 18, 0, 0, 0, 0, kolkata)
+
+	mock.ExpectQuery("SELECT timezone FROM user_profiles").
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"timezone"}).AddRow("Asia/Kolkata"))
+	mock.ExpectQuery(regexp.QuoteMeta("start_time >= $2 AND start_time < $3")).
+		WithArgs("user-1", monday, monday.AddDate(0, 0, 7)).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "dist", "dur"}).AddRow(1, 5000.0, 1500.0))
+	mock.ExpectQuery("FROM user_profiles").
+		WithArgs("user-1").
+		WillReturnError(sql.ErrNoRows)
+
+	ws, err := repo.GetWeekSummaryFor(context.Background(), "user-1", time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("GetWeekSummaryFor: %v", err)
+	}
+	if !ws.WeekStart.Equal(monday) {
+		t.Errorf("week start = %v, want %v", ws.WeekStart, monday)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+var workoutColumns = []string{
+	"id", "user_id", "workout_type", "planned_date", "description",
+	"target_distance_meters", "target_duration_minutes",
+	"is_completed", "completed_activity_id", "coaching_rationale", "created_at",
+}
+
+func workoutRow(id, userID string, completedActivityID interface{}) []driver.Value {
+	day := time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)
+	return []driver.Value{id, userID, "tempo", day, "3 x 10 min at threshold", nil, 50, true, completedActivityID, nil, day}
+}
+
+func TestCompleteWorkout(t *testing.T) {
+	const (
+		workoutID  = "11111111-1111-1111-1111-111111111111"
+		activityID = "22222222-2222-2222-2222-222222222222"
+	)
+	activity := activityID
+
+	t.Run("another user's workout is not found", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("UPDATE planned_workouts").
+			WithArgs(workoutID, "intruder", nil).
+			WillReturnError(sql.ErrNoRows)
+
+		w, err := repo.CompleteWorkout(context.Background(), "intruder", workoutID, nil)
+		if err != nil {
+			t.Fatalf("CompleteWorkout: %v", err)
+		}
+		if w != nil {
+			t.Errorf("expected nil for a workout the user doesn't own, got %+v", w)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("links an owned activity", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT 1 FROM activities")).
+			WithArgs(workoutID, "user-1", &activity).
+			WillReturnRows(sqlmock.NewRows(workoutColumns).AddRow(workoutRow(workoutID, "user-1", activityID)...))
+
+		w, err := repo.CompleteWorkout(context.Background(), "user-1", workoutID, &activity)
+		if err != nil {
+			t.Fatalf("CompleteWorkout: %v", err)
+		}
+		if w == nil || !w.IsCompleted || w.CompletedActivityID == nil || *w.CompletedActivityID != activityID {
+			t.Errorf("expected completed workout linked to %s, got %+v", activityID, w)
+		}
+	})
+
+	t.Run("re-completing is idempotent and keeps the link", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		for i := 0; i < 2; i++ {
+			mock.ExpectQuery(regexp.QuoteMeta("completed_activity_id = COALESCE($3, completed_activity_id)")).
+				WithArgs(workoutID, "user-1", nil).
+				WillReturnRows(sqlmock.NewRows(workoutColumns).AddRow(workoutRow(workoutID, "user-1", activityID)...))
+		}
+
+		for i := 0; i < 2; i++ {
+			w, err := repo.CompleteWorkout(context.Background(), "user-1", workoutID, nil)
+			if err != nil {
+				t.Fatalf("CompleteWorkout #%d: %v", i+1, err)
+			}
+			if w == nil || !w.IsCompleted || w.CompletedActivityID == nil {
+				t.Errorf("CompleteWorkout #%d: got %+v, want completed with activity kept", i+1, w)
+			}
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestListWorkouts_RangeOrderedByDate(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	from := time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 24, 0, 0, 0, 0, time.UTC)
+
+	rows := sqlmock.NewRows(workoutColumns)
+	for i, day := range []int{11, 13, 13, 20} {
+		row := workoutRow(fmt.Sprintf("w%d", i), "user-1", nil)
+		row[3] = time.Date(2024, 3, day, 0, 0, 0, 0, time.UTC)
+		rows.AddRow(row...)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("planned_date BETWEEN $2::date AND $3::date\n\t\tORDER BY planned_date, created_at")).
+		WithArgs("user-1", "2024-03-11", "2024-03-24").
+		WillReturnRows(rows)
+
+	workouts, err := repo.ListWorkouts(context.Background(), "user-1", from, to)
+	if err != nil {
+		t.Fatalf("ListWorkouts: %v", err)
+	}
+	if len(workouts) != 4 {
+		t.Fatalf("expected 4 workouts, got %d", len(workouts))
+	}
+	for i := 1; i < len(workouts); i++ {
+		if workouts[i].PlannedDate.Before(workouts[i-1].PlannedDate) {
+			t.Errorf("workouts out of date order at %d: %v before %v", i, workouts[i].PlannedDate, workouts[i-1].PlannedDate)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListWorkouts_EmptyRangeIsEmptySlice(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	mock.ExpectQuery("FROM planned_workouts").WillReturnRows(sqlmock.NewRows(workoutColumns))
+
+	day := time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)
+	workouts, err := repo.ListWorkouts(context.Background(), "user-1", day, day)
+	if err != nil {
+		t.Fatalf("ListWorkouts: %v", err)
+	}
+	if workouts == nil || len(workouts) != 0 {
+		t.Errorf("expected an empty, non-nil slice, got %#v", workouts)
+	}
+}
+
+func TestCreateWorkout(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	minutes := 50
+	req := &coaching.CreateWorkoutRequest{
+		WorkoutType:           "tempo",
+		PlannedDate:           "2024-03-11",
+		Description:           "3 x 10 min at threshold",
+		TargetDurationMinutes: &minutes,
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO planned_workouts")).
+		WithArgs("user-1", "tempo", "2024-03-11", "3 x 10 min at threshold", nil, &minutes, nil).
+		WillReturnRows(sqlmock.NewRows(workoutColumns).AddRow(workoutRow("w1", "user-1", nil)...))
+
+	w, err := repo.CreateWorkout(context.Background(), "user-1", req)
+	if err != nil {
+		t.Fatalf("CreateWorkout: %v", err)
+	}
+	if w.ID != "w1" || w.WorkoutType != "tempo" {
+		t.Errorf("unexpected workout %+v", w)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,52 @@
+package coaching
+
+import "time"
+
+// StreakResponse reports a user's running streaks in days.
+type StreakResponse struct {
+	Current int `json:"current_days"`
+	Longest int `json:"longest_days"`
+}
+
+// localDate returns t's calendar date in loc as midnight UTC, the form
+// dates scanned from Postgres DATE columns take.
+func localDate(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// currentStreak counts consecutive days ending today, or yesterday if today
+// has no activity yet. days are distinct dates, newest first.
+func currentStreak(days []time.Time, today time.Time) int {
+	if len(days) == 0 {
+		return 0
+	}
+	expect := today
+	if !days[0].Equal(today) {
+		expect = today.AddDate(0, 0, -1)
+	}
+	n := 0
+	for _, d := range days {
+		if !d.Equal(expect) {
+			break
+		}
+		n++
+		expect = expect.AddDate(0, 0, -1)
+	}
+	return n
+}
+
+// longestStreak returns the longest run of consecutive dates. days are
+// distinct dates, newest first.
+func longestStreak(days []time.Time) int {
+	longest, run := 0, 0
+	for i, d := range days {
+		if i > 0 && days[i-1].AddDate(0, 0, -1).Equal(d) {
+			run++
+		} else {
+			run = 1
+		}
+		longest = max(longest, run)
+	}
+	return longest
+}
@@ -0,0 +1,134 @@
+package coaching_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// localToday returns today's date in loc the way a DATE column scans.
+func localToday(loc *time.Location) time.Time {
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// expectActiveDays mocks the timezone lookup and the active-day query with
+// activity on each of daysAgo (newest first) relative to today in tz.
+func expectActiveDays(mock sqlmock.Sqlmock, tz interface{}, daysAgo ...int) {
+	loc := time.UTC
+	if name, ok := tz.(string); ok {
+		if l, err := time.LoadLocation(name); err == nil {
+			loc = l
+		}
+	}
+	if tz == nil {
+		mock.ExpectQuery("SELECT timezone FROM user_profiles").WillReturnError(sql.ErrNoRows)
+	} else {
+		mock.ExpectQuery("SELECT timezone FROM user_profiles").
+			WillReturnRows(sqlmock.NewRows([]string{"timezone"}).AddRow(tz))
+	}
+	rows := sqlmock.NewRows([]string{"day"})
+	for _, n := range daysAgo {
+		rows.AddRow(localToday(loc).AddDate(0, 0, -n))
+	}
+	mock.ExpectQuery("AT TIME ZONE").WithArgs("user-1", loc.String()).WillReturnRows(rows)
+}
+
+func TestStreaks(t *testing.T) {
+	tests := []struct {
+		name        string
+		daysAgo     []int
+		wantCurrent int
+		wantLongest int
+	}{
+		{"active through today", []int{0, 1, 2}, 3, 3},
+		{"today not yet run keeps the streak", []int{1, 2, 3}, 3, 3},
+		{"gap day breaks the streak", []int{0, 1, 3, 4, 5, 6}, 2, 4},
+		{"two idle days end it", []int{2, 3}, 0, 2},
+		{"no activities", nil, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			// Both streaks come from one timezone lookup and one scan.
+			expectActiveDays(mock, nil, tt.daysAgo...)
+
+			got, err := repo.Streaks(context.Background(), "user-1")
+			if err != nil {
+				t.Fatalf("Streaks: %v", err)
+			}
+			if got.Current != tt.wantCurrent || got.Longest != tt.wantLongest {
+				t.Errorf("got current=%d longest=%d, want %d/%d", got.Current, got.Longest, tt.wantCurrent, tt.wantLongest)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCurrentStreak(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	expectActiveDays(mock, nil, 1, 2, 4, 5, 6, 7)
+
+	got, err := repo.CurrentStreak(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("CurrentStreak: %v", err)
+	}
+	if got != 2 {
+		t.Errorf("current = %d, want 2", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLongestStreak(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	expectActiveDays(mock, nil, 1, 2, 4, 5, 6, 7)
+
+	got, err := repo.LongestStreak(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("LongestStreak: %v", err)
+	}
+	if got != 4 {
+		t.Errorf("longest = %d, want 4", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStreaks_UseProfileTimezone(t *testing.T) {
+	tests := []struct {
+		name string
+		tz   interface{}
+	}{
+		{"named zone", "Asia/Kolkata"},
+		{"unknown zone falls back to UTC", "Mars/Olympus_Mons"},
+		{"unset", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			// expectActiveDays asserts the zone passed to Postgres and
+			// seeds days relative to today in that zone.
+			expectActiveDays(mock, tt.tz, 0, 1)
+
+			got, err := repo.Streaks(context.Background(), "user-1")
+			if err != nil {
+				t.Fatalf("Streaks: %v", err)
+			}
+			if got.Current != 2 {
+				t.Errorf("current = %d, want 2", got.Current)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
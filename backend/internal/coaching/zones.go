@@ -0,0 +1,64 @@
+package coaching
+
+import "github.com/apexrun/backend/pkg/utils"
+
+// Pace zone names, easiest first.
+const (
+	PaceZoneEasy     = "easy"
+	PaceZoneModerate = "moderate"
+	PaceZoneHard     = "hard"
+)
+
+// Pace zone boundaries as multiples of threshold pace (sec/km; higher is slower).
+// Slower than 115% of threshold is easy, within 103% is hard, between is moderate.
+const (
+	easyPaceFactor = 1.15
+	hardPaceFactor = 1.03
+)
+
+// PaceZoneSeconds is time spent in each pace zone.
+type PaceZoneSeconds struct {
+	Easy     float64 `json:"easy_seconds"`
+	Moderate float64 `json:"moderate_seconds"`
+	Hard     float64 `json:"hard_seconds"`
+}
+
+// ActivityEffort is the minimal activity data needed for zone bucketing.
+type ActivityEffort struct {
+	DistanceMeters  float64
+	DurationSeconds float64
+}
+
+// AssignPaceZone returns the zone for an average pace given a threshold pace,
+// both in seconds per km.
+func AssignPaceZone(paceSecPerKm, thresholdSecPerKm float64) string {
+	switch {
+	case paceSecPerKm > thresholdSecPerKm*easyPaceFactor:
+		return PaceZoneEasy
+	case paceSecPerKm > thresholdSecPerKm*hardPaceFactor:
+		return PaceZoneModerate
+	default:
+		return PaceZoneHard
+	}
+}
+
+// PaceZoneDistribution buckets each activity's full duration into the zone of
+// its average pace. Activities without distance are skipped.
+func PaceZoneDistribution(efforts []ActivityEffort, thresholdSecPerKm float64) PaceZoneSeconds {
+	var zones PaceZoneSeconds
+	for _, e := range efforts {
+		if e.DistanceMeters <= 0 || e.DurationSeconds <= 0 {
+			continue
+		}
+		pace := utils.PaceSecPerKm(e.DistanceMeters, e.DurationSeconds)
+		switch AssignPaceZone(pace, thresholdSecPerKm) {
+		case PaceZoneEasy:
+			zones.Easy += e.DurationSeconds
+		case PaceZoneModerate:
+			zones.Moderate += e.DurationSeconds
+		default:
+			zones.Hard += e.DurationSeconds
+		}
+	}
+	return zones
+}
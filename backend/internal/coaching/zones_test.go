@@ -0,0 +1,46 @@
+package coaching_test
+
+import (
+	"testing"
+
+	"github.com/apexrun/backend/internal/coaching"
+)
+
+func TestAssignPaceZone(t *testing.T) {
+	const threshold = 300.0 // 5:00/km
+
+	tests := []struct {
+		pace float64
+		want string
+	}{
+		{420, coaching.PaceZoneEasy},     // 7:00/km
+		{345.1, coaching.PaceZoneEasy},   // just slower than 115%
+		{345, coaching.PaceZoneModerate}, // exactly 115%
+		{320, coaching.PaceZoneModerate},
+		{309, coaching.PaceZoneHard}, // exactly 103%
+		{280, coaching.PaceZoneHard}, // faster than threshold
+	}
+	for _, tt := range tests {
+		if got := coaching.AssignPaceZone(tt.pace, threshold); got != tt.want {
+			t.Errorf("AssignPaceZone(%.1f): got %s, want %s", tt.pace, got, tt.want)
+		}
+	}
+}
+
+func TestPaceZoneDistribution(t *testing.T) {
+	const threshold = 300.0
+
+	efforts := []coaching.ActivityEffort{
+		{DistanceMeters: 10000, DurationSeconds: 3600}, // 6:00/km easy
+		{DistanceMeters: 8000, DurationSeconds: 2640},  // 5:30/km moderate
+		{DistanceMeters: 5000, DurationSeconds: 1450},  // 4:50/km hard
+		{DistanceMeters: 5000, DurationSeconds: 1800},  // 6:00/km easy
+		{DistanceMeters: 0, DurationSeconds: 1200},     // no distance, skipped
+	}
+
+	got := coaching.PaceZoneDistribution(efforts, threshold)
+	want := coaching.PaceZoneSeconds{Easy: 5400, Moderate: 2640, Hard: 1450}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -1,34 +1,61 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
 // Config holds all application configuration
 type Config struct {
 	// Server
-	Port           string
-	GinMode        string
-	AllowedOrigins []string
-	RateLimitRPM   int
+	Port             string
+	GinMode          string
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+	RateLimitRPM     int
+	UserRateLimitRPM int
+	RequestTimeout   time.Duration
+	EnableHSTS       bool
+
+	// API keys (server-to-server)
+	APIKeyRateLimitRPM int
 
 	// Supabase
-	SupabaseURL       string
-	SupabaseAnonKey   string
+	SupabaseURL        string
+	SupabaseAnonKey    string
 	SupabaseServiceKey string
-	SupabaseJWTSecret string
+	SupabaseJWTSecret  string
+	JWTIssuer          string   // expected iss; defaults to SUPABASE_URL + "/auth/v1"
+	JWTAudience        []string // accepted aud values
+	JWTClockSkew       time.Duration
 
 	// Database
-	DatabaseURL            string
-	DBMaxOpenConns         int
-	DBMaxIdleConns         int
-	DBConnMaxLifetime      time.Duration
+	DatabaseURL       string
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBQueryTimeout    time.Duration // per repository call; 0 disables
+
+	// Database connection retries
+	DBConnectAttempts   int
+	DBConnectBackoff    time.Duration
+	DBConnectMaxBackoff time.Duration
+	DBPingTimeout       time.Duration
+	DBReconnectInterval time.Duration
+
+	// Schema migrations
+	RunMigrations bool
+	MigrationsDir string
 
 	// Redis
 	RedisURL      string
@@ -40,73 +67,325 @@ type Config struct {
 	SegmentMatchBufferMeters int
 	MaxGPSPointsPerActivity  int
 
+	// Weather enrichment
+	EnableWeatherEnrichment bool
+	WeatherProviderURL      string
+
+	// Reverse geocoding of activity start points
+	EnableReverseGeocoding bool
+	GeocoderURL            string
+
+	// Server-side AI coach (disabled without an API key)
+	CoachAPIKey string
+	CoachModel  string
+	CoachAPIURL string
+
 	// Logging
-	LogLevel  string
-	LogFormat string
+	LogLevel    string
+	LogFormat   string
+	LogSampling bool // throttle repeated non-error entries
+
+	// Optional rotating log file, written in addition to stdout
+	LogFile           string
+	LogFileMaxSizeMB  int
+	LogFileMaxAgeDays int
+	LogFileMaxBackups int
 
 	// Development
 	EnableMockData     bool
 	EnableDebugLogging bool
+
+	// Strict makes main exit when Validate fails instead of starting degraded.
+	Strict bool
+}
+
+// ValidationError lists every required variable that is missing and every
+// setting that is present but malformed.
+type ValidationError struct {
+	Missing []string
+	Invalid []string
+}
+
+func (e *ValidationError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing required env vars: "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Invalid) > 0 {
+		parts = append(parts, "invalid settings: "+strings.Join(e.Invalid, "; "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// defaultAllowedHeaders are the request headers CORS preflights may ask for
+// when ALLOWED_HEADERS is unset.
+const defaultAllowedHeaders = "Authorization,Content-Type,Accept,X-Request-ID,Idempotency-Key,If-None-Match"
+
+// Validate reports all required settings that are empty and all malformed
+// ALLOWED_ORIGINS patterns as one *ValidationError, or nil if the config is
+// usable. A bare "*" origin is also rejected with CORS_ALLOW_CREDENTIALS,
+// since any site could then make credentialed requests.
+func (c *Config) Validate() error {
+	required := []struct {
+		key   string
+		value string
+	}{
+		{"SUPABASE_URL", c.SupabaseURL},
+		{"SUPABASE_ANON_KEY", c.SupabaseAnonKey},
+		{"SUPABASE_JWT_SECRET", c.SupabaseJWTSecret},
+		{"DATABASE_URL", c.DatabaseURL},
+	}
+	var missing []string
+	for _, r := range required {
+		if r.value == "" {
+			missing = append(missing, r.key)
+		}
+	}
+	var invalid []string
+	for _, pattern := range c.AllowedOrigins {
+		if problem := originProblem(strings.TrimSpace(pattern)); problem != "" {
+			invalid = append(invalid, fmt.Sprintf("ALLOWED_ORIGINS entry %q %s", pattern, problem))
+		} else if c.AllowCredentials && strings.TrimSpace(pattern) == "*" {
+			invalid = append(invalid, `ALLOWED_ORIGINS entry "*" cannot be combined with CORS_ALLOW_CREDENTIALS`)
+		}
+	}
+	if len(missing) > 0 || len(invalid) > 0 {
+		return &ValidationError{Missing: missing, Invalid: invalid}
+	}
+	return nil
+}
+
+// originProblem describes why a CORS origin pattern can never match as
+// intended, or returns "" if it is well formed. A "*" may only stand alone,
+// end the pattern, or open a subdomain wildcard ("*.example.com",
+// "https://*.example.com").
+func originProblem(pattern string) string {
+	switch n := strings.Count(pattern, "*"); {
+	case pattern == "":
+		return "is empty"
+	case n == 0, pattern == "*":
+		return ""
+	case n > 1:
+		return "has more than one wildcard"
+	}
+	i := strings.Index(pattern, "*")
+	if i == len(pattern)-1 {
+		return ""
+	}
+	if strings.HasPrefix(pattern[i:], "*.") && (i == 0 || strings.HasSuffix(pattern[:i], "://")) {
+		return ""
+	}
+	return "has a wildcard in the middle (use a trailing * or a *.domain subdomain wildcard)"
 }
 
 // Load reads environment variables and returns a populated Config.
 // It attempts to load a .env file but does not fail if one is missing.
+// If CONFIG_FILE is set, that file is loaded as in LoadFromFile.
 func Load() (*Config, error) {
 	// Best-effort load of .env
 	_ = godotenv.Load()
 
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return LoadFromFile(path)
+	}
+	return load(nil), nil
+}
+
+// LoadFromFile reads settings from a YAML (.yaml, .yml) or JSON (.json)
+// file, then applies environment variables on top; a non-empty env var
+// always wins. Keys are the env var names, case-insensitive, and lists
+// (e.g. allowed_origins) may be given as arrays:
+//
+//	port: 8080
+//	database_url: postgres://localhost:5432/apexrun
+//	allowed_origins: [https://apexrun.app, https://*.apexrun.app]
+func LoadFromFile(path string) (*Config, error) {
+	_ = godotenv.Load()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	raw := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported extension %q (want .yaml, .yml or .json)", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	values := make(source, len(raw))
+	for k, v := range raw {
+		str, err := fileValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %s: %w", path, k, err)
+		}
+		values[strings.ToUpper(k)] = str
+	}
+	return load(values), nil
+}
+
+// fileValue renders a decoded file value the way it would appear in the
+// environment; arrays become comma-separated lists.
+func fileValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			str, err := fileValue(item)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = str
+		}
+		return strings.Join(parts, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+// load builds a Config from the environment, falling back to file values
+// (nil when there is no config file) and then to defaults.
+func load(src source) *Config {
 	cfg := &Config{
 		// Server
-		Port:           getEnv("PORT", "8080"),
-		GinMode:        getEnv("GIN_MODE", "debug"),
-		AllowedOrigins: strings.Split(getEnv("ALLOWED_ORIGINS", "http://localhost:*"), ","),
-		RateLimitRPM:   getEnvInt("RATE_LIMIT_REQUESTS_PER_MINUTE", 60),
+		Port:             src.getEnv("PORT", "8080"),
+		GinMode:          src.getEnv("GIN_MODE", "debug"),
+		AllowedOrigins:   strings.Split(src.getEnv("ALLOWED_ORIGINS", "http://localhost:*"), ","),
+		AllowedMethods:   strings.Split(src.getEnv("ALLOWED_METHODS", "GET,POST,PUT,PATCH,DELETE,OPTIONS"), ","),
+		AllowedHeaders:   strings.Split(src.getEnv("ALLOWED_HEADERS", defaultAllowedHeaders), ","),
+		AllowCredentials: src.getEnvBool("CORS_ALLOW_CREDENTIALS", src.getEnvBool("ALLOW_CREDENTIALS", false)),
+		RateLimitRPM:     src.getEnvInt("RATE_LIMIT_REQUESTS_PER_MINUTE", 60),
+		UserRateLimitRPM: src.getEnvInt("USER_RATE_LIMIT_RPM", 120),
+		RequestTimeout:   time.Duration(src.getEnvInt("REQUEST_TIMEOUT_SECONDS", 10)) * time.Second,
+		EnableHSTS:       src.getEnvBool("ENABLE_HSTS", false),
+
+		// API keys
+		APIKeyRateLimitRPM: src.getEnvInt("API_KEY_RATE_LIMIT_RPM", 120),
 
 		// Supabase
-		SupabaseURL:       mustGetEnv("SUPABASE_URL"),
-		SupabaseAnonKey:   mustGetEnv("SUPABASE_ANON_KEY"),
-		SupabaseServiceKey: getEnv("SUPABASE_SERVICE_KEY", ""),
-		SupabaseJWTSecret: mustGetEnv("SUPABASE_JWT_SECRET"),
+		SupabaseURL:        src.mustGetEnv("SUPABASE_URL"),
+		SupabaseAnonKey:    src.mustGetEnv("SUPABASE_ANON_KEY"),
+		SupabaseServiceKey: src.getEnv("SUPABASE_SERVICE_KEY", ""),
+		SupabaseJWTSecret:  src.mustGetEnv("SUPABASE_JWT_SECRET"),
+		JWTIssuer:          src.getEnv("JWT_ISSUER", ""),
+		JWTAudience:        splitList(src.getEnv("JWT_AUDIENCE", "authenticated")),
+		JWTClockSkew:       time.Duration(src.getEnvInt("JWT_CLOCK_SKEW_SECONDS", 30)) * time.Second,
 
 		// Database
-		DatabaseURL:       mustGetEnv("DATABASE_URL"),
-		DBMaxOpenConns:    getEnvInt("DB_MAX_OPEN_CONNS", 25),
-		DBMaxIdleConns:    getEnvInt("DB_MAX_IDLE_CONNS", 10),
-		DBConnMaxLifetime: time.Duration(getEnvInt("DB_CONN_MAX_LIFETIME_MINUTES", 30)) * time.Minute,
+		DatabaseURL:       src.mustGetEnv("DATABASE_URL"),
+		DBMaxOpenConns:    src.getEnvInt("DB_MAX_OPEN_CONNS", 25),
+		DBMaxIdleConns:    src.getEnvInt("DB_MAX_IDLE_CONNS", 10),
+		DBConnMaxLifetime: time.Duration(src.getEnvInt("DB_CONN_MAX_LIFETIME_MINUTES", 30)) * time.Minute,
+		DBQueryTimeout:    time.Duration(src.getEnvInt("DB_QUERY_TIMEOUT_SECONDS", 10)) * time.Second,
+
+		// Database connection retries
+		DBConnectAttempts:   src.getEnvInt("DB_CONNECT_ATTEMPTS", 3),
+		DBConnectBackoff:    time.Duration(src.getEnvInt("DB_CONNECT_BACKOFF_SECONDS", 3)) * time.Second,
+		DBConnectMaxBackoff: time.Duration(src.getEnvInt("DB_CONNECT_MAX_BACKOFF_SECONDS", 30)) * time.Second,
+		DBPingTimeout:       time.Duration(src.getEnvInt("DB_PING_TIMEOUT_SECONDS", 8)) * time.Second,
+		DBReconnectInterval: time.Duration(src.getEnvInt("DB_RECONNECT_INTERVAL_SECONDS", 30)) * time.Second,
+
+		// Schema migrations
+		RunMigrations: src.getEnvBool("RUN_MIGRATIONS", false),
+		MigrationsDir: src.getEnv("MIGRATIONS_DIR", "migrations"),
 
 		// Redis
-		RedisURL:      getEnv("REDIS_URL", "localhost:6379"),
-		RedisPassword: getEnv("REDIS_PASSWORD", ""),
-		RedisDB:       getEnvInt("REDIS_DB", 0),
-		RedisPoolSize: getEnvInt("REDIS_POOL_SIZE", 10),
+		RedisURL:      src.getEnv("REDIS_URL", "localhost:6379"),
+		RedisPassword: src.getEnv("REDIS_PASSWORD", ""),
+		RedisDB:       src.getEnvInt("REDIS_DB", 0),
+		RedisPoolSize: src.getEnvInt("REDIS_POOL_SIZE", 10),
 
 		// GPS
-		SegmentMatchBufferMeters: getEnvInt("SEGMENT_MATCH_BUFFER_METERS", 20),
-		MaxGPSPointsPerActivity:  getEnvInt("MAX_GPS_POINTS_PER_ACTIVITY", 10000),
+		SegmentMatchBufferMeters: src.getEnvInt("SEGMENT_MATCH_BUFFER_METERS", 20),
+		MaxGPSPointsPerActivity:  src.getEnvInt("MAX_GPS_POINTS_PER_ACTIVITY", 10000),
+
+		// Weather
+		EnableWeatherEnrichment: src.getEnvBool("ENABLE_WEATHER_ENRICHMENT", false),
+		WeatherProviderURL:      src.getEnv("WEATHER_PROVIDER_URL", ""),
+
+		// Geocoding
+		EnableReverseGeocoding: src.getEnvBool("ENABLE_REVERSE_GEOCODING", false),
+		GeocoderURL:            src.getEnv("GEOCODER_URL", ""),
+
+		// AI coach
+		CoachAPIKey: src.getEnv("COACH_API_KEY", ""),
+		CoachModel:  src.getEnv("COACH_MODEL", "gemini-1.5-flash"),
+		CoachAPIURL: src.getEnv("COACH_API_URL", "https://generativelanguage.googleapis.com"),
 
 		// Logging
-		LogLevel:  getEnv("LOG_LEVEL", "info"),
-		LogFormat: getEnv("LOG_FORMAT", "json"),
+		LogLevel:    src.getEnv("LOG_LEVEL", "info"),
+		LogFormat:   src.getEnv("LOG_FORMAT", "json"),
+		LogSampling: src.getEnvBool("LOG_SAMPLING", false),
+
+		LogFile:           src.getEnv("LOG_FILE", ""),
+		LogFileMaxSizeMB:  src.getEnvInt("LOG_FILE_MAX_SIZE_MB", 100),
+		LogFileMaxAgeDays: src.getEnvInt("LOG_FILE_MAX_AGE_DAYS", 7),
+		LogFileMaxBackups: src.getEnvInt("LOG_FILE_MAX_BACKUPS", 5),
 
 		// Development
-		EnableMockData:     getEnvBool("ENABLE_MOCK_DATA", false),
-		EnableDebugLogging: getEnvBool("ENABLE_DEBUG_LOGGING", true),
+		EnableMockData:     src.getEnvBool("ENABLE_MOCK_DATA", false),
+		EnableDebugLogging: src.getEnvBool("ENABLE_DEBUG_LOGGING", true),
+
+		Strict: src.getEnvBool("CONFIG_STRICT", false),
+	}
+
+	if cfg.JWTIssuer == "" && cfg.SupabaseURL != "" {
+		cfg.JWTIssuer = strings.TrimSuffix(cfg.SupabaseURL, "/") + "/auth/v1"
 	}
 
-	return cfg, nil
+	return cfg
 }
 
 // --- helpers ---
 
-func getEnv(key, fallback string) string {
+// splitList splits a comma-separated value, dropping blanks.
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// source holds values read from a config file, keyed by env var name.
+type source map[string]string
+
+// lookup returns the env var if set, else the config file value.
+func (s source) lookup(key string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
 	}
+	return s[key]
+}
+
+func (s source) getEnv(key, fallback string) string {
+	if v := s.lookup(key); v != "" {
+		return v
+	}
 	return fallback
 }
 
-func mustGetEnv(key string) string {
-	v := os.Getenv(key)
+func (s source) mustGetEnv(key string) string {
+	v := s.lookup(key)
 	if v == "" {
 		// Log clearly which required variable is missing
 		fmt.Printf("CRITICAL: required env var %s is not set — set it in .env or environment\n", key)
@@ -121,8 +400,8 @@ func mustGetEnv(key string) string {
 	return v
 }
 
-func getEnvInt(key string, fallback int) int {
-	v := os.Getenv(key)
+func (s source) getEnvInt(key string, fallback int) int {
+	v := s.lookup(key)
 	if v == "" {
 		return fallback
 	}
@@ -133,8 +412,8 @@ func getEnvInt(key string, fallback int) int {
 	return i
 }
 
-func getEnvBool(key string, fallback bool) bool {
-	v := os.Getenv(key)
+func (s source) getEnvBool(key string, fallback bool) bool {
+	v := s.lookup(key)
 	if v == "" {
 		return fallback
 	}
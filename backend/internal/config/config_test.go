@@ -0,0 +1,243 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apexrun/backend/internal/config"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		missing []string
+	}{
+		{
+			name: "complete",
+			env: map[string]string{
+				"SUPABASE_URL":        "https://example.supabase.co",
+				"SUPABASE_ANON_KEY":   "anon",
+				"SUPABASE_JWT_SECRET": "secret",
+				"DATABASE_URL":        "postgres://localhost/apexrun",
+			},
+		},
+		{
+			name:    "nothing set",
+			env:     map[string]string{},
+			missing: []string{"SUPABASE_URL", "SUPABASE_ANON_KEY", "SUPABASE_JWT_SECRET", "DATABASE_URL"},
+		},
+		{
+			name: "secrets missing",
+			env: map[string]string{
+				"SUPABASE_URL": "https://example.supabase.co",
+				"DATABASE_URL": "postgres://localhost/apexrun",
+			},
+			missing: []string{"SUPABASE_ANON_KEY", "SUPABASE_JWT_SECRET"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"SUPABASE_URL", "SUPABASE_ANON_KEY", "SUPABASE_JWT_SECRET", "DATABASE_URL"} {
+				t.Setenv(key, tt.env[key])
+			}
+			t.Setenv("CONFIG_STRICT", "true")
+
+			cfg, err := config.Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !cfg.Strict {
+				t.Error("expected CONFIG_STRICT=true to enable strict mode")
+			}
+
+			err = cfg.Validate()
+			if tt.missing == nil {
+				if err != nil {
+					t.Fatalf("expected valid config, got %v", err)
+				}
+				return
+			}
+			var verr *config.ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected *ValidationError, got %v", err)
+			}
+			if !reflect.DeepEqual(verr.Missing, tt.missing) {
+				t.Errorf("missing = %v, want %v", verr.Missing, tt.missing)
+			}
+		})
+	}
+}
+
+func TestLoadFromFile(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		body string
+	}{
+		{
+			name: "yaml",
+			file: "config.yaml",
+			body: `
+port: 9090
+database_url: postgres://file-host:5432/apexrun
+enable_hsts: true
+db_query_timeout_seconds: 5
+allowed_origins:
+  - https://apexrun.app
+  - https://*.apexrun.app
+`,
+		},
+		{
+			name: "json",
+			file: "config.json",
+			body: `{
+  "PORT": 9090,
+  "DATABASE_URL": "postgres://file-host:5432/apexrun",
+  "ENABLE_HSTS": true,
+  "DB_QUERY_TIMEOUT_SECONDS": 5,
+  "ALLOWED_ORIGINS": ["https://apexrun.app", "https://*.apexrun.app"]
+}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.body), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"DATABASE_URL", "ENABLE_HSTS", "DB_QUERY_TIMEOUT_SECONDS", "ALLOWED_ORIGINS"} {
+				t.Setenv(key, "")
+			}
+			t.Setenv("PORT", "7070") // env beats the file
+
+			cfg, err := config.LoadFromFile(path)
+			if err != nil {
+				t.Fatalf("LoadFromFile: %v", err)
+			}
+
+			if cfg.Port != "7070" {
+				t.Errorf("Port = %q, want env override 7070", cfg.Port)
+			}
+			if cfg.DatabaseURL != "postgres://file-host:5432/apexrun" {
+				t.Errorf("DatabaseURL = %q, want file value", cfg.DatabaseURL)
+			}
+			if !cfg.EnableHSTS {
+				t.Error("EnableHSTS = false, want file value true")
+			}
+			if cfg.DBQueryTimeout != 5*time.Second {
+				t.Errorf("DBQueryTimeout = %v, want 5s", cfg.DBQueryTimeout)
+			}
+			if want := []string{"https://apexrun.app", "https://*.apexrun.app"}; !reflect.DeepEqual(cfg.AllowedOrigins, want) {
+				t.Errorf("AllowedOrigins = %v, want %v", cfg.AllowedOrigins, want)
+			}
+			if cfg.RedisPoolSize != 10 {
+				t.Errorf("RedisPoolSize = %d, want default 10", cfg.RedisPoolSize)
+			}
+		})
+	}
+}
+
+func TestLoad_ConfigFileEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("gin_mode: release\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GIN_MODE", "")
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.GinMode != "release" {
+		t.Errorf("GinMode = %q, want release from CONFIG_FILE", cfg.GinMode)
+	}
+}
+
+func TestLoadFromFile_Errors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"missing file", filepath.Join(dir, "nope.yaml")},
+		{"unknown extension", write("config.toml", "port = 1")},
+		{"malformed yaml", write("bad.yaml", "port: [")},
+		{"nested value", write("nested.yaml", "redis:\n  db: 1\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := config.LoadFromFile(tt.path); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestValidate_AllowedOrigins(t *testing.T) {
+	// credentials names the env var set to true, if any.
+	tests := []struct {
+		origins     string
+		credentials string
+		invalid     int
+	}{
+		{"http://localhost:*,https://apexrun.app", "", 0},
+		{"*", "", 0},
+		{"*", "CORS_ALLOW_CREDENTIALS", 1},
+		{"*", "ALLOW_CREDENTIALS", 1},
+		{"https://*.apexrun.app", "CORS_ALLOW_CREDENTIALS", 0},
+		{"*.apexrun.app,https://*.apexrun.app", "", 0},
+		{"https://app.*.com", "", 1},
+		{"https://*apexrun.app", "", 1},
+		{"http://*.localhost:*", "", 1},
+		{"https://apexrun.app,,https://www.apexrun.app", "", 1},
+		{"https://apexrun.app,", "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origins+" "+tt.credentials, func(t *testing.T) {
+			t.Setenv("SUPABASE_URL", "https://example.supabase.co")
+			t.Setenv("SUPABASE_ANON_KEY", "anon")
+			t.Setenv("SUPABASE_JWT_SECRET", "secret")
+			t.Setenv("DATABASE_URL", "postgres://localhost/apexrun")
+			t.Setenv("ALLOWED_ORIGINS", tt.origins)
+			if tt.credentials != "" {
+				t.Setenv(tt.credentials, "true")
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			err = cfg.Validate()
+			if tt.invalid == 0 {
+				if err != nil {
+					t.Fatalf("expected valid origins, got %v", err)
+				}
+				return
+			}
+			var verr *config.ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected *ValidationError, got %v", err)
+			}
+			if len(verr.Invalid) != tt.invalid || len(verr.Missing) != 0 {
+				t.Errorf("got invalid=%v missing=%v, want %d invalid", verr.Invalid, verr.Missing, tt.invalid)
+			}
+		})
+	}
+}
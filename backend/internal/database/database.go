@@ -9,18 +9,25 @@ import (
 	"sync"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
 )
 
-// DB wraps *sql.DB with a logger and tracks connection state.
+// DB wraps *sql.DB with a logger and tracks connection state. Pool is a
+// database/sql view over the pgx connection pool in pgx.
 type DB struct {
 	Pool      *sql.DB
+	pgx       *pgxpool.Pool
 	logger    *zap.Logger
 	mu        sync.RWMutex
 	connected bool
 	lastError string
 	connType  string // "pooler-session", "pooler-transaction", "direct", "unknown"
+	postgis   bool   // PostGIS functions resolved on the last successful connect
+
+	reconnectDone chan struct{} // closed when reconnectLoop exits; nil if it never ran
 }
 
 // IsConnected returns whether the database is currently connected.
@@ -44,6 +51,35 @@ func (db *DB) ConnType() string {
 	return db.connType
 }
 
+// HasPostGIS reports whether PostGIS functions were callable when the
+// database last connected. It is false until then.
+func (db *DB) HasPostGIS() bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.postgis
+}
+
+// detectPostGIS probes for PostGIS on the connection's search_path; the
+// extension may be missing entirely or installed in a schema the pooler's
+// search_path doesn't include.
+func (db *DB) detectPostGIS(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var version string
+	err := db.Pool.QueryRowContext(ctx, `SELECT postgis_lib_version()`).Scan(&version)
+	if err != nil {
+		db.logger.Warn("database: PostGIS unavailable, segment matching falls back to in-process",
+			zap.Error(err))
+	} else {
+		db.logger.Info("database: PostGIS available", zap.String("version", version))
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.postgis = err == nil
+}
+
 func (db *DB) setConnected(v bool) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
@@ -56,6 +92,60 @@ func (db *DB) setLastError(err string) {
 	db.lastError = err
 }
 
+// RetryPolicy controls connection attempts at startup and in the background.
+// Attempt n (1-based) waits n*Backoff before the next try, capped at MaxBackoff.
+type RetryPolicy struct {
+	Attempts          int
+	Backoff           time.Duration
+	MaxBackoff        time.Duration
+	PingTimeout       time.Duration
+	ReconnectInterval time.Duration
+}
+
+// DefaultRetryPolicy matches the historical hardcoded behavior.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:          3,
+		Backoff:           3 * time.Second,
+		MaxBackoff:        30 * time.Second,
+		PingTimeout:       8 * time.Second,
+		ReconnectInterval: 30 * time.Second,
+	}
+}
+
+// withDefaults fills zero or negative fields from DefaultRetryPolicy.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	d := DefaultRetryPolicy()
+	if p.Attempts <= 0 {
+		p.Attempts = d.Attempts
+	}
+	if p.Backoff < 0 {
+		p.Backoff = d.Backoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = d.MaxBackoff
+	}
+	if p.PingTimeout <= 0 {
+		p.PingTimeout = d.PingTimeout
+	}
+	if p.ReconnectInterval <= 0 {
+		p.ReconnectInterval = d.ReconnectInterval
+	}
+	return p
+}
+
+// Delay returns how long to wait after a failed attempt (1-based).
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		return 0
+	}
+	d := time.Duration(attempt) * p.Backoff
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return d
+}
+
 // ensureSSLMode appends sslmode=require to DSN if not already present.
 func ensureSSLMode(dsn string) string {
 	if strings.Contains(dsn, "sslmode=") {
@@ -81,6 +171,40 @@ func detectConnType(dsn string) string {
 	return "unknown"
 }
 
+// queryExecMode picks how pgx sends queries. Supavisor in transaction mode
+// can hand consecutive statements to different backends, so cached prepared
+// statements would go missing; there every query is sent as one unnamed
+// prepare-and-execute instead.
+func queryExecMode(connType string) pgx.QueryExecMode {
+	if connType == "pooler-transaction" {
+		return pgx.QueryExecModeExec
+	}
+	return pgx.QueryExecModeCacheStatement
+}
+
+// openPool builds a pgx pool for dsn and wraps it as a *sql.DB. The pgx pool
+// owns the connections and dials lazily on first use, so callers still ping
+// to verify connectivity.
+func openPool(dsn, connType string, maxOpen int, maxLifetime time.Duration) (*pgxpool.Pool, *sql.DB, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if maxOpen > 0 {
+		cfg.MaxConns = int32(maxOpen)
+	}
+	if maxLifetime > 0 {
+		cfg.MaxConnLifetime = maxLifetime
+	}
+	cfg.ConnConfig.DefaultQueryExecMode = queryExecMode(connType)
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pool, stdlib.OpenDBFromPool(pool), nil
+}
+
 // maskDSN returns a safe-to-log version of the DSN.
 func maskDSN(dsn string) string {
 	u, err := url.Parse(dsn)
@@ -95,9 +219,10 @@ func maskDSN(dsn string) string {
 
 // New opens a PostgreSQL connection pool and verifies connectivity with retry logic.
 // It ALWAYS returns a non-nil *DB so callers never need to nil-check.
-// If the initial connection fails, it starts background reconnection.
+// If the initial connection fails, it starts background reconnection, which
+// stops once ctx is cancelled.
 // Callers can check db.IsConnected() to determine if the database is available.
-func New(dsn string, maxOpen, maxIdle int, maxLifetime time.Duration, logger *zap.Logger) *DB {
+func New(ctx context.Context, dsn string, maxOpen, maxIdle int, maxLifetime time.Duration, retry RetryPolicy, logger *zap.Logger) *DB {
 	if dsn == "" {
 		logger.Error("database: DATABASE_URL is empty — set it in environment variables")
 		// Return a stub DB that will never connect but won't crash
@@ -111,26 +236,32 @@ func New(dsn string, maxOpen, maxIdle int, maxLifetime time.Duration, logger *za
 		zap.String("dsn_masked", maskDSN(dsn)),
 		zap.String("conn_type", connType),
 		zap.Int("max_open", maxOpen),
-		zap.Int("max_idle", maxIdle),
 	)
 
-	pool, err := sql.Open("postgres", dsn)
+	// maxIdle has no pgx equivalent: idle connections live in the pgx pool,
+	// which the *sql.DB view must not hold on to.
+	pgxPool, pool, err := openPool(dsn, connType, maxOpen, maxLifetime)
 	if err != nil {
 		logger.Error("database: failed to open pool (bad DSN format?)", zap.Error(err))
 		return &DB{logger: logger, connType: connType, lastError: fmt.Sprintf("open: %v", err)}
 	}
 
-	pool.SetMaxOpenConns(maxOpen)
-	pool.SetMaxIdleConns(maxIdle)
-	pool.SetConnMaxLifetime(maxLifetime)
+	db := &DB{Pool: pool, pgx: pgxPool, logger: logger, connType: connType}
 
-	db := &DB{Pool: pool, logger: logger, connType: connType}
+	retry = retry.withDefaults()
+	logger.Info("database: retry policy",
+		zap.Int("attempts", retry.Attempts),
+		zap.Duration("backoff", retry.Backoff),
+		zap.Duration("max_backoff", retry.MaxBackoff),
+		zap.Duration("ping_timeout", retry.PingTimeout),
+		zap.Duration("reconnect_interval", retry.ReconnectInterval),
+	)
 
-	// Try initial connection with retries (up to 3 attempts with exponential backoff)
+	// Try initial connection with retries (linear backoff, capped)
 	var lastPingErr error
-	for attempt := 1; attempt <= 3; attempt++ {
-		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
-		pingErr := pool.PingContext(ctx)
+	for attempt := 1; attempt <= retry.Attempts; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, retry.PingTimeout)
+		pingErr := pool.PingContext(pingCtx)
 		cancel()
 
 		if pingErr == nil {
@@ -138,9 +269,9 @@ func New(dsn string, maxOpen, maxIdle int, maxLifetime time.Duration, logger *za
 				zap.Int("attempt", attempt),
 				zap.String("conn_type", connType),
 				zap.Int("max_open", maxOpen),
-				zap.Int("max_idle", maxIdle),
 			)
 			db.setConnected(true)
+			db.detectPostGIS(retry.PingTimeout)
 			return db
 		}
 
@@ -172,49 +303,71 @@ func New(dsn string, maxOpen, maxIdle int, maxLifetime time.Duration, logger *za
 
 		logger.Warn("database: ping failed, retrying...",
 			zap.Int("attempt", attempt),
-			zap.Int("max_attempts", 3),
+			zap.Int("max_attempts", retry.Attempts),
 			zap.Error(pingErr),
 		)
 
-		if attempt < 3 {
-			time.Sleep(time.Duration(attempt*3) * time.Second)
+		if attempt < retry.Attempts {
+			time.Sleep(retry.Delay(attempt))
 		}
 	}
 
 	// All initial attempts failed — start background reconnection loop
 	if lastPingErr != nil {
 		db.setLastError(lastPingErr.Error())
-		logger.Error("database: initial connection failed, starting background reconnection (every 30s)",
+		logger.Error("database: initial connection failed, starting background reconnection",
 			zap.Error(lastPingErr),
 			zap.String("conn_type", connType),
+			zap.Duration("interval", retry.ReconnectInterval),
 		)
 	}
-	go db.reconnectLoop()
+	db.reconnectDone = make(chan struct{})
+	go db.reconnectLoop(ctx, retry)
 
 	return db
 }
 
-// reconnectLoop tries to reconnect to the database every 30 seconds.
-// It runs indefinitely until a connection succeeds.
-func (db *DB) reconnectLoop() {
-	ticker := time.NewTicker(30 * time.Second)
+// ReconnectDone returns a channel that is closed once background
+// reconnection has stopped, because it succeeded or New's context was
+// cancelled. It is already closed when no reconnection was started.
+func (db *DB) ReconnectDone() <-chan struct{} {
+	if db.reconnectDone == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	return db.reconnectDone
+}
+
+// reconnectLoop tries to reconnect to the database every ReconnectInterval
+// until a connection succeeds or ctx is cancelled.
+func (db *DB) reconnectLoop(ctx context.Context, retry RetryPolicy) {
+	defer close(db.reconnectDone)
+	ticker := time.NewTicker(retry.ReconnectInterval)
 	defer ticker.Stop()
 
 	attempt := 0
-	for range ticker.C {
+	for {
+		select {
+		case <-ctx.Done():
+			db.logger.Info("database: reconnection stopped", zap.Int("attempts", attempt))
+			return
+		case <-ticker.C:
+		}
 		attempt++
 		if db.Pool == nil {
 			db.logger.Warn("database: reconnect skipped — no pool available (empty DATABASE_URL?)")
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		err := db.Pool.PingContext(ctx)
+		pingCtx, cancel := context.WithTimeout(ctx, retry.PingTimeout)
+		err := db.Pool.PingContext(pingCtx)
 		cancel()
 
 		if err == nil {
 			db.setConnected(true)
 			db.setLastError("")
+			db.detectPostGIS(retry.PingTimeout)
 			db.logger.Info("database: reconnected successfully", zap.Int("attempt", attempt))
 			return
 		}
@@ -241,7 +394,11 @@ func (db *DB) Close() error {
 	if db.Pool == nil {
 		return nil
 	}
-	return db.Pool.Close()
+	err := db.Pool.Close()
+	if db.pgx != nil {
+		db.pgx.Close()
+	}
+	return err
 }
 
 // HealthCheck pings the database and returns nil if healthy.
@@ -260,6 +417,29 @@ func (db *DB) HealthCheck(ctx context.Context) error {
 	return err
 }
 
+// Stats reports connection pool usage, or zeros when there is no pool. When
+// the pool is pgx-backed the numbers come from the pgx pool, since the
+// *sql.DB view holds no idle connections of its own; WaitCount is then the
+// number of acquires that had to wait and WaitDuration the total time spent
+// acquiring.
+func (db *DB) Stats() sql.DBStats {
+	if db.pgx != nil {
+		st := db.pgx.Stat()
+		return sql.DBStats{
+			MaxOpenConnections: int(st.MaxConns()),
+			OpenConnections:    int(st.TotalConns()),
+			InUse:              int(st.AcquiredConns()),
+			Idle:               int(st.IdleConns()),
+			WaitCount:          st.EmptyAcquireCount(),
+			WaitDuration:       st.AcquireDuration(),
+		}
+	}
+	if db.Pool == nil {
+		return sql.DBStats{}
+	}
+	return db.Pool.Stats()
+}
+
 // GetPool returns the underlying sql.DB pool. May be nil if DSN was empty/invalid.
 func (db *DB) GetPool() *sql.DB {
 	return db.Pool
@@ -0,0 +1,178 @@
+package database_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/database"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  database.RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{"default first retry", database.DefaultRetryPolicy(), 1, 3 * time.Second},
+		{"default second retry", database.DefaultRetryPolicy(), 2, 6 * time.Second},
+		{"custom base", database.RetryPolicy{Backoff: 500 * time.Millisecond, MaxBackoff: time.Minute}, 4, 2 * time.Second},
+		{"capped", database.RetryPolicy{Backoff: 10 * time.Second, MaxBackoff: 25 * time.Second}, 5, 25 * time.Second},
+		{"zero backoff retries immediately", database.RetryPolicy{Backoff: 0, MaxBackoff: time.Second}, 3, 0},
+		{"no cap", database.RetryPolicy{Backoff: time.Second}, 100, 100 * time.Second},
+		{"invalid attempt", database.DefaultRetryPolicy(), 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Delay(tt.attempt); got != tt.want {
+				t.Errorf("Delay(%d): got %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+// serveFakePostgres speaks just enough of the wire protocol on ln for pgx to
+// connect and ping: trust auth, then an empty response to every query.
+func serveFakePostgres(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			be := pgproto3.NewBackend(conn, conn)
+			if _, err := be.ReceiveStartupMessage(); err != nil {
+				return
+			}
+			be.Send(&pgproto3.AuthenticationOk{})
+			be.Send(&pgproto3.ParameterStatus{Name: "client_encoding", Value: "UTF8"})
+			be.Send(&pgproto3.ParameterStatus{Name: "standard_conforming_strings", Value: "on"})
+			be.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1})
+			be.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			if err := be.Flush(); err != nil {
+				return
+			}
+			for {
+				msg, err := be.Receive()
+				if err != nil {
+					return
+				}
+				switch msg.(type) {
+				case *pgproto3.Query:
+					be.Send(&pgproto3.EmptyQueryResponse{})
+					be.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+					if err := be.Flush(); err != nil {
+						return
+					}
+				case *pgproto3.Terminate:
+					return
+				}
+			}
+		}(conn)
+	}
+}
+
+func TestNew_CancelStopsReconnectLoop(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	retry := database.RetryPolicy{
+		Attempts:          1,
+		PingTimeout:       time.Second,
+		ReconnectInterval: 20 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	db := database.New(ctx, "postgres://runner:secret@"+addr+"/postgres?sslmode=disable", 2, 2, time.Minute, retry, zap.NewNop())
+	defer db.Close()
+
+	select {
+	case <-db.ReconnectDone():
+		t.Fatal("reconnect loop exited before cancel")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case <-db.ReconnectDone():
+	case <-time.After(time.Second):
+		t.Fatal("reconnect loop still running after cancel")
+	}
+	if db.IsConnected() {
+		t.Error("expected not connected")
+	}
+}
+
+func TestNew_NoReconnectLoopWithoutPool(t *testing.T) {
+	db := database.New(context.Background(), "", 0, 0, 0, database.RetryPolicy{}, zap.NewNop())
+	select {
+	case <-db.ReconnectDone():
+	default:
+		t.Error("expected ReconnectDone closed when no loop was started")
+	}
+}
+
+func TestNew_ReconnectsOnceDatabaseIsUp(t *testing.T) {
+	// Reserve a port, then leave it closed so the first attempt is refused.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	retry := database.RetryPolicy{
+		Attempts:          1,
+		PingTimeout:       time.Second,
+		ReconnectInterval: 20 * time.Millisecond,
+	}
+	db := database.New(context.Background(), "postgres://runner:secret@"+addr+"/postgres?sslmode=disable", 2, 2, time.Minute, retry, zap.NewNop())
+	defer db.Close()
+
+	if db.GetPool() == nil {
+		t.Fatal("expected a pool even when the first connection fails")
+	}
+	if db.IsConnected() {
+		t.Fatal("expected not connected before the server is up")
+	}
+	if db.LastError() == "" {
+		t.Error("expected the connection error to be recorded")
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("could not re-listen on %s: %v", addr, err)
+	}
+	defer ln.Close()
+	go serveFakePostgres(ln)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !db.IsConnected() {
+		if time.Now().After(deadline) {
+			t.Fatalf("did not reconnect; last error: %s", db.LastError())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if db.LastError() != "" {
+		t.Errorf("expected last error cleared, got %q", db.LastError())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := db.HealthCheck(ctx); err != nil {
+		t.Errorf("HealthCheck after reconnect: %v", err)
+	}
+	if st := db.Stats(); st.MaxOpenConnections != 2 || st.OpenConnections < 1 {
+		t.Errorf("expected pgx pool stats, got %+v", st)
+	}
+}
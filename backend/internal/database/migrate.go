@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// migrationLockID is the advisory lock key held while a migration runs, so
+// instances starting together don't apply the same file twice.
+const migrationLockID = 74_221_001
+
+// migrationFile matches versioned migrations such as 012_activity_soft_delete.sql.
+// Other .sql files in the directory (one-off scripts) are ignored.
+var migrationFile = regexp.MustCompile(`^(\d+)_.+\.sql$`)
+
+type migration struct {
+	version string
+	order   int
+	path    string
+}
+
+// Migrate applies the versioned .sql files in migrationsDir in version order,
+// recording each in schema_migrations. Versions already recorded are skipped,
+// and each file runs in its own transaction, so a failing file leaves no
+// partial changes and earlier ones stay applied.
+func Migrate(ctx context.Context, pool *sql.DB, migrationsDir string) error {
+	if pool == nil {
+		return fmt.Errorf("migrate: database pool not initialized")
+	}
+
+	migrations, err := loadMigrations(migrationsDir)
+	if err != nil {
+		return err
+	}
+
+	if _, err := pool.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version TEXT PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	for _, m := range migrations {
+		if err := applyMigration(ctx, pool, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadMigrations lists the versioned migrations in dir, lowest version first.
+func loadMigrations(dir string) ([]migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations dir: %w", err)
+	}
+
+	var out []migration
+	seen := make(map[int]string)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		match := migrationFile.FindStringSubmatch(e.Name())
+		if match == nil {
+			continue
+		}
+		order, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", e.Name(), err)
+		}
+		if other, dup := seen[order]; dup {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", order, other, e.Name())
+		}
+		seen[order] = e.Name()
+		out = append(out, migration{version: match[1], order: order, path: filepath.Join(dir, e.Name())})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].order < out[j].order })
+	return out, nil
+}
+
+// applyMigration runs one file and records its version in a single
+// transaction, unless the version is already recorded.
+func applyMigration(ctx context.Context, pool *sql.DB, m migration) error {
+	script, err := os.ReadFile(m.path)
+	if err != nil {
+		return fmt.Errorf("read migration %s: %w", m.version, err)
+	}
+
+	tx, err := pool.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin migration %s: %w", m.version, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("lock migration %s: %w", m.version, err)
+	}
+
+	var applied bool
+	if err := tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, m.version,
+	).Scan(&applied); err != nil {
+		return fmt.Errorf("check migration %s: %w", m.version, err)
+	}
+	if applied {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+		return fmt.Errorf("apply migration %s: %w", filepath.Base(m.path), err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version) VALUES ($1)`, m.version,
+	); err != nil {
+		return fmt.Errorf("record migration %s: %w", m.version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migration %s: %w", m.version, err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/apexrun/backend/internal/database"
+)
+
+// writeMigrations creates files out of order, plus a one-off script the
+// runner must ignore.
+func writeMigrations(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"010_third.sql":    "ALTER TABLE runs ADD COLUMN c INT;",
+		"001_first.sql":    "CREATE TABLE runs (id INT);",
+		"002_second.sql":   "ALTER TABLE runs ADD COLUMN b INT;",
+		"VERIFY_SETUP.sql": "SELECT 1;",
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func expectMigration(mock sqlmock.Sqlmock, version, script string, applied bool) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)")).
+		WithArgs(version).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(applied))
+	if applied {
+		mock.ExpectRollback()
+		return
+	}
+	mock.ExpectExec(regexp.QuoteMeta(script)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations (version) VALUES ($1)")).
+		WithArgs(version).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func newMigrateMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	mock.MatchExpectationsInOrder(true)
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	return db, mock
+}
+
+func TestMigrate_AppliesInVersionOrder(t *testing.T) {
+	dir := writeMigrations(t)
+	db, mock := newMigrateMock(t)
+	expectMigration(mock, "001", "CREATE TABLE runs (id INT);", false)
+	expectMigration(mock, "002", "ALTER TABLE runs ADD COLUMN b INT;", false)
+	expectMigration(mock, "010", "ALTER TABLE runs ADD COLUMN c INT;", false)
+
+	if err := database.Migrate(context.Background(), db, dir); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrate_SkipsAppliedVersions(t *testing.T) {
+	dir := writeMigrations(t)
+	db, mock := newMigrateMock(t)
+	// A second run after 001 and 002 were applied only runs 010.
+	expectMigration(mock, "001", "", true)
+	expectMigration(mock, "002", "", true)
+	expectMigration(mock, "010", "ALTER TABLE runs ADD COLUMN c INT;", false)
+
+	if err := database.Migrate(context.Background(), db, dir); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrate_FailedFileRollsBackAndStops(t *testing.T) {
+	dir := writeMigrations(t)
+	db, mock := newMigrateMock(t)
+	expectMigration(mock, "001", "CREATE TABLE runs (id INT);", false)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs("002").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE runs ADD COLUMN b INT;")).
+		WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+	// 010 is never attempted.
+
+	if err := database.Migrate(context.Background(), db, dir); err == nil {
+		t.Fatal("expected error from failing migration")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestMigrationFiles_Rerunnable guards databases first set up by pasting the
+// scripts by hand: every versioned file must re-apply cleanly on top of its
+// own objects, so policies and triggers need a DROP ... IF EXISTS first.
+func TestMigrationFiles_Rerunnable(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "[0-9]*_*.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found: %v", err)
+	}
+	create := regexp.MustCompile(`(?m)^CREATE (POLICY|TRIGGER) ("[^"]+"|\S+)\s+(?:ON|BEFORE \w+ ON|AFTER \w+ ON)\s+(\S+)`)
+	for _, f := range files {
+		body, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range create.FindAllStringSubmatch(string(body), -1) {
+			drop := "DROP " + m[1] + " IF EXISTS " + m[2] + " ON " + m[3] + ";"
+			if !regexp.MustCompile(regexp.QuoteMeta(drop)).Match(body) {
+				t.Errorf("%s: CREATE %s %s without %q", filepath.Base(f), m[1], m[2], drop)
+			}
+		}
+	}
+}
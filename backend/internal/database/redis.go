@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -54,21 +55,327 @@ func LeaderboardKey(segmentID string) string {
 	return fmt.Sprintf("leaderboard:%s", segmentID)
 }
 
-// SetLeaderboardEntry adds or updates a user's best time on a segment.
-// Score = elapsed_time_seconds (lower is better).
-func (r *Redis) SetLeaderboardEntry(ctx context.Context, segmentID, userID string, elapsedSeconds float64) error {
-	return r.Client.ZAdd(ctx, LeaderboardKey(segmentID), &redis.Z{
-		Score:  elapsedSeconds,
-		Member: userID,
-	}).Err()
+// LeaderboardEntriesKey returns the Redis hash holding each leaderboard
+// member's JSON-encoded effort.
+func LeaderboardEntriesKey(segmentID string) string {
+	return fmt.Sprintf("leaderboard:%s:entries", segmentID)
 }
 
-// GetLeaderboard returns the top N entries for a segment (fastest first).
-func (r *Redis) GetLeaderboard(ctx context.Context, segmentID string, limit int64) ([]redis.Z, error) {
-	return r.Client.ZRangeWithScores(ctx, LeaderboardKey(segmentID), 0, limit-1).Result()
+// LeaderboardTotalKey returns the Redis key holding how many athletes are on
+// a segment leaderboard; the cached sorted set may hold only the top of it.
+func LeaderboardTotalKey(segmentID string) string {
+	return fmt.Sprintf("leaderboard:%s:total", segmentID)
 }
 
-// InvalidateLeaderboard removes the cached leaderboard for a segment.
+// LeaderboardEntry is one user's best effort on a segment.
+type LeaderboardEntry struct {
+	UserID         string
+	ElapsedSeconds float64
+	Data           interface{} // JSON-encoded into LeaderboardEntriesKey
+}
+
+// setLeaderboardEntry drops the cached KOM, then updates the leaderboard
+// only if it is already cached (so a single effort never masquerades as a
+// complete board) and the time beats the user's cached best. A user not in
+// a truncated board may already be counted in the total beyond the cached
+// top, so that case drops the board instead of guessing.
+var setLeaderboardEntry = redis.NewScript(`
+redis.call('DEL', KEYS[3])
+if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+local cur = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if cur and tonumber(cur) <= tonumber(ARGV[2]) then return 0 end
+if not cur then
+  local total = tonumber(redis.call('GET', KEYS[4]) or '0')
+  if total > redis.call('ZCARD', KEYS[1]) then
+    redis.call('DEL', KEYS[1], KEYS[2], KEYS[4])
+    return 0
+  end
+  redis.call('INCR', KEYS[4])
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+return 1`)
+
+// SetLeaderboardEntry records a user's new time on a cached segment
+// leaderboard if it is their best. Score = elapsed_time_seconds (lower is
+// better). The segment's cached KOM is always invalidated.
+func (r *Redis) SetLeaderboardEntry(ctx context.Context, segmentID string, e LeaderboardEntry) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return fmt.Errorf("encode leaderboard entry: %w", err)
+	}
+	keys := []string{
+		LeaderboardKey(segmentID), LeaderboardEntriesKey(segmentID),
+		KOMKey(segmentID), LeaderboardTotalKey(segmentID),
+	}
+	return setLeaderboardEntry.Run(ctx, r.Client, keys, e.UserID, e.ElapsedSeconds, data).Err()
+}
+
+// ReplaceLeaderboard caches the top of a segment leaderboard (fastest first)
+// and its total athlete count, replacing whatever was cached before.
+func (r *Redis) ReplaceLeaderboard(ctx context.Context, segmentID string, entries []LeaderboardEntry, total int, ttl time.Duration) error {
+	zs := make([]*redis.Z, 0, len(entries))
+	fields := make(map[string]interface{}, len(entries))
+	for _, e := range entries {
+		data, err := json.Marshal(e.Data)
+		if err != nil {
+			return fmt.Errorf("encode leaderboard entry: %w", err)
+		}
+		zs = append(zs, &redis.Z{Score: e.ElapsedSeconds, Member: e.UserID})
+		fields[e.UserID] = data
+	}
+
+	key, entriesKey, totalKey := LeaderboardKey(segmentID), LeaderboardEntriesKey(segmentID), LeaderboardTotalKey(segmentID)
+	_, err := r.Client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Del(ctx, key, entriesKey, totalKey)
+		if len(zs) == 0 {
+			return nil
+		}
+		p.ZAdd(ctx, key, zs...)
+		p.HSet(ctx, entriesKey, fields)
+		p.Set(ctx, totalKey, total, ttl)
+		p.Expire(ctx, key, ttl)
+		p.Expire(ctx, entriesKey, ttl)
+		return nil
+	})
+	return err
+}
+
+// GetLeaderboard returns limit entries for a segment starting at offset
+// (fastest first).
+func (r *Redis) GetLeaderboard(ctx context.Context, segmentID string, offset, limit int64) ([]redis.Z, error) {
+	return r.Client.ZRangeWithScores(ctx, LeaderboardKey(segmentID), offset, offset+limit-1).Result()
+}
+
+// LeaderboardSize returns the total athlete count and how many of them are
+// cached. ok is false when the leaderboard isn't cached.
+func (r *Redis) LeaderboardSize(ctx context.Context, segmentID string) (total, cached int64, ok bool, err error) {
+	var totalCmd *redis.StringCmd
+	var cardCmd *redis.IntCmd
+	_, err = r.Client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		totalCmd = p.Get(ctx, LeaderboardTotalKey(segmentID))
+		cardCmd = p.ZCard(ctx, LeaderboardKey(segmentID))
+		return nil
+	})
+	if err == redis.Nil {
+		return 0, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, err
+	}
+	total, err = totalCmd.Int64()
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("decode leaderboard total: %w", err)
+	}
+	cached = cardCmd.Val()
+	return total, cached, cached > 0, nil
+}
+
+// GetLeaderboardEntries returns the cached JSON effort for each user, in
+// order. ok is false if any of them is missing.
+func (r *Redis) GetLeaderboardEntries(ctx context.Context, segmentID string, userIDs []string) ([][]byte, bool, error) {
+	if len(userIDs) == 0 {
+		return nil, true, nil
+	}
+	vals, err := r.Client.HMGet(ctx, LeaderboardEntriesKey(segmentID), userIDs...).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	out := make([][]byte, len(vals))
+	for i, v := range vals {
+		str, isStr := v.(string)
+		if !isStr {
+			return nil, false, nil
+		}
+		out[i] = []byte(str)
+	}
+	return out, true, nil
+}
+
+// InvalidateLeaderboard removes the cached leaderboard and KOM for a segment.
 func (r *Redis) InvalidateLeaderboard(ctx context.Context, segmentID string) error {
-	return r.Client.Del(ctx, LeaderboardKey(segmentID)).Err()
+	return r.Client.Del(ctx,
+		LeaderboardKey(segmentID), LeaderboardEntriesKey(segmentID),
+		LeaderboardTotalKey(segmentID), KOMKey(segmentID),
+	).Err()
+}
+
+// KOMKey returns the Redis key for a segment's cached record holder.
+func KOMKey(segmentID string) string {
+	return fmt.Sprintf("kom:%s", segmentID)
+}
+
+// --- Rate limiting helpers ---
+
+// RateLimitKey returns the Redis counter key for id's requests in the
+// fixed window starting at window.
+func RateLimitKey(id string, window time.Time) string {
+	return fmt.Sprintf("ratelimit:%s:%d", id, window.Unix())
+}
+
+// IncrRateLimit increments a rate limit counter and returns the new count.
+// The counter expires ttl after its last increment.
+func (r *Redis) IncrRateLimit(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := r.Client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		incr = p.Incr(ctx, key)
+		p.Expire(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// --- Token blocklist helpers ---
+
+// TokenBlocklistKey returns the Redis key marking a revoked auth token.
+func TokenBlocklistKey(tokenID string) string {
+	return fmt.Sprintf("revoked_token:%s", tokenID)
+}
+
+// BlockToken marks a token as revoked for ttl, which should cover the rest
+// of its lifetime.
+func (r *Redis) BlockToken(ctx context.Context, tokenID string, ttl time.Duration) error {
+	return r.Client.Set(ctx, TokenBlocklistKey(tokenID), 1, ttl).Err()
+}
+
+// IsTokenBlocked reports whether a token has been revoked.
+func (r *Redis) IsTokenBlocked(ctx context.Context, tokenID string) (bool, error) {
+	n, err := r.Client.Exists(ctx, TokenBlocklistKey(tokenID)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// --- Activity list cache helpers ---
+
+// ActivityListVersionKey returns the Redis counter that versions a user's
+// cached activity lists.
+func ActivityListVersionKey(userID string) string {
+	return fmt.Sprintf("activities:version:%s", userID)
+}
+
+// ActivityListKey returns the Redis key for one cached page of a user's
+// activity list; page identifies limit, offset and filters.
+func ActivityListKey(userID string, version int64, page string) string {
+	return fmt.Sprintf("activities:list:%s:%d:%s", userID, version, page)
+}
+
+// ActivityListVersion returns the current version of a user's cached
+// activity lists (0 if never invalidated).
+func (r *Redis) ActivityListVersion(ctx context.Context, userID string) (int64, error) {
+	v, err := r.Client.Get(ctx, ActivityListVersionKey(userID)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return v, err
+}
+
+// InvalidateActivityLists bumps the user's list version so every cached page
+// is skipped; the stale pages expire on their own TTL.
+func (r *Redis) InvalidateActivityLists(ctx context.Context, userID string) error {
+	return r.Client.Incr(ctx, ActivityListVersionKey(userID)).Err()
+}
+
+// --- Idempotency key helpers ---
+
+// IdempotencyKey returns the Redis key recording a user's request made with
+// an Idempotency-Key header.
+func IdempotencyKey(userID, key string) string {
+	return fmt.Sprintf("idempotency:%s:%s", userID, key)
+}
+
+// IdempotencyRecord is the stored outcome of an idempotent request. Status
+// 0 means the first request is still in flight. RequestHash identifies the
+// payload the key was first used with.
+type IdempotencyRecord struct {
+	Status      int             `json:"status"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	RequestHash string          `json:"request_hash,omitempty"`
+}
+
+// ReserveIdempotencyKey claims key for an in-flight request with payload
+// requestHash for ttl. If the key is already claimed, reserved is false and
+// rec is what it holds.
+func (r *Redis) ReserveIdempotencyKey(ctx context.Context, key, requestHash string, ttl time.Duration) (rec *IdempotencyRecord, reserved bool, err error) {
+	pending, _ := json.Marshal(IdempotencyRecord{RequestHash: requestHash})
+	reserved, err = r.Client.SetNX(ctx, key, pending, ttl).Result()
+	if err != nil || reserved {
+		return nil, reserved, err
+	}
+	rec = &IdempotencyRecord{}
+	hit, err := r.GetJSON(ctx, key, rec)
+	if err != nil {
+		return nil, false, err
+	}
+	if !hit { // expired between SETNX and GET
+		return r.ReserveIdempotencyKey(ctx, key, requestHash, ttl)
+	}
+	return rec, false, nil
+}
+
+// StoreIdempotentResponse records the response for a reserved key for ttl.
+func (r *Redis) StoreIdempotentResponse(ctx context.Context, key string, rec IdempotencyRecord, ttl time.Duration) error {
+	return r.SetJSON(ctx, key, rec, ttl)
+}
+
+// ReleaseIdempotencyKey drops a reservation so the request can be retried.
+func (r *Redis) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	return r.Client.Del(ctx, key).Err()
+}
+
+// --- Reverse geocoding cache helpers ---
+
+// GeocodeKey returns the Redis key caching the place label for a coordinate.
+// Coordinates are rounded to two decimals (~1km), so runs starting from the
+// same neighbourhood share one lookup.
+func GeocodeKey(lat, lng float64) string {
+	return fmt.Sprintf("geocode:%.2f:%.2f", lat, lng)
+}
+
+// GetGeocode returns the cached place label for a coordinate. It reports
+// false on a cache miss.
+func (r *Redis) GetGeocode(ctx context.Context, lat, lng float64) (string, bool, error) {
+	label, err := r.Client.Get(ctx, GeocodeKey(lat, lng)).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return label, true, nil
+}
+
+// SetGeocode caches the place label for a coordinate for ttl.
+func (r *Redis) SetGeocode(ctx context.Context, lat, lng float64, label string, ttl time.Duration) error {
+	return r.Client.Set(ctx, GeocodeKey(lat, lng), label, ttl).Err()
+}
+
+// --- Generic JSON cache helpers ---
+
+// GetJSON loads a cached value into dst. It reports false on a cache miss.
+func (r *Redis) GetJSON(ctx context.Context, key string, dst interface{}) (bool, error) {
+	data, err := r.Client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return false, fmt.Errorf("decode cached %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// SetJSON caches v under key for ttl.
+func (r *Redis) SetJSON(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode cached %s: %w", key, err)
+	}
+	return r.Client.Set(ctx, key, data, ttl).Err()
 }
@@ -0,0 +1,75 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/database"
+)
+
+func TestSetLeaderboardEntry(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rds, err := database.NewRedis(mr.Addr(), "", 0, 5, zap.NewNop())
+	if err != nil {
+		t.Fatalf("redis: %v", err)
+	}
+	defer rds.Close()
+
+	score := func(user string) float64 {
+		t.Helper()
+		s, err := mr.ZScore(database.LeaderboardKey("seg-1"), user)
+		if err != nil {
+			t.Fatalf("zscore %s: %v", user, err)
+		}
+		return s
+	}
+
+	// Not cached yet: the entry must not create a partial board.
+	if err := rds.SetLeaderboardEntry(ctx, "seg-1", database.LeaderboardEntry{UserID: "u1", ElapsedSeconds: 200}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if mr.Exists(database.LeaderboardKey("seg-1")) {
+		t.Fatal("uncached leaderboard was created by a single entry")
+	}
+
+	if err := rds.ReplaceLeaderboard(ctx, "seg-1", []database.LeaderboardEntry{
+		{UserID: "u1", ElapsedSeconds: 300, Data: map[string]int{"elapsed_seconds": 300}},
+	}, 1, time.Minute); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	mr.Set(database.KOMKey("seg-1"), "{}")
+
+	// Slower than the cached best: ignored, but the KOM is still dropped.
+	if err := rds.SetLeaderboardEntry(ctx, "seg-1", database.LeaderboardEntry{UserID: "u1", ElapsedSeconds: 320}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if got := score("u1"); got != 300 {
+		t.Errorf("slower time replaced best: %v", got)
+	}
+	if mr.Exists(database.KOMKey("seg-1")) {
+		t.Error("expected KOM cache to be invalidated")
+	}
+
+	// A new best and a new athlete both land.
+	if err := rds.SetLeaderboardEntry(ctx, "seg-1", database.LeaderboardEntry{UserID: "u1", ElapsedSeconds: 250, Data: map[string]int{"elapsed_seconds": 250}}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := rds.SetLeaderboardEntry(ctx, "seg-1", database.LeaderboardEntry{UserID: "u2", ElapsedSeconds: 280, Data: map[string]int{"elapsed_seconds": 280}}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if got := score("u1"); got != 250 {
+		t.Errorf("expected new best 250, got %v", got)
+	}
+	entries, ok, err := rds.GetLeaderboardEntries(ctx, "seg-1", []string{"u1", "u2"})
+	if err != nil || !ok {
+		t.Fatalf("entries: ok=%v err=%v", ok, err)
+	}
+	if string(entries[0]) != `{"elapsed_seconds":250}` {
+		t.Errorf("expected updated entry, got %s", entries[0])
+	}
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// readRetries is how many times a read is retried after a transient error;
+// attempt n waits n*readRetryBackoff first.
+const (
+	readRetries      = 2
+	readRetryBackoff = 50 * time.Millisecond
+)
+
+// RetryQuerier wraps a Querier and retries reads that fail on a dropped
+// connection (e.g. a Supabase pooler restart). Only statements starting with
+// SELECT are retried; ExecContext and any other statement, including
+// INSERT ... RETURNING through QueryRowContext, run exactly once.
+type RetryQuerier struct {
+	q      Querier
+	logger *zap.Logger
+}
+
+// NewRetryQuerier wraps q with read retries.
+func NewRetryQuerier(q Querier, logger *zap.Logger) *RetryQuerier {
+	return &RetryQuerier{q: q, logger: logger}
+}
+
+// BeginTx starts a transaction on the wrapped pool, so RunInTx works on a
+// RetryQuerier. Statements inside the transaction are never retried.
+func (r *RetryQuerier) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	b, ok := r.q.(TxBeginner)
+	if !ok {
+		return nil, errors.New("querier does not support transactions")
+	}
+	return b.BeginTx(ctx, opts)
+}
+
+// ExecContext runs query once; writes are never retried implicitly.
+func (r *RetryQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.q.ExecContext(ctx, query, args...)
+}
+
+// QueryContext runs query, retrying reads on transient errors.
+func (r *RetryQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	for attempt := 1; attempt <= readRetries && r.shouldRetry(ctx, query, err, attempt); attempt++ {
+		rows, err = r.q.QueryContext(ctx, query, args...)
+	}
+	return rows, err
+}
+
+// QueryRowContext runs query, retrying reads on transient errors. Errors
+// that only surface in Scan are not retried.
+func (r *RetryQuerier) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	row := r.q.QueryRowContext(ctx, query, args...)
+	for attempt := 1; attempt <= readRetries && r.shouldRetry(ctx, query, row.Err(), attempt); attempt++ {
+		row = r.q.QueryRowContext(ctx, query, args...)
+	}
+	return row
+}
+
+// shouldRetry reports whether a failed read should run again and, if so,
+// waits out the backoff. It returns false if ctx ends while waiting.
+func (r *RetryQuerier) shouldRetry(ctx context.Context, query string, err error, attempt int) bool {
+	if !isTransient(err) || !isRead(query) {
+		return false
+	}
+	r.logger.Warn("database: retrying read after transient error",
+		zap.Int("attempt", attempt),
+		zap.Error(err),
+	)
+	t := time.NewTimer(time.Duration(attempt) * readRetryBackoff)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// isRead reports whether query is a plain SELECT. WITH is excluded because
+// a CTE can contain writes.
+func isRead(query string) bool {
+	q := strings.TrimSpace(query)
+	return len(q) >= 6 && strings.EqualFold(q[:6], "SELECT")
+}
+
+// isTransient reports whether err is a connection-level failure that a
+// fresh connection may not hit: resets, EOFs, server shutdowns and errors
+// pgx knows happened before the query was sent. Query errors (bad SQL,
+// constraint violations) and context cancellation are not transient.
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, net.ErrClosed) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08 is connection exceptions; 57P01-03 are admin/crash
+		// shutdown and "cannot connect now" during a restart.
+		return strings.HasPrefix(pgErr.Code, "08") ||
+			pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset by peer") ||
+		strings.Contains(msg, "broken pipe") ||
+		strings.Contains(msg, "unexpected EOF")
+}
@@ -0,0 +1,99 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/database"
+)
+
+func newRetryMock(t *testing.T) (*database.RetryQuerier, sqlmock.Sqlmock) {
+	t.Helper()
+	pool, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { pool.Close() })
+	return database.NewRetryQuerier(pool, zap.NewNop()), mock
+}
+
+func TestRetryQuerier_RetriesTransientRead(t *testing.T) {
+	q, mock := newRetryMock(t)
+	read := regexp.QuoteMeta("SELECT name FROM segments WHERE id = $1")
+	mock.ExpectQuery(read).WithArgs("seg-1").WillReturnError(io.ErrUnexpectedEOF)
+	mock.ExpectQuery(read).WithArgs("seg-1").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Park Loop"))
+
+	var name string
+	err := q.QueryRowContext(context.Background(), "SELECT name FROM segments WHERE id = $1", "seg-1").Scan(&name)
+	if err != nil {
+		t.Fatalf("expected retry to succeed, got %v", err)
+	}
+	if name != "Park Loop" {
+		t.Errorf("got %q", name)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRetryQuerier_GivesUpAfterRetries(t *testing.T) {
+	q, mock := newRetryMock(t)
+	reset := errors.New("read tcp: connection reset by peer")
+	for i := 0; i < 3; i++ {
+		mock.ExpectQuery("SELECT id FROM activities").WillReturnError(reset)
+	}
+
+	_, err := q.QueryContext(context.Background(), "SELECT id FROM activities")
+	if !errors.Is(err, reset) {
+		t.Fatalf("expected the reset error after exhausting retries, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRetryQuerier_DoesNotRetry(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		err   error
+	}{
+		{"write through QueryRow", "INSERT INTO activities (id) VALUES ($1) RETURNING id", io.EOF},
+		{"CTE", "WITH moved AS (DELETE FROM activities RETURNING id) SELECT id FROM moved", io.EOF},
+		{"query error", "SELECT nope FROM activities", errors.New(`column "nope" does not exist`)},
+		{"cancelled", "SELECT id FROM activities", context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, mock := newRetryMock(t)
+			mock.ExpectQuery(regexp.QuoteMeta(tt.query)).WillReturnError(tt.err)
+
+			// A second attempt would fail with sqlmock's unexpected-call
+			// error instead of the original one.
+			var id string
+			if err := q.QueryRowContext(context.Background(), tt.query).Scan(&id); !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestRetryQuerier_ExecRunsOnce(t *testing.T) {
+	q, mock := newRetryMock(t)
+	mock.ExpectExec("UPDATE activities").WillReturnError(io.EOF)
+
+	if _, err := q.ExecContext(context.Background(), "UPDATE activities SET is_private = true"); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
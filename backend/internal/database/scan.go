@@ -0,0 +1,27 @@
+package database
+
+// Scanner is the Scan method shared by *sql.Row and *sql.Rows.
+type Scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// WithTotal wraps a row whose last column is COUNT(*) OVER () so an existing
+// scan function reads the leading columns while the count lands in total.
+func WithTotal(s Scanner, total *int) Scanner {
+	return WithTrailing(s, total)
+}
+
+// WithTrailing wraps a row with extra columns after the ones an existing
+// scan function reads, scanning those into dest.
+func WithTrailing(s Scanner, dest ...interface{}) Scanner {
+	return trailingScanner{s: s, trailing: dest}
+}
+
+type trailingScanner struct {
+	s        Scanner
+	trailing []interface{}
+}
+
+func (t trailingScanner) Scan(dest ...interface{}) error {
+	return t.s.Scan(append(dest, t.trailing...)...)
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Querier is the query surface shared by *sql.DB and *sql.Tx. Repositories
+// hold a Querier so the same code runs against the pool or inside a
+// transaction.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// TxBeginner starts transactions; *sql.DB and *RetryQuerier implement it.
+type TxBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+var (
+	_ Querier    = (*sql.DB)(nil)
+	_ Querier    = (*sql.Tx)(nil)
+	_ Querier    = (*RetryQuerier)(nil)
+	_ TxBeginner = (*sql.DB)(nil)
+	_ TxBeginner = (*RetryQuerier)(nil)
+)
+
+// WithTx runs fn in a transaction on the pool. The transaction commits if fn
+// returns nil and rolls back if it returns an error or panics (the panic is
+// re-raised after the rollback).
+func (db *DB) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if db.Pool == nil {
+		return fmt.Errorf("database pool not initialized")
+	}
+	return RunInTx(ctx, db.Pool, fn)
+}
+
+// RunInTx is WithTx for a bare pool.
+func RunInTx(ctx context.Context, pool TxBeginner, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := pool.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// WithSavepoint runs fn inside a savepoint on q, which must be a
+// transaction. If fn fails, only its writes are rolled back and the
+// transaction stays usable.
+func WithSavepoint(ctx context.Context, q Querier, name string, fn func() error) error {
+	if _, err := q.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("savepoint %s: %w", name, err)
+	}
+	if err := fn(); err != nil {
+		_, _ = q.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+		return err
+	}
+	if _, err := q.ExecContext(ctx, "RELEASE SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("release savepoint %s: %w", name, err)
+	}
+	return nil
+}
+
+// WithQueryTimeout bounds ctx for one repository call. The parent's deadline
+// still applies if it is sooner; a timeout <= 0 leaves ctx as is.
+func WithQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,188 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/apexrun/backend/internal/database"
+)
+
+func TestWithTx(t *testing.T) {
+	insert := func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(context.Background(), "INSERT INTO activities (id) VALUES ($1)", "a1")
+		return err
+	}
+
+	tests := []struct {
+		name    string
+		fn      func(tx *sql.Tx) error
+		expect  func(mock sqlmock.Sqlmock)
+		wantErr bool
+	}{
+		{
+			name: "commits on success",
+			fn:   insert,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO activities").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "rolls back when fn fails after a write",
+			fn: func(tx *sql.Tx) error {
+				if err := insert(tx); err != nil {
+					return err
+				}
+				return errors.New("effort insert failed")
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO activities").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+		{
+			name: "begin failure",
+			fn:   insert,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin().WillReturnError(errors.New("connection refused"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock: %v", err)
+			}
+			defer pool.Close()
+			tt.expect(mock)
+
+			err = (&database.DB{Pool: pool}).WithTx(context.Background(), tt.fn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WithTx error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestWithTx_RollsBackOnPanic(t *testing.T) {
+	pool, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer pool.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic to propagate")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	}()
+	_ = (&database.DB{Pool: pool}).WithTx(context.Background(), func(*sql.Tx) error {
+		panic("boom")
+	})
+}
+
+func TestWithTx_NoPool(t *testing.T) {
+	if err := (&database.DB{}).WithTx(context.Background(), func(*sql.Tx) error { return nil }); err == nil {
+		t.Fatal("expected error without a pool")
+	}
+}
+
+func TestWithSavepoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		fnErr   error
+		release bool
+	}{
+		{"releases on success", nil, true},
+		{"rolls back to the savepoint on failure", errors.New("insert failed"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock: %v", err)
+			}
+			defer pool.Close()
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("SAVEPOINT sp")).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("INSERT INTO t").WillReturnResult(sqlmock.NewResult(0, 1))
+			if tt.release {
+				mock.ExpectExec(regexp.QuoteMeta("RELEASE SAVEPOINT sp")).WillReturnResult(sqlmock.NewResult(0, 0))
+			} else {
+				mock.ExpectExec(regexp.QuoteMeta("ROLLBACK TO SAVEPOINT sp")).WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			// The transaction is still usable, so it commits either way.
+			mock.ExpectCommit()
+
+			err = (&database.DB{Pool: pool}).WithTx(context.Background(), func(tx *sql.Tx) error {
+				err := database.WithSavepoint(context.Background(), tx, "sp", func() error {
+					if _, err := tx.Exec("INSERT INTO t VALUES (1)"); err != nil {
+						return err
+					}
+					return tt.fnErr
+				})
+				if err != tt.fnErr {
+					t.Errorf("WithSavepoint: got %v, want %v", err, tt.fnErr)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("WithTx: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestWithQueryTimeout(t *testing.T) {
+	t.Run("bounds an open-ended context", func(t *testing.T) {
+		ctx, cancel := database.WithQueryTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if dl, ok := ctx.Deadline(); !ok || time.Until(dl) > time.Minute {
+			t.Errorf("expected a deadline within a minute, got %v %v", dl, ok)
+		}
+	})
+
+	t.Run("never extends the parent deadline", func(t *testing.T) {
+		parent, cancelParent := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancelParent()
+		want, _ := parent.Deadline()
+
+		ctx, cancel := database.WithQueryTimeout(parent, time.Hour)
+		defer cancel()
+		if dl, _ := ctx.Deadline(); !dl.Equal(want) {
+			t.Errorf("deadline %v, want parent's %v", dl, want)
+		}
+	})
+
+	t.Run("zero disables", func(t *testing.T) {
+		ctx, cancel := database.WithQueryTimeout(context.Background(), 0)
+		defer cancel()
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("expected no deadline")
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package segments_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/database"
+	"github.com/apexrun/backend/internal/segments"
+)
+
+// realSegmentDB connects to the database named by TEST_DATABASE_URL and
+// returns the segment, activities and users its tests record efforts
+// against, or skips. The schema must be applied and the rows must exist:
+//
+//	TEST_DATABASE_URL=postgres://... TEST_SEGMENT_ID=<uuid> \
+//	TEST_ACTIVITY_IDS=<uuid>,... TEST_USER_IDS=<uuid>,... \
+//	go test -run RealDB ./internal/segments
+//
+// Efforts the tests record for those activities on that segment are deleted
+// afterwards and the segment's counters recomputed.
+func realSegmentDB(t *testing.T) (repo *segments.Repository, db *database.DB, segmentID string, activityIDs, userIDs []string) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	segmentID = os.Getenv("TEST_SEGMENT_ID")
+	activityIDs = strings.Split(os.Getenv("TEST_ACTIVITY_IDS"), ",")
+	userIDs = strings.Split(os.Getenv("TEST_USER_IDS"), ",")
+	if dsn == "" || segmentID == "" || activityIDs[0] == "" || userIDs[0] == "" {
+		t.Skip("TEST_DATABASE_URL, TEST_SEGMENT_ID, TEST_ACTIVITY_IDS and TEST_USER_IDS not set")
+	}
+
+	db = database.New(context.Background(), dsn, 20, 10, time.Minute, database.RetryPolicy{Attempts: 1}, zap.NewNop())
+	t.Cleanup(func() { db.Close() })
+	if !db.IsConnected() {
+		t.Fatalf("connect: %s", db.LastError())
+	}
+	repo = segments.NewRepository(db.GetPool(), zap.NewNop())
+
+	clean := func() {
+		ctx := context.Background()
+		_, _ = db.GetPool().ExecContext(ctx,
+			`DELETE FROM segment_efforts WHERE segment_id = $1 AND activity_id = ANY($2)`,
+			segmentID, activityIDs)
+		_ = repo.RecomputeSegmentCounters(ctx, segmentID)
+	}
+	clean()
+	t.Cleanup(clean)
+	return repo, db, segmentID, activityIDs, userIDs
+}
+
+// TestCreateEffort_RealDBConcurrentCounters records one effort per activity
+// from concurrent goroutines and checks the segment counters against
+// segment_efforts.
+func TestCreateEffort_RealDBConcurrentCounters(t *testing.T) {
+	repo, db, segmentID, activityIDs, userIDs := realSegmentDB(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i, activityID := range activityIDs {
+		wg.Add(1)
+		go func(i int, activityID string) {
+			defer wg.Done()
+			effort := &segments.SegmentEffort{
+				SegmentID:      segmentID,
+				ActivityID:     activityID,
+				UserID:         userIDs[i%len(userIDs)],
+				ElapsedSeconds: 300 + i,
+				RecordedAt:     time.Now().UTC(),
+			}
+			if _, err := repo.CreateEffort(ctx, effort); err != nil {
+				t.Errorf("CreateEffort: %v", err)
+			}
+		}(i, activityID)
+	}
+	wg.Wait()
+
+	var attempts, athletes, wantAttempts, wantAthletes int
+	if err := db.GetPool().QueryRowContext(ctx,
+		`SELECT total_attempts, unique_athletes FROM segments WHERE id = $1`, segmentID,
+	).Scan(&attempts, &athletes); err != nil {
+		t.Fatalf("read counters: %v", err)
+	}
+	if err := db.GetPool().QueryRowContext(ctx,
+		`SELECT COUNT(*), COUNT(DISTINCT user_id) FROM segment_efforts WHERE segment_id = $1`, segmentID,
+	).Scan(&wantAttempts, &wantAthletes); err != nil {
+		t.Fatalf("count efforts: %v", err)
+	}
+	if attempts != wantAttempts || athletes != wantAthletes {
+		t.Errorf("counters = (%d attempts, %d athletes), efforts table has (%d, %d)",
+			attempts, athletes, wantAttempts, wantAthletes)
+	}
+}
+
+// TestCreateEffort_RealDBRematch records the same activity on the segment
+// twice and expects one effort holding the faster time.
+func TestCreateEffort_RealDBRematch(t *testing.T) {
+	repo, db, segmentID, activityIDs, userIDs := realSegmentDB(t)
+	ctx := context.Background()
+
+	var attemptsBefore int
+	if err := db.GetPool().QueryRowContext(ctx,
+		`SELECT total_attempts FROM segments WHERE id = $1`, segmentID,
+	).Scan(&attemptsBefore); err != nil {
+		t.Fatalf("read counters: %v", err)
+	}
+
+	for _, elapsed := range []int{320, 300, 310} {
+		effort := &segments.SegmentEffort{
+			SegmentID:      segmentID,
+			ActivityID:     activityIDs[0],
+			UserID:         userIDs[0],
+			ElapsedSeconds: elapsed,
+			RecordedAt:     time.Now().UTC(),
+		}
+		if _, err := repo.CreateEffort(ctx, effort); err != nil {
+			t.Fatalf("CreateEffort(%d): %v", elapsed, err)
+		}
+	}
+
+	var count, best, attempts int
+	if err := db.GetPool().QueryRowContext(ctx, `
+		SELECT COUNT(*), MIN(elapsed_seconds),
+		       (SELECT total_attempts FROM segments WHERE id = $1)
+		FROM segment_efforts WHERE segment_id = $1 AND activity_id = $2`,
+		segmentID, activityIDs[0],
+	).Scan(&count, &best, &attempts); err != nil {
+		t.Fatalf("read effort: %v", err)
+	}
+	if count != 1 || best != 300 {
+		t.Errorf("got %d efforts, best %ds; want 1 effort of 300s", count, best)
+	}
+	if attempts != attemptsBefore+1 {
+		t.Errorf("total_attempts = %d, want %d", attempts, attemptsBefore+1)
+	}
+}
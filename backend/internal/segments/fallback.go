@@ -0,0 +1,149 @@
+package segments
+
+import (
+	"math"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+// MatchRouteToSegment reports whether activityRoute traverses segmentRoute in
+// the segment's direction, with every part of the segment within
+// bufferMeters of the activity. It is the in-process counterpart of the
+// ST_Buffer/ST_Contains match, for databases without PostGIS.
+//
+// entryIdx and exitIdx are the activity points closest to the segment's
+// start and end on the first traversal. A route that passes the start more
+// than once is tried from each pass in turn, and a pass that wanders off
+// before the route takes up the segment doesn't count as its entry.
+func MatchRouteToSegment(activityRoute, segmentRoute []utils.GPSPoint, bufferMeters float64) (matched bool, entryIdx, exitIdx int) {
+	if len(activityRoute) < 2 || len(segmentRoute) < 2 || bufferMeters <= 0 {
+		return false, 0, 0
+	}
+	samples := densify(segmentRoute, bufferMeters)
+	start, end := segmentRoute[0], segmentRoute[len(segmentRoute)-1]
+
+	for i := 0; i < len(activityRoute); i++ {
+		if utils.HaversineDistance(activityRoute[i], start) > bufferMeters {
+			continue
+		}
+		// Enter at the closest point of this pass by the start.
+		entry, best := i, utils.HaversineDistance(activityRoute[i], start)
+		for i+1 < len(activityRoute) {
+			d := utils.HaversineDistance(activityRoute[i+1], start)
+			if d > bufferMeters {
+				break
+			}
+			i++
+			if d < best {
+				entry, best = i, d
+			}
+		}
+		if entry, exit, ok := followSegment(activityRoute, samples, entry, start, end, bufferMeters); ok {
+			return true, entry, exit
+		}
+	}
+	return false, 0, 0
+}
+
+// followSegment walks the activity forward from entry, requiring each segment
+// sample in order to lie within buffer of an activity edge at or after the
+// previous sample's. It returns the activity points closest to start and end
+// on the traversal.
+func followSegment(route, samples []utils.GPSPoint, entry int, start, end utils.GPSPoint, buffer float64) (int, int, bool) {
+	edge := entry
+	if edge == len(route)-1 {
+		edge--
+	}
+	anchor := -1 // edge of the first sample clear of the start
+	for _, s := range samples {
+		for distanceToEdge(s, route[edge], route[edge+1]) > buffer {
+			edge++
+			if edge == len(route)-1 {
+				return 0, 0, false
+			}
+		}
+		if anchor < 0 && utils.HaversineDistance(s, start) > buffer {
+			anchor = edge
+		}
+	}
+	if anchor >= 0 {
+		entry = lastPassBefore(route, start, entry, anchor+1, buffer)
+	}
+
+	// Exit at the closest point to the end among the last matched edge and
+	// any points after it still near the end.
+	exit, best := edge, utils.HaversineDistance(route[edge], end)
+	for j := edge + 1; j < len(route); j++ {
+		d := utils.HaversineDistance(route[j], end)
+		if d > buffer && j > edge+1 {
+			break
+		}
+		if d < best {
+			exit, best = j, d
+		}
+	}
+	if exit <= entry {
+		return 0, 0, false
+	}
+	return entry, exit, true
+}
+
+// lastPassBefore returns the point closest to p on the last pass within
+// buffer of it in route[from:to+1], or from if there is none.
+func lastPassBefore(route []utils.GPSPoint, p utils.GPSPoint, from, to int, buffer float64) int {
+	j := to
+	for j > from && utils.HaversineDistance(route[j], p) > buffer {
+		j--
+	}
+	closest, best := j, utils.HaversineDistance(route[j], p)
+	for ; j >= from; j-- {
+		d := utils.HaversineDistance(route[j], p)
+		if d > buffer {
+			break
+		}
+		if d < best {
+			closest, best = j, d
+		}
+	}
+	return closest
+}
+
+// densify returns the segment's points with extra points interpolated so no
+// two consecutive samples are more than spacing apart, so a segment corner
+// can't cut outside the buffer between vertices unnoticed.
+func densify(route []utils.GPSPoint, spacing float64) []utils.GPSPoint {
+	out := []utils.GPSPoint{route[0]}
+	for i := 1; i < len(route); i++ {
+		a, b := route[i-1], route[i]
+		steps := int(math.Ceil(utils.HaversineDistance(a, b) / spacing))
+		for k := 1; k < steps; k++ {
+			f := float64(k) / float64(steps)
+			out = append(out, utils.GPSPoint{
+				Lat: a.Lat + (b.Lat-a.Lat)*f,
+				Lng: a.Lng + (b.Lng-a.Lng)*f,
+			})
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// distanceToEdge is the great-circle distance in meters from p to the closest
+// point of edge ab, found in a local equirectangular projection around p
+// (accurate at segment-buffer scales).
+func distanceToEdge(p, a, b utils.GPSPoint) float64 {
+	cos := math.Cos(p.Lat * math.Pi / 180)
+	ax, ay := (a.Lng-p.Lng)*cos, a.Lat-p.Lat
+	bx, by := (b.Lng-p.Lng)*cos, b.Lat-p.Lat
+	dx, dy := bx-ax, by-ay
+
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l))
+	}
+	closest := utils.GPSPoint{
+		Lat: a.Lat + (b.Lat-a.Lat)*t,
+		Lng: a.Lng + (b.Lng-a.Lng)*t,
+	}
+	return utils.HaversineDistance(p, closest)
+}
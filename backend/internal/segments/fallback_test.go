@@ -0,0 +1,79 @@
+package segments_test
+
+import (
+	"testing"
+
+	"github.com/apexrun/backend/internal/segments"
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+// northLine returns n points ~111m apart heading north from (lat0, lng).
+func northLine(lat0, lng float64, n int) []utils.GPSPoint {
+	route := make([]utils.GPSPoint, n)
+	for i := range route {
+		route[i] = utils.GPSPoint{Lat: lat0 + float64(i)*0.001, Lng: lng}
+	}
+	return route
+}
+
+func reversed(route []utils.GPSPoint) []utils.GPSPoint {
+	out := make([]utils.GPSPoint, len(route))
+	for i, p := range route {
+		out[len(route)-1-i] = p
+	}
+	return out
+}
+
+func TestMatchRouteToSegment(t *testing.T) {
+	activity := northLine(0, 0, 11)
+
+	tests := []struct {
+		name      string
+		segment   []utils.GPSPoint
+		wantMatch bool
+		wantEntry int
+		wantExit  int
+	}{
+		// ~5m east of the route, from the 3rd point to the 7th.
+		{"contained segment", northLine(0.002, 0.000045, 5), true, 2, 6},
+		{"contained between vertices", []utils.GPSPoint{{Lat: 0.0021, Lng: 0}, {Lat: 0.0079, Lng: 0}}, true, 2, 8},
+		// Same shape ~200m east: parallel but outside the buffer.
+		{"parallel but far", northLine(0.002, 0.0018, 5), false, 0, 0},
+		{"reverse direction", reversed(northLine(0.002, 0.000045, 5)), false, 0, 0},
+		{"leaves the route midway", []utils.GPSPoint{{Lat: 0.002, Lng: 0}, {Lat: 0.004, Lng: 0.002}, {Lat: 0.006, Lng: 0}}, false, 0, 0},
+		{"runs past the route's end", northLine(0.008, 0, 5), false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, entry, exit := segments.MatchRouteToSegment(activity, tt.segment, 25)
+			if ok != tt.wantMatch {
+				t.Fatalf("matched = %v, want %v", ok, tt.wantMatch)
+			}
+			if ok && (entry != tt.wantEntry || exit != tt.wantExit) {
+				t.Errorf("entry, exit = %d, %d, want %d, %d", entry, exit, tt.wantEntry, tt.wantExit)
+			}
+		})
+	}
+}
+
+func TestMatchRouteToSegment_LaterPass(t *testing.T) {
+	// The route touches the segment's start, heads ~220m east and loops
+	// back south of it, then runs north along the segment. Entry is the
+	// second pass by the start, not the first.
+	route := []utils.GPSPoint{
+		{Lat: 0.001, Lng: 0},
+		{Lat: 0.001, Lng: 0.002},
+		{Lat: 0, Lng: 0.002},
+		{Lat: 0, Lng: 0},
+	}
+	route = append(route, northLine(0.001, 0, 5)...)
+	segment := northLine(0.001, 0, 4)
+
+	ok, entry, exit := segments.MatchRouteToSegment(route, segment, 25)
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	if entry != 4 || exit != 7 {
+		t.Errorf("entry, exit = %d, %d, want 4, 7", entry, exit)
+	}
+}
@@ -0,0 +1,67 @@
+package segments
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/auth"
+)
+
+// Flag handles POST /api/v1/segments/:id/flag
+// Each user may flag a segment once; a repeat flag is a 409.
+func (h *Handler) Flag(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req FlagSegmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	segmentID := c.Param("id")
+	segment, err := h.repo.GetByID(ctx, segmentID)
+	if err != nil {
+		h.logger.Error("get segment", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	if segment == nil || !segment.VisibleTo(userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "segment not found"})
+		return
+	}
+
+	count, flagged, err := h.repo.FlagSegment(ctx, segmentID, userID, req.Reason)
+	if err != nil {
+		h.logger.Error("flag segment", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	if !flagged {
+		c.JSON(http.StatusConflict, gin.H{"error": "you have already flagged this segment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"segment_id": segmentID, "flag_count": count})
+}
+
+// Flagged handles GET /api/v1/admin/segments/flagged
+// Returns flagged segments, most flagged first, with their reports.
+func (h *Handler) Flagged(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	segments, err := h.repo.ListFlagged(c.Request.Context(), limit)
+	if err != nil {
+		h.logger.Error("list flagged segments", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"segments": segments})
+}
@@ -1,22 +1,54 @@
 package segments
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
 	"github.com/apexrun/backend/internal/auth"
+	"github.com/apexrun/backend/internal/coaching"
 	"github.com/apexrun/backend/internal/database"
+	"github.com/apexrun/backend/pkg/utils"
 )
 
+// komCacheTTL bounds how stale a cached KOM can be; new efforts also
+// invalidate it via Redis.SetLeaderboardEntry.
+const komCacheTTL = 60 * time.Second
+
+// Leaderboard orderings for ?sort=.
+const (
+	leaderboardSortElapsed   = "elapsed"
+	leaderboardSortAgeGraded = "age_graded"
+)
+
+// leaderboardCacheSize is how many athletes a cached leaderboard holds; it
+// is also the largest ?limit served.
+const leaderboardCacheSize = 200
+
+// leaderboardCacheTTL bounds staleness if an effort is written without going
+// through Redis.SetLeaderboardEntry.
+const leaderboardCacheTTL = 10 * time.Minute
+
+// maxListSegments is the default and largest ?limit for List.
+const maxListSegments = 100
+
+// profileIntervalMeters is the spacing of elevation profile samples.
+const profileIntervalMeters = 50
+
 // Handler serves segment HTTP endpoints.
 type Handler struct {
-	repo                *Repository
-	redis               *database.Redis
-	segmentMatchBuffer  int
-	logger              *zap.Logger
+	repo               *Repository
+	redis              *database.Redis
+	segmentMatchBuffer int
+	logger             *zap.Logger
 }
 
 // NewHandler creates a new segments handler.
@@ -34,11 +66,36 @@ func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
 	rg.GET("", h.List)
 	rg.GET("/:id", h.GetByID)
 	rg.GET("/:id/leaderboard", h.Leaderboard)
+	rg.GET("/:id/kom", h.KOM)
+	rg.GET("/:id/my-efforts", h.MyEfforts)
+	rg.GET("/:id/profile", h.Profile)
 	rg.POST("", h.Create)
+	rg.POST("/from-activity", h.CreateFromActivity)
+	rg.PUT("/:id", h.Update)
+	rg.DELETE("/:id", h.Delete)
+	rg.POST("/:id/flag", h.Flag)
 	rg.POST("/match", h.Match)
 }
 
+// RegisterPublicRoutes mounts read-only segment routes that also serve
+// anonymous callers. rg must be outside the auth middleware; behind
+// auth.OptionalMiddleware, a signed-in creator still sees their private
+// segments.
+func (h *Handler) RegisterPublicRoutes(rg *gin.RouterGroup) {
+	rg.GET("/segments", h.List)
+	rg.GET("/segments/:id", h.GetByID)
+}
+
+// RegisterAdminRoutes mounts moderation routes on the given RouterGroup,
+// which the caller must already restrict to admins.
+func (h *Handler) RegisterAdminRoutes(rg *gin.RouterGroup) {
+	rg.GET("/flagged", h.Flagged)
+	rg.POST("/:id/verify", h.Verify)
+	rg.POST("/:id/unverify", h.Unverify)
+}
+
 // List handles GET /api/v1/segments
+// Pages use the {"data", "pagination"} envelope unless ?envelope=false.
 func (h *Handler) List(c *gin.Context) {
 	var nearLat, nearLng, radiusKm *float64
 
@@ -61,7 +118,37 @@ func (h *Handler) List(c *gin.Context) {
 		}
 	}
 
-	segments, err := h.repo.ListSegments(c.Request.Context(), nearLat, nearLng, radiusKm)
+	// As with activity lists, a malformed limit or offset is a 400 and an
+	// out-of-range one falls back to the default.
+	limit := maxListSegments
+	if v := c.Query("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be an integer"})
+			return
+		}
+		if l > 0 && l <= maxListSegments {
+			limit = l
+		}
+	}
+	offset := 0
+	if v := c.Query("offset"); v != "" {
+		o, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be an integer"})
+			return
+		}
+		if o > 0 {
+			offset = o
+		}
+	}
+	envelope, ok := utils.ParseEnvelope(c)
+	if !ok {
+		return
+	}
+
+	viewerID, _ := auth.GetUserID(c)
+	segments, total, err := h.repo.ListSegments(c.Request.Context(), viewerID, nearLat, nearLng, radiusKm, limit, offset)
 	if err != nil {
 		h.logger.Error("list segments", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
@@ -71,7 +158,11 @@ func (h *Handler) List(c *gin.Context) {
 	if segments == nil {
 		segments = []Segment{}
 	}
-	c.JSON(http.StatusOK, gin.H{"segments": segments})
+	if !envelope {
+		c.JSON(http.StatusOK, gin.H{"segments": segments})
+		return
+	}
+	c.JSON(http.StatusOK, utils.NewListEnvelope(segments, len(segments), limit, offset, total))
 }
 
 // GetByID handles GET /api/v1/segments/:id
@@ -84,7 +175,9 @@ func (h *Handler) GetByID(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
 		return
 	}
-	if segment == nil {
+	// Private segments 404 for non-creators so their existence isn't leaked.
+	viewerID, _ := auth.GetUserID(c)
+	if segment == nil || !segment.VisibleTo(viewerID) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "segment not found"})
 		return
 	}
@@ -92,27 +185,401 @@ func (h *Handler) GetByID(c *gin.Context) {
 	c.JSON(http.StatusOK, segment)
 }
 
-// Leaderboard handles GET /api/v1/segments/:id/leaderboard
+// Leaderboard handles GET /api/v1/segments/:id/leaderboard?period=week|month|year|all&limit=&offset=
+// Each athlete appears once, with their best effort in the period (calendar
+// periods in UTC; default all time). Ranks are absolute across pages and
+// total is the number of athletes on the board. The top of the all-time
+// board is served from the Redis cache when available and refilled from the
+// database on a miss.
+//
+// ?age_graded=true adds age_graded_seconds and age_grade_pct from each
+// athlete's profile age and gender; ?sort=age_graded also re-ranks by graded
+// time (ungraded athletes last), covering the fastest 200 athletes.
+//
+// ?sex=M|F&age_min=&age_max= restrict the board to a category by profile
+// gender and age; the applied filters are echoed back as "filters".
 func (h *Handler) Leaderboard(c *gin.Context) {
 	segmentID := c.Param("id")
+	ctx := c.Request.Context()
+	period := c.DefaultQuery("period", "all")
+	since, ok := utils.PeriodStart(period, time.Now().UTC())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be one of: week, month, year, all"})
+		return
+	}
 	limit := 50
 	if v := c.Query("limit"); v != "" {
 		if l, err := strconv.Atoi(v); err == nil && l > 0 {
 			limit = l
 		}
 	}
+	if limit > leaderboardCacheSize {
+		limit = leaderboardCacheSize
+	}
+	offset := 0
+	if v := c.Query("offset"); v != "" {
+		if o, err := strconv.Atoi(v); err == nil && o > 0 {
+			offset = o
+		}
+	}
+
+	sortBy := c.DefaultQuery("sort", leaderboardSortElapsed)
+	if sortBy != leaderboardSortElapsed && sortBy != leaderboardSortAgeGraded {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of: elapsed, age_graded"})
+		return
+	}
+	ageGraded := c.Query("age_graded") == "true" || sortBy == leaderboardSortAgeGraded
 
-	efforts, err := h.repo.GetLeaderboard(c.Request.Context(), segmentID, limit)
+	filter, ok := parseLeaderboardCategory(c)
+	if !ok {
+		return
+	}
+	if !since.IsZero() {
+		filter.Since = &since
+	}
+
+	segment, err := h.repo.GetByID(ctx, segmentID)
+	if err != nil {
+		h.logger.Error("get segment", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	viewerID, _ := auth.GetUserID(c)
+	if segment == nil || !segment.VisibleTo(viewerID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "segment not found"})
+		return
+	}
+
+	var efforts []SegmentEffort
+	var total int
+	if sortBy == leaderboardSortAgeGraded {
+		// Re-ranking needs the whole board, so grade the cached top and page it.
+		efforts, total, err = h.board(ctx, segmentID, viewerID, filter, leaderboardCacheSize, 0)
+	} else {
+		efforts, total, err = h.board(ctx, segmentID, viewerID, filter, limit, offset)
+	}
 	if err != nil {
 		h.logger.Error("get leaderboard", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
 		return
 	}
 
+	if ageGraded {
+		if err := h.ageGrade(ctx, efforts, segment.DistanceMeters); err != nil {
+			h.logger.Error("age grade leaderboard", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			return
+		}
+	}
+	if sortBy == leaderboardSortAgeGraded {
+		sortByAgeGrade(efforts)
+		efforts = pageOf(efforts, offset, limit)
+	}
+
 	if efforts == nil {
 		efforts = []SegmentEffort{}
 	}
-	c.JSON(http.StatusOK, gin.H{"leaderboard": efforts})
+	c.JSON(http.StatusOK, gin.H{
+		"period":      period,
+		"filters":     filter,
+		"leaderboard": efforts,
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
+	})
+}
+
+// board returns a page of the leaderboard. The unfiltered all-time board is
+// read from the Redis cache when possible; a miss within the cached top
+// refills it.
+func (h *Handler) board(ctx context.Context, segmentID, viewerID string, filter LeaderboardFilter, limit, offset int) ([]SegmentEffort, int, error) {
+	if filter == (LeaderboardFilter{}) {
+		if efforts, total, hit := h.cachedLeaderboard(ctx, segmentID, limit, offset); hit {
+			return efforts, total, nil
+		}
+		if offset+limit <= leaderboardCacheSize {
+			// Refill the cached top of the board and serve the page from it.
+			efforts, total, err := h.repo.GetLeaderboard(ctx, segmentID, viewerID, leaderboardCacheSize, 0, filter)
+			if err != nil {
+				return nil, 0, err
+			}
+			h.cacheLeaderboard(ctx, segmentID, efforts, total)
+			return pageOf(efforts, offset, limit), total, nil
+		}
+	}
+	return h.repo.GetLeaderboard(ctx, segmentID, viewerID, limit, offset, filter)
+}
+
+// ageGrade sets the age-graded time and percentage on each effort whose
+// athlete's profile has a gradable age and gender.
+func (h *Handler) ageGrade(ctx context.Context, efforts []SegmentEffort, distanceMeters float64) error {
+	if len(efforts) == 0 {
+		return nil
+	}
+	userIDs := make([]string, len(efforts))
+	for i, e := range efforts {
+		userIDs[i] = e.UserID
+	}
+	profiles, err := h.repo.GetAthleteProfiles(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+	for i := range efforts {
+		p, ok := profiles[efforts[i].UserID]
+		if !ok || p.Age == nil || p.Gender == nil {
+			continue
+		}
+		g, ok := coaching.AgeGrade(float64(efforts[i].ElapsedSeconds), distanceMeters, *p.Age, *p.Gender)
+		if !ok {
+			continue
+		}
+		efforts[i].AgeGradedSeconds = &g.GradedSeconds
+		efforts[i].AgeGradePct = &g.Percent
+	}
+	return nil
+}
+
+// sortByAgeGrade orders efforts by age-graded time, ungraded efforts last in
+// their raw order, and re-ranks them.
+func sortByAgeGrade(efforts []SegmentEffort) {
+	sort.SliceStable(efforts, func(i, j int) bool {
+		a, b := efforts[i].AgeGradedSeconds, efforts[j].AgeGradedSeconds
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return *a < *b
+	})
+	for i := range efforts {
+		rank := i + 1
+		efforts[i].Rank = &rank
+	}
+}
+
+// cachedLeaderboard reads a page of the board from Redis. It misses when the
+// page reaches past the cached top of a larger board; any Redis error or
+// missing entry is also treated as a miss.
+func (h *Handler) cachedLeaderboard(ctx context.Context, segmentID string, limit, offset int) ([]SegmentEffort, int, bool) {
+	if h.redis == nil {
+		return nil, 0, false
+	}
+	total, cached, ok, err := h.redis.LeaderboardSize(ctx, segmentID)
+	if err != nil {
+		h.logger.Debug("leaderboard cache read failed", zap.Error(err))
+		return nil, 0, false
+	}
+	if !ok || (int64(offset+limit) > cached && total > cached) {
+		return nil, 0, false
+	}
+
+	zs, err := h.redis.GetLeaderboard(ctx, segmentID, int64(offset), int64(limit))
+	if err != nil {
+		h.logger.Debug("leaderboard cache read failed", zap.Error(err))
+		return nil, 0, false
+	}
+
+	userIDs := make([]string, len(zs))
+	for i, z := range zs {
+		userIDs[i], _ = z.Member.(string)
+	}
+	raw, ok, err := h.redis.GetLeaderboardEntries(ctx, segmentID, userIDs)
+	if err != nil {
+		h.logger.Debug("leaderboard cache read failed", zap.Error(err))
+		return nil, 0, false
+	}
+	if !ok {
+		return nil, 0, false
+	}
+
+	efforts := make([]SegmentEffort, len(raw))
+	for i, data := range raw {
+		if err := json.Unmarshal(data, &efforts[i]); err != nil {
+			h.logger.Debug("leaderboard cache entry corrupt", zap.Error(err))
+			return nil, 0, false
+		}
+		rank := offset + i + 1
+		efforts[i].Rank = &rank
+	}
+	return efforts, int(total), true
+}
+
+// cacheLeaderboard stores the top of a best-per-user board and its total.
+// Failures only cost a cache miss next time.
+func (h *Handler) cacheLeaderboard(ctx context.Context, segmentID string, efforts []SegmentEffort, total int) {
+	if h.redis == nil || len(efforts) == 0 {
+		return
+	}
+	entries := make([]database.LeaderboardEntry, len(efforts))
+	for i, e := range efforts {
+		e.Rank = nil
+		entries[i] = database.LeaderboardEntry{UserID: e.UserID, ElapsedSeconds: float64(e.ElapsedSeconds), Data: e}
+	}
+	if err := h.redis.ReplaceLeaderboard(ctx, segmentID, entries, total, leaderboardCacheTTL); err != nil {
+		h.logger.Debug("leaderboard cache write failed", zap.Error(err))
+	}
+}
+
+// pageOf slices efforts[offset:offset+limit], clamped to its bounds.
+func pageOf(efforts []SegmentEffort, offset, limit int) []SegmentEffort {
+	if offset >= len(efforts) {
+		return nil
+	}
+	end := offset + limit
+	if end > len(efforts) {
+		end = len(efforts)
+	}
+	return efforts[offset:end]
+}
+
+// parseLeaderboardCategory reads ?sex=M|F&age_min=&age_max=. It writes a
+// 400 response and returns false if any is malformed.
+func parseLeaderboardCategory(c *gin.Context) (LeaderboardFilter, bool) {
+	var f LeaderboardFilter
+	if v := c.Query("sex"); v != "" {
+		if _, ok := leaderboardGenders[v]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sex must be one of: M, F"})
+			return f, false
+		}
+		f.Sex = v
+	}
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"age_min", &f.AgeMin}, {"age_max", &f.AgeMax}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 120 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": p.name + " must be an age between 1 and 120"})
+			return f, false
+		}
+		*p.dst = n
+	}
+	if f.AgeMin > 0 && f.AgeMax > 0 && f.AgeMin > f.AgeMax {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "age_min must not exceed age_max"})
+		return f, false
+	}
+	return f, true
+}
+
+// KOM handles GET /api/v1/segments/:id/kom
+// Returns the segment's single fastest effort.
+func (h *Handler) KOM(c *gin.Context) {
+	segmentID := c.Param("id")
+	ctx := c.Request.Context()
+
+	segment, err := h.repo.GetByID(ctx, segmentID)
+	if err != nil {
+		h.logger.Error("get segment", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	viewerID, _ := auth.GetUserID(c)
+	if segment == nil || !segment.VisibleTo(viewerID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "segment not found"})
+		return
+	}
+
+	var kom *SegmentEffort
+	if h.redis != nil {
+		var cached SegmentEffort
+		hit, err := h.redis.GetJSON(ctx, database.KOMKey(segmentID), &cached)
+		if err != nil {
+			h.logger.Debug("kom cache read failed", zap.Error(err))
+		} else if hit {
+			kom = &cached
+		}
+	}
+
+	if kom == nil {
+		kom, err = h.repo.GetRecordHolder(ctx, segmentID)
+		if err != nil {
+			h.logger.Error("get record holder", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			return
+		}
+		if kom == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "segment has no efforts"})
+			return
+		}
+		if h.redis != nil {
+			if err := h.redis.SetJSON(ctx, database.KOMKey(segmentID), kom, komCacheTTL); err != nil {
+				h.logger.Debug("kom cache write failed", zap.Error(err))
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"segment_id": segmentID, "kom": kom})
+}
+
+// MyEfforts handles GET /api/v1/segments/:id/my-efforts
+// Returns the caller's efforts on the segment, newest first.
+func (h *Handler) MyEfforts(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	segmentID := c.Param("id")
+	ctx := c.Request.Context()
+	segment, err := h.repo.GetByID(ctx, segmentID)
+	if err != nil {
+		h.logger.Error("get segment", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	if segment == nil || !segment.VisibleTo(userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "segment not found"})
+		return
+	}
+
+	efforts, err := h.repo.GetUserEfforts(ctx, segmentID, userID)
+	if err != nil {
+		h.logger.Error("get user efforts", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	if efforts == nil {
+		efforts = []UserEffort{}
+	}
+	c.JSON(http.StatusOK, gin.H{"segment_id": segmentID, "efforts": efforts})
+}
+
+// Profile handles GET /api/v1/segments/:id/profile
+// Samples distance, elevation and grade along the segment path every
+// profileIntervalMeters. Segments without recorded elevation (those not cut
+// from an activity with altitude) get null elevations.
+func (h *Handler) Profile(c *gin.Context) {
+	segmentID := c.Param("id")
+	ctx := c.Request.Context()
+
+	segment, err := h.repo.GetByID(ctx, segmentID)
+	if err != nil {
+		h.logger.Error("get segment", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	viewerID, _ := auth.GetUserID(c)
+	if segment == nil || !segment.VisibleTo(viewerID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "segment not found"})
+		return
+	}
+
+	path, hasElevation, err := h.repo.GetPath(ctx, segmentID)
+	if err != nil {
+		h.logger.Error("get segment path", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	profile := utils.ElevationProfile(path, profileIntervalMeters, hasElevation)
+	if profile == nil {
+		profile = []utils.ProfilePoint{}
+	}
+	c.JSON(http.StatusOK, gin.H{"segment_id": segmentID, "profile": profile})
 }
 
 // Create handles POST /api/v1/segments
@@ -139,6 +606,171 @@ func (h *Handler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, segment)
 }
 
+// CreateFromActivity handles POST /api/v1/segments/from-activity
+// The segment path is route points [start_index, end_index) of one of the
+// caller's activities; distance and elevation gain are computed from them.
+func (h *Handler) CreateFromActivity(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req CreateFromActivityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	track, err := h.repo.GetActivityTrack(ctx, req.ActivityID)
+	if err != nil {
+		h.logger.Error("get activity track", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	if track == nil || track.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
+		return
+	}
+
+	start, end := *req.StartIndex, *req.EndIndex
+	if start < 0 || end > len(track.Points) || end-start < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("start_index and end_index must select at least 2 of the activity's %d route points", len(track.Points)),
+		})
+		return
+	}
+	slice := track.Points[start:end]
+
+	distance := utils.TotalDistance(slice)
+	if distance <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "selected route points cover no distance"})
+		return
+	}
+	var elevation *float64
+	if gain := utils.ElevationGain(slice); gain > 0 {
+		elevation = &gain
+	}
+	// Keep the activity's altitude for the profile; the stored path is 2D.
+	elevations := make([]float64, len(slice))
+	recorded := false
+	for i, p := range slice {
+		elevations[i] = p.Elevation
+		recorded = recorded || p.Elevation != 0
+	}
+	if !recorded {
+		elevations = nil
+	}
+
+	segment, err := h.repo.Create(ctx, userID, &CreateSegmentRequest{
+		Name:                req.Name,
+		Description:         req.Description,
+		DistanceMeters:      distance,
+		ElevationGainMeters: elevation,
+		RouteWKT:            utils.RouteToWKTLineString(slice),
+		Visibility:          req.Visibility,
+		ActivityType:        track.ActivityType,
+		Elevations:          elevations,
+	})
+	if err != nil {
+		h.logger.Error("create segment from activity", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create segment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, segment)
+}
+
+// Update handles PUT /api/v1/segments/:id
+// Only the segment's creator may edit it.
+func (h *Handler) Update(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req UpdateSegmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	segmentID := c.Param("id")
+	if !h.authorizeCreator(c, userID, segmentID) {
+		return
+	}
+
+	segment, err := h.repo.Update(c.Request.Context(), userID, segmentID, &req)
+	if err != nil {
+		h.logger.Error("update segment", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	if segment == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "segment not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, segment)
+}
+
+// Delete handles DELETE /api/v1/segments/:id
+// Only the segment's creator may delete it; its efforts go with it.
+func (h *Handler) Delete(c *gin.Context) {
+	userID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	segmentID := c.Param("id")
+	if !h.authorizeCreator(c, userID, segmentID) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	err := h.repo.Delete(ctx, userID, segmentID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "segment not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("delete segment", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	if h.redis != nil {
+		if err := h.redis.InvalidateLeaderboard(ctx, segmentID); err != nil {
+			h.logger.Warn("invalidate leaderboard", zap.String("segment_id", segmentID), zap.Error(err))
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "segment deleted"})
+}
+
+// authorizeCreator writes a 404 if the segment isn't visible to userID and a
+// 403 if userID didn't create it. It reports whether the caller may proceed.
+func (h *Handler) authorizeCreator(c *gin.Context, userID, segmentID string) bool {
+	segment, err := h.repo.GetByID(c.Request.Context(), segmentID)
+	if err != nil {
+		h.logger.Error("get segment", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return false
+	}
+	if segment == nil || !segment.VisibleTo(userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "segment not found"})
+		return false
+	}
+	if segment.CreatorID == nil || *segment.CreatorID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the segment creator can modify it"})
+		return false
+	}
+	return true
+}
+
 // Match handles POST /api/v1/segments/match
 // Finds all segments that overlap with a given activity's route.
 func (h *Handler) Match(c *gin.Context) {
@@ -154,8 +786,23 @@ func (h *Handler) Match(c *gin.Context) {
 		return
 	}
 
+	// Matches include private segments, so only the activity's owner may
+	// ask; anyone else's (or a missing) activity is a 404 as in
+	// CreateFromActivity.
+	ctx := c.Request.Context()
+	track, err := h.repo.GetActivityTrack(ctx, req.ActivityID)
+	if err != nil {
+		h.logger.Error("get activity track", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	if track == nil || track.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
+		return
+	}
+
 	matchedIDs, err := h.repo.MatchActivityToSegments(
-		c.Request.Context(), req.ActivityID, h.segmentMatchBuffer,
+		ctx, req.ActivityID, h.segmentMatchBuffer, req.AllowReverse,
 	)
 	if err != nil {
 		h.logger.Error("match segments", zap.Error(err))
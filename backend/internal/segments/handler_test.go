@@ -1,15 +1,26 @@
 package segments_test
 
 import (
+	"context"
+	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 
 	"github.com/apexrun/backend/internal/auth"
+	"github.com/apexrun/backend/internal/database"
+	"github.com/apexrun/backend/internal/segments"
+	"github.com/apexrun/backend/pkg/utils"
 )
 
 func init() {
@@ -232,3 +243,1254 @@ func TestSegmentQueryParams_Parse(t *testing.T) {
 		t.Errorf("expected radius_km=5, got %s", gotRadius)
 	}
 }
+
+func TestGetByID_PrivateSegmentHiddenFromOthers(t *testing.T) {
+	tests := []struct {
+		name       string
+		viewer     string
+		expectCode int
+	}{
+		{"creator", "owner-1", http.StatusOK},
+		{"other user", "user-2", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			mock.ExpectQuery("FROM segments").
+				WithArgs("seg-1").
+				WillReturnRows(sqlmock.NewRows(segmentColumns).
+					AddRow("seg-1", "owner-1", "My Hill", nil, 800.0, nil, false, "run", "private", 3, 1, time.Now(), "", 0))
+
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set(auth.ContextKeyUserID, tt.viewer)
+				c.Next()
+			})
+			segments.NewHandler(repo, nil, 20, zap.NewNop()).RegisterRoutes(router.Group("/segments"))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/segments/seg-1", nil))
+			if w.Code != tt.expectCode {
+				t.Errorf("expected %d, got %d: %s", tt.expectCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestPublicGetByID(t *testing.T) {
+	tests := []struct {
+		name       string
+		visibility string
+		viewer     string // empty for an anonymous caller
+		expectCode int
+	}{
+		{"anonymous sees a public segment", "public", "", http.StatusOK},
+		{"anonymous can't see a private segment", "private", "", http.StatusNotFound},
+		{"signed-in creator sees their private segment", "private", "owner-1", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			mock.ExpectQuery("FROM segments").
+				WithArgs("seg-1").
+				WillReturnRows(sqlmock.NewRows(segmentColumns).
+					AddRow("seg-1", "owner-1", "My Hill", nil, 800.0, nil, false, "run", tt.visibility, 3, 1, time.Now(), "", 0))
+
+			router := gin.New()
+			if tt.viewer != "" {
+				router.Use(func(c *gin.Context) {
+					c.Set(auth.ContextKeyUserID, tt.viewer)
+					c.Next()
+				})
+			}
+			segments.NewHandler(repo, nil, 20, zap.NewNop()).RegisterPublicRoutes(router.Group("/public"))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/public/segments/seg-1", nil))
+			if w.Code != tt.expectCode {
+				t.Errorf("expected %d, got %d: %s", tt.expectCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestPublicList(t *testing.T) {
+	for name, viewer := range map[string]string{"anonymous": "", "signed in": "owner-1"} {
+		t.Run(name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			mock.ExpectQuery(`ORDER BY total_attempts DESC, id\s+LIMIT \$2 OFFSET \$3`).
+				WithArgs(viewer, 100, 0).
+				WillReturnRows(sqlmock.NewRows(segmentListColumns).
+					AddRow("seg-1", "owner-1", "My Hill", nil, 800.0, nil, false, "run", "public", 3, 1, time.Now(), "", 0, 1))
+
+			router := gin.New()
+			if viewer != "" {
+				router.Use(func(c *gin.Context) {
+					c.Set(auth.ContextKeyUserID, viewer)
+					c.Next()
+				})
+			}
+			segments.NewHandler(repo, nil, 20, zap.NewNop()).RegisterPublicRoutes(router.Group("/public"))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/public/segments", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestKOMHandler(t *testing.T) {
+	recorded := time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		efforts    *sqlmock.Rows
+		expectCode int
+		expectID   string
+	}{
+		{
+			name: "fastest of several efforts",
+			// Rows come back in the query's ORDER BY, as Postgres would
+			// return them before LIMIT; the fastest must win over slower
+			// and more recent efforts.
+			efforts: sqlmock.NewRows(effortColumns).
+				AddRow("e2", "seg-1", "a2", "fast-user", 240, 4.0, nil, nil, recorded, "Speedy").
+				AddRow("e1", "seg-1", "a1", "steady-user", 265, 4.4, nil, nil, recorded.Add(-time.Hour), "Steady").
+				AddRow("e3", "seg-1", "a3", "slow-user", 310, 5.2, nil, nil, recorded.Add(time.Hour), "Slow"),
+			expectCode: http.StatusOK,
+			expectID:   "e2",
+		},
+		{
+			name: "tie goes to the earlier effort",
+			efforts: sqlmock.NewRows(effortColumns).
+				AddRow("e4", "seg-1", "a4", "fast-user", 240, 4.0, nil, nil, recorded.Add(-24*time.Hour), "Speedy").
+				AddRow("e5", "seg-1", "a5", "rival-user", 240, 4.0, nil, nil, recorded, "Rival"),
+			expectCode: http.StatusOK,
+			expectID:   "e4",
+		},
+		{
+			name:       "no efforts",
+			efforts:    sqlmock.NewRows(effortColumns),
+			expectCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			mock.ExpectQuery("FROM segments").
+				WithArgs("seg-1").
+				WillReturnRows(sqlmock.NewRows(segmentColumns).
+					AddRow("seg-1", "owner-1", "Park Loop", nil, 1000.0, nil, true, "run", "public", 3, 3, time.Now(), "", 0))
+			mock.ExpectQuery(regexp.QuoteMeta("ORDER BY se.elapsed_seconds ASC, se.recorded_at ASC\n\t\tLIMIT 1")).
+				WithArgs("seg-1").
+				WillReturnRows(tt.efforts)
+
+			router := gin.New()
+			segments.NewHandler(repo, nil, 20, zap.NewNop()).RegisterRoutes(router.Group("/segments"))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/segments/seg-1/kom", nil))
+			if w.Code != tt.expectCode {
+				t.Fatalf("expected %d, got %d: %s", tt.expectCode, w.Code, w.Body.String())
+			}
+			if tt.expectCode != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				KOM segments.SegmentEffort `json:"kom"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.KOM.ID != tt.expectID || resp.KOM.UserID != "fast-user" || resp.KOM.ElapsedSeconds != 240 {
+				t.Errorf("expected %s by fast-user in 240s, got %+v", tt.expectID, resp.KOM)
+			}
+			if resp.KOM.DisplayName == nil || *resp.KOM.DisplayName != "Speedy" {
+				t.Errorf("expected display name, got %v", resp.KOM.DisplayName)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func newTestRedis(t *testing.T) (*database.Redis, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rds, err := database.NewRedis(mr.Addr(), "", 0, 5, zap.NewNop())
+	if err != nil {
+		t.Fatalf("redis: %v", err)
+	}
+	t.Cleanup(func() { rds.Close() })
+	return rds, mr
+}
+
+func getLeaderboard(t *testing.T, h *segments.Handler, url string) []segments.SegmentEffort {
+	t.Helper()
+	router := gin.New()
+	h.RegisterRoutes(router.Group("/segments"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Leaderboard []segments.SegmentEffort `json:"leaderboard"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return resp.Leaderboard
+}
+
+func expectPublicSegment(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("FROM segments").
+		WithArgs("seg-1").
+		WillReturnRows(sqlmock.NewRows(segmentColumns).
+			AddRow("seg-1", "owner-1", "Park Loop", nil, 1000.0, nil, true, "run", "public", 3, 2, time.Now(), "", 0))
+}
+
+func TestLeaderboardHandler_Cache(t *testing.T) {
+	recorded := time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC)
+
+	get := func(t *testing.T, h *segments.Handler) []segments.SegmentEffort {
+		t.Helper()
+		return getLeaderboard(t, h, "/segments/seg-1/leaderboard")
+	}
+
+	t.Run("miss reads database and fills cache", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		rds, mr := newTestRedis(t)
+		expectPublicSegment(mock)
+		mock.ExpectQuery(regexp.QuoteMeta("FROM segment_efforts se")).
+			WithArgs("seg-1", "", 200, 0).
+			WillReturnRows(sqlmock.NewRows(leaderboardColumns).
+				AddRow("e1", "seg-1", "a1", "fast-user", 240, 4.0, nil, nil, recorded, "Speedy", 2).
+				AddRow("e2", "seg-1", "a2", "slow-user", 300, 5.0, nil, nil, recorded, "Steady", 2))
+
+		board := get(t, segments.NewHandler(repo, rds, 20, zap.NewNop()))
+		if len(board) != 2 || board[0].UserID != "fast-user" || board[1].UserID != "slow-user" {
+			t.Fatalf("unexpected board: %+v", board)
+		}
+		if board[1].Rank == nil || *board[1].Rank != 2 {
+			t.Errorf("expected rank 2, got %v", board[1].Rank)
+		}
+
+		members, err := mr.ZMembers(database.LeaderboardKey("seg-1"))
+		if err != nil || len(members) != 2 {
+			t.Errorf("expected cached leaderboard with 2 members, got %v (%v)", members, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("hit skips database", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		rds, _ := newTestRedis(t)
+		name := "Cached"
+		err := rds.ReplaceLeaderboard(context.Background(), "seg-1", []database.LeaderboardEntry{
+			{UserID: "slow-user", ElapsedSeconds: 300, Data: segments.SegmentEffort{ID: "e2", UserID: "slow-user", ElapsedSeconds: 300}},
+			{UserID: "fast-user", ElapsedSeconds: 240, Data: segments.SegmentEffort{ID: "e1", UserID: "fast-user", ElapsedSeconds: 240, DisplayName: &name}},
+		}, 2, time.Minute)
+		if err != nil {
+			t.Fatalf("seed cache: %v", err)
+		}
+		// Only the visibility lookup; no leaderboard query.
+		expectPublicSegment(mock)
+
+		board := get(t, segments.NewHandler(repo, rds, 20, zap.NewNop()))
+		if len(board) != 2 || board[0].ID != "e1" || board[1].ID != "e2" {
+			t.Fatalf("expected cached board fastest first, got %+v", board)
+		}
+		if board[0].DisplayName == nil || *board[0].DisplayName != "Cached" {
+			t.Errorf("expected cached display name, got %v", board[0].DisplayName)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("nil redis reads database", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		expectPublicSegment(mock)
+		mock.ExpectQuery(regexp.QuoteMeta("FROM segment_efforts se")).
+			WithArgs("seg-1", "", 200, 0).
+			WillReturnRows(sqlmock.NewRows(leaderboardColumns).
+				AddRow("e1", "seg-1", "a1", "fast-user", 240, 4.0, nil, nil, recorded, "Speedy", 1))
+
+		if board := get(t, segments.NewHandler(repo, nil, 20, zap.NewNop())); len(board) != 1 {
+			t.Fatalf("expected 1 entry, got %+v", board)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// sinceArg matches a leaderboard period bound, recording it for inspection.
+type sinceArg struct{ got *time.Time }
+
+func (a sinceArg) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	*a.got = t
+	return ok
+}
+
+func TestLeaderboardHandler_Period(t *testing.T) {
+	now := time.Now().UTC()
+	fresh := now.Add(-time.Minute)
+
+	t.Run("week excludes older efforts", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		expectPublicSegment(mock)
+		// Seeded: fast-user's 200s effort last year and 260s today; slow-user
+		// only has a 300s effort today. The database applies the bound, so
+		// only this week's rows come back.
+		var since time.Time
+		mock.ExpectQuery(regexp.QuoteMeta("AND se.recorded_at >= $3")).
+			WithArgs("seg-1", "", sinceArg{&since}, 50, 0).
+			WillReturnRows(sqlmock.NewRows(leaderboardColumns).
+				AddRow("e2", "seg-1", "a2", "fast-user", 260, 4.3, nil, nil, fresh, "Speedy", 2).
+				AddRow("e3", "seg-1", "a3", "slow-user", 300, 5.0, nil, nil, fresh, "Steady", 2))
+
+		board := getLeaderboard(t, segments.NewHandler(repo, nil, 20, zap.NewNop()), "/segments/seg-1/leaderboard?period=week")
+		if len(board) != 2 || board[0].ElapsedSeconds != 260 {
+			t.Fatalf("expected this week's efforts only, got %+v", board)
+		}
+		if since.Weekday() != time.Monday || since.After(now) || now.Sub(since) > 7*24*time.Hour {
+			t.Errorf("expected bound at start of this week, got %v", since)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("all time has no bound", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		expectPublicSegment(mock)
+		mock.ExpectQuery(regexp.QuoteMeta("DISTINCT ON (se.user_id)")).
+			WithArgs("seg-1", "", 200, 0).
+			WillReturnRows(sqlmock.NewRows(leaderboardColumns).
+				AddRow("e1", "seg-1", "a1", "fast-user", 200, 3.3, nil, nil, now.AddDate(-1, 0, 0), "Speedy", 1))
+
+		board := getLeaderboard(t, segments.NewHandler(repo, nil, 20, zap.NewNop()), "/segments/seg-1/leaderboard?period=all")
+		if len(board) != 1 || board[0].ElapsedSeconds != 200 {
+			t.Fatalf("expected all-time best, got %+v", board)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("invalid period", func(t *testing.T) {
+		repo, _ := newMockRepo(t)
+		router := gin.New()
+		segments.NewHandler(repo, nil, 20, zap.NewNop()).RegisterRoutes(router.Group("/segments"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/segments/seg-1/leaderboard?period=decade", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestLeaderboardHandler_Pagination(t *testing.T) {
+	decode := func(t *testing.T, h *segments.Handler, url string) (board []segments.SegmentEffort, total int) {
+		t.Helper()
+		router := gin.New()
+		h.RegisterRoutes(router.Group("/segments"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Leaderboard []segments.SegmentEffort `json:"leaderboard"`
+			Total       int                      `json:"total"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Leaderboard, resp.Total
+	}
+
+	t.Run("cached second page", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		rds, _ := newTestRedis(t)
+		var entries []database.LeaderboardEntry
+		for i := 1; i <= 5; i++ {
+			id := fmt.Sprintf("user-%d", i)
+			entries = append(entries, database.LeaderboardEntry{
+				UserID: id, ElapsedSeconds: float64(200 + i*10),
+				Data: segments.SegmentEffort{ID: fmt.Sprintf("e%d", i), UserID: id, ElapsedSeconds: 200 + i*10},
+			})
+		}
+		if err := rds.ReplaceLeaderboard(context.Background(), "seg-1", entries, 5, time.Minute); err != nil {
+			t.Fatalf("seed cache: %v", err)
+		}
+		expectPublicSegment(mock)
+
+		board, total := decode(t, segments.NewHandler(repo, rds, 20, zap.NewNop()), "/segments/seg-1/leaderboard?limit=2&offset=2")
+		if total != 5 {
+			t.Errorf("expected total 5, got %d", total)
+		}
+		if len(board) != 2 || board[0].ID != "e3" || *board[0].Rank != 3 || *board[1].Rank != 4 {
+			t.Fatalf("expected e3/e4 ranked 3 and 4, got %+v", board)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("page beyond the cached top reads database", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		expectPublicSegment(mock)
+		mock.ExpectQuery(regexp.QuoteMeta("LIMIT $3 OFFSET $4")).
+			WithArgs("seg-1", "", 50, 200).
+			WillReturnRows(sqlmock.NewRows(leaderboardColumns).
+				AddRow("e201", "seg-1", "a201", "user-201", 900, 9.0, nil, nil, time.Now(), nil, 201))
+
+		board, total := decode(t, segments.NewHandler(repo, nil, 20, zap.NewNop()), "/segments/seg-1/leaderboard?offset=200")
+		if total != 201 || len(board) != 1 || *board[0].Rank != 201 {
+			t.Fatalf("expected rank 201 of 201, got total %d, %+v", total, board)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestLeaderboardHandler_AgeGraded(t *testing.T) {
+	recorded := time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC)
+	// On the 1km Park Loop: a 25-year-old man is fastest on raw time, but a
+	// 60-year-old woman's 230s grades to 184s. anon has no profile.
+	expectBoard := func(mock sqlmock.Sqlmock) {
+		expectPublicSegment(mock)
+		mock.ExpectQuery(regexp.QuoteMeta("FROM segment_efforts se")).
+			WithArgs("seg-1", "", 200, 0).
+			WillReturnRows(sqlmock.NewRows(leaderboardColumns).
+				AddRow("e1", "seg-1", "a1", "young", 200, 3.3, 178, nil, recorded, "Young", 3).
+				AddRow("e2", "seg-1", "a2", "anon", 210, 3.5, nil, nil, recorded, nil, 3).
+				AddRow("e3", "seg-1", "a3", "veteran", 230, 3.8, 165, nil, recorded, "Veteran", 3))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, age, gender FROM user_profiles WHERE id = ANY($1)")).
+			WithArgs([]string{"young", "anon", "veteran"}).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "age", "gender"}).
+				AddRow("young", 25, "male").
+				AddRow("veteran", 60, "female"))
+	}
+	ids := func(board []segments.SegmentEffort) string {
+		var out []string
+		for _, e := range board {
+			out = append(out, fmt.Sprintf("%s#%d", e.UserID, *e.Rank))
+		}
+		return strings.Join(out, " ")
+	}
+
+	t.Run("graded columns keep raw order", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		expectBoard(mock)
+
+		board := getLeaderboard(t, segments.NewHandler(repo, nil, 20, zap.NewNop()), "/segments/seg-1/leaderboard?age_graded=true")
+		if got := ids(board); got != "young#1 anon#2 veteran#3" {
+			t.Fatalf("expected raw order, got %s", got)
+		}
+		if board[0].AgeGradedSeconds == nil || *board[0].AgeGradedSeconds != 200 {
+			t.Errorf("expected open-class time ungraded, got %v", board[0].AgeGradedSeconds)
+		}
+		if board[1].AgeGradedSeconds != nil || board[1].AgeGradePct != nil {
+			t.Errorf("expected no grade without a profile, got %+v", board[1])
+		}
+		if g := board[2].AgeGradedSeconds; g == nil || *g < 183.9 || *g > 184.1 {
+			t.Errorf("expected veteran graded to 184s, got %v", g)
+		}
+		if p := board[2].AgeGradePct; p == nil || *p <= *board[0].AgeGradePct {
+			t.Errorf("expected veteran's grade above young's, got %v vs %v", p, board[0].AgeGradePct)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("sort by graded time", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		expectBoard(mock)
+
+		board := getLeaderboard(t, segments.NewHandler(repo, nil, 20, zap.NewNop()), "/segments/seg-1/leaderboard?sort=age_graded")
+		if got := ids(board); got != "veteran#1 young#2 anon#3" {
+			t.Fatalf("expected graded order with ungraded last, got %s", got)
+		}
+	})
+
+	t.Run("graded sort pages after re-ranking", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		expectBoard(mock)
+
+		board := getLeaderboard(t, segments.NewHandler(repo, nil, 20, zap.NewNop()), "/segments/seg-1/leaderboard?sort=age_graded&limit=1&offset=1")
+		if got := ids(board); got != "young#2" {
+			t.Fatalf("expected second graded athlete, got %s", got)
+		}
+	})
+
+	t.Run("elapsed sort serves plain board", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		expectPublicSegment(mock)
+		mock.ExpectQuery(regexp.QuoteMeta("FROM segment_efforts se")).
+			WithArgs("seg-1", "", 200, 0).
+			WillReturnRows(sqlmock.NewRows(leaderboardColumns).
+				AddRow("e1", "seg-1", "a1", "young", 200, 3.3, nil, nil, recorded, "Young", 1))
+
+		board := getLeaderboard(t, segments.NewHandler(repo, nil, 20, zap.NewNop()), "/segments/seg-1/leaderboard?sort=elapsed")
+		if len(board) != 1 || board[0].AgeGradedSeconds != nil {
+			t.Fatalf("expected ungraded board, got %+v", board)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("invalid sort", func(t *testing.T) {
+		repo, _ := newMockRepo(t)
+		router := gin.New()
+		segments.NewHandler(repo, nil, 20, zap.NewNop()).RegisterRoutes(router.Group("/segments"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/segments/seg-1/leaderboard?sort=heart_rate", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestLeaderboardHandler_Category(t *testing.T) {
+	recorded := time.Now().UTC().Add(-time.Minute)
+	// Seeded athletes: the database applies the category, so each case
+	// returns the rows its WHERE clause matches.
+	athletes := []struct {
+		id     string
+		gender string
+		age    int
+		secs   int
+	}{
+		{"m-25", "male", 25, 200},
+		{"f-42", "female", 42, 220},
+		{"m-45", "male", 45, 230},
+		{"f-38", "female", 38, 240},
+		{"f-51", "female", 51, 250},
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		wantSQL  string
+		wantArgs []driver.Value
+		match    func(gender string, age int) bool
+		wantIDs  string
+		wantEcho string
+	}{
+		{
+			name:     "women 40-49",
+			query:    "?sex=F&age_min=40&age_max=49",
+			wantSQL:  "AND up.gender = $3\n\t\t\t  AND up.age >= $4\n\t\t\t  AND up.age <= $5",
+			wantArgs: []driver.Value{"seg-1", "", "female", 40, 49, 50, 0},
+			match:    func(g string, a int) bool { return g == "female" && a >= 40 && a <= 49 },
+			wantIDs:  "f-42",
+			wantEcho: `{"sex":"F","age_min":40,"age_max":49}`,
+		},
+		{
+			name:     "men of any age",
+			query:    "?sex=M",
+			wantSQL:  "AND up.gender = $3",
+			wantArgs: []driver.Value{"seg-1", "", "male", 50, 0},
+			match:    func(g string, _ int) bool { return g == "male" },
+			wantIDs:  "m-25 m-45",
+			wantEcho: `{"sex":"M"}`,
+		},
+		{
+			name:     "composes with period",
+			query:    "?period=week&age_min=40",
+			wantSQL:  "AND se.recorded_at >= $3\n\t\t\t  AND up.age >= $4",
+			wantArgs: []driver.Value{"seg-1", "", sqlmock.AnyArg(), 40, 50, 0},
+			match:    func(_ string, a int) bool { return a >= 40 },
+			wantIDs:  "f-42 m-45 f-51",
+			wantEcho: `{"age_min":40}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			// A cached all-time board must not answer a category query.
+			rds, _ := newTestRedis(t)
+			if err := rds.ReplaceLeaderboard(context.Background(), "seg-1", []database.LeaderboardEntry{
+				{UserID: "cached", ElapsedSeconds: 100, Data: segments.SegmentEffort{ID: "e0", UserID: "cached", ElapsedSeconds: 100}},
+			}, 1, time.Minute); err != nil {
+				t.Fatalf("seed cache: %v", err)
+			}
+			expectPublicSegment(mock)
+
+			rows := sqlmock.NewRows(leaderboardColumns)
+			n := 0
+			for _, a := range athletes {
+				if tt.match(a.gender, a.age) {
+					n++
+				}
+			}
+			for _, a := range athletes {
+				if tt.match(a.gender, a.age) {
+					rows.AddRow("e-"+a.id, "seg-1", "act-"+a.id, a.id, a.secs, 4.0, nil, nil, recorded, nil, n)
+				}
+			}
+			mock.ExpectQuery(regexp.QuoteMeta(tt.wantSQL)).
+				WithArgs(tt.wantArgs...).
+				WillReturnRows(rows)
+
+			router := gin.New()
+			segments.NewHandler(repo, rds, 20, zap.NewNop()).RegisterRoutes(router.Group("/segments"))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/segments/seg-1/leaderboard"+tt.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var resp struct {
+				Filters     json.RawMessage          `json:"filters"`
+				Leaderboard []segments.SegmentEffort `json:"leaderboard"`
+				Total       int                      `json:"total"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			var got []string
+			for _, e := range resp.Leaderboard {
+				got = append(got, e.UserID)
+			}
+			if strings.Join(got, " ") != tt.wantIDs || resp.Total != len(got) {
+				t.Errorf("expected %s, got %v (total %d)", tt.wantIDs, got, resp.Total)
+			}
+			if string(resp.Filters) != tt.wantEcho {
+				t.Errorf("filters = %s, want %s", resp.Filters, tt.wantEcho)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	for _, q := range []string{"?sex=X", "?age_min=abc", "?age_max=0", "?age_min=50&age_max=40"} {
+		t.Run("invalid "+q, func(t *testing.T) {
+			repo, _ := newMockRepo(t)
+			router := gin.New()
+			segments.NewHandler(repo, nil, 20, zap.NewNop()).RegisterRoutes(router.Group("/segments"))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/segments/seg-1/leaderboard"+q, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestSegmentUpdateDelete_Ownership(t *testing.T) {
+	segmentRow := func() *sqlmock.Rows {
+		return sqlmock.NewRows(segmentColumns).
+			AddRow("seg-1", "owner-1", "Park Loop", nil, 1000.0, nil, true, "run", "public", 3, 2, time.Now(), "", 0)
+	}
+	serve := func(h *segments.Handler, userID, method, body string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set(auth.ContextKeyUserID, userID)
+			c.Next()
+		})
+		h.RegisterRoutes(router.Group("/segments"))
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/segments/seg-1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("creator updates", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("FROM segments").WithArgs("seg-1").WillReturnRows(segmentRow())
+		mock.ExpectQuery(regexp.QuoteMeta("UPDATE segments SET name = $1, updated_at = NOW()")).
+			WithArgs("Park Loop Fixed", "seg-1", "owner-1").
+			WillReturnRows(sqlmock.NewRows(segmentColumns).
+				AddRow("seg-1", "owner-1", "Park Loop Fixed", nil, 1000.0, nil, true, "run", "public", 3, 2, time.Now(), "", 0))
+
+		w := serve(segments.NewHandler(repo, nil, 20, zap.NewNop()), "owner-1", "PUT", `{"name":"Park Loop Fixed"}`)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Park Loop Fixed") {
+			t.Fatalf("expected updated segment, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("non-creator cannot update", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("FROM segments").WithArgs("seg-1").WillReturnRows(segmentRow())
+
+		w := serve(segments.NewHandler(repo, nil, 20, zap.NewNop()), "user-2", "PUT", `{"name":"Hijacked"}`)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("non-creator cannot delete", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery("FROM segments").WithArgs("seg-1").WillReturnRows(segmentRow())
+
+		w := serve(segments.NewHandler(repo, nil, 20, zap.NewNop()), "user-2", "DELETE", "")
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("creator deletes with efforts and cache", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		rds, mr := newTestRedis(t)
+		mr.Set(database.LeaderboardTotalKey("seg-1"), "1")
+		mr.ZAdd(database.LeaderboardKey("seg-1"), 240, "fast-user")
+
+		mock.ExpectQuery("FROM segments").WithArgs("seg-1").WillReturnRows(segmentRow())
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM segment_efforts")).
+			WithArgs("seg-1", "owner-1").
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM segments WHERE id = $1 AND creator_id = $2")).
+			WithArgs("seg-1", "owner-1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		w := serve(segments.NewHandler(repo, rds, 20, zap.NewNop()), "owner-1", "DELETE", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if mr.Exists(database.LeaderboardKey("seg-1")) || mr.Exists(database.LeaderboardTotalKey("seg-1")) {
+			t.Error("expected cached leaderboard to be invalidated")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestCreateFromActivity(t *testing.T) {
+	// Five points ~111m apart heading north.
+	route := make([]utils.GPSPoint, 5)
+	for i := range route {
+		route[i] = utils.GPSPoint{Lat: float64(i) * 0.001, Lng: 0, Elevation: float64(i * 2)}
+	}
+	raw, _ := json.Marshal(route)
+
+	tests := []struct {
+		name       string
+		body       string
+		owner      string
+		expectCode int
+	}{
+		{"valid slice", `{"activity_id":"act-1","name":"North Climb","start_index":1,"end_index":4}`, "user-1", http.StatusCreated},
+		{"end past route", `{"activity_id":"act-1","name":"North Climb","start_index":1,"end_index":6}`, "user-1", http.StatusBadRequest},
+		{"negative start", `{"activity_id":"act-1","name":"North Climb","start_index":-1,"end_index":3}`, "user-1", http.StatusBadRequest},
+		{"single point", `{"activity_id":"act-1","name":"North Climb","start_index":2,"end_index":3}`, "user-1", http.StatusBadRequest},
+		{"reversed range", `{"activity_id":"act-1","name":"North Climb","start_index":3,"end_index":1}`, "user-1", http.StatusBadRequest},
+		{"someone else's activity", `{"activity_id":"act-1","name":"North Climb","start_index":1,"end_index":4}`, "user-2", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, activity_type, raw_gps_points, route_path::text")).
+				WithArgs("act-1").
+				WillReturnRows(sqlmock.NewRows(trackColumns).
+					AddRow(tt.owner, "bike", raw, nil))
+			if tt.expectCode == http.StatusCreated {
+				// Points 1..3: two ~111m legs, 4m of climb, typed like the activity.
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO segments")).
+					WithArgs("user-1", "North Climb", nil, sqlmock.AnyArg(), 4.0,
+						"SRID=4326;LINESTRING(0.000000 0.001000, 0.000000 0.002000, 0.000000 0.003000)",
+						"public", "bike", "", []float64{2, 4, 6}).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "activity_type", "created_at"}).AddRow("seg-9", "bike", time.Now()))
+			}
+
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set(auth.ContextKeyUserID, "user-1")
+				c.Next()
+			})
+			segments.NewHandler(repo, nil, 20, zap.NewNop()).RegisterRoutes(router.Group("/segments"))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/segments/from-activity", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			if w.Code != tt.expectCode {
+				t.Fatalf("expected %d, got %d: %s", tt.expectCode, w.Code, w.Body.String())
+			}
+			if tt.expectCode == http.StatusCreated {
+				var seg segments.Segment
+				if err := json.Unmarshal(w.Body.Bytes(), &seg); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if seg.DistanceMeters < 220 || seg.DistanceMeters > 225 {
+					t.Errorf("expected ~222m, got %v", seg.DistanceMeters)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestMatchHandler_Ownership(t *testing.T) {
+	tests := []struct {
+		name       string
+		owner      string // empty when the activity doesn't exist
+		expectCode int
+	}{
+		{"own activity", "user-1", http.StatusOK},
+		{"someone else's activity", "user-2", http.StatusNotFound},
+		{"missing activity", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			track := mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, activity_type, raw_gps_points, route_path::text")).
+				WithArgs("act-1")
+			if tt.owner == "" {
+				track.WillReturnRows(sqlmock.NewRows(trackColumns))
+			} else {
+				track.WillReturnRows(sqlmock.NewRows(trackColumns).AddRow(tt.owner, "run", nil, nil))
+			}
+			if tt.expectCode == http.StatusOK {
+				mock.ExpectQuery("ST_Buffer").
+					WithArgs("act-1", 20, false).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("seg-private"))
+			}
+
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set(auth.ContextKeyUserID, "user-1")
+				c.Next()
+			})
+			segments.NewHandler(repo, nil, 20, zap.NewNop()).RegisterRoutes(router.Group("/segments"))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/segments/match", strings.NewReader(`{"activity_id":"act-1"}`))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			if w.Code != tt.expectCode {
+				t.Fatalf("expected %d, got %d: %s", tt.expectCode, w.Code, w.Body.String())
+			}
+			if tt.expectCode != http.StatusOK && strings.Contains(w.Body.String(), "seg-private") {
+				t.Errorf("segment ids leaked: %s", w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestMyEfforts(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	day := func(d int) time.Time { return time.Date(2024, 6, d, 7, 0, 0, 0, time.UTC) }
+
+	expectPublicSegment(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY se.recorded_at DESC")).
+		WithArgs("seg-1", "user-1").
+		WillReturnRows(sqlmock.NewRows(append(append([]string{}, effortColumns...), "rank")).
+			AddRow("e3", "seg-1", "a3", "user-1", 250, 4.2, nil, nil, day(20), "Me", 3).
+			AddRow("e2", "seg-1", "a2", "user-1", 230, 3.8, nil, nil, day(10), "Me", 2).
+			AddRow("e1", "seg-1", "a1", "user-1", 270, 4.5, nil, nil, day(1), "Me", 4))
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(auth.ContextKeyUserID, "user-1")
+		c.Next()
+	})
+	segments.NewHandler(repo, nil, 20, zap.NewNop()).RegisterRoutes(router.Group("/segments"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/segments/seg-1/my-efforts", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Efforts []segments.UserEffort `json:"efforts"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Efforts) != 3 {
+		t.Fatalf("expected 3 efforts, got %d", len(resp.Efforts))
+	}
+	for i := 1; i < len(resp.Efforts); i++ {
+		if resp.Efforts[i].RecordedAt.After(resp.Efforts[i-1].RecordedAt) {
+			t.Errorf("efforts not newest first at index %d", i)
+		}
+	}
+	for _, e := range resp.Efforts {
+		if wantPR := e.ElapsedSeconds == 230; e.IsPR != wantPR {
+			t.Errorf("effort %s (%ds): is_pr = %v, want %v", e.ID, e.ElapsedSeconds, e.IsPR, wantPR)
+		}
+	}
+	if r := resp.Efforts[1].Rank; r == nil || *r != 2 {
+		t.Errorf("expected rank-at-the-time 2, got %v", r)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProfileHandler(t *testing.T) {
+	path := hexEWKB([]utils.GPSPoint{{Lat: 0}, {Lat: 0.001}, {Lat: 0.002}, {Lat: 0.003}})
+	tests := []struct {
+		name          string
+		elevations    interface{}
+		wantElevation bool
+	}{
+		{"path with elevation", "{100,110,120,130}", true},
+		{"path without elevation", nil, false},
+		{"elevations not matching the path", "{100,110}", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			expectPublicSegment(mock)
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT segment_path::text, path_elevations")).
+				WithArgs("seg-1").
+				WillReturnRows(sqlmock.NewRows([]string{"segment_path", "path_elevations"}).AddRow(path, tt.elevations))
+
+			router := gin.New()
+			segments.NewHandler(repo, nil, 20, zap.NewNop()).RegisterRoutes(router.Group("/segments"))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/segments/seg-1/profile", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var resp struct {
+				Profile []utils.ProfilePoint `json:"profile"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			// ~333m sampled every 50m, plus the end.
+			if len(resp.Profile) != 8 {
+				t.Fatalf("expected 8 samples, got %d", len(resp.Profile))
+			}
+			for i, p := range resp.Profile {
+				if i > 0 && p.DistanceMeters <= resp.Profile[i-1].DistanceMeters {
+					t.Errorf("distance not monotonic at %d", i)
+				}
+				if got := p.ElevationMeters != nil; got != tt.wantElevation {
+					t.Errorf("sample %d: elevation present = %v, want %v", i, got, tt.wantElevation)
+				}
+			}
+			if last := resp.Profile[len(resp.Profile)-1]; tt.wantElevation && *last.ElevationMeters != 130 {
+				t.Errorf("expected the profile to end at 130m, got %v", *last.ElevationMeters)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestFlagHandler(t *testing.T) {
+	flagSQL := regexp.QuoteMeta("ON CONFLICT (segment_id, user_id) DO NOTHING")
+	serve := func(h *segments.Handler, body string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set(auth.ContextKeyUserID, "user-2")
+			c.Next()
+		})
+		h.RegisterRoutes(router.Group("/segments"))
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/segments/seg-1/flag", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("first flag increments the count", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		expectPublicSegment(mock)
+		mock.ExpectQuery(flagSQL).
+			WithArgs("seg-1", "user-2", "Crosses a busy road").
+			WillReturnRows(sqlmock.NewRows([]string{"flag_count"}).AddRow(3))
+
+		w := serve(segments.NewHandler(repo, nil, 20, zap.NewNop()), `{"reason":"Crosses a busy road"}`)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			FlagCount int `json:"flag_count"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if resp.FlagCount != 3 {
+			t.Errorf("expected flag_count 3, got %d", resp.FlagCount)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("duplicate flag conflicts", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		expectPublicSegment(mock)
+		// ON CONFLICT DO NOTHING leaves nothing for the UPDATE to bump.
+		mock.ExpectQuery(flagSQL).
+			WithArgs("seg-1", "user-2", "Crosses a busy road").
+			WillReturnRows(sqlmock.NewRows([]string{"flag_count"}))
+
+		w := serve(segments.NewHandler(repo, nil, 20, zap.NewNop()), `{"reason":"Crosses a busy road"}`)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("reason is required", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+
+		w := serve(segments.NewHandler(repo, nil, 20, zap.NewNop()), `{"reason":""}`)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestFlaggedHandler(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE flag_count > 0")).
+		WithArgs(50).
+		WillReturnRows(sqlmock.NewRows(segmentColumns).
+			AddRow("seg-1", "owner-1", "Park Loop", nil, 1000.0, nil, true, "run", "public", 3, 2, time.Now(), "", 2))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM segment_flags")).
+		WithArgs([]string{"seg-1"}).
+		WillReturnRows(sqlmock.NewRows([]string{"segment_id", "user_id", "reason", "created_at"}).
+			AddRow("seg-1", "user-3", "Unlit at night", time.Now()).
+			AddRow("seg-1", "user-2", "Crosses a busy road", time.Now().Add(-time.Hour)))
+
+	router := gin.New()
+	segments.NewHandler(repo, nil, 20, zap.NewNop()).RegisterAdminRoutes(router.Group("/admin/segments"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/admin/segments/flagged", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Segments []segments.FlaggedSegment `json:"segments"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Segments) != 1 || resp.Segments[0].FlagCount != 2 || len(resp.Segments[0].Flags) != 2 {
+		t.Fatalf("expected one segment with 2 flags, got %+v", resp.Segments)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerifyHandler(t *testing.T) {
+	serve := func(h *segments.Handler, role, action string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set(auth.ContextKeyUserID, "admin-1")
+			c.Set(auth.ContextKeyRole, role)
+			c.Next()
+		})
+		h.RegisterAdminRoutes(router.Group("/admin/segments", auth.RequireRole("admin")))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/segments/seg-1/"+action, nil))
+		return w
+	}
+
+	t.Run("non-admin is forbidden", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+
+		w := serve(segments.NewHandler(repo, nil, 20, zap.NewNop()), "authenticated", "verify")
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	tests := []struct {
+		action   string
+		sql      string
+		args     []driver.Value
+		verified bool
+	}{
+		{"verify", "SET is_verified = TRUE, verified_by = $2, verified_at = NOW()", []driver.Value{"seg-1", "admin-1"}, true},
+		{"unverify", "SET is_verified = FALSE, verified_by = NULL, verified_at = NULL", []driver.Value{"seg-1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run("admin can "+tt.action, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			mock.ExpectQuery(regexp.QuoteMeta(tt.sql)).
+				WithArgs(tt.args...).
+				WillReturnRows(sqlmock.NewRows(segmentColumns).
+					AddRow("seg-1", "owner-1", "Park Loop", nil, 1000.0, nil, tt.verified, "run", "public", 3, 2, time.Now(), "", 0))
+
+			w := serve(segments.NewHandler(repo, nil, 20, zap.NewNop()), "admin", tt.action)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+			var seg segments.Segment
+			if err := json.Unmarshal(w.Body.Bytes(), &seg); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if seg.IsVerified != tt.verified {
+				t.Errorf("is_verified = %v, want %v", seg.IsVerified, tt.verified)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	t.Run("unknown segment", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery(regexp.QuoteMeta("SET is_verified = TRUE")).
+			WithArgs("seg-1", "admin-1").
+			WillReturnRows(sqlmock.NewRows(segmentColumns))
+
+		w := serve(segments.NewHandler(repo, nil, 20, zap.NewNop()), "admin", "verify")
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestListHandler_Pagination(t *testing.T) {
+	listSQL := `ORDER BY total_attempts DESC, id\s+LIMIT \$2 OFFSET \$3`
+	row := func(rows *sqlmock.Rows, id string, total int) *sqlmock.Rows {
+		return rows.AddRow(id, "other", "Loop "+id, nil, 3000.0, nil, true, "run", "public", 5, 2, time.Now(), "", 0, total)
+	}
+	get := func(t *testing.T, h *segments.Handler, url string) *httptest.ResponseRecorder {
+		t.Helper()
+		router := gin.New()
+		h.RegisterRoutes(router.Group("/segments"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+	type envelope struct {
+		Data       []segments.Segment `json:"data"`
+		Pagination utils.Pagination   `json:"pagination"`
+	}
+
+	t.Run("middle page has more", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		rows := sqlmock.NewRows(segmentListColumns)
+		row(rows, "s3", 5)
+		row(rows, "s4", 5)
+		mock.ExpectQuery(listSQL).WithArgs("", 2, 2).WillReturnRows(rows)
+
+		w := get(t, segments.NewHandler(repo, nil, 20, zap.NewNop()), "/segments?limit=2&offset=2")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp envelope
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		want := utils.Pagination{Limit: 2, Offset: 2, Total: 5, HasMore: true}
+		if len(resp.Data) != 2 || resp.Pagination != want {
+			t.Errorf("got %d segments, pagination %+v; want 2, %+v", len(resp.Data), resp.Pagination, want)
+		}
+	})
+
+	t.Run("last page has no more", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery(listSQL).WithArgs("", 2, 4).
+			WillReturnRows(row(sqlmock.NewRows(segmentListColumns), "s5", 5))
+
+		w := get(t, segments.NewHandler(repo, nil, 20, zap.NewNop()), "/segments?limit=2&offset=4")
+		var resp envelope
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(resp.Data) != 1 || resp.Pagination.HasMore || resp.Pagination.Total != 5 {
+			t.Errorf("unexpected page: %+v", resp)
+		}
+	})
+
+	t.Run("envelope=false keeps the legacy shape", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery(listSQL).WithArgs("", 100, 0).
+			WillReturnRows(row(sqlmock.NewRows(segmentListColumns), "s1", 1))
+
+		w := get(t, segments.NewHandler(repo, nil, 20, zap.NewNop()), "/segments?envelope=false")
+		var resp struct {
+			Segments []segments.Segment `json:"segments"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(resp.Segments) != 1 || resp.Segments[0].ID != "s1" {
+			t.Errorf("unexpected segments: %s", w.Body.String())
+		}
+	})
+
+	t.Run("invalid envelope", func(t *testing.T) {
+		repo, _ := newMockRepo(t)
+		w := get(t, segments.NewHandler(repo, nil, 20, zap.NewNop()), "/segments?envelope=maybe")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("malformed limit", func(t *testing.T) {
+		repo, _ := newMockRepo(t)
+		w := get(t, segments.NewHandler(repo, nil, 20, zap.NewNop()), "/segments?limit=ten")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("out of range limit uses the default", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery(listSQL).WithArgs("", 100, 0).
+			WillReturnRows(row(sqlmock.NewRows(segmentListColumns), "s1", 1))
+
+		w := get(t, segments.NewHandler(repo, nil, 20, zap.NewNop()), "/segments?limit=500")
+		if w.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
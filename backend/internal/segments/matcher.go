@@ -0,0 +1,259 @@
+package segments
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/database"
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+// Matcher matches a newly created activity against segments and records an
+// effort for each one it traverses.
+type Matcher struct {
+	repo         *Repository
+	redis        *database.Redis // nil skips leaderboard cache updates
+	bufferMeters int
+	postgis      func() bool // nil assumes PostGIS
+	logger       *zap.Logger
+}
+
+// NewMatcher creates a Matcher using the given spatial match buffer. redis
+// may be nil.
+func NewMatcher(repo *Repository, redis *database.Redis, bufferMeters int, logger *zap.Logger) *Matcher {
+	return &Matcher{repo: repo, redis: redis, bufferMeters: bufferMeters, logger: logger}
+}
+
+// SetPostGISCheck makes the matcher consult available before each match and
+// fall back to MatchRouteToSegment in Go while it reports false.
+func (m *Matcher) SetPostGISCheck(available func() bool) {
+	m.postgis = available
+}
+
+// MatchActivity finds segments traversed by the activity and creates a
+// SegmentEffort for each, timed by interpolating the GPS timestamps at the
+// segment's entry and exit fractions along the route. Segments traversed
+// against their direction, or that can't be timed (no timestamps), are
+// skipped, as is any effort that fails to record.
+func (m *Matcher) MatchActivity(ctx context.Context, activityID string) error {
+	efforts, err := m.recordEfforts(ctx, m.repo, activityID)
+	m.cacheEfforts(ctx, efforts)
+	return err
+}
+
+// MatchActivityTx is MatchActivity run inside tx, so the efforts commit or
+// roll back together with the caller's other writes. Leaderboard cache
+// updates are deferred to the returned func, which the caller runs once tx
+// has committed.
+func (m *Matcher) MatchActivityTx(ctx context.Context, tx *sql.Tx, activityID string) (func(context.Context), error) {
+	efforts, err := m.recordEfforts(ctx, m.repo.WithTx(tx), activityID)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) { m.cacheEfforts(ctx, efforts) }, nil
+}
+
+// timedMatch is a segment traversal with its entry and exit times (unix ms).
+type timedMatch struct {
+	segmentID      string
+	distanceMeters float64
+	entryMs        float64
+	exitMs         float64
+}
+
+// recordEfforts does the matching for MatchActivity against repo. It returns
+// the efforts created before any error.
+func (m *Matcher) recordEfforts(ctx context.Context, repo *Repository, activityID string) ([]*SegmentEffort, error) {
+	var (
+		track   *ActivityTrack
+		matches []timedMatch
+		err     error
+	)
+	if m.postgis == nil || m.postgis() {
+		track, matches, err = m.spatialMatches(ctx, repo, activityID)
+	} else {
+		track, matches, err = m.inProcessMatches(ctx, repo, activityID)
+	}
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+
+	var created []*SegmentEffort
+	for _, match := range matches {
+		elapsed := (match.exitMs - match.entryMs) / 1000
+		if elapsed < 1 {
+			// Would round to 0s, which segment_efforts rejects.
+			m.logger.Debug("segment traversal too short to time, skipping",
+				zap.String("segment_id", match.segmentID), zap.String("activity_id", activityID))
+			continue
+		}
+		effort := &SegmentEffort{
+			SegmentID:       match.segmentID,
+			ActivityID:      activityID,
+			UserID:          track.UserID,
+			ElapsedSeconds:  int(math.Round(elapsed)),
+			AvgPaceMinPerKm: utils.PaceMinPerKmFloat(match.distanceMeters, elapsed),
+			RecordedAt:      time.UnixMilli(int64(match.entryMs)).UTC(),
+		}
+		if _, err := repo.CreateEffort(ctx, effort); err != nil {
+			if ctx.Err() != nil {
+				return created, fmt.Errorf("record effort on %s: %w", match.segmentID, err)
+			}
+			// One bad effort shouldn't cost the activity its other efforts;
+			// CreateEffort has already undone its own writes.
+			m.logger.Warn("record segment effort failed, skipping",
+				zap.String("segment_id", match.segmentID),
+				zap.String("activity_id", activityID), zap.Error(err))
+			continue
+		}
+		created = append(created, effort)
+	}
+
+	m.logger.Info("segment efforts recorded",
+		zap.String("activity_id", activityID),
+		zap.Int("matched", len(matches)),
+		zap.Int("created", len(created)),
+	)
+	return created, nil
+}
+
+// spatialMatches matches with PostGIS (Repository.MatchWithTiming) and times
+// each traversal from its route fractions.
+func (m *Matcher) spatialMatches(ctx context.Context, repo *Repository, activityID string) (*ActivityTrack, []timedMatch, error) {
+	matches, err := repo.MatchWithTiming(ctx, activityID, m.bufferMeters)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(matches) == 0 {
+		return nil, nil, nil
+	}
+
+	track, err := repo.GetActivityTrack(ctx, activityID)
+	if err != nil || track == nil {
+		return nil, nil, err
+	}
+
+	var timed []timedMatch
+	for _, match := range matches {
+		if match.ExitFraction <= match.EntryFraction {
+			m.logger.Debug("segment traversed in reverse, skipping",
+				zap.String("segment_id", match.SegmentID), zap.String("activity_id", activityID))
+			continue
+		}
+		// The SQL fractions are along route_path, which privacy shrouding may
+		// have trimmed, so the endpoints are located again on the timed track.
+		entryMs, ok1 := timestampAtFraction(track.Points, locateOnRoute(track.Points, match.Start))
+		exitMs, ok2 := timestampAtFraction(track.Points, locateOnRoute(track.Points, match.End))
+		if !ok1 || !ok2 || exitMs <= entryMs {
+			m.logger.Debug("segment matched but could not be timed",
+				zap.String("segment_id", match.SegmentID), zap.String("activity_id", activityID))
+			continue
+		}
+		timed = append(timed, timedMatch{match.SegmentID, match.DistanceMeters, entryMs, exitMs})
+	}
+	return track, timed, nil
+}
+
+// inProcessMatches matches with MatchRouteToSegment against every candidate
+// segment, timing each traversal from the entry and exit points.
+func (m *Matcher) inProcessMatches(ctx context.Context, repo *Repository, activityID string) (*ActivityTrack, []timedMatch, error) {
+	track, err := repo.GetActivityTrack(ctx, activityID)
+	if err != nil || track == nil || len(track.Points) < 2 {
+		return nil, nil, err
+	}
+	routes, err := repo.SegmentRoutes(ctx, track.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var timed []timedMatch
+	for _, route := range routes {
+		ok, entry, exit := MatchRouteToSegment(track.Points, route.Points, float64(m.bufferMeters))
+		if !ok {
+			continue
+		}
+		entryMs, exitMs := float64(track.Points[entry].Timestamp), float64(track.Points[exit].Timestamp)
+		if entryMs == 0 || exitMs <= entryMs {
+			m.logger.Debug("segment matched but could not be timed",
+				zap.String("segment_id", route.SegmentID), zap.String("activity_id", activityID))
+			continue
+		}
+		timed = append(timed, timedMatch{route.SegmentID, route.DistanceMeters, entryMs, exitMs})
+	}
+	return track, timed, nil
+}
+
+// cacheEfforts pushes new efforts into their segments' cached leaderboards.
+func (m *Matcher) cacheEfforts(ctx context.Context, efforts []*SegmentEffort) {
+	if m.redis == nil {
+		return
+	}
+	for _, effort := range efforts {
+		entry := database.LeaderboardEntry{UserID: effort.UserID, ElapsedSeconds: float64(effort.ElapsedSeconds), Data: effort}
+		if err := m.redis.SetLeaderboardEntry(ctx, effort.SegmentID, entry); err != nil {
+			m.logger.Debug("leaderboard cache update failed", zap.Error(err))
+		}
+	}
+}
+
+// locateOnRoute returns the fraction (0-1) of route's planar length at the
+// point closest to p, measured like ST_LineLocatePoint so it can be passed to
+// timestampAtFraction.
+func locateOnRoute(route []utils.GPSPoint, p utils.GPSPoint) float64 {
+	total, along := 0.0, 0.0
+	best := math.Inf(1)
+	for i := 1; i < len(route); i++ {
+		a, b := route[i-1], route[i]
+		dx, dy := b.Lng-a.Lng, b.Lat-a.Lat
+		l := math.Hypot(dx, dy)
+		t := 0.0
+		if l > 0 {
+			t = math.Max(0, math.Min(1, ((p.Lng-a.Lng)*dx+(p.Lat-a.Lat)*dy)/(l*l)))
+		}
+		if d := math.Hypot(a.Lng+dx*t-p.Lng, a.Lat+dy*t-p.Lat); d < best {
+			best, along = d, total+t*l
+		}
+		total += l
+	}
+	if total == 0 {
+		return 0
+	}
+	return along / total
+}
+
+// timestampAtFraction interpolates the unix-ms timestamp at fraction f of the
+// route's length. Length is measured in planar lat/lng degrees to match
+// ST_LineLocatePoint on a 4326 geometry. ok is false when the route has no
+// timestamps.
+func timestampAtFraction(route []utils.GPSPoint, f float64) (float64, bool) {
+	if len(route) < 2 || route[0].Timestamp == 0 {
+		return 0, false
+	}
+	seg := make([]float64, len(route)-1)
+	total := 0.0
+	for i := 1; i < len(route); i++ {
+		seg[i-1] = math.Hypot(route[i].Lat-route[i-1].Lat, route[i].Lng-route[i-1].Lng)
+		total += seg[i-1]
+	}
+	if total == 0 {
+		return 0, false
+	}
+
+	target := math.Max(0, math.Min(1, f)) * total
+	for i, d := range seg {
+		if target <= d || i == len(seg)-1 {
+			t0, t1 := float64(route[i].Timestamp), float64(route[i+1].Timestamp)
+			if d == 0 {
+				return t0, true
+			}
+			return t0 + (t1-t0)*math.Min(1, target/d), true
+		}
+		target -= d
+	}
+	return 0, false
+}
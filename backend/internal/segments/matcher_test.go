@@ -0,0 +1,251 @@
+package segments_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/segments"
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+var matchColumns = []string{"id", "distance_meters", "entry_fraction", "exit_fraction", "segment_path"}
+
+// testSegmentPath runs north from a quarter to three quarters of testTrack.
+var testSegmentPath = []utils.GPSPoint{{Lat: 0.0025}, {Lat: 0.0075}}
+
+var trackColumns = []string{"user_id", "activity_type", "raw_gps_points", "route_path"}
+
+const trackStart = int64(1_700_000_000_000)
+
+func testTrack() []byte {
+	// 11 points ~111m apart heading north, 30s apart.
+	route := make([]utils.GPSPoint, 11)
+	for i := range route {
+		route[i] = utils.GPSPoint{Lat: float64(i) * 0.001, Lng: 0, Timestamp: trackStart + int64(i)*30_000}
+	}
+	raw, _ := json.Marshal(route)
+	return raw
+}
+
+func TestMatcher_MatchActivity_CreatesEffort(t *testing.T) {
+	repo, mock := newMockRepo(t)
+
+	// Segment enters a quarter of the way along (75s) and exits at three
+	// quarters (225s): 150s over 500m.
+	mock.ExpectQuery(regexp.QuoteMeta("ST_LineLocatePoint")).
+		WithArgs("act-1", 25).
+		WillReturnRows(sqlmock.NewRows(matchColumns).AddRow("seg-1", 500.0, 0.25, 0.75, hexEWKB(testSegmentPath)))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, activity_type, raw_gps_points, route_path::text")).
+		WithArgs("act-1").
+		WillReturnRows(sqlmock.NewRows(trackColumns).AddRow("user-1", "run", testTrack(), nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("FOR UPDATE")).
+		WithArgs("seg-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO segment_efforts")).
+		WithArgs("seg-1", "act-1", "user-1", 150, 5.0, nil, nil, time.UnixMilli(trackStart+75_000).UTC()).
+		WillReturnRows(sqlmock.NewRows(upsertColumns).AddRow("eff-1", 150, 5.0, nil, nil, time.UnixMilli(trackStart+75_000).UTC(), true, "Runner"))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE segments")).
+		WithArgs("seg-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	m := segments.NewMatcher(repo, nil, 25, zap.NewNop())
+	if err := m.MatchActivity(context.Background(), "act-1"); err != nil {
+		t.Fatalf("MatchActivity: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMatcher_MatchActivity_TimesOnRawTrackWhenRouteShrouded(t *testing.T) {
+	repo, mock := newMockRepo(t)
+
+	// route_path lost its first points to a privacy zone, so the SQL
+	// fractions (0.1, 0.7) don't line up with the raw track. The effort is
+	// still timed from where the segment's endpoints fall on the raw track:
+	// 75s to 225s.
+	mock.ExpectQuery(regexp.QuoteMeta("ST_LineLocatePoint")).
+		WithArgs("act-1", 25).
+		WillReturnRows(sqlmock.NewRows(matchColumns).AddRow("seg-1", 500.0, 0.1, 0.7, hexEWKB(testSegmentPath)))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, activity_type, raw_gps_points, route_path::text")).
+		WithArgs("act-1").
+		WillReturnRows(sqlmock.NewRows(trackColumns).AddRow("user-1", "run", testTrack(), nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("FOR UPDATE")).
+		WithArgs("seg-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO segment_efforts")).
+		WithArgs("seg-1", "act-1", "user-1", 150, 5.0, nil, nil, time.UnixMilli(trackStart+75_000).UTC()).
+		WillReturnRows(sqlmock.NewRows(upsertColumns).AddRow("eff-1", 150, 5.0, nil, nil, time.UnixMilli(trackStart+75_000).UTC(), true, "Runner"))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE segments")).
+		WithArgs("seg-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	m := segments.NewMatcher(repo, nil, 25, zap.NewNop())
+	if err := m.MatchActivity(context.Background(), "act-1"); err != nil {
+		t.Fatalf("MatchActivity: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMatcher_MatchActivity_SkipsShortAndFailedEfforts(t *testing.T) {
+	repo, mock := newMockRepo(t)
+
+	// seg-a covers 0.3s of the track and can't be timed to a whole second;
+	// seg-b fails to record; seg-c is still recorded.
+	short := []utils.GPSPoint{{Lat: 0.005}, {Lat: 0.00501}}
+	mock.ExpectQuery(regexp.QuoteMeta("ST_LineLocatePoint")).
+		WithArgs("act-1", 25).
+		WillReturnRows(sqlmock.NewRows(matchColumns).
+			AddRow("seg-a", 1.0, 0.5, 0.501, hexEWKB(short)).
+			AddRow("seg-b", 500.0, 0.25, 0.75, hexEWKB(testSegmentPath)).
+			AddRow("seg-c", 500.0, 0.25, 0.75, hexEWKB(testSegmentPath)))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, activity_type, raw_gps_points, route_path::text")).
+		WithArgs("act-1").
+		WillReturnRows(sqlmock.NewRows(trackColumns).AddRow("user-1", "run", testTrack(), nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("FOR UPDATE")).
+		WithArgs("seg-b").
+		WillReturnError(errors.New("deadlock detected"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("FOR UPDATE")).
+		WithArgs("seg-c").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO segment_efforts")).
+		WithArgs("seg-c", "act-1", "user-1", 150, 5.0, nil, nil, time.UnixMilli(trackStart+75_000).UTC()).
+		WillReturnRows(sqlmock.NewRows(upsertColumns).AddRow("eff-1", 150, 5.0, nil, nil, time.UnixMilli(trackStart+75_000).UTC(), true, "Runner"))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE segments")).
+		WithArgs("seg-c").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	m := segments.NewMatcher(repo, nil, 25, zap.NewNop())
+	if err := m.MatchActivity(context.Background(), "act-1"); err != nil {
+		t.Fatalf("MatchActivity: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMatcher_MatchActivity_NoSegments(t *testing.T) {
+	repo, mock := newMockRepo(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("ST_LineLocatePoint")).
+		WithArgs("act-1", 25).
+		WillReturnRows(sqlmock.NewRows(matchColumns))
+
+	m := segments.NewMatcher(repo, nil, 25, zap.NewNop())
+	if err := m.MatchActivity(context.Background(), "act-1"); err != nil {
+		t.Fatalf("MatchActivity: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMatcher_MatchActivity_ReverseDirectionSkipped(t *testing.T) {
+	repo, mock := newMockRepo(t)
+
+	// The route reaches the segment's end before its start.
+	mock.ExpectQuery(regexp.QuoteMeta("ST_LineLocatePoint")).
+		WithArgs("act-1", 25).
+		WillReturnRows(sqlmock.NewRows(matchColumns).AddRow("seg-1", 500.0, 0.75, 0.25,
+			hexEWKB([]utils.GPSPoint{testSegmentPath[1], testSegmentPath[0]})))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, activity_type, raw_gps_points, route_path::text")).
+		WithArgs("act-1").
+		WillReturnRows(sqlmock.NewRows(trackColumns).AddRow("user-1", "run", testTrack(), nil))
+
+	m := segments.NewMatcher(repo, nil, 25, zap.NewNop())
+	if err := m.MatchActivity(context.Background(), "act-1"); err != nil {
+		t.Fatalf("MatchActivity: %v", err)
+	}
+	// No INSERT INTO segment_efforts expected.
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// hexEWKB encodes a 2D SRID=4326 LineString as PostGIS prints one.
+func hexEWKB(route []utils.GPSPoint) string {
+	b := []byte{1}
+	b = binary.LittleEndian.AppendUint32(b, 0x20000002)
+	b = binary.LittleEndian.AppendUint32(b, 4326)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(route)))
+	for _, p := range route {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(p.Lng))
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(p.Lat))
+	}
+	return hex.EncodeToString(b)
+}
+
+func TestMatcher_MatchActivity_InProcessFallback(t *testing.T) {
+	repo, mock := newMockRepo(t)
+
+	// No ST_LineLocatePoint query: the activity's points are matched in Go
+	// against each candidate segment's decoded path.
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, activity_type, raw_gps_points, route_path::text")).
+		WithArgs("act-1").
+		WillReturnRows(sqlmock.NewRows(trackColumns).AddRow("user-1", "run", testTrack(), nil))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, distance_meters, segment_path::text")).
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "distance_meters", "segment_path"}).
+			// Points 2-7 of the track: 150s over 500m.
+			AddRow("seg-1", 500.0, hexEWKB([]utils.GPSPoint{{Lat: 0.002}, {Lat: 0.007}})).
+			// Parallel, ~200m east: no match.
+			AddRow("seg-2", 500.0, hexEWKB([]utils.GPSPoint{{Lat: 0.002, Lng: 0.0018}, {Lat: 0.007, Lng: 0.0018}})))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("FOR UPDATE")).
+		WithArgs("seg-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO segment_efforts")).
+		WithArgs("seg-1", "act-1", "user-1", 150, 5.0, nil, nil, time.UnixMilli(trackStart+60_000).UTC()).
+		WillReturnRows(sqlmock.NewRows(upsertColumns).AddRow("eff-1", 150, 5.0, nil, nil, time.UnixMilli(trackStart+60_000).UTC(), true, "Runner"))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE segments")).
+		WithArgs("seg-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	m := segments.NewMatcher(repo, nil, 25, zap.NewNop())
+	m.SetPostGISCheck(func() bool { return false })
+	if err := m.MatchActivity(context.Background(), "act-1"); err != nil {
+		t.Fatalf("MatchActivity: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGetActivityTrack_DecodesRoutePath(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	// No raw points stored: the route comes from route_path's hex EWKB,
+	// which needs no PostGIS function to read.
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id, activity_type, raw_gps_points, route_path::text")).
+		WithArgs("act-1").
+		WillReturnRows(sqlmock.NewRows(trackColumns).
+			AddRow("user-1", "run", nil, hexEWKB([]utils.GPSPoint{{Lat: 51.5, Lng: -0.12}, {Lat: 51.51, Lng: -0.12}})))
+
+	track, err := repo.GetActivityTrack(context.Background(), "act-1")
+	if err != nil {
+		t.Fatalf("GetActivityTrack: %v", err)
+	}
+	if len(track.Points) != 2 || track.Points[1].Lat != 51.51 || track.Points[1].Lng != -0.12 {
+		t.Errorf("unexpected points: %+v", track.Points)
+	}
+}
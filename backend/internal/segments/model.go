@@ -2,6 +2,8 @@ package segments
 
 import (
 	"time"
+
+	"github.com/apexrun/backend/pkg/utils"
 )
 
 // Segment represents a fixed GPS route for community competition (matches DB schema).
@@ -14,9 +16,30 @@ type Segment struct {
 	ElevationGainMeters *float64  `json:"elevation_gain_meters,omitempty"`
 	IsVerified          bool      `json:"is_verified"`
 	ActivityType        string    `json:"activity_type"`
+	Visibility          string    `json:"visibility"`
 	TotalAttempts       int       `json:"total_attempts"`
 	UniqueAthletes      int       `json:"unique_athletes"`
 	CreatedAt           time.Time `json:"created_at"`
+	// Category is the climb category ("HC", "1".."4"), empty for non-climbs.
+	Category string `json:"category,omitempty"`
+	// FlagCount is how many users reported the segment as hazardous.
+	FlagCount int `json:"flag_count"`
+}
+
+// Segment visibility levels.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+// VisibleTo reports whether a viewer may open the segment directly by ID.
+// viewerID is empty for anonymous callers.
+func (s *Segment) VisibleTo(viewerID string) bool {
+	if s.Visibility != VisibilityPrivate {
+		return true
+	}
+	return viewerID != "" && s.CreatorID != nil && *s.CreatorID == viewerID
 }
 
 // SegmentEffort represents a user's attempt on a segment (matches DB schema).
@@ -33,6 +56,60 @@ type SegmentEffort struct {
 	// Computed fields (not in DB)
 	Rank        *int    `json:"rank,omitempty"`
 	DisplayName *string `json:"display_name,omitempty"`
+	// Set on ?age_graded=true leaderboards when the athlete's profile has an
+	// age and a male/female gender (see coaching.AgeGrade).
+	AgeGradedSeconds *float64 `json:"age_graded_seconds,omitempty"`
+	AgeGradePct      *float64 `json:"age_grade_pct,omitempty"`
+}
+
+// LeaderboardFilter narrows a leaderboard to efforts recorded since a time
+// and to a category of athletes. Zero fields don't filter. Age is the
+// profile's current age, as profiles hold no birth date.
+type LeaderboardFilter struct {
+	Since  *time.Time `json:"-"`
+	Sex    string     `json:"sex,omitempty"` // "M" or "F"
+	AgeMin int        `json:"age_min,omitempty"`
+	AgeMax int        `json:"age_max,omitempty"`
+}
+
+// leaderboardGenders maps LeaderboardFilter.Sex to user_profiles.gender.
+var leaderboardGenders = map[string]string{
+	"M": "male",
+	"F": "female",
+}
+
+// FlagSegmentRequest is the request body for flagging a segment as hazardous.
+type FlagSegmentRequest struct {
+	Reason string `json:"reason" binding:"required,min=3,max=500"`
+}
+
+// SegmentFlag is one user's hazard report on a segment.
+type SegmentFlag struct {
+	SegmentID string    `json:"segment_id"`
+	UserID    string    `json:"user_id"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FlaggedSegment is a segment awaiting moderation with its reports, newest
+// first.
+type FlaggedSegment struct {
+	Segment
+	Flags []SegmentFlag `json:"flags"`
+}
+
+// AthleteProfile is the part of a user profile used for age grading.
+type AthleteProfile struct {
+	Age    *int
+	Gender *string
+}
+
+// UserEffort is one of an athlete's own efforts on a segment. Rank is the
+// athlete's position on the leaderboard as of that effort; IsPR marks their
+// fastest effort.
+type UserEffort struct {
+	SegmentEffort
+	IsPR bool `json:"is_pr"`
 }
 
 // CreateSegmentRequest is the request body for creating a segment.
@@ -42,9 +119,64 @@ type CreateSegmentRequest struct {
 	DistanceMeters      float64  `json:"distance_meters" binding:"required,gt=0"`
 	ElevationGainMeters *float64 `json:"elevation_gain_meters"`
 	RouteWKT            string   `json:"route_wkt" binding:"required"` // EWKT LineString
+	Visibility          string   `json:"visibility" binding:"omitempty,oneof=public unlisted private"`
+	ActivityType        string   `json:"activity_type" binding:"omitempty,oneof=run walk bike hike"`
+
+	// Elevations holds one elevation per RouteWKT vertex, taken from the
+	// source activity's GPS points; nil when unknown. segment_path itself
+	// is 2D.
+	Elevations []float64 `json:"-"`
+}
+
+// CreateFromActivityRequest carves a segment out of one of the caller's
+// activities: route points [StartIndex, EndIndex) become the segment path.
+type CreateFromActivityRequest struct {
+	ActivityID  string  `json:"activity_id" binding:"required"`
+	Name        string  `json:"name" binding:"required,min=3,max=100"`
+	Description *string `json:"description"`
+	StartIndex  *int    `json:"start_index" binding:"required"`
+	EndIndex    *int    `json:"end_index" binding:"required"`
+	Visibility  string  `json:"visibility" binding:"omitempty,oneof=public unlisted private"`
+}
+
+// UpdateSegmentRequest allows partial updates by the segment's creator.
+type UpdateSegmentRequest struct {
+	Name         *string `json:"name" binding:"omitempty,min=3,max=100"`
+	Description  *string `json:"description"`
+	ActivityType *string `json:"activity_type" binding:"omitempty,oneof=run walk bike hike"`
 }
 
 // MatchSegmentsRequest is the request body for matching segments to an activity.
 type MatchSegmentsRequest struct {
 	ActivityID string `json:"activity_id" binding:"required"`
+	// AllowReverse also matches segments run against their direction.
+	AllowReverse bool `json:"allow_reverse"`
+}
+
+// ActivityTrack is the subset of an activity needed to time segment efforts
+// or carve a segment from its route.
+type ActivityTrack struct {
+	UserID       string
+	ActivityType string
+	Points       []utils.GPSPoint
+}
+
+// SegmentMatch is a segment traversed by an activity, located along the
+// activity route. See Repository.MatchWithTiming.
+type SegmentMatch struct {
+	SegmentID      string
+	DistanceMeters float64
+	EntryFraction  float64
+	ExitFraction   float64
+	// Start and End are the segment's endpoints, for locating the traversal
+	// on a track other than route_path.
+	Start, End utils.GPSPoint
+}
+
+// SegmentRoute is a segment's path decoded in Go, for matching without
+// PostGIS. See Repository.SegmentRoutes.
+type SegmentRoute struct {
+	SegmentID      string
+	DistanceMeters float64
+	Points         []utils.GPSPoint
 }
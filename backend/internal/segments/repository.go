@@ -3,88 +3,142 @@ package segments
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/database"
+	"github.com/apexrun/backend/pkg/utils"
 )
 
 // Repository provides data access for segments and segment efforts.
 type Repository struct {
-	db     *sql.DB
-	logger *zap.Logger
+	db      database.Querier
+	logger  *zap.Logger
+	timeout time.Duration // per-call query timeout; 0 disables
 }
 
 // NewRepository creates a new segments repository.
-func NewRepository(db *sql.DB, logger *zap.Logger) *Repository {
+func NewRepository(db database.Querier, logger *zap.Logger) *Repository {
 	return &Repository{db: db, logger: logger}
 }
 
-// ListSegments returns all segments, optionally filtered by proximity.
-func (r *Repository) ListSegments(ctx context.Context, nearLat, nearLng, radiusKm *float64) ([]Segment, error) {
-	var query string
-	var args []interface{}
+// SetQueryTimeout bounds each repository call; 0 (the default) leaves calls
+// bounded only by the caller's context.
+func (r *Repository) SetQueryTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+func (r *Repository) queryCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	return database.WithQueryTimeout(ctx, r.timeout)
+}
+
+// WithTx returns a copy of the repository that runs its queries in tx.
+func (r *Repository) WithTx(tx *sql.Tx) *Repository {
+	return &Repository{db: tx, logger: r.logger, timeout: r.timeout}
+}
+
+// segmentSelectColumns is the standard column list for segment queries.
+const segmentSelectColumns = `id, creator_id, name, description, distance_meters,
+	elevation_gain_meters, is_verified, activity_type, visibility,
+	total_attempts, unique_athletes, created_at, COALESCE(category, ''),
+	flag_count`
+
+// scanSegment scans a row into a Segment struct.
+func scanSegment(scanner interface{ Scan(...interface{}) error }, s *Segment) error {
+	return scanner.Scan(
+		&s.ID, &s.CreatorID, &s.Name, &s.Description, &s.DistanceMeters,
+		&s.ElevationGainMeters, &s.IsVerified, &s.ActivityType, &s.Visibility,
+		&s.TotalAttempts, &s.UniqueAthletes, &s.CreatedAt, &s.Category,
+		&s.FlagCount,
+	)
+}
+
+// ListSegments returns a page of the segments listed for the viewer,
+// optionally filtered by proximity, and how many are listed in all. Only
+// public segments are listed for others; creators also see their own.
+// viewerID is empty for anonymous callers; limit is capped at 100.
+func (r *Repository) ListSegments(ctx context.Context, viewerID string, nearLat, nearLng, radiusKm *float64, limit, offset int) ([]Segment, int, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	// $1 is the viewer; NULLIF keeps anonymous callers from matching NULL creators.
+	where := `(visibility = 'public' OR creator_id = NULLIF($1, '')::uuid)`
+	args := []interface{}{viewerID}
+	// id breaks ties so offset pages neither repeat nor skip rows.
+	orderBy := "total_attempts DESC, id"
 
 	if nearLat != nil && nearLng != nil && radiusKm != nil {
 		// Spatial proximity query using PostGIS
-		query = `
-			SELECT id, creator_id, name, description, distance_meters,
-			       elevation_gain_meters, is_verified, activity_type,
-			       total_attempts, unique_athletes, created_at
-			FROM segments
-			WHERE ST_DWithin(
+		where += `
+			  AND ST_DWithin(
 				segment_path::geography,
-				ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography,
-				$3
-			)
-			ORDER BY distance_meters ASC
-			LIMIT 100`
-		args = []interface{}{*nearLng, *nearLat, *radiusKm * 1000}
-	} else {
-		query = `
-			SELECT id, creator_id, name, description, distance_meters,
-			       elevation_gain_meters, is_verified, activity_type,
-			       total_attempts, unique_athletes, created_at
-			FROM segments
-			ORDER BY total_attempts DESC
-			LIMIT 100`
+				ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography,
+				$4
+			)`
+		args = append(args, *nearLng, *nearLat, *radiusKm*1000)
+		orderBy = "distance_meters ASC, id"
 	}
 
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	query := fmt.Sprintf(`
+			SELECT `+segmentSelectColumns+`, COUNT(*) OVER ()
+			FROM segments
+			WHERE %s
+			ORDER BY %s
+			LIMIT $%d OFFSET $%d`, where, orderBy, len(args)+1, len(args)+2)
+
+	rows, err := r.db.QueryContext(ctx, query, append(args, limit, offset)...)
 	if err != nil {
-		return nil, fmt.Errorf("list segments: %w", err)
+		return nil, 0, fmt.Errorf("list segments: %w", err)
 	}
 	defer rows.Close()
 
 	var segments []Segment
+	total := 0
 	for rows.Next() {
 		var s Segment
-		if err := rows.Scan(
-			&s.ID, &s.CreatorID, &s.Name, &s.Description, &s.DistanceMeters,
-			&s.ElevationGainMeters, &s.IsVerified, &s.ActivityType,
-			&s.TotalAttempts, &s.UniqueAthletes, &s.CreatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("scan segment: %w", err)
+		if err := scanSegment(database.WithTotal(rows, &total), &s); err != nil {
+			return nil, 0, fmt.Errorf("scan segment: %w", err)
 		}
 		segments = append(segments, s)
 	}
-	return segments, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// A page past the end carries no window count; count separately.
+	if len(segments) == 0 && offset > 0 {
+		err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM segments WHERE `+where, args...).Scan(&total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("count segments: %w", err)
+		}
+	}
+	return segments, total, nil
 }
 
-// GetByID returns a single segment.
+// GetByID returns a single segment regardless of visibility; callers must
+// check Segment.VisibleTo before exposing it.
 func (r *Repository) GetByID(ctx context.Context, segmentID string) (*Segment, error) {
-	query := `
-		SELECT id, creator_id, name, description, distance_meters,
-		       elevation_gain_meters, is_verified, activity_type,
-		       total_attempts, unique_athletes, created_at
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	query := `SELECT ` + segmentSelectColumns + `
 		FROM segments
 		WHERE id = $1`
 
 	s := &Segment{}
-	err := r.db.QueryRowContext(ctx, query, segmentID).Scan(
-		&s.ID, &s.CreatorID, &s.Name, &s.Description, &s.DistanceMeters,
-		&s.ElevationGainMeters, &s.IsVerified, &s.ActivityType,
-		&s.TotalAttempts, &s.UniqueAthletes, &s.CreatedAt,
-	)
+	err := scanSegment(r.db.QueryRowContext(ctx, query, segmentID), s)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -94,14 +148,61 @@ func (r *Repository) GetByID(ctx context.Context, segmentID string) (*Segment, e
 	return s, nil
 }
 
-// Create inserts a new segment with its PostGIS path.
+// GetPath returns a segment's stored path and whether it carries elevation,
+// or nil if the segment has no path. segment_path is 2D, so elevations come
+// from path_elevations, recorded when the segment was cut from an activity.
+func (r *Repository) GetPath(ctx context.Context, segmentID string) ([]utils.GPSPoint, bool, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	var path sql.NullString
+	var elevations []float64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT segment_path::text, path_elevations
+		FROM segments WHERE id = $1`,
+		segmentID,
+	).Scan(&path, pgtype.NewMap().SQLScanner(&elevations))
+	if err == sql.ErrNoRows || (err == nil && !path.Valid) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("get segment path: %w", err)
+	}
+	points, err := utils.ParseHexEWKBLineString(path.String)
+	if err != nil {
+		return nil, false, fmt.Errorf("decode segment path: %w", err)
+	}
+	if len(elevations) != len(points) {
+		return points, false, nil
+	}
+	for i := range points {
+		points[i].Elevation = elevations[i]
+	}
+	return points, true, nil
+}
+
+// Create inserts a new segment with its PostGIS path and climb category.
 func (r *Repository) Create(ctx context.Context, userID string, req *CreateSegmentRequest) (*Segment, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	visibility := req.Visibility
+	if visibility == "" {
+		visibility = VisibilityPublic
+	}
+	var elevation float64
+	if req.ElevationGainMeters != nil {
+		elevation = *req.ElevationGainMeters
+	}
+
 	query := `
 		INSERT INTO segments (
 			creator_id, name, description, distance_meters,
-			elevation_gain_meters, segment_path
-		) VALUES ($1, $2, $3, $4, $5, ST_GeomFromEWKT($6))
-		RETURNING id, created_at`
+			elevation_gain_meters, segment_path, visibility, activity_type,
+			category, path_elevations
+		) VALUES ($1, $2, $3, $4, $5, ST_GeomFromEWKT($6), $7, COALESCE(NULLIF($8, ''), 'run'),
+			NULLIF($9, ''), $10)
+		RETURNING id, activity_type, created_at`
 
 	s := &Segment{
 		CreatorID:           &userID,
@@ -109,74 +210,386 @@ func (r *Repository) Create(ctx context.Context, userID string, req *CreateSegme
 		Description:         req.Description,
 		DistanceMeters:      req.DistanceMeters,
 		ElevationGainMeters: req.ElevationGainMeters,
+		Visibility:          visibility,
+		Category:            utils.CategorizeClimb(req.DistanceMeters, elevation),
 	}
 
 	err := r.db.QueryRowContext(ctx, query,
 		userID, req.Name, req.Description, req.DistanceMeters,
-		req.ElevationGainMeters, req.RouteWKT,
-	).Scan(&s.ID, &s.CreatedAt)
+		req.ElevationGainMeters, req.RouteWKT, visibility, req.ActivityType,
+		s.Category, req.Elevations,
+	).Scan(&s.ID, &s.ActivityType, &s.CreatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("create segment: %w", err)
 	}
 	return s, nil
 }
 
-// GetLeaderboard returns segment efforts ordered fastest first, with display names.
-func (r *Repository) GetLeaderboard(ctx context.Context, segmentID string, limit int) ([]SegmentEffort, error) {
+// Update applies a partial update to a segment owned by userID. Returns nil
+// if no such segment exists for that creator.
+func (r *Repository) Update(ctx context.Context, userID, segmentID string, req *UpdateSegmentRequest) (*Segment, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	setClauses := []string{}
+	args := []interface{}{}
+
+	if req.Name != nil {
+		args = append(args, *req.Name)
+		setClauses = append(setClauses, fmt.Sprintf("name = $%d", len(args)))
+	}
+	if req.Description != nil {
+		args = append(args, *req.Description)
+		setClauses = append(setClauses, fmt.Sprintf("description = $%d", len(args)))
+	}
+	if req.ActivityType != nil {
+		args = append(args, *req.ActivityType)
+		setClauses = append(setClauses, fmt.Sprintf("activity_type = $%d", len(args)))
+	}
+
+	if len(setClauses) == 0 {
+		s, err := r.GetByID(ctx, segmentID)
+		if err != nil || s == nil || s.CreatorID == nil || *s.CreatorID != userID {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE segments SET %s, updated_at = NOW()
+		WHERE id = $%d AND creator_id = $%d
+		RETURNING `+segmentSelectColumns,
+		strings.Join(setClauses, ", "), len(args)+1, len(args)+2)
+	args = append(args, segmentID, userID)
+
+	s := &Segment{}
+	err := scanSegment(r.db.QueryRowContext(ctx, query, args...), s)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update segment: %w", err)
+	}
+	return s, nil
+}
+
+// Delete removes a segment owned by userID together with its efforts, in
+// one transaction. Returns sql.ErrNoRows if no such segment exists for that
+// creator.
+func (r *Repository) Delete(ctx context.Context, userID, segmentID string) error {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	pool, ok := r.db.(database.TxBeginner)
+	if !ok {
+		// Already bound to the caller's transaction.
+		return deleteSegment(ctx, r.db, userID, segmentID)
+	}
+	err := database.RunInTx(ctx, pool, func(tx *sql.Tx) error {
+		return deleteSegment(ctx, tx, userID, segmentID)
+	})
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("delete segment: %w", err)
+	}
+	return err
+}
+
+func deleteSegment(ctx context.Context, q database.Querier, userID, segmentID string) error {
+	// segment_efforts also cascades on segment_id; deleting explicitly keeps
+	// this correct on databases created without the constraint.
+	if _, err := q.ExecContext(ctx, `
+		DELETE FROM segment_efforts
+		WHERE segment_id = $1
+		  AND EXISTS (SELECT 1 FROM segments WHERE id = $1 AND creator_id = $2)`,
+		segmentID, userID,
+	); err != nil {
+		return fmt.Errorf("efforts: %w", err)
+	}
+
+	result, err := q.ExecContext(ctx,
+		`DELETE FROM segments WHERE id = $1 AND creator_id = $2`,
+		segmentID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetLeaderboard returns a page of each athlete's best effort on a segment,
+// fastest first, with display names, plus how many athletes are on the
+// board. Ranks are absolute (offset-based) within the filtered board (see
+// LeaderboardFilter). Efforts on a private segment are only returned to its
+// creator (viewerID).
+func (r *Repository) GetLeaderboard(ctx context.Context, segmentID, viewerID string, limit, offset int, filter LeaderboardFilter) ([]SegmentEffort, int, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
 	if limit <= 0 || limit > 200 {
 		limit = 50
 	}
+	if offset < 0 {
+		offset = 0
+	}
 
-	query := `
-		SELECT se.id, se.segment_id, se.activity_id, se.user_id,
-		       se.elapsed_seconds, se.avg_pace_min_per_km,
-		       se.avg_heart_rate, se.max_speed_kmh, se.recorded_at,
-		       up.display_name
-		FROM segment_efforts se
-		LEFT JOIN user_profiles up ON up.id = se.user_id
-		WHERE se.segment_id = $1
-		ORDER BY se.elapsed_seconds ASC
-		LIMIT $2`
+	args := []interface{}{segmentID, viewerID}
+	filterClause := ""
+	where := func(cond string, value interface{}) {
+		args = append(args, value)
+		filterClause += fmt.Sprintf("\n\t\t\t  AND "+cond, len(args))
+	}
+	if filter.Since != nil {
+		where("se.recorded_at >= $%d", *filter.Since)
+	}
+	if gender, ok := leaderboardGenders[filter.Sex]; ok {
+		where("up.gender = $%d", gender)
+	}
+	if filter.AgeMin > 0 {
+		where("up.age >= $%d", filter.AgeMin)
+	}
+	if filter.AgeMax > 0 {
+		where("up.age <= $%d", filter.AgeMax)
+	}
 
-	rows, err := r.db.QueryContext(ctx, query, segmentID, limit)
+	best := `
+			SELECT DISTINCT ON (se.user_id)
+			       se.id, se.segment_id, se.activity_id, se.user_id,
+			       se.elapsed_seconds, se.avg_pace_min_per_km,
+			       se.avg_heart_rate, se.max_speed_kmh, se.recorded_at,
+			       up.display_name
+			FROM segment_efforts se
+			JOIN segments s ON s.id = se.segment_id
+			JOIN activities a ON a.id = se.activity_id AND a.deleted_at IS NULL
+			LEFT JOIN user_profiles up ON up.id = se.user_id
+			WHERE se.segment_id = $1
+			  AND (s.visibility <> 'private' OR s.creator_id = NULLIF($2, '')::uuid)` + filterClause + `
+			ORDER BY se.user_id, se.elapsed_seconds ASC, se.recorded_at ASC`
+
+	query := fmt.Sprintf(`
+		SELECT id, segment_id, activity_id, user_id,
+		       elapsed_seconds, avg_pace_min_per_km,
+		       avg_heart_rate, max_speed_kmh, recorded_at,
+		       display_name, COUNT(*) OVER ()
+		FROM (%s
+		) best
+		ORDER BY elapsed_seconds ASC, recorded_at ASC
+		LIMIT $%d OFFSET $%d`, best, len(args)+1, len(args)+2)
+
+	rows, err := r.db.QueryContext(ctx, query, append(args, limit, offset)...)
 	if err != nil {
-		return nil, fmt.Errorf("get leaderboard: %w", err)
+		return nil, 0, fmt.Errorf("get leaderboard: %w", err)
 	}
 	defer rows.Close()
 
 	var efforts []SegmentEffort
-	rank := 1
+	total := 0
 	for rows.Next() {
 		var e SegmentEffort
 		if err := rows.Scan(
 			&e.ID, &e.SegmentID, &e.ActivityID, &e.UserID,
 			&e.ElapsedSeconds, &e.AvgPaceMinPerKm,
 			&e.AvgHeartRate, &e.MaxSpeedKmh, &e.RecordedAt,
-			&e.DisplayName,
+			&e.DisplayName, &total,
 		); err != nil {
-			return nil, fmt.Errorf("scan effort: %w", err)
+			return nil, 0, fmt.Errorf("scan effort: %w", err)
 		}
+		rank := offset + len(efforts) + 1
 		e.Rank = &rank
 		efforts = append(efforts, e)
-		rank++
 	}
-	return efforts, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// A page past the end carries no window count; count separately.
+	if len(efforts) == 0 && offset > 0 {
+		err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM (`+best+`
+		) best`, args...).Scan(&total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("count leaderboard: %w", err)
+		}
+	}
+	return efforts, total, nil
+}
+
+// FlagSegment records userID's hazard report on a segment and bumps its
+// flag_count in one statement. flagged is false, and count 0, when the user
+// has already flagged the segment.
+func (r *Repository) FlagSegment(ctx context.Context, segmentID, userID, reason string) (count int, flagged bool, err error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	err = r.db.QueryRowContext(ctx, `
+		WITH flag AS (
+			INSERT INTO segment_flags (segment_id, user_id, reason)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (segment_id, user_id) DO NOTHING
+			RETURNING segment_id
+		)
+		UPDATE segments SET flag_count = flag_count + 1
+		WHERE id IN (SELECT segment_id FROM flag)
+		RETURNING flag_count`,
+		segmentID, userID, reason,
+	).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("flag segment: %w", err)
+	}
+	return count, true, nil
+}
+
+// SetVerified marks a segment verified by adminID, or clears its
+// verification. It returns nil, nil if the segment doesn't exist.
+func (r *Repository) SetVerified(ctx context.Context, segmentID, adminID string, verified bool) (*Segment, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE segments
+		SET is_verified = TRUE, verified_by = $2, verified_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+		RETURNING ` + segmentSelectColumns
+	args := []interface{}{segmentID, adminID}
+	if !verified {
+		query = `
+		UPDATE segments
+		SET is_verified = FALSE, verified_by = NULL, verified_at = NULL, updated_at = NOW()
+		WHERE id = $1
+		RETURNING ` + segmentSelectColumns
+		args = args[:1]
+	}
+
+	s := &Segment{}
+	err := scanSegment(r.db.QueryRowContext(ctx, query, args...), s)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("set segment verified: %w", err)
+	}
+	return s, nil
+}
+
+// ListFlagged returns up to limit flagged segments, most flagged first,
+// each with its reports.
+func (r *Repository) ListFlagged(ctx context.Context, limit int) ([]FlaggedSegment, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+segmentSelectColumns+`
+		FROM segments
+		WHERE flag_count > 0
+		ORDER BY flag_count DESC, created_at ASC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list flagged segments: %w", err)
+	}
+	defer rows.Close()
+
+	var flagged []FlaggedSegment
+	index := map[string]int{}
+	var ids []string
+	for rows.Next() {
+		var f FlaggedSegment
+		if err := scanSegment(rows, &f.Segment); err != nil {
+			return nil, fmt.Errorf("scan segment: %w", err)
+		}
+		f.Flags = []SegmentFlag{}
+		index[f.ID] = len(flagged)
+		ids = append(ids, f.ID)
+		flagged = append(flagged, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(flagged) == 0 {
+		return flagged, nil
+	}
+
+	flagRows, err := r.db.QueryContext(ctx, `
+		SELECT segment_id, user_id, reason, created_at
+		FROM segment_flags
+		WHERE segment_id = ANY($1)
+		ORDER BY created_at DESC`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("list segment flags: %w", err)
+	}
+	defer flagRows.Close()
+
+	for flagRows.Next() {
+		var f SegmentFlag
+		if err := flagRows.Scan(&f.SegmentID, &f.UserID, &f.Reason, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan segment flag: %w", err)
+		}
+		if i, ok := index[f.SegmentID]; ok {
+			flagged[i].Flags = append(flagged[i].Flags, f)
+		}
+	}
+	return flagged, flagRows.Err()
+}
+
+// GetAthleteProfiles returns the age and gender of each of userIDs that has
+// a profile, keyed by user id.
+func (r *Repository) GetAthleteProfiles(ctx context.Context, userIDs []string) (map[string]AthleteProfile, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, age, gender FROM user_profiles WHERE id = ANY($1)`, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("get athlete profiles: %w", err)
+	}
+	defer rows.Close()
+
+	profiles := make(map[string]AthleteProfile, len(userIDs))
+	for rows.Next() {
+		var id string
+		var p AthleteProfile
+		if err := rows.Scan(&id, &p.Age, &p.Gender); err != nil {
+			return nil, fmt.Errorf("scan athlete profile: %w", err)
+		}
+		profiles[id] = p
+	}
+	return profiles, rows.Err()
 }
 
 // MatchActivityToSegments uses PostGIS to find segments traversed by an activity.
-func (r *Repository) MatchActivityToSegments(ctx context.Context, activityID string, bufferMeters int) ([]string, error) {
+// Private segments only match activities recorded by their creator. Unless
+// allowReverse is set, the activity must reach the segment's first vertex
+// before its last (compared as ST_LineLocatePoint fractions along the route).
+// Ids are in ascending order, the order CreateEffort's segment locks must be
+// taken in so concurrent uploads over the same segments can't deadlock.
+func (r *Repository) MatchActivityToSegments(ctx context.Context, activityID string, bufferMeters int, allowReverse bool) ([]string, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
 	query := `
 		SELECT s.id
 		FROM segments s
 		JOIN activities a ON a.id = $1
 		WHERE a.route_path IS NOT NULL
+		  AND a.deleted_at IS NULL
 		  AND s.segment_path IS NOT NULL
+		  AND (s.visibility <> 'private' OR s.creator_id = a.user_id)
 		  AND ST_Contains(
 		      ST_Buffer(a.route_path::geography, $2)::geometry,
 		      s.segment_path
-		  )`
+		  )
+		  AND ($3 OR ST_LineLocatePoint(a.route_path::geometry, ST_StartPoint(s.segment_path::geometry))
+		           < ST_LineLocatePoint(a.route_path::geometry, ST_EndPoint(s.segment_path::geometry)))
+		ORDER BY s.id`
 
-	rows, err := r.db.QueryContext(ctx, query, activityID, bufferMeters)
+	rows, err := r.db.QueryContext(ctx, query, activityID, bufferMeters, allowReverse)
 	if err != nil {
 		return nil, fmt.Errorf("match segments: %w", err)
 	}
@@ -193,35 +606,357 @@ func (r *Repository) MatchActivityToSegments(ctx context.Context, activityID str
 	return ids, rows.Err()
 }
 
-// CreateEffort inserts a segment effort record.
-func (r *Repository) CreateEffort(ctx context.Context, e *SegmentEffort) (*SegmentEffort, error) {
+// GetActivityTrack returns the owner, type and route of a live activity, or
+// nil if it doesn't exist. Points come from raw_gps_points (with timestamps)
+// when stored, otherwise from the route_path geometry.
+func (r *Repository) GetActivityTrack(ctx context.Context, activityID string) (*ActivityTrack, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	// route_path is read as hex EWKB rather than through ST_AsText so the
+	// in-process matcher works without PostGIS functions.
+	var t ActivityTrack
+	var raw []byte
+	var path sql.NullString
+	err := r.db.QueryRowContext(ctx,
+		`SELECT user_id, activity_type, raw_gps_points, route_path::text
+		FROM activities WHERE id = $1 AND deleted_at IS NULL`,
+		activityID,
+	).Scan(&t.UserID, &t.ActivityType, &raw, &path)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get activity track: %w", err)
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &t.Points); err != nil {
+			return nil, fmt.Errorf("decode gps points: %w", err)
+		}
+	}
+	if len(t.Points) == 0 && path.Valid && path.String != "" {
+		if t.Points, err = utils.ParseHexEWKBLineString(path.String); err != nil {
+			return nil, fmt.Errorf("decode route path: %w", err)
+		}
+	}
+	return &t, nil
+}
+
+// MatchWithTiming is MatchActivityToSegments plus where along the activity
+// route each segment starts and ends, as ST_LineLocatePoint fractions (0-1)
+// of the route's planar length.
+//
+// It assumes the activity traverses the segment in the segment's defined
+// direction: a reverse traversal yields ExitFraction <= EntryFraction and
+// callers should not record it. On routes that pass a segment endpoint more
+// than once, the fraction is that of the closest pass. Start and End are
+// filled from the segment path. Matches are in segment id order, like
+// MatchActivityToSegments.
+func (r *Repository) MatchWithTiming(ctx context.Context, activityID string, bufferMeters int) ([]SegmentMatch, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	query := `
+		SELECT s.id, s.distance_meters,
+		       ST_LineLocatePoint(a.route_path::geometry, ST_StartPoint(s.segment_path::geometry)),
+		       ST_LineLocatePoint(a.route_path::geometry, ST_EndPoint(s.segment_path::geometry)),
+		       s.segment_path::text
+		FROM segments s
+		JOIN activities a ON a.id = $1
+		WHERE a.route_path IS NOT NULL
+		  AND a.deleted_at IS NULL
+		  AND s.segment_path IS NOT NULL
+		  AND (s.visibility <> 'private' OR s.creator_id = a.user_id)
+		  AND ST_Contains(
+		      ST_Buffer(a.route_path::geography, $2)::geometry,
+		      s.segment_path
+		  )
+		ORDER BY s.id`
+
+	rows, err := r.db.QueryContext(ctx, query, activityID, bufferMeters)
+	if err != nil {
+		return nil, fmt.Errorf("match segments with timing: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []SegmentMatch
+	for rows.Next() {
+		var m SegmentMatch
+		var path string
+		if err := rows.Scan(&m.SegmentID, &m.DistanceMeters, &m.EntryFraction, &m.ExitFraction, &path); err != nil {
+			return nil, fmt.Errorf("scan match: %w", err)
+		}
+		points, err := utils.ParseHexEWKBLineString(path)
+		if err == nil && len(points) < 2 {
+			err = fmt.Errorf("fewer than two points")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode segment %s path: %w", m.SegmentID, err)
+		}
+		m.Start, m.End = points[0], points[len(points)-1]
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// SegmentRoutes returns the paths of every segment userID may match,
+// decoded from segment_path's hex EWKB text so no PostGIS function is
+// called. It backs the in-process matcher and loads all candidates, so it
+// suits only deployments with modest segment counts. Routes are in id order,
+// like MatchActivityToSegments.
+func (r *Repository) SegmentRoutes(ctx context.Context, userID string) ([]SegmentRoute, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, distance_meters, segment_path::text
+		FROM segments
+		WHERE segment_path IS NOT NULL
+		  AND (visibility <> 'private' OR creator_id = $1)
+		ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list segment routes: %w", err)
+	}
+	defer rows.Close()
+
+	var routes []SegmentRoute
+	for rows.Next() {
+		var sr SegmentRoute
+		var ewkb string
+		if err := rows.Scan(&sr.SegmentID, &sr.DistanceMeters, &ewkb); err != nil {
+			return nil, fmt.Errorf("scan segment route: %w", err)
+		}
+		if sr.Points, err = utils.ParseHexEWKBLineString(ewkb); err != nil {
+			return nil, fmt.Errorf("decode segment %s path: %w", sr.SegmentID, err)
+		}
+		routes = append(routes, sr)
+	}
+	return routes, rows.Err()
+}
+
+// GetRecordHolder returns the fastest effort on a segment (the KOM), or
+// nil if the segment has no efforts. Efforts on soft-deleted activities are
+// skipped here and on every other effort read. It uses
+// idx_segment_efforts_leaderboard.
+func (r *Repository) GetRecordHolder(ctx context.Context, segmentID string) (*SegmentEffort, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	query := `
+		SELECT se.id, se.segment_id, se.activity_id, se.user_id,
+		       se.elapsed_seconds, se.avg_pace_min_per_km,
+		       se.avg_heart_rate, se.max_speed_kmh, se.recorded_at,
+		       up.display_name
+		FROM segment_efforts se
+		JOIN activities a ON a.id = se.activity_id AND a.deleted_at IS NULL
+		LEFT JOIN user_profiles up ON up.id = se.user_id
+		WHERE se.segment_id = $1
+		ORDER BY se.elapsed_seconds ASC, se.recorded_at ASC
+		LIMIT 1`
+
+	var e SegmentEffort
+	err := r.db.QueryRowContext(ctx, query, segmentID).Scan(
+		&e.ID, &e.SegmentID, &e.ActivityID, &e.UserID,
+		&e.ElapsedSeconds, &e.AvgPaceMinPerKm,
+		&e.AvgHeartRate, &e.MaxSpeedKmh, &e.RecordedAt,
+		&e.DisplayName,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get record holder: %w", err)
+	}
+	rank := 1
+	e.Rank = &rank
+	return &e, nil
+}
+
+// GetUserEfforts returns userID's efforts on a segment, newest first. Each
+// effort's Rank counts the other athletes who had gone faster by the time it
+// was recorded; IsPR marks the fastest (earliest on ties).
+func (r *Repository) GetUserEfforts(ctx context.Context, segmentID, userID string) ([]UserEffort, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
 	query := `
+		SELECT se.id, se.segment_id, se.activity_id, se.user_id,
+		       se.elapsed_seconds, se.avg_pace_min_per_km,
+		       se.avg_heart_rate, se.max_speed_kmh, se.recorded_at,
+		       up.display_name,
+		       1 + (
+		           SELECT COUNT(DISTINCT o.user_id)
+		           FROM segment_efforts o
+		           JOIN activities oa ON oa.id = o.activity_id AND oa.deleted_at IS NULL
+		           WHERE o.segment_id = se.segment_id
+		             AND o.user_id <> se.user_id
+		             AND o.recorded_at <= se.recorded_at
+		             AND o.elapsed_seconds < se.elapsed_seconds
+		       )
+		FROM segment_efforts se
+		JOIN activities a ON a.id = se.activity_id AND a.deleted_at IS NULL
+		LEFT JOIN user_profiles up ON up.id = se.user_id
+		WHERE se.segment_id = $1 AND se.user_id = $2
+		ORDER BY se.recorded_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, segmentID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get user efforts: %w", err)
+	}
+	defer rows.Close()
+
+	var efforts []UserEffort
+	pr := -1
+	for rows.Next() {
+		var e UserEffort
+		var rank int
+		if err := rows.Scan(
+			&e.ID, &e.SegmentID, &e.ActivityID, &e.UserID,
+			&e.ElapsedSeconds, &e.AvgPaceMinPerKm,
+			&e.AvgHeartRate, &e.MaxSpeedKmh, &e.RecordedAt,
+			&e.DisplayName, &rank,
+		); err != nil {
+			return nil, fmt.Errorf("scan effort: %w", err)
+		}
+		e.Rank = &rank
+		// Rows are newest first, so <= moves a tie to the earlier effort.
+		if pr < 0 || e.ElapsedSeconds <= efforts[pr].ElapsedSeconds {
+			pr = len(efforts)
+		}
+		efforts = append(efforts, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if pr >= 0 {
+		efforts[pr].IsPR = true
+	}
+	return efforts, nil
+}
+
+// CreateEffort records a segment effort and fills in the athlete's display
+// name. An activity has at most one effort per segment: recording another
+// keeps whichever is faster and leaves e holding the kept effort, so
+// re-running matching is idempotent. The write and the segment's counter
+// refresh share one transaction that holds the segment row lock throughout,
+// so concurrent efforts on a segment serialize and each recount sees every
+// committed effort.
+func (r *Repository) CreateEffort(ctx context.Context, e *SegmentEffort) (*SegmentEffort, error) {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	pool, ok := r.db.(database.TxBeginner)
+	if !ok {
+		// Already bound to the caller's transaction: a savepoint undoes just
+		// this effort on failure and leaves the transaction usable.
+		err := database.WithSavepoint(ctx, r.db, "create_effort", func() error {
+			return r.createEffort(ctx, r.db, e)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create effort: %w", err)
+		}
+		return e, nil
+	}
+	err := database.RunInTx(ctx, pool, func(tx *sql.Tx) error {
+		return r.createEffort(ctx, tx, e)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create effort: %w", err)
+	}
+	return e, nil
+}
+
+func (r *Repository) createEffort(ctx context.Context, q database.Querier, e *SegmentEffort) error {
+	// Lock the segment before inserting. Under READ COMMITTED the recount
+	// below then takes its snapshot after any concurrent effort transaction
+	// on this segment has committed, instead of racing it.
+	if _, err := q.ExecContext(ctx,
+		`SELECT 1 FROM segments WHERE id = $1 FOR UPDATE`, e.SegmentID,
+	); err != nil {
+		return fmt.Errorf("lock segment: %w", err)
+	}
+
+	// SET expressions see the existing row, so each CASE compares against
+	// the stored time, not the LEAST already assigned. xmax = 0 only on a
+	// freshly inserted row.
+	var inserted bool
+	err := q.QueryRowContext(ctx, `
 		INSERT INTO segment_efforts (
 			segment_id, activity_id, user_id, elapsed_seconds,
 			avg_pace_min_per_km, avg_heart_rate, max_speed_kmh,
 			recorded_at
 		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id`
-
-	err := r.db.QueryRowContext(ctx, query,
+		ON CONFLICT (segment_id, activity_id) DO UPDATE SET
+			elapsed_seconds = LEAST(segment_efforts.elapsed_seconds, EXCLUDED.elapsed_seconds),
+			avg_pace_min_per_km = CASE WHEN EXCLUDED.elapsed_seconds < segment_efforts.elapsed_seconds
+				THEN EXCLUDED.avg_pace_min_per_km ELSE segment_efforts.avg_pace_min_per_km END,
+			avg_heart_rate = CASE WHEN EXCLUDED.elapsed_seconds < segment_efforts.elapsed_seconds
+				THEN EXCLUDED.avg_heart_rate ELSE segment_efforts.avg_heart_rate END,
+			max_speed_kmh = CASE WHEN EXCLUDED.elapsed_seconds < segment_efforts.elapsed_seconds
+				THEN EXCLUDED.max_speed_kmh ELSE segment_efforts.max_speed_kmh END,
+			recorded_at = CASE WHEN EXCLUDED.elapsed_seconds < segment_efforts.elapsed_seconds
+				THEN EXCLUDED.recorded_at ELSE segment_efforts.recorded_at END
+		RETURNING id, elapsed_seconds, avg_pace_min_per_km, avg_heart_rate,
+			max_speed_kmh, recorded_at, xmax = 0,
+			(SELECT display_name FROM user_profiles WHERE id = $3)`,
 		e.SegmentID, e.ActivityID, e.UserID, e.ElapsedSeconds,
 		e.AvgPaceMinPerKm, e.AvgHeartRate, e.MaxSpeedKmh,
 		e.RecordedAt,
-	).Scan(&e.ID)
+	).Scan(&e.ID, &e.ElapsedSeconds, &e.AvgPaceMinPerKm, &e.AvgHeartRate,
+		&e.MaxSpeedKmh, &e.RecordedAt, &inserted, &e.DisplayName)
 	if err != nil {
-		return nil, fmt.Errorf("create effort: %w", err)
+		return err
+	}
+	if !inserted {
+		// A re-match replaces no effort, so the counts can't have changed.
+		return nil
 	}
 
-	// Update segment counters
-	_, _ = r.db.ExecContext(ctx, `
-		UPDATE segments
-		SET total_attempts = total_attempts + 1,
-		    unique_athletes = (
-		        SELECT COUNT(DISTINCT user_id)
-		        FROM segment_efforts
-		        WHERE segment_id = $1
-		    )
-		WHERE id = $1`, e.SegmentID)
+	// Failing here rolls the effort back too, so a retry can't double-count.
+	if err := recomputeCounters(ctx, q, e.SegmentID); err != nil {
+		r.logger.Error("update segment counters",
+			zap.String("segment_id", e.SegmentID), zap.Error(err))
+		return fmt.Errorf("update counters: %w", err)
+	}
+	return nil
+}
 
-	return e, nil
+// RecomputeSegmentCounters rebuilds a segment's total_attempts and
+// unique_athletes from segment_efforts, repairing any drift. Returns
+// sql.ErrNoRows if the segment doesn't exist.
+func (r *Repository) RecomputeSegmentCounters(ctx context.Context, segmentID string) error {
+	ctx, cancel := r.queryCtx(ctx)
+	defer cancel()
+
+	err := recomputeCounters(ctx, r.db, segmentID)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("recompute segment counters: %w", err)
+	}
+	return err
+}
+
+// recomputeCounters sets both counters from segment_efforts in one statement
+// rather than incrementing, so they can't drift from the rows they count.
+// Efforts on soft-deleted activities don't count; migration 020 applies the
+// same rule when an activity is deleted or restored.
+func recomputeCounters(ctx context.Context, q database.Querier, segmentID string) error {
+	result, err := q.ExecContext(ctx, `
+		UPDATE segments
+		SET total_attempts = counts.attempts,
+		    unique_athletes = counts.athletes
+		FROM (
+		    SELECT COUNT(*) AS attempts, COUNT(DISTINCT se.user_id) AS athletes
+		    FROM segment_efforts se
+		    JOIN activities a ON a.id = se.activity_id AND a.deleted_at IS NULL
+		    WHERE se.segment_id = $1
+		) counts
+		WHERE id = $1`, segmentID,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
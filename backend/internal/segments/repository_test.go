@@ -0,0 +1,466 @@
+package segments_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/apexrun/backend/internal/segments"
+)
+
+// segmentColumns mirrors the repository's segmentSelectColumns order.
+var segmentColumns = []string{
+	"id", "creator_id", "name", "description", "distance_meters",
+	"elevation_gain_meters", "is_verified", "activity_type", "visibility",
+	"total_attempts", "unique_athletes", "created_at", "category",
+	"flag_count",
+}
+
+// segmentListColumns is segmentColumns plus ListSegments' window total.
+var segmentListColumns = append(append([]string{}, segmentColumns...), "total")
+
+// upsertColumns mirrors what CreateEffort's upsert returns.
+var upsertColumns = []string{
+	"id", "elapsed_seconds", "avg_pace_min_per_km", "avg_heart_rate",
+	"max_speed_kmh", "recorded_at", "inserted", "display_name",
+}
+
+// pgxArgs lets sqlmock accept the slice arguments pgx encodes natively
+// (e.g. []string for ANY($1)), which database/sql's default converter rejects.
+type pgxArgs struct{}
+
+func (pgxArgs) ConvertValue(v interface{}) (driver.Value, error) {
+	switch v.(type) {
+	case []string, []float64:
+		return v, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+func newMockRepo(t *testing.T) (*segments.Repository, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(pgxArgs{}))
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return segments.NewRepository(db, zap.NewNop()), mock
+}
+
+func TestSegmentVisibility(t *testing.T) {
+	owner := "owner-1"
+	tests := []struct {
+		visibility string
+		viewer     string
+		wantView   bool
+	}{
+		{segments.VisibilityPublic, "someone-else", true},
+		{segments.VisibilityPublic, "", true},
+		{segments.VisibilityUnlisted, "someone-else", true},
+		{segments.VisibilityUnlisted, "", true},
+		{segments.VisibilityUnlisted, owner, true},
+		{segments.VisibilityPrivate, "someone-else", false},
+		{segments.VisibilityPrivate, "", false},
+		{segments.VisibilityPrivate, owner, true},
+	}
+
+	for _, tt := range tests {
+		name := tt.visibility + "/viewer=" + tt.viewer
+		t.Run(name, func(t *testing.T) {
+			s := segments.Segment{CreatorID: &owner, Visibility: tt.visibility}
+			if got := s.VisibleTo(tt.viewer); got != tt.wantView {
+				t.Errorf("VisibleTo: got %v, want %v", got, tt.wantView)
+			}
+		})
+	}
+}
+
+func TestListSegments_FiltersByViewerVisibility(t *testing.T) {
+	repo, mock := newMockRepo(t)
+
+	mock.ExpectQuery(`WHERE \(visibility = 'public' OR creator_id = NULLIF\(\$1, ''\)::uuid\)\s+ORDER BY total_attempts DESC, id\s+LIMIT \$2 OFFSET \$3`).
+		WithArgs("viewer-1", 100, 0).
+		WillReturnRows(sqlmock.NewRows(segmentListColumns).
+			AddRow("s1", "other", "Park Loop", nil, 3000.0, nil, true, "run", "public", 50, 20, time.Now(), "", 0, 2).
+			AddRow("s2", "viewer-1", "My Hill", nil, 800.0, 72.0, false, "run", "private", 3, 1, time.Now(), "4", 0, 2))
+
+	got, total, err := repo.ListSegments(context.Background(), "viewer-1", nil, nil, nil, 100, 0)
+	if err != nil {
+		t.Fatalf("ListSegments: %v", err)
+	}
+	if len(got) != 2 || got[1].Visibility != "private" || got[1].Category != "4" || total != 2 {
+		t.Errorf("unexpected segments: %+v (total %d)", got, total)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListSegments_ProximityKeepsVisibilityFilter(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	lat, lng, radius := 28.6139, 77.2090, 5.0
+
+	mock.ExpectQuery(`visibility = 'public' OR creator_id = NULLIF\(\$1, ''\)::uuid\)\s+AND ST_DWithin`).
+		WithArgs("", lng, lat, radius*1000, 100, 0).
+		WillReturnRows(sqlmock.NewRows(segmentListColumns))
+
+	if _, _, err := repo.ListSegments(context.Background(), "", &lat, &lng, &radius, 100, 0); err != nil {
+		t.Fatalf("ListSegments: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// effortColumns mirrors the leaderboard/KOM select order.
+var effortColumns = []string{
+	"id", "segment_id", "activity_id", "user_id",
+	"elapsed_seconds", "avg_pace_min_per_km",
+	"avg_heart_rate", "max_speed_kmh", "recorded_at",
+	"display_name",
+}
+
+// leaderboardColumns is effortColumns plus the window total.
+var leaderboardColumns = append(append([]string{}, effortColumns...), "total")
+
+func TestGetRecordHolder_NoEfforts(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	mock.ExpectQuery("FROM segment_efforts").
+		WithArgs("seg-1").
+		WillReturnRows(sqlmock.NewRows(effortColumns))
+
+	got, err := repo.GetRecordHolder(context.Background(), "seg-1")
+	if err != nil {
+		t.Fatalf("GetRecordHolder: %v", err)
+	}
+	if got != nil {
+		t.Errorf("expected nil, got %+v", got)
+	}
+}
+
+func TestMatchActivityToSegments_Direction(t *testing.T) {
+	// sqlmock can't evaluate PostGIS, so this pins the predicate itself: the
+	// segment's start must be located before its end along the activity
+	// route, unless $3 (allowReverse) short-circuits it.
+	direction := regexp.QuoteMeta(`AND ($3 OR ST_LineLocatePoint(a.route_path::geometry, ST_StartPoint(s.segment_path::geometry))
+		           < ST_LineLocatePoint(a.route_path::geometry, ST_EndPoint(s.segment_path::geometry)))`)
+
+	for name, allowReverse := range map[string]bool{"forward only": false, "reverse allowed": true} {
+		t.Run(name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			mock.ExpectQuery(direction).
+				WithArgs("act-1", 25, allowReverse).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			if _, err := repo.MatchActivityToSegments(context.Background(), "act-1", 25, allowReverse); err != nil {
+				t.Fatalf("MatchActivityToSegments: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestMatchQueries_OrderBySegmentID(t *testing.T) {
+	// Recording efforts locks each matched segment in turn, so matches must
+	// come back in one global order for concurrent uploads not to deadlock.
+	repo, mock := newMockRepo(t)
+	mock.ExpectQuery(`ORDER BY s\.id$`).
+		WithArgs("act-1", 25, false).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`ORDER BY s\.id$`).
+		WithArgs("act-1", 25).
+		WillReturnRows(sqlmock.NewRows(matchColumns))
+	mock.ExpectQuery(`ORDER BY id$`).
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "distance_meters", "segment_path"}))
+
+	if _, err := repo.MatchActivityToSegments(context.Background(), "act-1", 25, false); err != nil {
+		t.Fatalf("MatchActivityToSegments: %v", err)
+	}
+	if _, err := repo.MatchWithTiming(context.Background(), "act-1", 25); err != nil {
+		t.Fatalf("MatchWithTiming: %v", err)
+	}
+	if _, err := repo.SegmentRoutes(context.Background(), "user-1"); err != nil {
+		t.Fatalf("SegmentRoutes: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetLeaderboard_BestEffortPerAthlete(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	recorded := time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC)
+
+	// Seeded: fast-user has 240s and 250s efforts, other-user 260s. The
+	// DISTINCT ON subquery keeps fast-user's 240s only, so the database
+	// returns two rows.
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT DISTINCT ON (se.user_id)")+
+		`(?s).*`+regexp.QuoteMeta("ORDER BY se.user_id, se.elapsed_seconds ASC, se.recorded_at ASC")+
+		`.*`+regexp.QuoteMeta("ORDER BY elapsed_seconds ASC, recorded_at ASC")).
+		WithArgs("seg-1", "", 50, 0).
+		WillReturnRows(sqlmock.NewRows(leaderboardColumns).
+			AddRow("e1", "seg-1", "a1", "fast-user", 240, 4.0, nil, nil, recorded, "Speedy", 2).
+			AddRow("e3", "seg-1", "a3", "other-user", 260, 4.3, nil, nil, recorded, nil, 2))
+
+	board, _, err := repo.GetLeaderboard(context.Background(), "seg-1", "", 50, 0, segments.LeaderboardFilter{})
+	if err != nil {
+		t.Fatalf("GetLeaderboard: %v", err)
+	}
+	if len(board) != 2 || board[0].ID != "e1" {
+		t.Fatalf("expected fast-user's best effort first, got %+v", board)
+	}
+	if board[0].Rank == nil || *board[0].Rank != 1 || board[1].Rank == nil || *board[1].Rank != 2 {
+		t.Errorf("expected ranks 1 and 2, got %v and %v", board[0].Rank, board[1].Rank)
+	}
+	if board[0].DisplayName == nil || *board[0].DisplayName != "Speedy" {
+		t.Errorf("expected display name, got %v", board[0].DisplayName)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetLeaderboard_Pagination(t *testing.T) {
+	recorded := time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC)
+
+	t.Run("second page ranks continue from offset", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery(regexp.QuoteMeta("LIMIT $3 OFFSET $4")).
+			WithArgs("seg-1", "", 2, 2).
+			WillReturnRows(sqlmock.NewRows(leaderboardColumns).
+				AddRow("e3", "seg-1", "a3", "user-3", 300, 5.0, nil, nil, recorded, nil, 5).
+				AddRow("e4", "seg-1", "a4", "user-4", 320, 5.3, nil, nil, recorded, nil, 5))
+
+		board, total, err := repo.GetLeaderboard(context.Background(), "seg-1", "", 2, 2, segments.LeaderboardFilter{})
+		if err != nil {
+			t.Fatalf("GetLeaderboard: %v", err)
+		}
+		if total != 5 {
+			t.Errorf("expected total 5, got %d", total)
+		}
+		if len(board) != 2 || *board[0].Rank != 3 || *board[1].Rank != 4 {
+			t.Fatalf("expected ranks 3 and 4, got %+v", board)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("page past the end still reports total", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery(regexp.QuoteMeta("LIMIT $3 OFFSET $4")).
+			WithArgs("seg-1", "", 2, 10).
+			WillReturnRows(sqlmock.NewRows(leaderboardColumns))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM (")).
+			WithArgs("seg-1", "").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+
+		board, total, err := repo.GetLeaderboard(context.Background(), "seg-1", "", 2, 10, segments.LeaderboardFilter{})
+		if err != nil {
+			t.Fatalf("GetLeaderboard: %v", err)
+		}
+		if len(board) != 0 || total != 5 {
+			t.Errorf("expected empty page with total 5, got %d entries, total %d", len(board), total)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestMatchWithTiming_QueryTimeout(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	repo.SetQueryTimeout(20 * time.Millisecond)
+
+	// A slow ST_LineLocatePoint match that would outlast the timeout.
+	mock.ExpectQuery(regexp.QuoteMeta("ST_LineLocatePoint")).
+		WithArgs("act-1", 25).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "distance_meters", "entry_fraction", "exit_fraction", "segment_path"}))
+
+	start := time.Now()
+	if _, err := repo.MatchWithTiming(context.Background(), "act-1", 25); err == nil {
+		t.Fatal("expected the query to be cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("query ran %v; the 20ms deadline did not fire", elapsed)
+	}
+}
+
+func TestCreateEffort_RollsBackOnCounterFailure(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(pgxArgs{}))
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	core, logs := observer.New(zap.ErrorLevel)
+	repo := segments.NewRepository(db, zap.New(core))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT 1 FROM segments WHERE id = $1 FOR UPDATE")).
+		WithArgs("seg-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO segment_efforts")).
+		WillReturnRows(sqlmock.NewRows(upsertColumns).AddRow("eff-1", 150, 5.0, nil, nil, time.Now(), true, "Runner"))
+	mock.ExpectExec(regexp.QuoteMeta("SELECT COUNT(*) AS attempts, COUNT(DISTINCT se.user_id) AS athletes")).
+		WithArgs("seg-1").
+		WillReturnError(errors.New("deadlock detected"))
+	// Rolled back, not committed: the effort must not be left orphaned.
+	mock.ExpectRollback()
+
+	effort := &segments.SegmentEffort{SegmentID: "seg-1", ActivityID: "act-1", UserID: "user-1", ElapsedSeconds: 150}
+	if _, err := repo.CreateEffort(context.Background(), effort); err == nil {
+		t.Fatal("expected the counter failure to surface")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if logs.FilterMessage("update segment counters").Len() != 1 {
+		t.Errorf("expected the counter failure to be logged, got %v", logs.All())
+	}
+}
+
+func TestRecomputeSegmentCounters(t *testing.T) {
+	recount := regexp.QuoteMeta("SET total_attempts = counts.attempts")
+
+	t.Run("repairs counters", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectExec(recount).WithArgs("seg-1").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := repo.RecomputeSegmentCounters(context.Background(), "seg-1"); err != nil {
+			t.Fatalf("RecomputeSegmentCounters: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("unknown segment", func(t *testing.T) {
+		repo, mock := newMockRepo(t)
+		mock.ExpectExec(recount).WithArgs("seg-x").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if err := repo.RecomputeSegmentCounters(context.Background(), "seg-x"); err != sql.ErrNoRows {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+	})
+}
+
+func TestEffortReads_SkipSoftDeletedActivities(t *testing.T) {
+	live := regexp.QuoteMeta("JOIN activities a ON a.id = se.activity_id AND a.deleted_at IS NULL")
+
+	tests := []struct {
+		name   string
+		expect func(mock sqlmock.Sqlmock)
+		call   func(repo *segments.Repository) error
+	}{
+		{
+			name: "leaderboard",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(live).WillReturnRows(sqlmock.NewRows(leaderboardColumns))
+			},
+			call: func(repo *segments.Repository) error {
+				_, _, err := repo.GetLeaderboard(context.Background(), "seg-1", "", 50, 0, segments.LeaderboardFilter{})
+				return err
+			},
+		},
+		{
+			name: "record holder",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(live).WillReturnRows(sqlmock.NewRows(effortColumns))
+			},
+			call: func(repo *segments.Repository) error {
+				_, err := repo.GetRecordHolder(context.Background(), "seg-1")
+				return err
+			},
+		},
+		{
+			name: "user efforts",
+			expect: func(mock sqlmock.Sqlmock) {
+				// The rank subquery only counts live rivals too.
+				mock.ExpectQuery(regexp.QuoteMeta("JOIN activities oa ON oa.id = o.activity_id AND oa.deleted_at IS NULL") + "(?s).*" + live).
+					WillReturnRows(sqlmock.NewRows(append(append([]string{}, effortColumns...), "rank")))
+			},
+			call: func(repo *segments.Repository) error {
+				_, err := repo.GetUserEfforts(context.Background(), "seg-1", "user-1")
+				return err
+			},
+		},
+		{
+			name: "counters",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(live).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func(repo *segments.Repository) error {
+				return repo.RecomputeSegmentCounters(context.Background(), "seg-1")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock := newMockRepo(t)
+			tt.expect(mock)
+
+			if err := tt.call(repo); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCreateEffort_Rematch(t *testing.T) {
+	upsert := regexp.QuoteMeta("ON CONFLICT (segment_id, activity_id) DO UPDATE SET")
+	recorded := time.Date(2026, 5, 1, 7, 0, 0, 0, time.UTC)
+
+	repo, mock := newMockRepo(t)
+	// First match inserts and recounts.
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("FOR UPDATE")).WithArgs("seg-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(upsert).
+		WithArgs("seg-1", "act-1", "user-1", 150, 5.0, nil, nil, recorded).
+		WillReturnRows(sqlmock.NewRows(upsertColumns).AddRow("eff-1", 150, 5.0, nil, nil, recorded, true, "Runner"))
+	mock.ExpectExec(regexp.QuoteMeta("SET total_attempts = counts.attempts")).
+		WithArgs("seg-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	// A slower re-match hits the existing effort, which keeps its time; no
+	// recount follows.
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("FOR UPDATE")).WithArgs("seg-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(upsert).
+		WithArgs("seg-1", "act-1", "user-1", 170, 5.67, nil, nil, recorded.Add(time.Second)).
+		WillReturnRows(sqlmock.NewRows(upsertColumns).AddRow("eff-1", 150, 5.0, nil, nil, recorded, false, "Runner"))
+	mock.ExpectCommit()
+
+	first := &segments.SegmentEffort{SegmentID: "seg-1", ActivityID: "act-1", UserID: "user-1",
+		ElapsedSeconds: 150, AvgPaceMinPerKm: 5.0, RecordedAt: recorded}
+	if _, err := repo.CreateEffort(context.Background(), first); err != nil {
+		t.Fatalf("first CreateEffort: %v", err)
+	}
+	again := &segments.SegmentEffort{SegmentID: "seg-1", ActivityID: "act-1", UserID: "user-1",
+		ElapsedSeconds: 170, AvgPaceMinPerKm: 5.67, RecordedAt: recorded.Add(time.Second)}
+	if _, err := repo.CreateEffort(context.Background(), again); err != nil {
+		t.Fatalf("second CreateEffort: %v", err)
+	}
+
+	if again.ID != first.ID || again.ElapsedSeconds != 150 || !again.RecordedAt.Equal(recorded) {
+		t.Errorf("expected the kept faster effort eff-1 at 150s, got %s at %ds", again.ID, again.ElapsedSeconds)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
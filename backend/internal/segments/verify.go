@@ -0,0 +1,41 @@
+package segments
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/internal/auth"
+)
+
+// Verify handles POST /api/v1/admin/segments/:id/verify
+func (h *Handler) Verify(c *gin.Context) {
+	h.setVerified(c, true)
+}
+
+// Unverify handles POST /api/v1/admin/segments/:id/unverify
+func (h *Handler) Unverify(c *gin.Context) {
+	h.setVerified(c, false)
+}
+
+func (h *Handler) setVerified(c *gin.Context, verified bool) {
+	adminID, ok := auth.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	segment, err := h.repo.SetVerified(c.Request.Context(), c.Param("id"), adminID, verified)
+	if err != nil {
+		h.logger.Error("set segment verified", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+	if segment == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "segment not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, segment)
+}
@@ -202,76 +202,93 @@ ALTER TABLE public.segments ENABLE ROW LEVEL SECURITY;
 ALTER TABLE public.segment_efforts ENABLE ROW LEVEL SECURITY;
 ALTER TABLE public.planned_workouts ENABLE ROW LEVEL SECURITY;
 
+-- Policies and triggers are dropped before being created so the file
+-- re-applies cleanly on databases that were set up by hand.
+
 -- User Profiles
+DROP POLICY IF EXISTS "Anyone can view public user profiles" ON public.user_profiles;
 CREATE POLICY "Anyone can view public user profiles"
   ON public.user_profiles
   FOR SELECT
   USING (true);
 
+DROP POLICY IF EXISTS "Users can update own profile" ON public.user_profiles;
 CREATE POLICY "Users can update own profile"
   ON public.user_profiles
   FOR UPDATE
   USING (auth.uid() = id);
 
+DROP POLICY IF EXISTS "Users can insert own profile" ON public.user_profiles;
 CREATE POLICY "Users can insert own profile"
   ON public.user_profiles
   FOR INSERT
   WITH CHECK (auth.uid() = id);
 
 -- Activities
+DROP POLICY IF EXISTS "Users can view public activities" ON public.activities;
 CREATE POLICY "Users can view public activities"
   ON public.activities
   FOR SELECT
   USING (is_private = FALSE OR auth.uid() = user_id);
 
+DROP POLICY IF EXISTS "Users can insert own activities" ON public.activities;
 CREATE POLICY "Users can insert own activities"
   ON public.activities
   FOR INSERT
   WITH CHECK (auth.uid() = user_id);
 
+DROP POLICY IF EXISTS "Users can update own activities" ON public.activities;
 CREATE POLICY "Users can update own activities"
   ON public.activities
   FOR UPDATE
   USING (auth.uid() = user_id);
 
+DROP POLICY IF EXISTS "Users can delete own activities" ON public.activities;
 CREATE POLICY "Users can delete own activities"
   ON public.activities
   FOR DELETE
   USING (auth.uid() = user_id);
 
 -- Segments
+DROP POLICY IF EXISTS "Anyone can view segments" ON public.segments;
 CREATE POLICY "Anyone can view segments"
   ON public.segments
   FOR SELECT
   USING (true);
 
+DROP POLICY IF EXISTS "Authenticated users can create segments" ON public.segments;
 CREATE POLICY "Authenticated users can create segments"
   ON public.segments
   FOR INSERT
   WITH CHECK (auth.uid() IS NOT NULL);
 
+DROP POLICY IF EXISTS "Creators can update own segments" ON public.segments;
 CREATE POLICY "Creators can update own segments"
   ON public.segments
   FOR UPDATE
   USING (auth.uid() = creator_id);
 
 -- Segment Efforts
+DROP POLICY IF EXISTS "Anyone can view segment efforts" ON public.segment_efforts;
 CREATE POLICY "Anyone can view segment efforts"
   ON public.segment_efforts
   FOR SELECT
   USING (true);
 
+DROP POLICY IF EXISTS "Users can create own efforts" ON public.segment_efforts;
 CREATE POLICY "Users can create own efforts"
   ON public.segment_efforts
   FOR INSERT
   WITH CHECK (auth.uid() = user_id);
 
 -- Planned Workouts
+DROP POLICY IF EXISTS "Users can view own workouts" ON public.planned_workouts;
 CREATE POLICY "Users can view own workouts"
   ON public.planned_workouts
   FOR SELECT
   USING (auth.uid() = user_id);
 
+DROP POLICY IF EXISTS "Users can manage own workouts" ON public.planned_workouts;
 CREATE POLICY "Users can manage own workouts"
   ON public.planned_workouts
   FOR ALL
@@ -291,21 +308,25 @@ END;
 $$ LANGUAGE plpgsql;
 
 -- Triggers for updated_at
+DROP TRIGGER IF EXISTS update_user_profiles_updated_at ON public.user_profiles;
 CREATE TRIGGER update_user_profiles_updated_at
   BEFORE UPDATE ON public.user_profiles
   FOR EACH ROW
   EXECUTE FUNCTION update_updated_at_column();
 
+DROP TRIGGER IF EXISTS update_activities_updated_at ON public.activities;
 CREATE TRIGGER update_activities_updated_at
   BEFORE UPDATE ON public.activities
   FOR EACH ROW
   EXECUTE FUNCTION update_updated_at_column();
 
+DROP TRIGGER IF EXISTS update_segments_updated_at ON public.segments;
 CREATE TRIGGER update_segments_updated_at
   BEFORE UPDATE ON public.segments
   FOR EACH ROW
   EXECUTE FUNCTION update_updated_at_column();
 
+DROP TRIGGER IF EXISTS update_planned_workouts_updated_at ON public.planned_workouts;
 CREATE TRIGGER update_planned_workouts_updated_at
   BEFORE UPDATE ON public.planned_workouts
   FOR EACH ROW
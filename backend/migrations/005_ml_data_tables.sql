@@ -70,14 +70,17 @@ ALTER TABLE hrv_readings ENABLE ROW LEVEL SECURITY;
 ALTER TABLE training_load_history ENABLE ROW LEVEL SECURITY;
 
 -- Policies: Users can only read/write their own data
+DROP POLICY IF EXISTS "Users can manage their form analysis" ON form_analysis_results;
 CREATE POLICY "Users can manage their form analysis"
     ON form_analysis_results FOR ALL
     USING (auth.uid() = user_id);
 
+DROP POLICY IF EXISTS "Users can manage their HRV data" ON hrv_readings;
 CREATE POLICY "Users can manage their HRV data"
     ON hrv_readings FOR ALL
     USING (auth.uid() = user_id);
 
+DROP POLICY IF EXISTS "Users can manage their training load" ON training_load_history;
 CREATE POLICY "Users can manage their training load"
     ON training_load_history FOR ALL
     USING (auth.uid() = user_id);
@@ -0,0 +1,21 @@
+-- Migration: Server-to-server API keys
+-- Long-lived keys for internal services (e.g. analytics). Only the SHA-256 hash
+-- of each key is stored; the plaintext is shown once at creation time.
+
+CREATE TABLE IF NOT EXISTS public.api_keys (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name TEXT NOT NULL,
+  key_hash TEXT NOT NULL UNIQUE, -- hex-encoded SHA-256 of the plaintext key
+  scopes TEXT[] NOT NULL DEFAULT '{}', -- allowed route prefixes (read-only)
+  created_by UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+  last_used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Active key lookup by hash
+CREATE INDEX IF NOT EXISTS idx_api_keys_hash_active
+  ON public.api_keys (key_hash) WHERE revoked_at IS NULL;
+
+-- Only the service role (backend) may read or manage keys
+ALTER TABLE public.api_keys ENABLE ROW LEVEL SECURITY;
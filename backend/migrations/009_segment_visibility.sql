@@ -0,0 +1,12 @@
+-- Migration: Segment visibility
+-- public:   listed and discoverable by everyone (default, existing behavior)
+-- unlisted: reachable by direct ID/link, excluded from lists and discovery
+-- private:  visible only to the creator
+
+ALTER TABLE public.segments
+  ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'unlisted', 'private'));
+
+-- Listing only scans public segments plus the viewer's own
+CREATE INDEX IF NOT EXISTS idx_segments_visibility_creator
+  ON public.segments (visibility, creator_id);
@@ -0,0 +1,6 @@
+-- Migration: Threshold pace on user profiles
+-- Lactate-threshold pace (seconds per km) used to bucket training by pace zone
+-- for athletes without a heart-rate strap.
+
+ALTER TABLE public.user_profiles
+  ADD COLUMN IF NOT EXISTS threshold_pace_sec_per_km FLOAT CHECK (threshold_pace_sec_per_km > 0);
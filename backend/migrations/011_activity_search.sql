@@ -0,0 +1,6 @@
+-- Migration: Full-text search over activity name and description
+-- Expression must match activities.Repository.Search exactly for the index to be used.
+
+CREATE INDEX IF NOT EXISTS idx_activities_search
+  ON public.activities
+  USING GIN (to_tsvector('english', activity_name || ' ' || COALESCE(description, '')));
@@ -0,0 +1,14 @@
+-- Soft delete for activities: Delete sets deleted_at, reads filter it out,
+-- and rows are purged permanently after the 30-day restore window.
+ALTER TABLE public.activities
+  ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Most reads are for live rows of one user.
+CREATE INDEX IF NOT EXISTS idx_activities_user_live
+  ON public.activities(user_id, start_time DESC)
+  WHERE deleted_at IS NULL;
+
+-- Purge job scans soft-deleted rows only.
+CREATE INDEX IF NOT EXISTS idx_activities_deleted_at
+  ON public.activities(deleted_at)
+  WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,8 @@
+-- Public share links: an unguessable token on the activity grants read-only,
+-- unauthenticated access via GET /api/v1/public/activities/:token.
+ALTER TABLE public.activities
+  ADD COLUMN IF NOT EXISTS share_token TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_activities_share_token
+  ON public.activities(share_token)
+  WHERE share_token IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Weather at activity start (temperature_c, humidity_pct, wind_speed_kmh),
+-- filled best-effort on create when ENABLE_WEATHER_ENRICHMENT is set.
+ALTER TABLE public.activities
+  ADD COLUMN IF NOT EXISTS weather JSONB;
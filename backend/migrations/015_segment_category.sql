@@ -0,0 +1,23 @@
+-- Climb category (HC, 1-4) from the climb score distance_m × grade%, set on
+-- create by utils.CategorizeClimb. NULL for non-climbs.
+ALTER TABLE public.segments
+  ADD COLUMN IF NOT EXISTS category TEXT
+    CHECK (category IN ('HC', '1', '2', '3', '4'));
+
+-- Backfill with the same thresholds (grade >= 3%).
+UPDATE public.segments
+SET category = CASE
+    WHEN score >= 80000 THEN 'HC'
+    WHEN score >= 64000 THEN '1'
+    WHEN score >= 32000 THEN '2'
+    WHEN score >= 16000 THEN '3'
+    WHEN score >= 8000  THEN '4'
+  END
+FROM (
+  SELECT id AS seg_id, elevation_gain_meters * 100 AS score
+  FROM public.segments
+  WHERE elevation_gain_meters > 0
+    AND distance_meters > 0
+    AND elevation_gain_meters / distance_meters >= 0.03
+) s
+WHERE segments.id = s.seg_id AND segments.category IS NULL;
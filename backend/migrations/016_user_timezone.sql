@@ -0,0 +1,6 @@
+-- Migration: User timezone
+-- IANA zone name (e.g. 'Asia/Kolkata') used to decide which calendar day an
+-- activity falls on when counting streaks. NULL means UTC.
+
+ALTER TABLE public.user_profiles
+  ADD COLUMN IF NOT EXISTS timezone TEXT;
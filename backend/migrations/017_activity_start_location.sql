@@ -0,0 +1,4 @@
+-- "City, Country" label for an activity's start point, filled best-effort
+-- on create when ENABLE_REVERSE_GEOCODING is set.
+ALTER TABLE public.activities
+  ADD COLUMN IF NOT EXISTS start_location TEXT;
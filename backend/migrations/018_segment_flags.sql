@@ -0,0 +1,19 @@
+-- Hazard reports on segments (e.g. crossing a busy road) for moderation.
+-- One flag per user per segment; segments.flag_count is maintained by the
+-- API in the same statement that inserts the flag.
+CREATE TABLE IF NOT EXISTS public.segment_flags (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  segment_id UUID NOT NULL REFERENCES public.segments(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+  reason TEXT NOT NULL CHECK (char_length(reason) BETWEEN 3 AND 500),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (segment_id, user_id)
+);
+
+ALTER TABLE public.segments
+  ADD COLUMN IF NOT EXISTS flag_count INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_segments_flagged
+  ON public.segments (flag_count DESC) WHERE flag_count > 0;
+
+ALTER TABLE public.segment_flags ENABLE ROW LEVEL SECURITY;
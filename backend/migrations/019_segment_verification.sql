@@ -0,0 +1,10 @@
+-- Admin verification of segments. is_verified existed since the initial
+-- schema but was never set; record who verified a segment and when.
+-- Unverifying clears both.
+UPDATE public.segments SET is_verified = FALSE WHERE is_verified IS NULL;
+
+ALTER TABLE public.segments
+  ALTER COLUMN is_verified SET DEFAULT FALSE,
+  ALTER COLUMN is_verified SET NOT NULL,
+  ADD COLUMN IF NOT EXISTS verified_by UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+  ADD COLUMN IF NOT EXISTS verified_at TIMESTAMPTZ;
@@ -0,0 +1,45 @@
+-- Segment counters ignore efforts on soft-deleted activities, matching the
+-- effort reads. Deleting or restoring an activity recounts every segment it
+-- has an effort on, in the same transaction, using the query in the
+-- segments repository's recomputeCounters.
+CREATE OR REPLACE FUNCTION recount_activity_segments()
+RETURNS TRIGGER AS $$
+BEGIN
+  UPDATE public.segments s
+  SET total_attempts = counts.attempts,
+      unique_athletes = counts.athletes
+  FROM (
+    SELECT se.segment_id,
+           COUNT(a.id) AS attempts,
+           COUNT(DISTINCT se.user_id) FILTER (WHERE a.id IS NOT NULL) AS athletes
+    FROM public.segment_efforts se
+    LEFT JOIN public.activities a ON a.id = se.activity_id AND a.deleted_at IS NULL
+    WHERE se.segment_id IN (
+      SELECT segment_id FROM public.segment_efforts WHERE activity_id = NEW.id
+    )
+    GROUP BY se.segment_id
+  ) counts
+  WHERE s.id = counts.segment_id;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS recount_segments_on_soft_delete ON public.activities;
+CREATE TRIGGER recount_segments_on_soft_delete
+  AFTER UPDATE OF deleted_at ON public.activities
+  FOR EACH ROW
+  WHEN (OLD.deleted_at IS DISTINCT FROM NEW.deleted_at)
+  EXECUTE FUNCTION recount_activity_segments();
+
+-- Repair counters that still include efforts deleted before this migration.
+UPDATE public.segments s
+SET total_attempts = COALESCE(counts.attempts, 0),
+    unique_athletes = COALESCE(counts.athletes, 0)
+FROM public.segments s2
+LEFT JOIN (
+  SELECT se.segment_id, COUNT(*) AS attempts, COUNT(DISTINCT se.user_id) AS athletes
+  FROM public.segment_efforts se
+  JOIN public.activities a ON a.id = se.activity_id AND a.deleted_at IS NULL
+  GROUP BY se.segment_id
+) counts ON counts.segment_id = s2.id
+WHERE s.id = s2.id;
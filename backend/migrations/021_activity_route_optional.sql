@@ -0,0 +1,5 @@
+-- Activities may be stored without a route: manual entries have none, and a
+-- public route lying entirely inside the owner's privacy zone is shrouded
+-- away. Reads already treat a NULL route_path as "no route".
+ALTER TABLE public.activities
+  ALTER COLUMN route_path DROP NOT NULL;
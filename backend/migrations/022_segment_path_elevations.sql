@@ -0,0 +1,6 @@
+-- segment_path is a 2D geography, so elevation profiles had no altitude to
+-- plot. Keep one elevation per segment_path vertex, copied from the source
+-- activity's GPS points when a segment is cut from an activity. NULL when
+-- unknown.
+ALTER TABLE public.segments
+  ADD COLUMN IF NOT EXISTS path_elevations DOUBLE PRECISION[];
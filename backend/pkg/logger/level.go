@@ -0,0 +1,61 @@
+package logger
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// LevelHandler reads and changes the log level at runtime. Mount it behind
+// an admin-only group; anyone who can reach it can flood the logs.
+type LevelHandler struct {
+	level  zap.AtomicLevel
+	logger *zap.Logger
+}
+
+// NewLevelHandler creates a handler for the level returned by NewWithLevel.
+func NewLevelHandler(level zap.AtomicLevel, logger *zap.Logger) *LevelHandler {
+	return &LevelHandler{level: level, logger: logger}
+}
+
+// RegisterRoutes mounts the log level routes on the given RouterGroup.
+func (h *LevelHandler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.GET("/loglevel", h.Get)
+	rg.PUT("/loglevel", h.Set)
+}
+
+// levelRequest is the body of PUT /loglevel.
+type levelRequest struct {
+	Level string `json:"level" binding:"required"`
+}
+
+// Get handles GET /api/v1/admin/loglevel
+func (h *LevelHandler) Get(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"level": h.level.Level().String()})
+}
+
+// Set handles PUT /api/v1/admin/loglevel
+// Accepts {"level": "debug" | "info" | "warn" | "error"}.
+func (h *LevelHandler) Set(c *gin.Context) {
+	var req levelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switch req.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "level must be one of debug, info, warn, error"})
+		return
+	}
+
+	prev := h.level.Level()
+	h.level.SetLevel(parseLevel(req.Level))
+	h.logger.Warn("log level changed",
+		zap.String("from", prev.String()),
+		zap.String("to", req.Level),
+		zap.String("request_id", RequestID(c)),
+	)
+	c.JSON(http.StatusOK, gin.H{"level": req.Level})
+}
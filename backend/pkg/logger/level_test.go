@@ -0,0 +1,91 @@
+package logger_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/apexrun/backend/pkg/logger"
+)
+
+func TestNewWithLevel_AtomicLevelControlsLogger(t *testing.T) {
+	log, level, err := logger.NewWithLevel("json", "info", false, logger.File{})
+	if err != nil {
+		t.Fatalf("NewWithLevel: %v", err)
+	}
+	if log.Core().Enabled(zapcore.DebugLevel) {
+		t.Fatal("debug enabled at info level")
+	}
+	level.SetLevel(zapcore.DebugLevel)
+	if !log.Core().Enabled(zapcore.DebugLevel) {
+		t.Error("debug still disabled after SetLevel(debug)")
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	core, logs := observer.New(level)
+	log := zap.New(core)
+
+	r := gin.New()
+	logger.NewLevelHandler(level, log).RegisterRoutes(r.Group("/admin"))
+
+	do := func(method, body string) (int, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/admin/loglevel", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		var resp struct {
+			Level string `json:"level"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Level
+	}
+	debugLines := func() int {
+		return logs.FilterMessage("probe").FilterLevelExact(zapcore.DebugLevel).Len()
+	}
+
+	if code, lvl := do("GET", ""); code != http.StatusOK || lvl != "info" {
+		t.Fatalf("GET: got %d %q, want 200 info", code, lvl)
+	}
+	log.Debug("probe")
+	if n := debugLines(); n != 0 {
+		t.Fatalf("debug emitted at info level: %d", n)
+	}
+
+	if code, lvl := do("PUT", `{"level":"debug"}`); code != http.StatusOK || lvl != "debug" {
+		t.Fatalf("PUT debug: got %d %q", code, lvl)
+	}
+	log.Debug("probe")
+	if n := debugLines(); n != 1 {
+		t.Fatalf("expected debug emitted after PUT debug, got %d", n)
+	}
+	if _, lvl := do("GET", ""); lvl != "debug" {
+		t.Errorf("GET after PUT: got %q, want debug", lvl)
+	}
+
+	if code, _ := do("PUT", `{"level":"warn"}`); code != http.StatusOK {
+		t.Fatalf("PUT warn: got %d", code)
+	}
+	log.Debug("probe")
+	if n := debugLines(); n != 1 {
+		t.Errorf("expected debug suppressed after PUT warn, got %d", n)
+	}
+
+	for _, body := range []string{`{"level":"verbose"}`, `{}`, `not json`} {
+		if code, _ := do("PUT", body); code != http.StatusBadRequest {
+			t.Errorf("PUT %s: got %d, want 400", body, code)
+		}
+	}
+	if lvl := level.Level(); lvl != zapcore.WarnLevel {
+		t.Errorf("rejected PUTs changed level to %v", lvl)
+	}
+}
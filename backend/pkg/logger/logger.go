@@ -2,26 +2,44 @@ package logger
 
 import (
 	"os"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// Sampling keeps the first samplingFirst identical (same level and
+// message) entries each second, then one in samplingThereafter.
+const (
+	samplingFirst      = 100
+	samplingThereafter = 100
+)
+
+// File configures an optional rotating log file written alongside stdout.
+// An empty Path disables it; zero limits fall back to lumberjack's defaults
+// (100 MB per file, no age or backup limit).
+type File struct {
+	Path       string
+	MaxSizeMB  int // rotate once the file reaches this size
+	MaxAgeDays int // delete rotated files older than this
+	MaxBackups int // keep at most this many rotated files
+}
+
 // New creates a configured *zap.Logger.
 // format: "json" | "console"
 // level:  "debug" | "info" | "warn" | "error"
-func New(format, level string) (*zap.Logger, error) {
-	var lvl zapcore.Level
-	switch level {
-	case "debug":
-		lvl = zap.DebugLevel
-	case "warn":
-		lvl = zap.WarnLevel
-	case "error":
-		lvl = zap.ErrorLevel
-	default:
-		lvl = zap.InfoLevel
-	}
+// sampling: throttle repeated entries below error level (see samplingFirst)
+// file: also write to a rotating file when file.Path is set
+func New(format, level string, sampling bool, file File) (*zap.Logger, error) {
+	log, _, err := NewWithLevel(format, level, sampling, file)
+	return log, err
+}
+
+// NewWithLevel is New, but also returns the logger's AtomicLevel so the
+// level can be changed at runtime (see LevelHandler).
+func NewWithLevel(format, level string, sampling bool, file File) (*zap.Logger, zap.AtomicLevel, error) {
+	lvl := zap.NewAtomicLevelAt(parseLevel(level))
 
 	var encoder zapcore.Encoder
 	encoderCfg := zap.NewProductionEncoderConfig()
@@ -35,6 +53,48 @@ func New(format, level string) (*zap.Logger, error) {
 		encoder = zapcore.NewJSONEncoder(encoderCfg)
 	}
 
-	core := zapcore.NewCore(encoder, zapcore.AddSync(os.Stdout), lvl)
-	return zap.New(core, zap.AddCaller(), zap.AddStacktrace(zap.ErrorLevel)), nil
+	core := newCore(encoder, zapcore.AddSync(os.Stdout), lvl, sampling)
+	if file.Path != "" {
+		rotator := &lumberjack.Logger{
+			Filename:   file.Path,
+			MaxSize:    file.MaxSizeMB,
+			MaxAge:     file.MaxAgeDays,
+			MaxBackups: file.MaxBackups,
+		}
+		core = zapcore.NewTee(core, newCore(encoder.Clone(), zapcore.AddSync(rotator), lvl, sampling))
+	}
+	return zap.New(core, zap.AddCaller(), zap.AddStacktrace(zap.ErrorLevel)), lvl, nil
+}
+
+// newCore writes entries enabled by lvl to out, optionally sampled.
+func newCore(encoder zapcore.Encoder, out zapcore.WriteSyncer, lvl zap.AtomicLevel, sampling bool) zapcore.Core {
+	if !sampling {
+		return zapcore.NewCore(encoder, out, lvl)
+	}
+	// Errors bypass the sampler so none are dropped during an incident.
+	belowError := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l < zap.ErrorLevel && lvl.Enabled(l)
+	})
+	atLeastError := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l >= zap.ErrorLevel && lvl.Enabled(l)
+	})
+	return zapcore.NewTee(
+		zapcore.NewSamplerWithOptions(zapcore.NewCore(encoder, out, belowError),
+			time.Second, samplingFirst, samplingThereafter),
+		zapcore.NewCore(encoder.Clone(), out, atLeastError),
+	)
+}
+
+// parseLevel maps a configured level name to a zap level, defaulting to info.
+func parseLevel(level string) zapcore.Level {
+	switch level {
+	case "debug":
+		return zap.DebugLevel
+	case "warn":
+		return zap.WarnLevel
+	case "error":
+		return zap.ErrorLevel
+	default:
+		return zap.InfoLevel
+	}
 }
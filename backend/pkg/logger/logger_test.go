@@ -0,0 +1,96 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/apexrun/backend/pkg/logger"
+)
+
+func TestNew_Sampling(t *testing.T) {
+	const n = 1000
+
+	tests := []struct {
+		name     string
+		sampling bool
+	}{
+		{"sampling off", false},
+		{"sampling on", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The logger writes to os.Stdout; capture it through a pipe.
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			stdout := os.Stdout
+			os.Stdout = w
+			log, err := logger.New("json", "info", tt.sampling, logger.File{})
+			os.Stdout = stdout
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			out := make(chan []byte)
+			go func() {
+				data, _ := io.ReadAll(r)
+				out <- data
+			}()
+			for i := 0; i < n; i++ {
+				log.Info("database unreachable, retrying")
+				log.Error("query failed")
+			}
+			_ = log.Sync()
+			w.Close()
+			data := <-out
+
+			infos := bytes.Count(data, []byte("database unreachable, retrying"))
+			errs := bytes.Count(data, []byte("query failed"))
+			if errs != n {
+				t.Errorf("errors emitted = %d, want all %d", errs, n)
+			}
+			if tt.sampling && infos >= n {
+				t.Errorf("infos emitted = %d, want fewer than %d with sampling", infos, n)
+			}
+			if !tt.sampling && infos != n {
+				t.Errorf("infos emitted = %d, want %d without sampling", infos, n)
+			}
+		})
+	}
+}
+
+func TestNew_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "api.log")
+	log, err := logger.New("json", "info", false, logger.File{Path: path, MaxSizeMB: 1})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	log.Info("written to file", zap.String("activity_id", "a1"))
+	log.Debug("below level")
+	_ = log.Sync()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log file: %v", err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line in log file, got %d:\n%s", len(lines), data)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(lines[0], &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v: %s", err, lines[0])
+	}
+	if entry["msg"] != "written to file" || entry["activity_id"] != "a1" || entry["level"] != "INFO" {
+		t.Errorf("unexpected entry: %v", entry)
+	}
+}
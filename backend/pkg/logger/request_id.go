@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderRequestID carries a request's correlation id in both directions.
+const HeaderRequestID = "X-Request-ID"
+
+// ContextKeyRequestID is the gin context key for the request's correlation id.
+const ContextKeyRequestID = "requestID"
+
+// maxRequestIDLength bounds client-supplied ids so they can't bloat logs.
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware tags each request with a correlation id: the incoming
+// X-Request-ID when it is a sane token, otherwise a generated UUID. The id
+// is stored in the gin context and echoed in the response header so log
+// lines can be tied back to a client's request.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderRequestID)
+		if !validRequestID(id) {
+			id = newUUID()
+		}
+		c.Set(ContextKeyRequestID, id)
+		c.Header(HeaderRequestID, id)
+		c.Next()
+	}
+}
+
+// RequestID returns the request's correlation id, or "" if
+// RequestIDMiddleware didn't run. Handlers attach it to their own log lines
+// with zap.String("request_id", logger.RequestID(c)).
+func RequestID(c *gin.Context) string {
+	return c.GetString(ContextKeyRequestID)
+}
+
+// validRequestID accepts non-empty printable ASCII without spaces, so a
+// client can't inject newlines or control characters into log output.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("request id: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,63 @@
+package logger_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/apexrun/backend/pkg/logger"
+)
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func newRequestIDRouter(seen *string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(logger.RequestIDMiddleware())
+	r.GET("/ping", func(c *gin.Context) {
+		*seen = logger.RequestID(c)
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		wantEcho bool
+	}{
+		{"incoming id round-trips", "client-trace-123", true},
+		{"missing id is generated", "", false},
+		{"unsafe id is replaced", "bad id\nforged log line", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			r := newRequestIDRouter(&seen)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/ping", nil)
+			if tt.incoming != "" {
+				req.Header.Set(logger.HeaderRequestID, tt.incoming)
+			}
+			r.ServeHTTP(w, req)
+
+			got := w.Header().Get(logger.HeaderRequestID)
+			if got != seen {
+				t.Errorf("response header %q differs from context id %q", got, seen)
+			}
+			if tt.wantEcho {
+				if got != tt.incoming {
+					t.Errorf("expected %q echoed, got %q", tt.incoming, got)
+				}
+			} else if !uuidV4.MatchString(got) {
+				t.Errorf("expected a generated UUID, got %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package utils
+
+// StandardDistance is a named race distance used for best-effort extraction.
+type StandardDistance struct {
+	Name   string
+	Meters float64
+}
+
+// StandardDistances are the distances reported as best efforts, shortest first.
+var StandardDistances = []StandardDistance{
+	{Name: "1k", Meters: 1000},
+	{Name: "1mi", Meters: 1609.344},
+	{Name: "5k", Meters: 5000},
+	{Name: "10k", Meters: 10000},
+}
+
+// BestEffort is the fastest continuous stretch of a route covering a distance.
+type BestEffort struct {
+	Name                string  `json:"name"`
+	DistanceMeters      float64 `json:"distance_meters"`
+	ElapsedSeconds      float64 `json:"elapsed_seconds"`
+	StartOffsetSeconds  float64 `json:"start_offset_seconds"`
+	StartDistanceMeters float64 `json:"start_distance_meters"`
+}
+
+// BestEfforts slides a window over a timestamped route and returns the fastest
+// segment covering each of the given distances. The window start is
+// interpolated between points so every effort covers exactly the target
+// distance. Distances longer than the route are omitted, as are all efforts
+// when the route lacks timestamps.
+func BestEfforts(route []GPSPoint, distances []StandardDistance) []BestEffort {
+	if len(route) < 2 || route[0].Timestamp == 0 {
+		return nil
+	}
+
+	cum := make([]float64, len(route))
+	for i := 1; i < len(route); i++ {
+		cum[i] = cum[i-1] + HaversineDistance(route[i-1], route[i])
+	}
+	total := cum[len(cum)-1]
+
+	var efforts []BestEffort
+	for _, d := range distances {
+		if d.Meters <= 0 || d.Meters > total {
+			continue
+		}
+
+		best := BestEffort{Name: d.Name, DistanceMeters: d.Meters}
+		found := false
+		start := 0
+		for end := 1; end < len(route); end++ {
+			startDist := cum[end] - d.Meters
+			if startDist < 0 {
+				continue
+			}
+			// Advance start to the last point at or before startDist.
+			for start+1 < end && cum[start+1] <= startDist {
+				start++
+			}
+
+			startMs := interpolateTimestamp(route[start], route[start+1], cum[start], cum[start+1], startDist)
+			elapsed := float64(route[end].Timestamp)/1000 - startMs/1000
+			if elapsed <= 0 {
+				continue
+			}
+			if !found || elapsed < best.ElapsedSeconds {
+				found = true
+				best.ElapsedSeconds = elapsed
+				best.StartOffsetSeconds = startMs/1000 - float64(route[0].Timestamp)/1000
+				best.StartDistanceMeters = startDist
+			}
+		}
+		if found {
+			efforts = append(efforts, best)
+		}
+	}
+	return efforts
+}
+
+// interpolateTimestamp returns the timestamp (unix ms) at distance `at` between
+// two consecutive points whose cumulative distances are distA and distB.
+func interpolateTimestamp(a, b GPSPoint, distA, distB, at float64) float64 {
+	if distB <= distA {
+		return float64(a.Timestamp)
+	}
+	frac := (at - distA) / (distB - distA)
+	return float64(a.Timestamp) + frac*float64(b.Timestamp-a.Timestamp)
+}
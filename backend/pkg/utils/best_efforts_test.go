@@ -0,0 +1,77 @@
+package utils_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+// metersPerDegreeLat matches the Haversine earth radius used by utils.
+const metersPerDegreeLat = 6371000.0 * math.Pi / 180
+
+// straightRoute builds a route heading due north with a point every stepMeters,
+// where paceAt returns the seconds-per-km pace for the step starting at a distance.
+func straightRoute(totalMeters, stepMeters float64, paceAt func(distance float64) float64) []utils.GPSPoint {
+	var route []utils.GPSPoint
+	ts := int64(1_700_000_000_000)
+	for d := 0.0; d <= totalMeters+1e-6; d += stepMeters {
+		route = append(route, utils.GPSPoint{Lat: d / metersPerDegreeLat, Lng: 0, Timestamp: ts})
+		ts += int64(paceAt(d) * stepMeters) // sec/km * m = ms
+	}
+	return route
+}
+
+func TestBestEfforts_NegativeSplit(t *testing.T) {
+	// 6 km: first 3 km at 6:00/km, last 3 km at 4:00/km.
+	route := straightRoute(6000, 10, func(d float64) float64 {
+		if d < 3000 {
+			return 360
+		}
+		return 240
+	})
+
+	efforts := utils.BestEfforts(route, utils.StandardDistances)
+	byName := map[string]utils.BestEffort{}
+	for _, e := range efforts {
+		byName[e.Name] = e
+	}
+
+	if _, ok := byName["10k"]; ok {
+		t.Error("expected 10k to be omitted from a 6 km activity")
+	}
+
+	tests := []struct {
+		name        string
+		wantElapsed float64
+		wantOffset  float64
+	}{
+		{"1k", 240, -1},                // anywhere in the fast half
+		{"1mi", 1.609344 * 240, -1},    // anywhere in the fast half
+		{"5k", 3*240 + 2*360, 1 * 360}, // must start 1 km into the slow half
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, ok := byName[tt.name]
+			if !ok {
+				t.Fatalf("expected a %s best effort", tt.name)
+			}
+			if math.Abs(e.ElapsedSeconds-tt.wantElapsed) > 0.5 {
+				t.Errorf("elapsed: got %.2fs, want %.2fs", e.ElapsedSeconds, tt.wantElapsed)
+			}
+			if tt.wantOffset >= 0 && math.Abs(e.StartOffsetSeconds-tt.wantOffset) > 0.5 {
+				t.Errorf("start offset: got %.2fs, want %.2fs", e.StartOffsetSeconds, tt.wantOffset)
+			}
+			if tt.wantOffset < 0 && e.StartOffsetSeconds < 3*360-0.5 {
+				t.Errorf("expected effort in the fast second half, started at %.2fs", e.StartOffsetSeconds)
+			}
+		})
+	}
+}
+
+func TestBestEfforts_NoTimestamps(t *testing.T) {
+	route := []utils.GPSPoint{{Lat: 0, Lng: 0}, {Lat: 0.02, Lng: 0}}
+	if efforts := utils.BestEfforts(route, utils.StandardDistances); len(efforts) != 0 {
+		t.Errorf("expected no efforts without timestamps, got %d", len(efforts))
+	}
+}
@@ -0,0 +1,55 @@
+package utils
+
+// EstimateCalories returns an estimated energy expenditure in kcal using
+//
+//	kcal = MET × weight (kg) × duration (h)
+//
+// where MET depends on activity type and average speed:
+//
+//   - run:  ACSM running equation, VO2 = 0.2 × v + 3.5 ml/kg/min (v in m/min)
+//   - walk: ACSM walking equation, VO2 = 0.1 × v + 3.5 ml/kg/min
+//   - bike: Compendium of Physical Activities bands by km/h (4.0 to 15.8 MET)
+//   - hike: Compendium "hiking, cross country", a flat 6.0 MET
+//
+// For run/walk, MET = VO2 / 3.5. Unsupported types or non-positive inputs
+// return 0 rather than a guess.
+func EstimateCalories(activityType string, distanceMeters, durationSeconds, weightKg float64) float64 {
+	if durationSeconds <= 0 || weightKg <= 0 || distanceMeters < 0 {
+		return 0
+	}
+
+	var met float64
+	metersPerMin := distanceMeters / (durationSeconds / 60)
+	switch activityType {
+	case "run":
+		met = (0.2*metersPerMin + 3.5) / 3.5
+	case "walk":
+		met = (0.1*metersPerMin + 3.5) / 3.5
+	case "bike":
+		met = cyclingMET(SpeedKmh(distanceMeters, durationSeconds))
+	case "hike":
+		met = 6.0
+	default:
+		return 0
+	}
+
+	return met * weightKg * (durationSeconds / 3600)
+}
+
+// cyclingMET maps average cycling speed to Compendium MET values.
+func cyclingMET(kmh float64) float64 {
+	switch {
+	case kmh < 16:
+		return 4.0
+	case kmh < 19:
+		return 6.8
+	case kmh < 22:
+		return 8.0
+	case kmh < 25.5:
+		return 10.0
+	case kmh < 30.5:
+		return 12.0
+	default:
+		return 15.8
+	}
+}
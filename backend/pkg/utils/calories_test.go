@@ -0,0 +1,37 @@
+package utils_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+func TestEstimateCalories(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      string
+		distance float64
+		duration float64
+		weight   float64
+		want     float64
+	}{
+		// 200 m/min -> VO2 43.5 -> 12.43 MET x 70 kg x 5/6 h.
+		{"70kg runner 10km in 50min", "run", 10000, 3000, 70, 725},
+		// 20 km/h -> 8.0 MET x 80 kg x 1 h.
+		{"bike 20km/h", "bike", 20000, 3600, 80, 640},
+		{"hike 2h", "hike", 8000, 7200, 60, 720},
+		{"unsupported type", "swim", 1000, 1800, 70, 0},
+		{"no weight", "run", 5000, 1500, 0, 0},
+		{"no duration", "run", 5000, 0, 70, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := utils.EstimateCalories(tt.typ, tt.distance, tt.duration, tt.weight)
+			if math.Abs(got-tt.want) > 1 {
+				t.Errorf("got %.1f kcal, want %.0f", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package utils
+
+// Climb score thresholds (distance_m × grade%) for each category, hardest
+// first. Cat 4 starts at 8000, e.g. 1 km at 8% or 2 km at 4%.
+var climbCategories = []struct {
+	minScore float64
+	category string
+}{
+	{80000, "HC"},
+	{64000, "1"},
+	{32000, "2"},
+	{16000, "3"},
+	{8000, "4"},
+}
+
+// MinClimbGradePct is the average grade below which a segment is never
+// categorized, however long it is.
+const MinClimbGradePct = 3.0
+
+// CategorizeClimb returns the climb category ("HC", "1".."4") for a segment
+// from its climb score, distance_m × grade%, or "" for non-climbs.
+func CategorizeClimb(distanceMeters, elevationGainMeters float64) string {
+	if distanceMeters <= 0 || elevationGainMeters <= 0 {
+		return ""
+	}
+	grade := elevationGainMeters / distanceMeters * 100
+	if grade < MinClimbGradePct {
+		return ""
+	}
+	score := distanceMeters * grade
+	for _, c := range climbCategories {
+		if score >= c.minScore {
+			return c.category
+		}
+	}
+	return ""
+}
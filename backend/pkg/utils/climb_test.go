@@ -0,0 +1,37 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+func TestCategorizeClimb(t *testing.T) {
+	tests := []struct {
+		name      string
+		distance  float64
+		elevation float64
+		want      string
+	}{
+		// 400 m at 15%: score 6000, steep but too short to categorize.
+		{"short steep ramp", 400, 60, ""},
+		// 1 km at 12%: score 12000.
+		{"steep kilometer", 1000, 120, "4"},
+		// 10 km at 4%: score 40000.
+		{"long gentle grade", 10000, 400, "2"},
+		// 20 km at 2%: long, but under the minimum grade.
+		{"long false flat", 20000, 400, ""},
+		// 15 km at 7%: score 105000.
+		{"alpine pass", 15000, 1050, "HC"},
+		{"flat", 5000, 0, ""},
+		{"no distance", 0, 100, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := utils.CategorizeClimb(tt.distance, tt.elevation); got != tt.want {
+				t.Errorf("CategorizeClimb(%v, %v) = %q, want %q", tt.distance, tt.elevation, got, tt.want)
+			}
+		})
+	}
+}
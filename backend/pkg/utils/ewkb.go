@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+)
+
+// EWKB geometry type flags (PostGIS extended WKB).
+const (
+	ewkbZFlag    = 0x80000000
+	ewkbMFlag    = 0x40000000
+	ewkbSRIDFlag = 0x20000000
+	wkbPointType = 1
+	wkbLineType  = 2
+)
+
+// ParseHexEWKBLineString decodes a LineString in PostGIS hex EWKB, the text
+// form a geometry or geography column takes without any PostGIS function,
+// e.g. segment_path::text. A Z ordinate is read as elevation; M is skipped.
+func ParseHexEWKBLineString(s string) ([]GPSPoint, error) {
+	g, err := decodeHexEWKB(s, wkbLineType)
+	if err != nil {
+		return nil, err
+	}
+	if len(g.b) < g.off+4 {
+		return nil, fmt.Errorf("EWKB too short")
+	}
+	n := int(g.order.Uint32(g.b[g.off : g.off+4]))
+	g.off += 4
+	if len(g.b) != g.off+n*g.dims*8 {
+		return nil, fmt.Errorf("EWKB length mismatch for %d points", n)
+	}
+
+	points := make([]GPSPoint, n)
+	for i := range points {
+		points[i] = g.point(i)
+	}
+	return points, nil
+}
+
+// ParseHexEWKBPoint decodes a Point in PostGIS hex EWKB, e.g.
+// home_location::text.
+func ParseHexEWKBPoint(s string) (GPSPoint, error) {
+	g, err := decodeHexEWKB(s, wkbPointType)
+	if err != nil {
+		return GPSPoint{}, err
+	}
+	if len(g.b) != g.off+g.dims*8 {
+		return GPSPoint{}, fmt.Errorf("EWKB length mismatch for a point")
+	}
+	return g.point(0), nil
+}
+
+// ewkbGeometry is a decoded EWKB header; off is where the body starts.
+type ewkbGeometry struct {
+	b     []byte
+	order binary.ByteOrder
+	off   int
+	dims  int
+	hasZ  bool
+}
+
+// decodeHexEWKB decodes s and reads its header, which must be of type want.
+func decodeHexEWKB(s string, want uint32) (ewkbGeometry, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return ewkbGeometry{}, fmt.Errorf("invalid hex EWKB: %w", err)
+	}
+	if len(b) < 5 {
+		return ewkbGeometry{}, fmt.Errorf("EWKB too short")
+	}
+
+	g := ewkbGeometry{b: b, order: binary.LittleEndian, off: 5, dims: 2}
+	if b[0] == 0 {
+		g.order = binary.BigEndian
+	}
+	typ := g.order.Uint32(b[1:5])
+	if typ&ewkbSRIDFlag != 0 {
+		g.off += 4
+	}
+	if typ&^(ewkbZFlag|ewkbMFlag|ewkbSRIDFlag) != want {
+		return ewkbGeometry{}, fmt.Errorf("unsupported EWKB geometry type %d", typ&0xff)
+	}
+	g.hasZ = typ&ewkbZFlag != 0
+	if g.hasZ {
+		g.dims++
+	}
+	if typ&ewkbMFlag != 0 {
+		g.dims++
+	}
+	return g, nil
+}
+
+// point reads the i'th coordinate of the body.
+func (g ewkbGeometry) point(i int) GPSPoint {
+	coord := func(j int) float64 {
+		return math.Float64frombits(g.order.Uint64(g.b[g.off+(i*g.dims+j)*8:]))
+	}
+	p := GPSPoint{Lng: coord(0), Lat: coord(1)}
+	if g.hasZ {
+		p.Elevation = coord(2)
+	}
+	return p
+}
@@ -0,0 +1,77 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+func TestParseHexEWKBLineString(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+		want []utils.GPSPoint
+	}{
+		{
+			"SRID=4326;LINESTRING(0 0,1 1)",
+			"0102000020E61000000200000000000000000000000000000000000000000000000000F03F000000000000F03F",
+			[]utils.GPSPoint{{Lng: 0, Lat: 0}, {Lng: 1, Lat: 1}},
+		},
+		{
+			"SRID=4326;LINESTRING Z(1 2 3)",
+			"01020000A0E610000001000000000000000000F03F00000000000000400000000000000840",
+			[]utils.GPSPoint{{Lng: 1, Lat: 2, Elevation: 3}},
+		},
+		{
+			"big-endian LINESTRING(1 2)",
+			"0000000002000000013FF00000000000004000000000000000",
+			[]utils.GPSPoint{{Lng: 1, Lat: 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := utils.ParseHexEWKBLineString(tt.hex)
+			if err != nil {
+				t.Fatalf("ParseHexEWKBLineString: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d points, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("point %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseHexEWKBLineString_Invalid(t *testing.T) {
+	for name, hex := range map[string]string{
+		"not hex":   "zz",
+		"too short": "0102",
+		"point":     "0101000020E610000000000000000000000000000000000000",
+		"truncated": "0102000020E610000002000000000000000000000000000000",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := utils.ParseHexEWKBLineString(hex); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseHexEWKBPoint(t *testing.T) {
+	got, err := utils.ParseHexEWKBPoint("0101000020E6100000000000000000E0BF0000000000C04940")
+	if err != nil {
+		t.Fatalf("ParseHexEWKBPoint: %v", err)
+	}
+	if want := (utils.GPSPoint{Lng: -0.5, Lat: 51.5}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// A LineString is not a point.
+	if _, err := utils.ParseHexEWKBPoint("0102000020E61000000200000000000000000000000000000000000000000000000000F03F000000000000F03F"); err == nil {
+		t.Error("expected an error for a LineString")
+	}
+}
@@ -0,0 +1,29 @@
+package utils
+
+// Gap is a stretch between two consecutive timestamped points with no
+// samples in between (signal loss or a paused recording).
+type Gap struct {
+	StartIndex      int     `json:"start_index"` // last point before the gap
+	EndIndex        int     `json:"end_index"`   // first point after it
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// DetectGaps returns every place where consecutive timestamps are more than
+// maxGapSeconds apart, in route order. Untimed points (timestamp 0) are
+// skipped, so a route without timestamps has no gaps.
+func DetectGaps(route []GPSPoint, maxGapSeconds float64) []Gap {
+	var gaps []Gap
+	prev := -1
+	for i, p := range route {
+		if p.Timestamp == 0 {
+			continue
+		}
+		if prev >= 0 {
+			if dt := float64(p.Timestamp-route[prev].Timestamp) / 1000; dt > maxGapSeconds {
+				gaps = append(gaps, Gap{StartIndex: prev, EndIndex: i, DurationSeconds: dt})
+			}
+		}
+		prev = i
+	}
+	return gaps
+}
@@ -0,0 +1,47 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+func TestDetectGaps(t *testing.T) {
+	t.Run("clean route", func(t *testing.T) {
+		route := straightRoute(1000, 100, func(float64) float64 { return 300 })
+		if gaps := utils.DetectGaps(route, 60); len(gaps) != 0 {
+			t.Errorf("got %d gaps, want none: %+v", len(gaps), gaps)
+		}
+	})
+
+	t.Run("five-minute gap", func(t *testing.T) {
+		route := straightRoute(1000, 100, func(float64) float64 { return 300 })
+		for i := 5; i < len(route); i++ {
+			route[i].Timestamp += 5 * 60 * 1000
+		}
+		gaps := utils.DetectGaps(route, 60)
+		if len(gaps) != 1 {
+			t.Fatalf("got %d gaps, want 1: %+v", len(gaps), gaps)
+		}
+		step := float64(route[1].Timestamp-route[0].Timestamp) / 1000
+		want := utils.Gap{StartIndex: 4, EndIndex: 5, DurationSeconds: 300 + step}
+		if gaps[0] != want {
+			t.Errorf("got %+v, want %+v", gaps[0], want)
+		}
+	})
+
+	t.Run("untimed points are skipped", func(t *testing.T) {
+		route := []utils.GPSPoint{
+			{Lat: 0, Lng: 0, Timestamp: 1000},
+			{Lat: 0, Lng: 0.001},
+			{Lat: 0, Lng: 0.002, Timestamp: 400000},
+		}
+		gaps := utils.DetectGaps(route, 60)
+		if len(gaps) != 1 || gaps[0].StartIndex != 0 || gaps[0].EndIndex != 2 || gaps[0].DurationSeconds != 399 {
+			t.Errorf("got %+v, want one 399s gap from 0 to 2", gaps)
+		}
+		if gaps := utils.DetectGaps([]utils.GPSPoint{{Lat: 0, Lng: 0}, {Lat: 0, Lng: 1}}, 60); gaps != nil {
+			t.Errorf("untimed route: got %+v, want nil", gaps)
+		}
+	})
+}
@@ -3,11 +3,18 @@ package utils
 import (
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
 )
 
 const earthRadiusKm = 6371.0
 
+// Imperial conversion factors (international mile and foot).
+const (
+	MetersPerMile = 1609.344
+	MetersPerFoot = 0.3048
+)
+
 // GPSPoint represents a single latitude/longitude coordinate.
 type GPSPoint struct {
 	Lat       float64 `json:"lat"`
@@ -16,6 +23,36 @@ type GPSPoint struct {
 	Timestamp int64   `json:"timestamp,omitempty"` // unix ms
 }
 
+// ValidateRoute checks that every point has a finite latitude in [-90, 90],
+// longitude in [-180, 180] and elevation, and that timestamps never go
+// backwards. Untimed points (timestamp 0) are skipped in the ordering check.
+func ValidateRoute(route []GPSPoint) error {
+	var lastTs int64
+	for i, p := range route {
+		if !isFinite(p.Lat) || !isFinite(p.Lng) || !isFinite(p.Elevation) {
+			return fmt.Errorf("point %d: coordinates must be finite numbers", i)
+		}
+		if p.Lat < -90 || p.Lat > 90 {
+			return fmt.Errorf("point %d: latitude %v out of range [-90, 90]", i, p.Lat)
+		}
+		if p.Lng < -180 || p.Lng > 180 {
+			return fmt.Errorf("point %d: longitude %v out of range [-180, 180]", i, p.Lng)
+		}
+		if p.Timestamp == 0 {
+			continue
+		}
+		if p.Timestamp < lastTs {
+			return fmt.Errorf("point %d: timestamp %d is before the previous point's %d", i, p.Timestamp, lastTs)
+		}
+		lastTs = p.Timestamp
+	}
+	return nil
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
 // HaversineDistance returns the distance in meters between two GPS points.
 func HaversineDistance(a, b GPSPoint) float64 {
 	dLat := degToRad(b.Lat - a.Lat)
@@ -62,6 +99,51 @@ func RouteToWKTLineString(route []GPSPoint) string {
 	return fmt.Sprintf("SRID=4326;LINESTRING(%s)", strings.Join(parts, ", "))
 }
 
+// ParseWKTLineString parses a LINESTRING(lng lat, ...) as produced by
+// RouteToWKTLineString or PostGIS ST_AsText. An SRID=...; prefix and a third
+// (Z) ordinate, read as elevation, are accepted.
+func ParseWKTLineString(wkt string) ([]GPSPoint, error) {
+	s := strings.TrimSpace(wkt)
+	if i := strings.Index(s, ";"); i >= 0 && strings.HasPrefix(strings.ToUpper(s), "SRID=") {
+		s = strings.TrimSpace(s[i+1:])
+	}
+	open := strings.Index(s, "(")
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return nil, fmt.Errorf("invalid WKT linestring")
+	}
+	kind := strings.ToUpper(strings.TrimSpace(s[:open]))
+	if kind != "LINESTRING" && kind != "LINESTRING Z" {
+		return nil, fmt.Errorf("unsupported WKT geometry %q", kind)
+	}
+
+	body := s[open+1 : len(s)-1]
+	if strings.TrimSpace(body) == "" {
+		return []GPSPoint{}, nil
+	}
+	coords := strings.Split(body, ",")
+	points := make([]GPSPoint, 0, len(coords))
+	for _, c := range coords {
+		fields := strings.Fields(c)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("invalid WKT coordinate %q", strings.TrimSpace(c))
+		}
+		vals := make([]float64, len(fields))
+		for i, f := range fields {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid WKT coordinate %q: %w", strings.TrimSpace(c), err)
+			}
+			vals[i] = v
+		}
+		p := GPSPoint{Lng: vals[0], Lat: vals[1]}
+		if len(vals) == 3 {
+			p.Elevation = vals[2]
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
 // PointToWKT converts a single GPS point to a WKT POINT(lng lat).
 func PointToWKT(p GPSPoint) string {
 	return fmt.Sprintf("SRID=4326;POINT(%f %f)", p.Lng, p.Lat)
@@ -79,17 +161,57 @@ func BlurRoute(route []GPSPoint, center GPSPoint, radiusMeters float64) []GPSPoi
 	return out
 }
 
+// PaceSecPerKm returns pace in seconds per km, or 0 when distance is not
+// positive. Use it to compute or compare paces; PaceMinPerKm formats it.
+func PaceSecPerKm(distanceMeters, durationSeconds float64) float64 {
+	if distanceMeters <= 0 {
+		return 0
+	}
+	return durationSeconds / (distanceMeters / 1000.0)
+}
+
 // PaceMinPerKm returns pace as "mm:ss /km" from distance (m) and duration (seconds).
 func PaceMinPerKm(distanceMeters, durationSeconds float64) string {
 	if distanceMeters <= 0 {
 		return "--:--"
 	}
-	secPerKm := durationSeconds / (distanceMeters / 1000.0)
+	secPerKm := PaceSecPerKm(distanceMeters, durationSeconds)
 	mins := int(secPerKm) / 60
 	secs := int(secPerKm) % 60
 	return fmt.Sprintf("%d:%02d", mins, secs)
 }
 
+// PaceMinPerKmFloat returns pace in decimal minutes per km (5.5 = 5:30 /km),
+// or 0 when distance is not positive.
+func PaceMinPerKmFloat(distanceMeters, durationSeconds float64) float64 {
+	return PaceSecPerKm(distanceMeters, durationSeconds) / 60.0
+}
+
+// PaceMinPerMile returns pace as "mm:ss /mile" from distance (m) and duration (seconds).
+func PaceMinPerMile(distanceMeters, durationSeconds float64) string {
+	if distanceMeters <= 0 {
+		return "--:--"
+	}
+	secPerMile := math.Round(PaceSecPerKm(distanceMeters, durationSeconds) * MetersPerMile / 1000)
+	return fmt.Sprintf("%d:%02d", int(secPerMile)/60, int(secPerMile)%60)
+}
+
+// MaxSpeedKmh returns the fastest speed between consecutive timestamped
+// points, or 0 if the route has no usable timestamps.
+func MaxSpeedKmh(route []GPSPoint) float64 {
+	var max float64
+	for i := 1; i < len(route); i++ {
+		dtMs := route[i].Timestamp - route[i-1].Timestamp
+		if route[i-1].Timestamp == 0 || dtMs <= 0 {
+			continue
+		}
+		if v := SpeedKmh(HaversineDistance(route[i-1], route[i]), float64(dtMs)/1000); v > max {
+			max = v
+		}
+	}
+	return max
+}
+
 // SpeedKmh returns speed in km/h.
 func SpeedKmh(distanceMeters, durationSeconds float64) float64 {
 	if durationSeconds <= 0 {
@@ -98,6 +220,14 @@ func SpeedKmh(distanceMeters, durationSeconds float64) float64 {
 	return (distanceMeters / 1000.0) / (durationSeconds / 3600.0)
 }
 
+// SpeedMph returns speed in miles per hour.
+func SpeedMph(distanceMeters, durationSeconds float64) float64 {
+	if durationSeconds <= 0 {
+		return 0
+	}
+	return (distanceMeters / MetersPerMile) / (durationSeconds / 3600.0)
+}
+
 func degToRad(deg float64) float64 {
 	return deg * math.Pi / 180
 }
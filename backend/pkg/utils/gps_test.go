@@ -0,0 +1,156 @@
+package utils_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+func TestPaceMinPerKmFloat(t *testing.T) {
+	tests := []struct {
+		name     string
+		distance float64
+		duration float64
+		want     float64
+	}{
+		{"5k in 25 minutes", 5000, 1500, 5.0},
+		{"10k in 55 minutes", 10000, 3300, 5.5},
+		{"zero distance", 0, 600, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := utils.PaceMinPerKmFloat(tt.distance, tt.duration); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Must agree with the formatted variant.
+	if got := utils.PaceMinPerKm(5000, 1500); got != "5:00" {
+		t.Errorf("PaceMinPerKm: got %s, want 5:00", got)
+	}
+}
+
+func TestPaceSecPerKm(t *testing.T) {
+	tests := []struct {
+		name     string
+		distance float64
+		duration float64
+		want     float64
+	}{
+		{"5k at 5:00/km", 5000, 1500, 300},
+		{"half marathon in 1:45:30", 21097.5, 6330, 300.03},
+		{"zero distance", 0, 600, 0},
+		{"negative distance", -100, 600, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := utils.PaceSecPerKm(tt.distance, tt.duration); math.Abs(got-tt.want) > 0.01 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImperialPaceAndSpeed(t *testing.T) {
+	if got := utils.PaceMinPerMile(1609.34, 600); got != "10:00" {
+		t.Errorf("PaceMinPerMile: got %s, want 10:00", got)
+	}
+	if got := utils.SpeedMph(1609.34, 600); math.Abs(got-6.0) > 0.001 {
+		t.Errorf("SpeedMph: got %v, want 6.0", got)
+	}
+	if got := utils.PaceMinPerMile(0, 600); got != "--:--" {
+		t.Errorf("PaceMinPerMile zero distance: got %s", got)
+	}
+	if got := utils.SpeedMph(1609.34, 0); got != 0 {
+		t.Errorf("SpeedMph zero duration: got %v", got)
+	}
+}
+
+func TestValidateRoute(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   []utils.GPSPoint
+		wantErr bool
+	}{
+		{"valid timed route", []utils.GPSPoint{
+			{Lat: 51.5, Lng: -0.12, Timestamp: 1000},
+			{Lat: 51.501, Lng: -0.121, Timestamp: 2000},
+			{Lat: 51.502, Lng: -0.122, Timestamp: 2000},
+		}, false},
+		{"untimed points", []utils.GPSPoint{{Lat: -90, Lng: 180}, {Lat: 90, Lng: -180}}, false},
+		{"empty", nil, false},
+		{"latitude out of range", []utils.GPSPoint{{Lat: 200, Lng: 0}}, true},
+		{"longitude out of range", []utils.GPSPoint{{Lat: 0, Lng: -180.5}}, true},
+		{"NaN latitude", []utils.GPSPoint{{Lat: math.NaN(), Lng: 0}}, true},
+		{"infinite longitude", []utils.GPSPoint{{Lat: 0, Lng: math.Inf(1)}}, true},
+		{"NaN elevation", []utils.GPSPoint{{Lat: 0, Lng: 0, Elevation: math.NaN()}}, true},
+		{"timestamps go backwards", []utils.GPSPoint{
+			{Lat: 0, Lng: 0, Timestamp: 2000},
+			{Lat: 0, Lng: 0.001, Timestamp: 1000},
+		}, true},
+		{"backwards across an untimed point", []utils.GPSPoint{
+			{Lat: 0, Lng: 0, Timestamp: 2000},
+			{Lat: 0, Lng: 0.001},
+			{Lat: 0, Lng: 0.002, Timestamp: 1500},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := utils.ValidateRoute(tt.route)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRoute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMaxSpeedKmh(t *testing.T) {
+	// 100 m steps at 6:00/km, then 4:00/km (= 15 km/h).
+	route := straightRoute(1000, 100, func(d float64) float64 {
+		if d < 500 {
+			return 360
+		}
+		return 240
+	})
+	if got := utils.MaxSpeedKmh(route); math.Abs(got-15) > 0.01 {
+		t.Errorf("got %.3f km/h, want 15", got)
+	}
+
+	untimed := []utils.GPSPoint{{Lat: 0, Lng: 0}, {Lat: 0.001, Lng: 0}}
+	if got := utils.MaxSpeedKmh(untimed); got != 0 {
+		t.Errorf("untimed route: got %v, want 0", got)
+	}
+}
+
+func TestParseWKTLineString(t *testing.T) {
+	route := []utils.GPSPoint{{Lat: 37.7749, Lng: -122.4194}, {Lat: 37.7755, Lng: -122.419}}
+
+	got, err := utils.ParseWKTLineString(utils.RouteToWKTLineString(route))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(got) != len(route) {
+		t.Fatalf("expected %d points, got %d", len(route), len(got))
+	}
+	for i := range route {
+		if math.Abs(got[i].Lat-route[i].Lat) > 1e-6 || math.Abs(got[i].Lng-route[i].Lng) > 1e-6 {
+			t.Errorf("point %d: got %+v, want %+v", i, got[i], route[i])
+		}
+	}
+
+	// PostGIS ST_AsText output for a 3D line.
+	z, err := utils.ParseWKTLineString("LINESTRING Z (1 2 30,3 4 40)")
+	if err != nil || len(z) != 2 || z[1].Elevation != 40 {
+		t.Errorf("LINESTRING Z: got %+v, %v", z, err)
+	}
+
+	for _, bad := range []string{"POINT(1 2)", "LINESTRING(1)", "LINESTRING(a b, 1 2)", "garbage"} {
+		if _, err := utils.ParseWKTLineString(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
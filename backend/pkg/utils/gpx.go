@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// GPX is a minimal GPX 1.1 document with a single track and segment.
+type GPX struct {
+	XMLName  xml.Name     `xml:"gpx"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	Version  string       `xml:"version,attr"`
+	Creator  string       `xml:"creator,attr"`
+	Metadata *GPXMetadata `xml:"metadata,omitempty"`
+	Tracks   []GPXTrack   `xml:"trk"`
+}
+
+// GPXMetadata holds document-level metadata.
+type GPXMetadata struct {
+	Name string `xml:"name,omitempty"`
+	Time string `xml:"time,omitempty"`
+}
+
+// GPXTrack is a named track made of segments.
+type GPXTrack struct {
+	Name     string       `xml:"name,omitempty"`
+	Type     string       `xml:"type,omitempty"`
+	Segments []GPXSegment `xml:"trkseg"`
+}
+
+// GPXSegment is a contiguous run of track points.
+type GPXSegment struct {
+	Points []GPXPoint `xml:"trkpt"`
+}
+
+// GPXPoint is a single track point. Ele and Time are omitted when unknown.
+type GPXPoint struct {
+	Lat  float64  `xml:"lat,attr"`
+	Lon  float64  `xml:"lon,attr"`
+	Ele  *float64 `xml:"ele,omitempty"`
+	Time string   `xml:"time,omitempty"`
+}
+
+// EncodeGPX renders route as a single-track GPX document. Elevation and
+// timestamps are written only for points that carry them.
+func EncodeGPX(name, activityType string, start time.Time, route []GPSPoint) ([]byte, error) {
+	seg := GPXSegment{Points: make([]GPXPoint, len(route))}
+	for i, p := range route {
+		pt := GPXPoint{Lat: p.Lat, Lon: p.Lng}
+		if p.Elevation != 0 {
+			ele := p.Elevation
+			pt.Ele = &ele
+		}
+		if p.Timestamp > 0 {
+			pt.Time = time.UnixMilli(p.Timestamp).UTC().Format(time.RFC3339)
+		}
+		seg.Points[i] = pt
+	}
+
+	doc := GPX{
+		Xmlns:   "http://www.topografix.com/GPX/1/1",
+		Version: "1.1",
+		Creator: "ApexRun",
+		Metadata: &GPXMetadata{
+			Name: name,
+			Time: start.UTC().Format(time.RFC3339),
+		},
+		Tracks: []GPXTrack{{Name: name, Type: activityType, Segments: []GPXSegment{seg}}},
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
@@ -0,0 +1,67 @@
+package utils
+
+// HeartRateSample is one entry of an activity's heart_rate_stream.
+// Timestamp is unix ms (matching GPSPoint) and may be 0 when unknown.
+type HeartRateSample struct {
+	Timestamp int64 `json:"timestamp,omitempty"`
+	BPM       int   `json:"bpm"`
+}
+
+// heartRateZoneFloors are the lower bounds of zones 1-5 as a fraction of max HR.
+// Each zone includes its lower bound; anything at or above 90% is zone 5.
+var heartRateZoneFloors = [5]float64{0.5, 0.6, 0.7, 0.8, 0.9}
+
+// HeartRateZones returns seconds spent in each of the 5 standard zones
+// (50-60%, 60-70%, 70-80%, 80-90%, 90-100% of maxHR), treating samples as
+// 1 Hz. Samples below 50% fall outside every zone.
+func HeartRateZones(samples []int, maxHR int) [5]float64 {
+	var zones [5]float64
+	if maxHR <= 0 {
+		return zones
+	}
+	for _, bpm := range samples {
+		frac := float64(bpm) / float64(maxHR)
+		for z := len(heartRateZoneFloors) - 1; z >= 0; z-- {
+			if frac >= heartRateZoneFloors[z] {
+				zones[z]++
+				break
+			}
+		}
+	}
+	return zones
+}
+
+// HeartRateZoneBounds returns the inclusive lower bpm of each zone for maxHR.
+func HeartRateZoneBounds(maxHR int) [5]int {
+	var bounds [5]int
+	for i, f := range heartRateZoneFloors {
+		// Match HeartRateZones: the smallest bpm with bpm/maxHR >= f.
+		b := int(f * float64(maxHR))
+		if float64(b)/float64(maxHR) < f {
+			b++
+		}
+		bounds[i] = b
+	}
+	return bounds
+}
+
+// ResampleHeartRate expands a stream to 1 Hz samples for HeartRateZones.
+// Each reading is held until the next timestamp; streams without
+// timestamps are assumed to already be 1 Hz.
+func ResampleHeartRate(stream []HeartRateSample) []int {
+	out := make([]int, 0, len(stream))
+	for i, s := range stream {
+		if i+1 < len(stream) && s.Timestamp > 0 && stream[i+1].Timestamp > s.Timestamp {
+			secs := int((stream[i+1].Timestamp - s.Timestamp) / 1000)
+			if secs < 1 {
+				secs = 1
+			}
+			for j := 0; j < secs; j++ {
+				out = append(out, s.BPM)
+			}
+			continue
+		}
+		out = append(out, s.BPM)
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+func TestHeartRateZones_Boundaries(t *testing.T) {
+	// maxHR 200: zone floors at 100, 120, 140, 160, 180 bpm.
+	samples := []int{
+		99,       // below zone 1, ignored
+		100, 119, // zone 1
+		120, 139, // zone 2
+		140,      // zone 3
+		160, 179, // zone 4
+		180, 200, 210, // zone 5 (above max still counts)
+	}
+	got := utils.HeartRateZones(samples, 200)
+	want := [5]float64{2, 2, 1, 2, 3}
+	if got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if got := utils.HeartRateZones(samples, 0); got != ([5]float64{}) {
+		t.Errorf("zero max HR: got %v, want all zero", got)
+	}
+}
+
+func TestHeartRateZoneBounds(t *testing.T) {
+	if got, want := utils.HeartRateZoneBounds(190), [5]int{95, 114, 133, 152, 171}; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// 0.7*185 = 129.5, so 130 is the first zone 3 bpm.
+	if got := utils.HeartRateZoneBounds(185)[2]; got != 130 {
+		t.Errorf("zone 3 floor: got %d, want 130", got)
+	}
+}
+
+func TestResampleHeartRate(t *testing.T) {
+	stream := []utils.HeartRateSample{
+		{Timestamp: 1_000, BPM: 120},
+		{Timestamp: 4_000, BPM: 150}, // 3 s at 120
+		{Timestamp: 5_000, BPM: 160}, // 1 s at 150
+	}
+	got := utils.ResampleHeartRate(stream)
+	want := []int{120, 120, 120, 150, 160}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	untimed := utils.ResampleHeartRate([]utils.HeartRateSample{{BPM: 100}, {BPM: 110}})
+	if len(untimed) != 2 {
+		t.Errorf("untimed stream: got %v", untimed)
+	}
+}
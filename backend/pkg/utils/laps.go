@@ -0,0 +1,81 @@
+package utils
+
+// Lap types reported by DetectLaps.
+const (
+	LapWork = "work"
+	LapRest = "rest"
+)
+
+// MinLapSeconds is how long a speed change must be sustained to start a new
+// lap. Shorter changes (GPS jitter, a stumble) are absorbed into the
+// surrounding lap.
+const MinLapSeconds = 15
+
+// Lap is a contiguous work or rest interval within a route.
+type Lap struct {
+	Type               string  `json:"type"`
+	StartOffsetSeconds float64 `json:"start_offset_seconds"`
+	DistanceMeters     float64 `json:"distance_meters"`
+	DurationSeconds    float64 `json:"duration_seconds"`
+	AvgPaceMinPerKm    float64 `json:"avg_pace_min_per_km"`
+}
+
+// DetectLaps splits a timestamped route into alternating work and rest laps.
+// A step between points is "work" when its speed is at or above
+// restSpeedKmh and "rest" otherwise; runs of steps shorter than
+// MinLapSeconds are merged into the preceding lap. Returns nil when the
+// route lacks timestamps.
+func DetectLaps(route []GPSPoint, restSpeedKmh float64) []Lap {
+	if len(route) < 2 || route[0].Timestamp == 0 {
+		return nil
+	}
+
+	var raw []Lap
+	for i := 1; i < len(route); i++ {
+		dt := float64(route[i].Timestamp-route[i-1].Timestamp) / 1000
+		if dt <= 0 {
+			continue
+		}
+		dist := HaversineDistance(route[i-1], route[i])
+		typ := LapRest
+		if SpeedKmh(dist, dt) >= restSpeedKmh {
+			typ = LapWork
+		}
+
+		if n := len(raw); n > 0 && raw[n-1].Type == typ {
+			raw[n-1].DistanceMeters += dist
+			raw[n-1].DurationSeconds += dt
+			continue
+		}
+		raw = append(raw, Lap{
+			Type:               typ,
+			StartOffsetSeconds: float64(route[i-1].Timestamp-route[0].Timestamp) / 1000,
+			DistanceMeters:     dist,
+			DurationSeconds:    dt,
+		})
+	}
+
+	// Absorb short blips into the previous lap (or the next, at the start),
+	// then merge neighbours that now share a type.
+	var laps []Lap
+	for _, l := range raw {
+		n := len(laps)
+		switch {
+		case n > 0 && (l.DurationSeconds < MinLapSeconds || laps[n-1].Type == l.Type):
+			laps[n-1].DistanceMeters += l.DistanceMeters
+			laps[n-1].DurationSeconds += l.DurationSeconds
+		case n == 1 && laps[0].DurationSeconds < MinLapSeconds:
+			l.StartOffsetSeconds = laps[0].StartOffsetSeconds
+			l.DistanceMeters += laps[0].DistanceMeters
+			l.DurationSeconds += laps[0].DurationSeconds
+			laps[0] = l
+		default:
+			laps = append(laps, l)
+		}
+	}
+
+	for i := range laps {
+		laps[i].AvgPaceMinPerKm = PaceMinPerKmFloat(laps[i].DistanceMeters, laps[i].DurationSeconds)
+	}
+	return laps
+}
@@ -0,0 +1,54 @@
+package utils_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+func TestDetectLaps_4x400(t *testing.T) {
+	// 4 x (400 m at 3:45/km, 100 m easy jog at 15:00/km = 90 s). The third
+	// rep includes a 10 m stumble at rest pace that must not split the lap.
+	const rep, jog = 400.0, 100.0
+	route := straightRoute(4*(rep+jog), 5, func(d float64) float64 {
+		offset := math.Mod(d, rep+jog)
+		if d >= 2*(rep+jog)+200 && d < 2*(rep+jog)+210 {
+			return 900
+		}
+		if offset < rep {
+			return 225
+		}
+		return 900
+	})
+
+	laps := utils.DetectLaps(route, 8)
+
+	var work []utils.Lap
+	for _, l := range laps {
+		if l.Type == utils.LapWork {
+			work = append(work, l)
+		}
+	}
+	if len(work) != 4 {
+		t.Fatalf("expected 4 work laps, got %d: %+v", len(work), laps)
+	}
+	for i, l := range work {
+		if math.Abs(l.DistanceMeters-rep) > 15 {
+			t.Errorf("work lap %d: distance %.1f, want ~%v", i+1, l.DistanceMeters, rep)
+		}
+	}
+	if math.Abs(work[0].AvgPaceMinPerKm-3.75) > 0.05 {
+		t.Errorf("work pace: got %.3f min/km, want 3.75", work[0].AvgPaceMinPerKm)
+	}
+	if len(laps) != 8 {
+		t.Errorf("expected alternating 8 laps, got %d", len(laps))
+	}
+}
+
+func TestDetectLaps_NoTimestamps(t *testing.T) {
+	route := []utils.GPSPoint{{Lat: 0, Lng: 0}, {Lat: 0.01, Lng: 0}}
+	if laps := utils.DetectLaps(route, 8); laps != nil {
+		t.Errorf("expected nil, got %+v", laps)
+	}
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pagination describes one offset-based page of a list response.
+type Pagination struct {
+	Limit   int  `json:"limit"`
+	Offset  int  `json:"offset"`
+	Total   int  `json:"total"`
+	HasMore bool `json:"has_more"`
+}
+
+// ListEnvelope is the list response body:
+// {"data": [...], "pagination": {...}}.
+type ListEnvelope struct {
+	Data       interface{} `json:"data"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+// NewListEnvelope wraps a page of returned items, out of total, that starts
+// at offset.
+func NewListEnvelope(data interface{}, returned, limit, offset, total int) ListEnvelope {
+	return ListEnvelope{
+		Data: data,
+		Pagination: Pagination{
+			Limit:   limit,
+			Offset:  offset,
+			Total:   total,
+			HasMore: offset+returned < total,
+		},
+	}
+}
+
+// ParseEnvelope reads ?envelope=, writing a 400 for anything but true or
+// false. Lists default to the {"data", "pagination"} envelope; false gives
+// the original top-level shape.
+func ParseEnvelope(c *gin.Context) (envelope bool, ok bool) {
+	switch c.Query("envelope") {
+	case "", "true":
+		return true, true
+	case "false":
+		return false, true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "envelope must be true or false"})
+		return false, false
+	}
+}
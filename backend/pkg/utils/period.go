@@ -0,0 +1,25 @@
+package utils
+
+import "time"
+
+// PeriodStart returns the start of the calendar period ("week", "month",
+// "year" or "all") containing now, in now's location. Weeks start Monday;
+// "all" yields the zero time. ok is false for any other period.
+func PeriodStart(period string, now time.Time) (start time.Time, ok bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch period {
+	case "week":
+		weekday := int(today.Weekday())
+		if weekday == 0 {
+			weekday = 7
+		}
+		return today.AddDate(0, 0, -(weekday - 1)), true
+	case "month":
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()), true
+	case "year":
+		return time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location()), true
+	case "all":
+		return time.Time{}, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,32 @@
+package utils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+func TestPeriodStart(t *testing.T) {
+	// A Sunday evening, so the week starts six days earlier.
+	now := time.Date(2024, 3, 17, 21, 15, 0, 0, time.UTC)
+	tests := []struct {
+		period string
+		want   time.Time
+		ok     bool
+	}{
+		{"week", time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), true},
+		{"month", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), true},
+		{"year", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"all", time.Time{}, true},
+		{"decade", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.period, func(t *testing.T) {
+			got, ok := utils.PeriodStart(tt.period, now)
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("PeriodStart(%q) = %v, %v; want %v, %v", tt.period, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
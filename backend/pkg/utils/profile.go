@@ -0,0 +1,61 @@
+package utils
+
+// ProfilePoint is one sample of a route's elevation profile. Elevation and
+// grade are nil when the route carries no elevation data; grade is also nil
+// for the first sample.
+type ProfilePoint struct {
+	DistanceMeters  float64  `json:"distance_m"`
+	ElevationMeters *float64 `json:"elevation_m"`
+	GradePct        *float64 `json:"grade_pct"`
+}
+
+// ElevationProfile resamples a route every intervalMeters of cumulative
+// distance, interpolating elevation linearly between points. The first and
+// last points are always included. Grade is the elevation change from the
+// previous sample over the distance between them.
+func ElevationProfile(route []GPSPoint, intervalMeters float64, hasElevation bool) []ProfilePoint {
+	if len(route) == 0 {
+		return nil
+	}
+	if intervalMeters <= 0 {
+		intervalMeters = 50
+	}
+
+	profile := []ProfilePoint{profileSample(0, route[0].Elevation, hasElevation)}
+	travelled := 0.0
+	next := intervalMeters
+	for i := 1; i < len(route); i++ {
+		step := HaversineDistance(route[i-1], route[i])
+		for step > 0 && next <= travelled+step {
+			f := (next - travelled) / step
+			ele := route[i-1].Elevation + f*(route[i].Elevation-route[i-1].Elevation)
+			profile = append(profile, profileSample(next, ele, hasElevation))
+			next += intervalMeters
+		}
+		travelled += step
+	}
+	// Skip a final sample that would only differ from the last by rounding.
+	if last := profile[len(profile)-1].DistanceMeters; travelled-last > 0.01 {
+		profile = append(profile, profileSample(travelled, route[len(route)-1].Elevation, hasElevation))
+	}
+
+	if hasElevation {
+		for i := 1; i < len(profile); i++ {
+			dd := profile[i].DistanceMeters - profile[i-1].DistanceMeters
+			if dd <= 0 {
+				continue
+			}
+			grade := (*profile[i].ElevationMeters - *profile[i-1].ElevationMeters) / dd * 100
+			profile[i].GradePct = &grade
+		}
+	}
+	return profile
+}
+
+func profileSample(distance, elevation float64, hasElevation bool) ProfilePoint {
+	p := ProfilePoint{DistanceMeters: distance}
+	if hasElevation {
+		p.ElevationMeters = &elevation
+	}
+	return p
+}
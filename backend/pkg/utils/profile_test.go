@@ -0,0 +1,56 @@
+package utils_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+// syntheticClimb is ~1.1 km due north rising 10 m every ~111 m (~9%).
+func syntheticClimb() []utils.GPSPoint {
+	route := make([]utils.GPSPoint, 11)
+	for i := range route {
+		route[i] = utils.GPSPoint{Lat: float64(i) * 0.001, Lng: 0, Elevation: 100 + float64(i)*10}
+	}
+	return route
+}
+
+func TestElevationProfile_SyntheticClimb(t *testing.T) {
+	route := syntheticClimb()
+	profile := utils.ElevationProfile(route, 100, true)
+
+	total := utils.TotalDistance(route)
+	if len(profile) != 13 {
+		t.Fatalf("expected 13 samples over %.0fm at 100m, got %d", total, len(profile))
+	}
+	if last := profile[len(profile)-1]; math.Abs(last.DistanceMeters-total) > 0.01 || math.Abs(*last.ElevationMeters-200) > 1e-9 {
+		t.Errorf("last sample = %.2fm @ %.2fm, want %.2fm @ 200m", last.DistanceMeters, *last.ElevationMeters, total)
+	}
+	if profile[0].GradePct != nil {
+		t.Errorf("first sample should have no grade, got %v", *profile[0].GradePct)
+	}
+	for i := 1; i < len(profile); i++ {
+		if profile[i].DistanceMeters <= profile[i-1].DistanceMeters {
+			t.Fatalf("distance not monotonic at %d: %.2f after %.2f", i, profile[i].DistanceMeters, profile[i-1].DistanceMeters)
+		}
+		if profile[i].GradePct == nil || math.Abs(*profile[i].GradePct-9.0) > 0.1 {
+			t.Errorf("sample %d grade = %v, want ~9%%", i, profile[i].GradePct)
+		}
+	}
+}
+
+func TestElevationProfile_NoElevation(t *testing.T) {
+	profile := utils.ElevationProfile(syntheticClimb(), 100, false)
+	if len(profile) == 0 {
+		t.Fatal("expected samples")
+	}
+	for i, p := range profile {
+		if p.ElevationMeters != nil || p.GradePct != nil {
+			t.Errorf("sample %d: expected null elevation and grade, got %+v", i, p)
+		}
+		if i > 0 && p.DistanceMeters <= profile[i-1].DistanceMeters {
+			t.Errorf("distance not monotonic at %d", i)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package utils
+
+// Stream keys accepted by ActivityStreams. StreamTime is the base every
+// other stream is aligned to and is always returned.
+const (
+	StreamTime      = "time"
+	StreamDistance  = "distance"
+	StreamAltitude  = "altitude"
+	StreamHeartRate = "heartrate"
+	StreamVelocity  = "velocity"
+)
+
+// StreamKeys are the selectable streams, in response order.
+var StreamKeys = []string{StreamDistance, StreamAltitude, StreamHeartRate, StreamVelocity}
+
+// ActivityStreams derives per-point arrays for charting, one entry per route
+// point in every array:
+//
+//   - time: seconds since the first point (the point index when the route
+//     has no timestamps, i.e. 1 Hz)
+//   - distance: cumulative meters
+//   - altitude: elevation in meters
+//   - heartrate: the latest reading at or before the point, the first one
+//     for points before it; matched by index when either side lacks
+//     timestamps
+//   - velocity: meters per second over the step from the previous point
+//     (0 at the first point and across steps with no elapsed time)
+//
+// Only the requested keys are built. heartrate is left out when hr is
+// empty, so a chart never plots a zero line for a missing sensor.
+func ActivityStreams(route []GPSPoint, hr []HeartRateSample, keys []string) map[string][]float64 {
+	timed := len(route) > 0 && route[0].Timestamp > 0
+	elapsed := make([]float64, len(route))
+	for i, p := range route {
+		if timed {
+			elapsed[i] = float64(p.Timestamp-route[0].Timestamp) / 1000
+		} else {
+			elapsed[i] = float64(i)
+		}
+	}
+
+	streams := map[string][]float64{StreamTime: elapsed}
+	for _, key := range keys {
+		switch key {
+		case StreamDistance:
+			dist := make([]float64, len(route))
+			for i := 1; i < len(route); i++ {
+				dist[i] = dist[i-1] + HaversineDistance(route[i-1], route[i])
+			}
+			streams[key] = dist
+		case StreamAltitude:
+			alt := make([]float64, len(route))
+			for i, p := range route {
+				alt[i] = p.Elevation
+			}
+			streams[key] = alt
+		case StreamHeartRate:
+			if len(hr) > 0 {
+				streams[key] = alignHeartRate(route, hr, timed)
+			}
+		case StreamVelocity:
+			vel := make([]float64, len(route))
+			for i := 1; i < len(route); i++ {
+				if dt := elapsed[i] - elapsed[i-1]; dt > 0 {
+					vel[i] = HaversineDistance(route[i-1], route[i]) / dt
+				}
+			}
+			streams[key] = vel
+		}
+	}
+	return streams
+}
+
+// alignHeartRate returns one bpm per route point.
+func alignHeartRate(route []GPSPoint, hr []HeartRateSample, timed bool) []float64 {
+	out := make([]float64, len(route))
+	if !timed || hr[0].Timestamp == 0 {
+		for i := range route {
+			out[i] = float64(hr[min(i, len(hr)-1)].BPM)
+		}
+		return out
+	}
+
+	j := 0
+	for i, p := range route {
+		for j+1 < len(hr) && hr[j+1].Timestamp <= p.Timestamp {
+			j++
+		}
+		out[i] = float64(hr[j].BPM)
+	}
+	return out
+}
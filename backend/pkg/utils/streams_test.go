@@ -0,0 +1,79 @@
+package utils_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+func TestActivityStreams(t *testing.T) {
+	// Three points ~111 m apart northwards, 30 s per step.
+	route := []utils.GPSPoint{
+		{Lat: 51.500, Lng: -0.12, Elevation: 10, Timestamp: 1_700_000_000_000},
+		{Lat: 51.501, Lng: -0.12, Elevation: 12, Timestamp: 1_700_000_030_000},
+		{Lat: 51.502, Lng: -0.12, Elevation: 11, Timestamp: 1_700_000_060_000},
+	}
+	hr := []utils.HeartRateSample{
+		{Timestamp: 1_700_000_010_000, BPM: 120},
+		{Timestamp: 1_700_000_050_000, BPM: 150},
+	}
+
+	got := utils.ActivityStreams(route, hr, utils.StreamKeys)
+	if len(got) != len(utils.StreamKeys)+1 {
+		t.Fatalf("expected %d streams, got %v", len(utils.StreamKeys)+1, got)
+	}
+	for key, s := range got {
+		if len(s) != len(route) {
+			t.Errorf("%s: %d entries, want %d", key, len(s), len(route))
+		}
+	}
+
+	if want := []float64{0, 30, 60}; !equalFloats(got[utils.StreamTime], want, 0) {
+		t.Errorf("time = %v, want %v", got[utils.StreamTime], want)
+	}
+	if want := []float64{10, 12, 11}; !equalFloats(got[utils.StreamAltitude], want, 0) {
+		t.Errorf("altitude = %v, want %v", got[utils.StreamAltitude], want)
+	}
+	if want := []float64{0, 111.2, 222.4}; !equalFloats(got[utils.StreamDistance], want, 0.1) {
+		t.Errorf("distance = %v, want %v", got[utils.StreamDistance], want)
+	}
+	if want := []float64{0, 3.71, 3.71}; !equalFloats(got[utils.StreamVelocity], want, 0.01) {
+		t.Errorf("velocity = %v, want %v", got[utils.StreamVelocity], want)
+	}
+	// The first point predates any reading and takes the first one.
+	if want := []float64{120, 120, 150}; !equalFloats(got[utils.StreamHeartRate], want, 0) {
+		t.Errorf("heartrate = %v, want %v", got[utils.StreamHeartRate], want)
+	}
+}
+
+func TestActivityStreams_Subset(t *testing.T) {
+	route := []utils.GPSPoint{{Lat: 51.5, Lng: -0.12}, {Lat: 51.501, Lng: -0.12}}
+
+	got := utils.ActivityStreams(route, nil, []string{utils.StreamDistance, utils.StreamHeartRate})
+	if _, ok := got[utils.StreamAltitude]; ok {
+		t.Error("altitude was not requested")
+	}
+	if _, ok := got[utils.StreamHeartRate]; ok {
+		t.Error("heartrate should be omitted without samples")
+	}
+	// Untimestamped routes are treated as 1 Hz.
+	if want := []float64{0, 1}; !equalFloats(got[utils.StreamTime], want, 0) {
+		t.Errorf("time = %v, want %v", got[utils.StreamTime], want)
+	}
+	if len(got[utils.StreamDistance]) != 2 {
+		t.Errorf("distance = %v", got[utils.StreamDistance])
+	}
+}
+
+func equalFloats(got, want []float64, tol float64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if math.Abs(got[i]-want[i]) > tol {
+			return false
+		}
+	}
+	return true
+}
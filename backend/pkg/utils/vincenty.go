@@ -0,0 +1,80 @@
+package utils
+
+import "math"
+
+// WGS-84 ellipsoid.
+const (
+	wgs84A = 6378137.0         // semi-major axis, meters
+	wgs84F = 1 / 298.257223563 // flattening
+	wgs84B = wgs84A * (1 - wgs84F)
+)
+
+// Vincenty's inverse formula stops once lambda moves less than
+// vincentyTolerance radians (~0.06 mm) or after vincentyMaxIterations.
+const (
+	vincentyTolerance     = 1e-12
+	vincentyMaxIterations = 200
+)
+
+// VincentyDistance returns the distance in meters between two GPS points on
+// the WGS-84 ellipsoid using Vincenty's inverse formula, accurate to well
+// under a millimeter where HaversineDistance's sphere is off by up to ~0.5%.
+// The iteration doesn't converge for nearly antipodal points; those fall
+// back to HaversineDistance.
+func VincentyDistance(a, b GPSPoint) float64 {
+	if a.Lat == b.Lat && a.Lng == b.Lng {
+		return 0
+	}
+
+	l := degToRad(b.Lng - a.Lng)
+	u1 := math.Atan((1 - wgs84F) * math.Tan(degToRad(a.Lat)))
+	u2 := math.Atan((1 - wgs84F) * math.Tan(degToRad(b.Lat)))
+	sinU1, cosU1 := math.Sincos(u1)
+	sinU2, cosU2 := math.Sincos(u2)
+
+	lambda := l
+	var sinSigma, cosSigma, sigma, cosSqAlpha, cos2SigmaM float64
+	converged := false
+	for i := 0; i < vincentyMaxIterations; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		sinSigma = math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			return 0 // coincident points
+		}
+		cosSigma = sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma = math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha = 1 - sinAlpha*sinAlpha
+		cos2SigmaM = 0 // equatorial line
+		if cosSqAlpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		}
+		c := wgs84F / 16 * cosSqAlpha * (4 + wgs84F*(4-3*cosSqAlpha))
+		prev := lambda
+		lambda = l + (1-c)*wgs84F*sinAlpha*
+			(sigma+c*sinSigma*(cos2SigmaM+c*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-prev) < vincentyTolerance {
+			converged = true
+			break
+		}
+	}
+	if !converged || math.Abs(lambda) > math.Pi {
+		return HaversineDistance(a, b)
+	}
+
+	uSq := cosSqAlpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+	bigA := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+	bigB := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+	deltaSigma := bigB * sinSigma * (cos2SigmaM + bigB/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+		bigB/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+	return wgs84B * bigA * (sigma - deltaSigma)
+}
+
+// TotalDistanceVincenty is TotalDistance using VincentyDistance.
+func TotalDistanceVincenty(route []GPSPoint) float64 {
+	var total float64
+	for i := 1; i < len(route); i++ {
+		total += VincentyDistance(route[i-1], route[i])
+	}
+	return total
+}
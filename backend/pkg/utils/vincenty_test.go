@@ -0,0 +1,91 @@
+package utils_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/apexrun/backend/pkg/utils"
+)
+
+// dms converts degrees, minutes and seconds to decimal degrees.
+func dms(deg, min, sec float64) float64 {
+	sign := 1.0
+	if deg < 0 {
+		sign, deg = -1, -deg
+	}
+	return sign * (deg + min/60 + sec/3600)
+}
+
+func TestVincentyDistance(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b utils.GPSPoint
+		want float64 // meters
+		tol  float64
+	}{
+		{
+			// Vincenty (1975) worked example, Flinders Peak to Buninyong.
+			"flinders peak to buninyong",
+			utils.GPSPoint{Lat: dms(-37, 57, 3.72030), Lng: dms(144, 25, 29.52440)},
+			utils.GPSPoint{Lat: dms(-37, 39, 10.15610), Lng: dms(143, 55, 35.38390)},
+			54972.271, 0.001,
+		},
+		{
+			// One degree along the equator is a * pi / 180.
+			"one degree of equator",
+			utils.GPSPoint{Lat: 0, Lng: 0}, utils.GPSPoint{Lat: 0, Lng: 1},
+			111319.491, 0.001,
+		},
+		{
+			// WGS-84 meridian quadrant.
+			"equator to north pole",
+			utils.GPSPoint{Lat: 0, Lng: 0}, utils.GPSPoint{Lat: 90, Lng: 0},
+			10001965.729, 0.001,
+		},
+		{
+			"same point",
+			utils.GPSPoint{Lat: 51.5, Lng: -0.12}, utils.GPSPoint{Lat: 51.5, Lng: -0.12},
+			0, 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := utils.VincentyDistance(tt.a, tt.b)
+			if math.Abs(got-tt.want) > tt.tol {
+				t.Errorf("VincentyDistance = %.4f m, want %.3f m", got, tt.want)
+			}
+			if back := utils.VincentyDistance(tt.b, tt.a); math.Abs(back-got) > 1e-6 {
+				t.Errorf("not symmetric: %.6f vs %.6f", got, back)
+			}
+		})
+	}
+}
+
+func TestVincentyDistance_NearAntipodalFallsBack(t *testing.T) {
+	a := utils.GPSPoint{Lat: 0, Lng: 0}
+	b := utils.GPSPoint{Lat: 0.5, Lng: 179.7}
+	if got, want := utils.VincentyDistance(a, b), utils.HaversineDistance(a, b); got != want {
+		t.Errorf("VincentyDistance = %.3f, want haversine fallback %.3f", got, want)
+	}
+}
+
+func TestTotalDistanceVincenty(t *testing.T) {
+	route := []utils.GPSPoint{
+		{Lat: 0, Lng: 0},
+		{Lat: 0, Lng: 0.5},
+		{Lat: 0, Lng: 1},
+	}
+	if got := utils.TotalDistanceVincenty(route); math.Abs(got-111319.491) > 0.001 {
+		t.Errorf("TotalDistanceVincenty = %.4f, want 111319.491", got)
+	}
+	if got := utils.TotalDistanceVincenty(route[:1]); got != 0 {
+		t.Errorf("single point = %v, want 0", got)
+	}
+
+	// Haversine's mean-radius sphere overestimates a meridian by ~0.06%.
+	meridian := []utils.GPSPoint{{Lat: 0, Lng: 0}, {Lat: 45, Lng: 0}, {Lat: 90, Lng: 0}}
+	v, h := utils.TotalDistanceVincenty(meridian), utils.TotalDistance(meridian)
+	if diff := math.Abs(v-h) / v; diff < 0.0005 || diff > 0.006 {
+		t.Errorf("vincenty %.0f vs haversine %.0f differ by %.4f%%", v, h, diff*100)
+	}
+}